@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// runCall will invoke a gRPC method with requests written as JSON, and write each response as JSON. Message types are found with the server reflection service (see Hoster.EnableReflection) or in a descriptor set file.
+func runCall(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var dial dialFlags
+	dial.bind(fs)
+	descriptorSetFile := fs.String("descriptor-set", "", "compiled FileDescriptorSet to find message types in instead of using server reflection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		fs.Usage()
+		return errUsage
+	}
+
+	// requests are the argument, standard input for -, or an empty message
+	input := []byte("{}")
+	if fs.NArg() == 3 {
+		input = []byte(fs.Arg(2))
+		if fs.Arg(2) == "-" {
+			b, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read requests: %v", err)
+			}
+			input = b
+		}
+	}
+
+	conn, err := dial.dial(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel, err := dial.context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	var set *dynamic.Set
+	if *descriptorSetFile != "" {
+		set, err = dynamic.LoadSetFile(*descriptorSetFile)
+	} else {
+		var serviceName string
+		if serviceName, _, err = dynamic.SplitMethodName(fs.Arg(1)); err != nil {
+			return err
+		}
+		set, err = reflectDescriptors(ctx, conn, serviceName)
+	}
+	if err != nil {
+		return err
+	}
+
+	return call(ctx, conn, set, fs.Arg(1), input, out)
+}
+
+// call will invoke a method with a sequence of JSON requests, writing each response as indented JSON. Unary and server streaming methods take exactly one request.
+func call(ctx context.Context, conn *grpc.ClientConn, set *dynamic.Set, method string, input []byte, out io.Writer) error {
+	md, fullMethod, err := set.FindMethod(method)
+	if err != nil {
+		return err
+	}
+	codec := dynamic.NewCodec(set)
+
+	// encode every request before calling, so invalid input fails without side effects
+	var requests []*dynamic.Message
+	dec := json.NewDecoder(bytes.NewReader(input))
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid request JSON: %v", err)
+		}
+
+		req := dynamic.NewMessage(codec, md.GetInputType())
+		if err := jsonpb.Unmarshal(bytes.NewReader(value), req); err != nil {
+			return fmt.Errorf("invalid request: %v", err)
+		}
+		requests = append(requests, req)
+	}
+	if !md.GetClientStreaming() && len(requests) != 1 {
+		return fmt.Errorf("%v takes one request, got %v", fullMethod, len(requests))
+	}
+
+	// write each response as it is received
+	marshaler := jsonpb.Marshaler{Indent: "  "}
+	write := func(resp *dynamic.Message) error {
+		s, err := marshaler.MarshalToString(resp)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, s)
+		return err
+	}
+
+	if !md.GetClientStreaming() && !md.GetServerStreaming() {
+		resp := dynamic.NewMessage(codec, md.GetOutputType())
+		if err := conn.Invoke(ctx, fullMethod, requests[0], resp); err != nil {
+			return callError(err)
+		}
+		return write(resp)
+	}
+
+	desc := &grpc.StreamDesc{
+		ClientStreams: md.GetClientStreaming(),
+		ServerStreams: md.GetServerStreaming(),
+	}
+	stream, err := conn.NewStream(ctx, desc, fullMethod)
+	if err != nil {
+		return callError(err)
+	}
+	for _, req := range requests {
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return callError(err)
+	}
+	for {
+		resp := dynamic.NewMessage(codec, md.GetOutputType())
+		err := stream.RecvMsg(resp)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return callError(err)
+		}
+		if err := write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// callError returns the status of a failed call as an error.
+func callError(err error) error {
+	st := status.Convert(err)
+
+	return fmt.Errorf("call failed with %v: %v", st.Code(), st.Message())
+}
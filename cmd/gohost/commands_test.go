@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Call_Reflection(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	server := startTestHoster(t, nil)
+	defer server.Stop()
+	set, err := reflectDescriptors(context.Background(), server.Conn, "test.TestService")
+	assert.NoError(t, err)
+
+	// act
+	var unary, serverStream, clientStream bytes.Buffer
+	unaryErr := call(context.Background(), server.Conn, set, "/test.TestService/Echo", []byte(`{"value":"test"}`), &unary)
+	serverStreamErr := call(context.Background(), server.Conn, set, "test.TestService.Repeat", []byte(`{"value":"test","count":"2"}`), &serverStream)
+	clientStreamErr := call(context.Background(), server.Conn, set, "test.TestService/Stream", []byte(`{"value":"a"} {"value":"b"}`), &clientStream)
+
+	// assert
+	assert.NoError(t, unaryErr)
+	assert.Equal(t, "{\n  \"echo\": \"test\"\n}\n", unary.String())
+	assert.NoError(t, serverStreamErr)
+	assert.Equal(t, "{\n  \"echo\": \"test\"\n}\n{\n  \"echo\": \"test\"\n}\n", serverStream.String())
+	assert.NoError(t, clientStreamErr)
+	assert.JSONEq(t, `{"success":true}`, clientStream.String())
+}
+
+func Test_Call_Errors(t *testing.T) {
+	t.Parallel()
+
+	// arrange - every unary call fails, while reflection still works since it is a stream
+	server := startTestHoster(t, func(h *gohost.Hoster) {
+		h.UnaryInterceptors = append(h.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "value not found")
+		})
+	})
+	set, err := reflectDescriptors(context.Background(), server.Conn, "test.TestService")
+	assert.NoError(t, err)
+	_, missingErr := reflectDescriptors(context.Background(), server.Conn, "test.MissingService")
+
+	// act
+	var out bytes.Buffer
+	failedErr := call(context.Background(), server.Conn, set, "test.TestService/Send", []byte(`{"value":"test"}`), &out)
+	invalidErr := call(context.Background(), server.Conn, set, "test.TestService/Send", []byte(`{"missing":"test"}`), &out)
+	countErr := call(context.Background(), server.Conn, set, "test.TestService/Send", []byte(`{} {}`), &out)
+	methodErr := call(context.Background(), server.Conn, set, "test.TestService/Missing", []byte(`{}`), &out)
+
+	// assert
+	assert.EqualError(t, failedErr, "call failed with NotFound: value not found")
+	assert.EqualError(t, invalidErr, `invalid request: unknown field "missing" in SendRequest`)
+	assert.EqualError(t, countErr, "/test.TestService/Send takes one request, got 2")
+	assert.EqualError(t, methodErr, "method Missing not found in service test.TestService")
+	assert.Error(t, missingErr)
+	assert.Empty(t, out.String())
+}
+
+func Test_Health(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	server := startTestHoster(t, nil)
+	defer server.Stop()
+
+	// act
+	var serverOut, serviceOut bytes.Buffer
+	serverErr := checkHealth(context.Background(), server.Conn, "", &serverOut)
+	serviceErr := checkHealth(context.Background(), server.Conn, "test.TestService", &serviceOut)
+	missingErr := checkHealth(context.Background(), server.Conn, "test.MissingService", &bytes.Buffer{})
+
+	// assert
+	assert.NoError(t, serverErr)
+	assert.Equal(t, "SERVING\n", serverOut.String())
+	assert.NoError(t, serviceErr)
+	assert.Equal(t, "SERVING\n", serviceOut.String())
+	assert.EqualError(t, missingErr, "call failed with NotFound: unknown service")
+}
+
+func Test_Routes(t *testing.T) {
+	// arrange
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	debugAddr := lis.Addr().String()
+	lis.Close()
+
+	server := startTestHoster(t, func(h *gohost.Hoster) {
+		h.EnableDebug = true
+		h.DebugAddr = debugAddr
+	})
+	defer server.Stop()
+
+	// make sure the debug endpoint has time to start
+	time.Sleep(time.Millisecond * 100)
+
+	// act
+	var out bytes.Buffer
+	err = runRoutes(newFlagSet("routes", "debug-addr"), []string{debugAddr}, &out)
+
+	// assert
+	assert.NoError(t, err)
+	lines := normalizeLines(out.String())
+	assert.Contains(t, lines, "GRPC METHOD STREAMING")
+	assert.Contains(t, lines, "/test.TestService/Repeat server")
+	assert.Contains(t, lines, "/test.TestService/Stream client")
+	assert.Contains(t, lines, "POST /v1/send - /test.TestService/Send")
+}
+
+func Test_Replay(t *testing.T) {
+	t.Parallel()
+
+	// arrange - a call that matches, a call whose recorded response differs and an HTTP request without an HTTP endpoint to send it to
+	server := startTestHoster(t, nil)
+	defer server.Stop()
+	recordings := []*gohost.Recording{
+		{
+			Method:       "/test.TestService/Echo",
+			RequestType:  "test.SendRequest",
+			ResponseType: "test.EchoResponse",
+			Requests:     []json.RawMessage{json.RawMessage(`{"value":"test"}`)},
+			Responses:    []json.RawMessage{json.RawMessage(`{"echo":"test"}`)},
+			Code:         "OK",
+		},
+		{
+			Method:       "/test.TestService/Echo",
+			RequestType:  "test.SendRequest",
+			ResponseType: "test.EchoResponse",
+			Requests:     []json.RawMessage{json.RawMessage(`{"value":"test"}`)},
+			Responses:    []json.RawMessage{json.RawMessage(`{"echo":"other"}`)},
+			Code:         "OK",
+		},
+		{
+			HTTPMethod: "GET",
+			Path:       "/v1/echo?value=test",
+			Status:     http.StatusOK,
+		},
+	}
+
+	// act
+	set, setErr := replayDescriptors(context.Background(), server.Conn, "", recordings)
+	var out bytes.Buffer
+	err := replay(context.Background(), &gohost.Replayer{Conn: server.Conn}, recordings, &out)
+
+	// assert
+	assert.NoError(t, setErr)
+	assert.True(t, set.HasMessage("test.SendRequest"))
+	assert.Equal(t, &exitError{code: 1}, err)
+	assert.Contains(t, out.String(), "Mismatch for /test.TestService/Echo")
+	assert.Contains(t, out.String(), `responses[0].echo: "other" != "test"`)
+	assert.Contains(t, out.String(), "Replayed 2 calls: 1 matched, 1 mismatched, 1 skipped\n")
+}
+
+func Test_Serve_Mock(t *testing.T) {
+	// arrange - a descriptor set of the test service with messages that are not linked into the program
+	fd := loadTestDescriptor(t)
+	for _, md := range fd.MessageType {
+		md.Name = proto.String("Unlinked" + md.GetName())
+	}
+	for _, method := range fd.Service[0].Method {
+		method.InputType = proto.String(strings.Replace(method.GetInputType(), ".test.", ".test.Unlinked", 1))
+		method.OutputType = proto.String(strings.Replace(method.GetOutputType(), ".test.", ".test.Unlinked", 1))
+	}
+	b, err := proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{fd}})
+	assert.NoError(t, err)
+	file, err := ioutil.TempFile("", "gohost-descriptor-set")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(b)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	grpcAddr, httpAddr := getTestAddr(t), getTestAddr(t)
+	args := []string{"-enable-mock", "-descriptor-set-file", file.Name(), "-grpc-addr", grpcAddr, "-http-addr", httpAddr}
+	go runServe(newFlagSet("serve", ""), args, ioutil.Discard)
+
+	// make sure the mock server has time to start
+	time.Sleep(time.Millisecond * 200)
+
+	// act
+	set, err := dynamic.LoadSetFile(file.Name())
+	assert.NoError(t, err)
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	var out bytes.Buffer
+	callErr := call(context.Background(), conn, set, "test.TestService/Echo", []byte(`{"value":"test"}`), &out)
+
+	httpResp, httpErr := http.Get("http://" + httpAddr + "/v1/echo?value=test")
+
+	// assert
+	assert.NoError(t, callErr)
+	assert.Equal(t, "{}\n", out.String())
+	assert.NoError(t, httpErr)
+	defer httpResp.Body.Close()
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+}
+
+func Test_Run_Usage(t *testing.T) {
+	// arrange
+	var out, errOut bytes.Buffer
+
+	// act
+	noCommand := run(nil, &out, &errOut)
+	unknownCommand := run([]string{"missing"}, &out, &errOut)
+	missingArgs := run([]string{"call", "127.0.0.1:50051"}, &out, &errOut)
+
+	// assert
+	assert.Equal(t, 2, noCommand)
+	assert.Equal(t, 2, unknownCommand)
+	assert.Equal(t, 2, missingArgs)
+	assert.Contains(t, errOut.String(), `gohost: unknown command "missing"`)
+	assert.Contains(t, errOut.String(), "Usage: gohost call [flags] addr method [json | -]")
+	assert.Empty(t, out.String())
+}
+
+// startTestHoster is a helper function that serves the test service with health and reflection enabled until the returned server is stopped.
+func startTestHoster(t *testing.T, configure func(h *gohost.Hoster)) *gohosttest.Server {
+	hoster := gohost.NewHoster()
+	hoster.EnableHealth = true
+	hoster.EnableReflection = true
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, test.NewService())
+	})
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	if configure != nil {
+		configure(hoster)
+	}
+
+	return gohosttest.Start(t, hoster)
+}
+
+// normalizeLines is a helper function that splits output into lines with single spaces between columns.
+func normalizeLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.Join(strings.Fields(lines[i]), " ")
+	}
+
+	return lines
+}
+
+// loadTestDescriptor is a helper function that returns the descriptor registered by the generated code of the test service.
+func loadTestDescriptor(t *testing.T) *descriptor.FileDescriptorProto {
+	r, err := gzip.NewReader(bytes.NewReader(proto.FileDescriptor("proto/test.proto")))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	fd := &descriptor.FileDescriptorProto{}
+	assert.NoError(t, proto.Unmarshal(b, fd))
+
+	return fd
+}
+
+// getTestAddr is a helper function that returns a free local address.
+func getTestAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	return lis.Addr().String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// reflectDescriptors returns the descriptors of the file that defines a symbol, and of every file it imports, from the server reflection service.
+func reflectDescriptors(ctx context.Context, conn *grpc.ClientConn, symbol string) (*dynamic.Set, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call server reflection: %v", err)
+	}
+	defer stream.CloseSend()
+
+	set := dynamic.NewSet()
+	pending := []*rpb.ServerReflectionRequest{{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}}
+	for len(pending) > 0 {
+		req := pending[0]
+		pending = pending[1:]
+
+		if err := stream.Send(req); err != nil {
+			return nil, fmt.Errorf("failed to call server reflection: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to call server reflection: %v", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection failed for %v: %v", requestSubject(req), e.ErrorMessage)
+		}
+
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptor.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return nil, fmt.Errorf("failed to parse descriptor of %v: %v", requestSubject(req), err)
+			}
+			if set.HasFile(fd.GetName()) {
+				continue
+			}
+			set.Add(fd)
+
+			// fetch imports that have not been fetched or requested yet
+			for _, dep := range fd.Dependency {
+				if set.HasFile(dep) || isPending(pending, dep) {
+					continue
+				}
+				pending = append(pending, &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				})
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// requestSubject returns the symbol or file name of a reflection request, for error messages.
+func requestSubject(req *rpb.ServerReflectionRequest) string {
+	if symbol := req.GetFileContainingSymbol(); symbol != "" {
+		return symbol
+	}
+
+	return req.GetFileByFilename()
+}
+
+// isPending returns true if a file has already been requested.
+func isPending(pending []*rpb.ServerReflectionRequest, file string) bool {
+	for _, req := range pending {
+		if req.GetFileByFilename() == file {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// runHealth will check the health of a service with the gRPC health service (see Hoster.EnableHealth), and exit with code 1 unless it is serving. The server as a whole is checked if no service is named.
+func runHealth(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var dial dialFlags
+	dial.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	conn, err := dial.dial(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel, err := dial.context()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return checkHealth(ctx, conn, fs.Arg(1), out)
+}
+
+// checkHealth will write the status of a service, returning an exit error unless it is serving.
+func checkHealth(ctx context.Context, conn *grpc.ClientConn, service string, out io.Writer) error {
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return callError(err)
+	}
+
+	fmt.Fprintln(out, resp.Status)
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return &exitError{code: 1}
+	}
+
+	return nil
+}
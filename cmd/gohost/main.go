@@ -0,0 +1,193 @@
+// Command gohost runs and probes gRPC services hosted with gohost.
+//
+// Usage:
+//
+//	gohost serve [flags]                     run a hoster from a config file
+//	gohost call [flags] addr method [json]   invoke a gRPC method with JSON input using server reflection
+//	gohost health [flags] addr [service]     query the gRPC health service
+//	gohost routes [flags] debug-addr         list the gRPC methods and HTTP gateway routes of a running server
+//	gohost replay [flags] recording-file...  replay recorded calls against a running server and report responses that differ
+//	gohost new [flags] name rpc...           create a new service from a template
+//
+// Run gohost <command> -h for the flags of each command.
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// command is a subcommand of the tool. Run defines its flags in fs, parses the arguments after the command name and writes results to out.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string, out io.Writer) error
+}
+
+// commands are the subcommands of the tool, in the order they are listed in the usage.
+var commands = []command{
+	{"serve", "", "run a hoster from a config file", runServe},
+	{"call", "addr method [json | -]", "invoke a gRPC method with JSON input using server reflection", runCall},
+	{"health", "addr [service]", "query the gRPC health service", runHealth},
+	{"routes", "debug-addr", "list the gRPC methods and HTTP gateway routes of a running server", runRoutes},
+	{"replay", "recording-file...", "replay recorded calls against a running server and report responses that differ", runReplay},
+	{"new", "name rpc...", "create a new service from a template", runNew},
+}
+
+// errUsage is returned by commands when the arguments are invalid, after the usage has been printed.
+var errUsage = errors.New("invalid arguments")
+
+// exitError is returned by commands that completed but should exit with a non-zero code, such as a health check that is not serving.
+type exitError struct {
+	code int
+}
+
+// Error returns a description of the exit code.
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %v", e.code)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run will run the command named by the first argument and return the exit code.
+func run(args []string, out io.Writer, errOut io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(errOut)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		fs := newFlagSet(cmd.name, cmd.args)
+		fs.SetOutput(errOut)
+		err := cmd.run(fs, args[1:], out)
+		switch e := err.(type) {
+		case nil:
+			return 0
+		case *exitError:
+			return e.code
+		default:
+			if err == errUsage || err == flag.ErrHelp {
+				return 2
+			}
+			fmt.Fprintf(errOut, "gohost %v: %v\n", cmd.name, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(errOut, "gohost: unknown command %q\n", args[0])
+	usage(errOut)
+	return 2
+}
+
+// usage will print the commands of the tool.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gohost <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8v %v\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run gohost <command> -h for the flags of each command.")
+}
+
+// newFlagSet creates a flag set for a command that prints its usage line and flags on error.
+func newFlagSet(name string, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("gohost "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace("Usage: gohost "+name+" [flags] "+args))
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// dialFlags are the flags of commands that connect to a gRPC endpoint.
+type dialFlags struct {
+	insecure           bool
+	insecureSkipVerify bool
+	metadata           string
+	timeout            time.Duration
+}
+
+// bind will define the flags in fs.
+func (f *dialFlags) bind(fs *flag.FlagSet) {
+	fs.BoolVar(&f.insecure, "insecure", false, "true to use insecure connection and disable TLS")
+	fs.BoolVar(&f.insecureSkipVerify, "insecure-skip-verify", false, "true to skip verifying the certificate chain and host name")
+	fs.StringVar(&f.metadata, "metadata", "", "comma separated list of key=value metadata to send with the call")
+	fs.DurationVar(&f.timeout, "timeout", time.Second*10, "deadline of the call, including connecting")
+}
+
+// dial will connect to a gRPC endpoint, waiting until the connection is ready or the timeout expires.
+func (f *dialFlags) dial(addr string) (*grpc.ClientConn, error) {
+	var creds grpc.DialOption
+	if f.insecure {
+		creds = grpc.WithInsecure()
+	} else {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: f.insecureSkipVerify,
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, creds, grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %v", addr, err)
+	}
+
+	return conn, nil
+}
+
+// context returns a context with the timeout and metadata of the flags.
+func (f *dialFlags) context() (context.Context, context.CancelFunc, error) {
+	pairs, err := f.metadataPairs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	if len(pairs) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+
+	return ctx, cancel, nil
+}
+
+// metadataPairs returns the keys and values of the metadata flag, in the order they were written.
+func (f *dialFlags) metadataPairs() ([]string, error) {
+	pairs := []string{}
+	if f.metadata == "" {
+		return pairs, nil
+	}
+
+	for _, pair := range strings.Split(f.metadata, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid metadata %q, expected key=value", pair)
+		}
+		pairs = append(pairs, strings.TrimSpace(kv[0]), kv[1])
+	}
+
+	return pairs, nil
+}
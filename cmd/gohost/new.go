@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var (
+	// serviceNamePattern matches valid service names, such as greeter or order-service.
+	serviceNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+	// rpcNamePattern matches valid RPC names, such as SayHello.
+	rpcNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+)
+
+// scaffold contains the names used by the templates of a new service.
+type scaffold struct {
+	// Name is the name of the service as given (e.g. order-service).
+	Name string
+
+	// Package is the Go and proto package of the service (e.g. orderservice).
+	Package string
+
+	// Service is the name of the gRPC service (e.g. OrderService).
+	Service string
+
+	// ImportPath is the Go import path of the service directory.
+	ImportPath string
+
+	// EnvPrefix is the prefix of environment variables read by the server (e.g. ORDER_SERVICE_).
+	EnvPrefix string
+
+	// RPCs are the methods of the service, in the order given.
+	RPCs []scaffoldRPC
+}
+
+// scaffoldRPC contains the names used by the templates for a method of a new service.
+type scaffoldRPC struct {
+	// Name is the name of the method (e.g. SayHello).
+	Name string
+
+	// Path is the path of the HTTP route of the method (e.g. /v1/say-hello).
+	Path string
+
+	// Var is the name of the variable holding the response in the client (e.g. sayHelloResp).
+	Var string
+}
+
+// runNew will create a service with the layout of examples/hello: a proto with http annotations, the service with go:generate lines and a unit test, server and client commands, and a script to generate the code from the proto.
+func runNew(fs *flag.FlagSet, args []string, out io.Writer) error {
+	dir := fs.String("dir", "", "directory to create the service in (default is the service name)")
+	importPath := fs.String("import-path", "", "Go import path of the directory (default is found from GOPATH)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errUsage
+	}
+
+	if *dir == "" {
+		*dir = fs.Arg(0)
+	}
+	if *importPath == "" {
+		path, err := gopathImportPath(*dir)
+		if err != nil {
+			return err
+		}
+		*importPath = path
+	}
+
+	s, err := newScaffold(fs.Arg(0), fs.Args()[1:], *importPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.render()
+	if err != nil {
+		return err
+	}
+
+	return writeScaffold(*dir, files, out)
+}
+
+// newScaffold returns the names for a new service, after checking that the service and RPC names are valid.
+func newScaffold(name string, rpcs []string, importPath string) (*scaffold, error) {
+	if !serviceNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid service name %q, expected letters, digits, hyphens and underscores", name)
+	}
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	s := &scaffold{
+		Name:       name,
+		Package:    strings.ToLower(strings.Join(words, "")),
+		ImportPath: strings.TrimSuffix(importPath, "/"),
+		EnvPrefix:  strings.ToUpper(strings.Join(words, "_")) + "_",
+	}
+	for _, word := range words {
+		s.Service += upperFirst(word)
+	}
+	if !strings.HasSuffix(s.Service, "Service") {
+		s.Service += "Service"
+	}
+
+	seen := map[string]bool{}
+	for _, rpc := range rpcs {
+		if !rpcNamePattern.MatchString(rpc) {
+			return nil, fmt.Errorf("invalid RPC name %q, expected letters and digits", rpc)
+		}
+		rpc = upperFirst(rpc)
+		if seen[rpc] {
+			return nil, fmt.Errorf("duplicate RPC name %q", rpc)
+		}
+		seen[rpc] = true
+
+		s.RPCs = append(s.RPCs, scaffoldRPC{
+			Name: rpc,
+			Path: "/v1/" + kebabCase(rpc),
+			Var:  lowerFirst(rpc) + "Resp",
+		})
+	}
+
+	return s, nil
+}
+
+// render returns the contents of the files of the service, keyed by path relative to the service directory. Go files are formatted, so a template that renders invalid Go is an error.
+func (s *scaffold) render() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for pathTemplate, tmpl := range scaffoldTemplates {
+		path, err := execute(template.Must(template.New("path").Parse(pathTemplate)), s)
+		if err != nil {
+			return nil, err
+		}
+		b, err := execute(tmpl, s)
+		if err != nil {
+			return nil, err
+		}
+
+		content := []byte(b)
+		if strings.HasSuffix(path, ".go") {
+			if content, err = format.Source(content); err != nil {
+				return nil, fmt.Errorf("failed to format %v: %v", path, err)
+			}
+		}
+		files[filepath.FromSlash(path)] = content
+	}
+
+	return files, nil
+}
+
+// execute returns the output of a template.
+func execute(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %v: %v", tmpl.Name(), err)
+	}
+
+	return buf.String(), nil
+}
+
+// writeScaffold will write the files of a service to a directory, listing each file created. No files are written if any of them already exist.
+func writeScaffold(dir string, files map[string][]byte, out io.Writer) error {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			return fmt.Errorf("%v already exists", filepath.Join(dir, path))
+		}
+	}
+
+	for _, path := range paths {
+		file := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		// scripts are executable
+		perm := os.FileMode(0644)
+		if strings.HasSuffix(path, ".sh") {
+			perm = 0755
+		}
+		if err := ioutil.WriteFile(file, files[path], perm); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created %v\n", file)
+	}
+
+	fmt.Fprintf(out, "\nGenerate the gRPC server and HTTP gateway with %v, then run the server with go run %v\n", filepath.Join(dir, "scripts", "generate.sh"), filepath.Join(dir, "cmd", "server", "main.go"))
+
+	return nil
+}
+
+// gopathImportPath returns the import path of a directory inside GOPATH.
+func gopathImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		rel, err := filepath.Rel(filepath.Join(gopath, "src"), abs)
+		if err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+
+	return "", errors.New("unable to find the import path of the directory in GOPATH, set it with -import-path")
+}
+
+// upperFirst returns a word with the first letter in upper case.
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// lowerFirst returns a word with the first letter in lower case.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// kebabCase returns a camel case name in lower case with words separated by hyphens (e.g. say-hello for SayHello).
+func kebabCase(s string) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				buf.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
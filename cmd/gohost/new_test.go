@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_New(t *testing.T) {
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "orders")
+
+	// act
+	var out bytes.Buffer
+	err = runNew(newFlagSet("new", "name rpc..."), []string{"-dir", dir, "-import-path", "github.com/me/orders", "order-service", "CreateOrder", "getOrder"}, &out)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Created "+filepath.Join(dir, "cmd", "server", "main.go"))
+
+	proto, err := ioutil.ReadFile(filepath.Join(dir, "proto", "orderservice.proto"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(proto), "service OrderService {")
+	assert.Contains(t, string(proto), "rpc CreateOrder(CreateOrderRequest) returns (CreateOrderResponse) {")
+	assert.Contains(t, string(proto), `post: "/v1/get-order"`)
+
+	service, err := ioutil.ReadFile(filepath.Join(dir, "orderservice_service.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(service), "--gohost_out=. proto/orderservice.proto")
+	assert.Contains(t, string(service), "func (s *Service) GetOrder(ctx context.Context, in *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {")
+
+	server, err := ioutil.ReadFile(filepath.Join(dir, "cmd", "server", "main.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(server), `hoster.LoadConfig(*configFile, "ORDER_SERVICE_", flag.CommandLine)`)
+	assert.Contains(t, string(server), "pb.RegisterOrderService(hoster, orderservice.NewService())")
+
+	client, err := ioutil.ReadFile(filepath.Join(dir, "cmd", "client", "main.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(client), "createOrderResp, err := client.CreateOrder(")
+
+	_, err = ioutil.ReadFile(filepath.Join(dir, "orderservice_service_unit_test.go"))
+	assert.NoError(t, err)
+
+	script, err := os.Stat(filepath.Join(dir, "scripts", "generate.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), script.Mode().Perm())
+}
+
+func Test_New_Errors(t *testing.T) {
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	readme := filepath.Join(dir, "README.md")
+	err = ioutil.WriteFile(readme, []byte("existing"), 0644)
+	assert.NoError(t, err)
+
+	// act
+	existingErr := runNew(newFlagSet("new", "name rpc..."), []string{"-dir", dir, "-import-path", "github.com/me/orders", "orders", "Get"}, &bytes.Buffer{})
+	_, nameErr := newScaffold("1orders", []string{"Get"}, "github.com/me/orders")
+	_, rpcErr := newScaffold("orders", []string{"Get-Order"}, "github.com/me/orders")
+	_, duplicateErr := newScaffold("orders", []string{"Get", "get"}, "github.com/me/orders")
+
+	// assert
+	assert.EqualError(t, existingErr, readme+" already exists")
+	assert.EqualError(t, nameErr, `invalid service name "1orders", expected letters, digits, hyphens and underscores`)
+	assert.EqualError(t, rpcErr, `invalid RPC name "Get-Order", expected letters and digits`)
+	assert.EqualError(t, duplicateErr, `duplicate RPC name "Get"`)
+
+	b, err := ioutil.ReadFile(readme)
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", string(b))
+	_, err = os.Stat(filepath.Join(dir, "proto"))
+	assert.True(t, os.IsNotExist(err))
+}
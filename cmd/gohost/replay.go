@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// runReplay will send the calls in recording files (see Hoster.RecordingFile) to a running server, and report the responses that differ from the recorded ones. Message types are found with the server reflection service (see Hoster.EnableReflection) or in a descriptor set file, so calls to any service can be replayed.
+func runReplay(fs *flag.FlagSet, args []string, out io.Writer) error {
+	var dial dialFlags
+	dial.bind(fs)
+	grpcAddr := fs.String("grpc-addr", "", "host and port of the gRPC endpoint to replay gRPC calls against (blank to skip them)")
+	httpURL := fs.String("http-url", "", "base URL of the HTTP endpoint to replay HTTP requests against (blank to skip them)")
+	descriptorSetFile := fs.String("descriptor-set", "", "compiled FileDescriptorSet to find message types in instead of using server reflection")
+	ignore := fs.String("ignore", "", "comma separated list of response fields to leave out of the comparison (a trailing * matches a prefix)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if *grpcAddr == "" && *httpURL == "" {
+		return errors.New("nothing to replay against, set -grpc-addr or -http-url")
+	}
+
+	recordings, err := readRecordingFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// the metadata replaces recorded values, such as credentials that were redacted
+	pairs, err := dial.metadataPairs()
+	if err != nil {
+		return err
+	}
+	replayer := &gohost.Replayer{
+		URL: *httpURL,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: dial.insecureSkipVerify,
+				},
+			},
+		},
+		Metadata: map[string]string{},
+		Timeout:  dial.timeout,
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		replayer.Metadata[pairs[i]] = pairs[i+1]
+	}
+	if *ignore != "" {
+		replayer.IgnoreFields = strings.Split(*ignore, ",")
+	}
+
+	if *grpcAddr != "" {
+		conn, err := dial.dial(*grpcAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ctx, cancel, err := dial.context()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		set, err := replayDescriptors(ctx, conn, *descriptorSetFile, recordings)
+		if err != nil {
+			return err
+		}
+		replayer.Conn = conn
+		replayer.DescriptorSet = &descriptor.FileDescriptorSet{File: set.Files()}
+	}
+
+	return replay(context.Background(), replayer, recordings, out)
+}
+
+// readRecordingFiles returns the recordings of each file, in order.
+func readRecordingFiles(files []string) ([]*gohost.Recording, error) {
+	recordings := []*gohost.Recording{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open recording file: %v", err)
+		}
+		read, err := gohost.ReadRecordings(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %v: %v", file, err)
+		}
+		recordings = append(recordings, read...)
+	}
+
+	return recordings, nil
+}
+
+// replayDescriptors returns the descriptors of the message types of recorded gRPC calls, from a descriptor set file or from the server reflection service for each recorded service.
+func replayDescriptors(ctx context.Context, conn *grpc.ClientConn, descriptorSetFile string, recordings []*gohost.Recording) (*dynamic.Set, error) {
+	if descriptorSetFile != "" {
+		return dynamic.LoadSetFile(descriptorSetFile)
+	}
+
+	set := dynamic.NewSet()
+	services := map[string]bool{}
+	for _, rec := range recordings {
+		if rec.Method == "" {
+			continue
+		}
+		serviceName, _, err := dynamic.SplitMethodName(rec.Method)
+		if err != nil {
+			return nil, err
+		}
+		if services[serviceName] {
+			continue
+		}
+		services[serviceName] = true
+
+		reflected, err := reflectDescriptors(ctx, conn, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		for _, fd := range reflected.Files() {
+			if !set.HasFile(fd.GetName()) {
+				set.Add(fd)
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// replay will replay the recordings in order, writing the calls that failed or did not match followed by a summary. It returns an exit error if any call did not match.
+func replay(ctx context.Context, replayer *gohost.Replayer, recordings []*gohost.Recording, out io.Writer) error {
+	var matched, mismatched, skipped int
+	for _, rec := range recordings {
+		result := replayer.Replay(ctx, rec)
+		name := rec.Method
+		if rec.HTTPMethod != "" {
+			name = rec.HTTPMethod + " " + rec.Path
+		}
+
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Err != nil:
+			mismatched++
+			fmt.Fprintf(out, "Failed to replay %v: %v\n", name, result.Err)
+		case !result.Matched():
+			mismatched++
+			fmt.Fprintf(out, "Mismatch for %v (%v recorded, %v replayed):\n  %v\n", name, rec.Duration, result.Duration, strings.Join(result.Diffs, "\n  "))
+		default:
+			matched++
+		}
+	}
+
+	fmt.Fprintf(out, "Replayed %v calls: %v matched, %v mismatched, %v skipped\n", matched+mismatched, matched, mismatched, skipped)
+	if mismatched > 0 {
+		return &exitError{code: 1}
+	}
+
+	return nil
+}
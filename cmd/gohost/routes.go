@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eleniums/gohost"
+)
+
+// runRoutes will list the gRPC methods and HTTP gateway routes of a running server, from the debug endpoint at /debug/routes (see Hoster.EnableDebug).
+func runRoutes(fs *flag.FlagSet, args []string, out io.Writer) error {
+	asJSON := fs.Bool("json", false, "true to write the routes as JSON")
+	timeout := fs.Duration("timeout", time.Second*10, "deadline of the request to the debug endpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	// the debug endpoint is plain HTTP, so a host and port is enough
+	url := fs.Arg(0)
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	url = strings.TrimSuffix(url, "/") + "/debug/routes"
+
+	client := &http.Client{
+		Timeout: *timeout,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to get routes: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get routes from %v: %v", url, resp.Status)
+	}
+
+	var routes gohost.Routes
+	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
+		return fmt.Errorf("failed to parse routes: %v", err)
+	}
+
+	if *asJSON {
+		b, err := json.MarshalIndent(routes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(b))
+		return err
+	}
+
+	return writeRoutes(routes, out)
+}
+
+// writeRoutes will write the gRPC methods and HTTP routes as aligned tables.
+func writeRoutes(routes gohost.Routes, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "GRPC METHOD\tSTREAMING")
+	for _, method := range routes.Methods {
+		fmt.Fprintf(w, "%v\t%v\n", method.Name, streaming(method))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "HTTP METHOD\tPATH\tBODY\tGRPC METHOD")
+	for _, route := range routes.HTTPRoutes {
+		body := route.Body
+		if body == "" {
+			body = "-"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", route.HTTPMethod, route.Path, body, route.GRPCMethod)
+	}
+
+	return w.Flush()
+}
+
+// streaming returns which side of a method streams messages.
+func streaming(method gohost.MethodRoute) string {
+	switch {
+	case method.ClientStreams && method.ServerStreams:
+		return "bidi"
+	case method.ClientStreams:
+		return "client"
+	case method.ServerStreams:
+		return "server"
+	default:
+		return "-"
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/eleniums/gohost"
+)
+
+// runServe will run a hoster configured from a config file, the environment and flags. Without compiled services, the hoster serves the services of a descriptor set with the mock server and dynamic gateway, along with the health, reflection and debug endpoints. The descriptor set alone is enough, since messages are read and written with its descriptors.
+func runServe(fs *flag.FlagSet, args []string, out io.Writer) error {
+	hoster := gohost.NewHoster()
+	hoster.Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	configFile := fs.String("config-file", "", "YAML, JSON or TOML file with hoster settings")
+	hoster.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	// load configuration with precedence: flags, then GOHOST_ environment variables, then the config file
+	if err := hoster.LoadConfig(*configFile, "GOHOST_", fs); err != nil {
+		return fmt.Errorf("unable to load configuration: %v", err)
+	}
+	if !hoster.EnableMock && !hoster.EnableDebug {
+		return errors.New("nothing to serve, set enable_mock with a descriptor_set_file or enable_debug")
+	}
+
+	if hoster.EnableMock {
+		fmt.Fprintf(out, "Serving gRPC endpoint at: %v\n", hoster.GRPCAddr)
+		fmt.Fprintf(out, "Serving HTTP endpoint at: %v\n", hoster.HTTPAddr)
+	}
+	if hoster.EnableDebug {
+		fmt.Fprintf(out, "Serving debug endpoint at: %v\n", hoster.DebugAddr)
+	}
+
+	return hoster.ListenAndServe()
+}
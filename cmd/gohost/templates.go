@@ -0,0 +1,254 @@
+package main
+
+import "text/template"
+
+// scaffoldTemplates are the files created by gohost new, keyed by path relative to the service directory. Paths are templates too, and Go files are formatted after they are rendered.
+var scaffoldTemplates = map[string]*template.Template{
+	"proto/{{.Package}}.proto":          template.Must(template.New("proto").Parse(protoTemplate)),
+	"{{.Package}}_service.go":           template.Must(template.New("service").Parse(serviceTemplate)),
+	"{{.Package}}_service_unit_test.go": template.Must(template.New("test").Parse(serviceTestTemplate)),
+	"cmd/server/main.go":                template.Must(template.New("server").Parse(serverTemplate)),
+	"cmd/client/main.go":                template.Must(template.New("client").Parse(clientTemplate)),
+	"scripts/generate.sh":               template.Must(template.New("generate").Parse(generateTemplate)),
+	"README.md":                         template.Must(template.New("readme").Parse(readmeTemplate)),
+}
+
+const protoTemplate = `syntax = "proto3";
+
+package {{.Package}};
+
+import "google/api/annotations.proto";
+
+// {{.Service}} is the {{.Name}} service.
+service {{.Service}} {
+{{- range .RPCs}}
+  // {{.Name}} returns the value in the request.
+  rpc {{.Name}}({{.Name}}Request) returns ({{.Name}}Response) {
+      option (google.api.http) = {
+        post: "{{.Path}}"
+        body: "*"
+    };
+  }
+{{- end}}
+}
+{{range .RPCs}}
+// Request for {{.Name}}.
+message {{.Name}}Request {
+  // Value to send.
+  string value = 1;
+}
+
+// Response from {{.Name}}.
+message {{.Name}}Response {
+  // Value from the service.
+  string value = 1;
+}
+{{end -}}
+`
+
+const serviceTemplate = `package {{.Package}}
+
+import (
+	"golang.org/x/net/context"
+
+	pb "{{.ImportPath}}/proto"
+)
+
+//go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --go_out=plugins=grpc:. proto/{{.Package}}.proto
+//go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --grpc-gateway_out=logtostderr=true:. proto/{{.Package}}.proto
+//go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --proto_path=./proto --swagger_out=logtostderr=true:. proto/{{.Package}}.proto
+//go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --gohost_out=. proto/{{.Package}}.proto
+
+// Service contains the implementation for the gRPC service.
+type Service struct{}
+
+// NewService creates a new instance of Service.
+func NewService() *Service {
+	return &Service{}
+}
+{{range .RPCs}}
+// {{.Name}} will return the value in the request.
+func (s *Service) {{.Name}}(ctx context.Context, in *pb.{{.Name}}Request) (*pb.{{.Name}}Response, error) {
+	return &pb.{{.Name}}Response{
+		Value: in.Value,
+	}, nil
+}
+{{end -}}
+`
+
+const serviceTestTemplate = `package {{.Package}}
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	pb "{{.ImportPath}}/proto"
+	assert "github.com/stretchr/testify/require"
+)
+{{range .RPCs}}
+func Test_Service_{{.Name}}(t *testing.T) {
+	// arrange
+	service := NewService()
+	ctx := context.TODO()
+
+	req := pb.{{.Name}}Request{
+		Value: "test",
+	}
+
+	// act
+	resp, err := service.{{.Name}}(ctx, &req)
+
+	// assert
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, "test", resp.Value)
+}
+{{end -}}
+`
+
+const serverTemplate = `package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/eleniums/gohost"
+	"{{.ImportPath}}"
+
+	pb "{{.ImportPath}}/proto"
+)
+
+func main() {
+	// create the hoster, with the health service on unless disabled by a flag, and log what it does in the background
+	hoster := gohost.NewHoster()
+	hoster.EnableHealth = true
+	hoster.Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	// command-line flags
+	configFile := flag.String("config-file", "", "optional YAML, JSON or TOML file with hoster settings")
+	hoster.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// load configuration with precedence: flags, then {{.EnvPrefix}} environment variables, then the config file
+	err := hoster.LoadConfig(*configFile, "{{.EnvPrefix}}", flag.CommandLine)
+	if err != nil {
+		log.Fatalf("Unable to load configuration: %v", err)
+	}
+
+	// register the service with the gRPC server, HTTP gateway, OpenAPI document and health service
+	pb.Register{{.Service}}(hoster, {{.Package}}.NewService())
+	log.Printf("Registered gRPC endpoint at: %v", hoster.GRPCAddr)
+	log.Printf("Registered HTTP endpoint at: %v", hoster.HTTPAddr)
+
+	// start the server
+	err = hoster.ListenAndServe()
+	if err != nil {
+		log.Fatalf("Unable to start the server: %v", err)
+	}
+}
+`
+
+const clientTemplate = `package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	pb "{{.ImportPath}}/proto"
+)
+
+func main() {
+	// command-line flags
+	grpcAddr := flag.String("grpc-addr", "127.0.0.1:50051", "host and port of the gRPC endpoint")
+	value := flag.String("value", "test", "value to send to the service")
+	insecure := flag.Bool("insecure", false, "true to use insecure connection and disable TLS")
+	insecureSkipVerify := flag.Bool("insecure-skip-verify", false, "true to skip verifying the certificate chain and host name")
+	flag.Parse()
+
+	// determine transport security to use
+	var creds grpc.DialOption
+	if *insecure {
+		creds = grpc.WithInsecure()
+	} else {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: *insecureSkipVerify,
+		}))
+	}
+
+	// dial the service
+	conn, err := grpc.Dial(*grpcAddr, creds)
+	if err != nil {
+		log.Fatalf("Failed to dial service: %v", err)
+	}
+
+	// create client for service
+	client := pb.New{{.Service}}Client(conn)
+	var start time.Time
+{{range .RPCs}}
+	// call {{.Name}} on the server
+	start = time.Now()
+	{{.Var}}, err := client.{{.Name}}(context.Background(), &pb.{{.Name}}Request{
+		Value: *value,
+	})
+	if err != nil {
+		log.Fatalf("Failed to call {{.Name}}: %v", err)
+	}
+	log.Printf("{{.Name}} response in %v: %v", time.Since(start), {{.Var}}.Value)
+{{end -}}
+}
+`
+
+const generateTemplate = `#!/bin/bash
+set -e
+
+# regenerate the gRPC server, HTTP gateway and swagger docs from the proto with the go:generate lines of the service
+cd "$(dirname "$0")/.."
+go generate ./...
+`
+
+const readmeTemplate = "# Service: {{.Name}}" + `
+
+A service hosted with gRPC and HTTP endpoints by [gohost](https://github.com/eleniums/gohost).
+
+## Prerequisites
+- Install [gRPC](https://grpc.io/docs/quickstart/go.html)
+    - Make sure protoc is in GOPATH/bin
+    - Make sure google/protobuf is also in GOPATH/bin
+- Install [grpc-gateway](https://github.com/grpc-ecosystem/grpc-gateway)
+- Install protoc-gen-gohost
+    - ` + "`go get -u github.com/eleniums/gohost/cmd/protoc-gen-gohost`" + `
+
+## Generate client/server from proto
+- Build the client/server and swagger docs after changing proto/{{.Package}}.proto:
+    - ` + "`./scripts/generate.sh`" + `
+
+## Run the server
+- Insecure
+    - ` + "`go run cmd/server/main.go`" + `
+- With a config file (YAML, JSON or TOML)
+    - ` + "`go run cmd/server/main.go -config-file config.yaml`" + `
+- With environment variables
+    - ` + "`{{.EnvPrefix}}HTTP_ADDR=127.0.0.1:8080 go run cmd/server/main.go`" + `
+
+## Test the gRPC endpoint with the command-line client
+- ` + "`go run cmd/client/main.go -insecure -value test`" + `
+
+## Test the HTTP endpoint with curl
+{{- range .RPCs}}
+- ` + "`curl -d '{\"value\":\"test\"}' http://127.0.0.1:9090{{.Path}}`" + `
+{{- end}}
+
+## Read the OpenAPI document
+- ` + "`curl http://127.0.0.1:9090/openapi/{{.Package}}.{{.Service}}.json`" + `
+
+## Check health
+- ` + "`gohost health -insecure 127.0.0.1:50051 {{.Package}}.{{.Service}}`" + `
+`
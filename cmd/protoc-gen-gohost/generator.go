@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	gwdescriptor "github.com/grpc-ecosystem/grpc-gateway/protoc-gen-grpc-gateway/descriptor"
+)
+
+// fileTemplate is the template of a generated file.
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by protoc-gen-gohost. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.Package}}
+
+import (
+	"github.com/eleniums/gohost"
+	"google.golang.org/grpc"
+)
+{{range .Services}}
+// {{.Name}}Name is the full name of {{.Name}}, which is reported by the health service{{if .Gateway}} and names its OpenAPI document{{end}}.
+const {{.Name}}Name = "{{.FullName}}"
+
+// Register{{.Name}} will register impl with the gRPC server of a hoster{{if .Gateway}}, along with the HTTP gateway and OpenAPI document for the http annotations of the service{{end}}, and report the service as serving with the health service.
+func Register{{.Name}}(h *gohost.Hoster, impl {{.Name}}Server) {
+	h.RegisterGRPCServer(func(s *grpc.Server) {
+		Register{{.Name}}Server(s, impl)
+	})
+{{- if .Gateway}}
+	h.RegisterHTTPGateway(Register{{.Name}}HandlerFromEndpoint)
+	h.RegisterOpenAPIDoc({{.Name}}Name, {{.DocVar}})
+{{- end}}
+	h.RegisterHealthService({{.Name}}Name)
+}
+{{if .Gateway}}
+// {{.DocVar}} is the OpenAPI document for the http annotations of {{.Name}}.
+var {{.DocVar}} = []byte(` + "`{{.OpenAPI}}`" + `)
+{{end}}{{end -}}
+`))
+
+// fileData contains the values used by the template of a generated file.
+type fileData struct {
+	Source   string
+	Package  string
+	Services []serviceData
+}
+
+// serviceData contains the values used by the template for a service.
+type serviceData struct {
+	// Name is the Go name of the service, as used by protoc-gen-go.
+	Name string
+
+	// FullName is the name of the service including the proto package.
+	FullName string
+
+	// Gateway is true if any methods of the service have http annotations, so protoc-gen-grpc-gateway generates a handler for it.
+	Gateway bool
+
+	// DocVar is the name of the variable with the OpenAPI document.
+	DocVar string
+
+	// OpenAPI is the OpenAPI document, escaped for a raw string literal.
+	OpenAPI string
+}
+
+// generate returns the files generated for the proto files in a request. Files without services are skipped.
+func generate(req *plugin.CodeGeneratorRequest) ([]*plugin.CodeGeneratorResponse_File, error) {
+	// load the files the same way as protoc-gen-grpc-gateway and protoc-gen-swagger
+	reg := gwdescriptor.NewRegistry()
+	if err := reg.Load(req); err != nil {
+		return nil, err
+	}
+
+	var files []*plugin.CodeGeneratorResponse_File
+	for _, name := range req.GetFileToGenerate() {
+		file, err := reg.LookupFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(file.Services) == 0 {
+			continue
+		}
+
+		content, err := generateFile(reg, file)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+
+		files = append(files, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(strings.TrimSuffix(name, path.Ext(name)) + ".pb.gohost.go"),
+			Content: proto.String(content),
+		})
+	}
+
+	return files, nil
+}
+
+// generateFile returns the generated code for the services of a proto file.
+func generateFile(reg *gwdescriptor.Registry, file *gwdescriptor.File) (string, error) {
+	data := fileData{
+		Source:  file.GetName(),
+		Package: goPackageName(file.FileDescriptorProto),
+	}
+
+	for i, svc := range file.Services {
+		service := serviceData{
+			Name:     generator.CamelCase(svc.GetName()),
+			FullName: qualifiedName(file.GetPackage(), svc.GetName()),
+		}
+		service.DocVar = lowerFirst(service.Name) + "OpenAPIDoc"
+
+		for _, m := range svc.Methods {
+			if len(m.Bindings) > 0 {
+				service.Gateway = true
+			}
+		}
+
+		if service.Gateway {
+			doc, err := newOpenAPIDoc(reg, file, i)
+			if err != nil {
+				return "", err
+			}
+			service.OpenAPI = strings.Replace(string(doc), "`", "` + \"`\" + `", -1)
+		}
+
+		data.Services = append(data.Services, service)
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to format generated code: %v", err)
+	}
+
+	return string(b), nil
+}
+
+// goPackageName returns the name of the Go package of a proto file, following the rules of protoc-gen-go: the go_package option, then the proto package, then the file name.
+func goPackageName(fd *descriptor.FileDescriptorProto) string {
+	name := strings.TrimSuffix(path.Base(fd.GetName()), path.Ext(fd.GetName()))
+	if pkg := fd.GetOptions().GetGoPackage(); pkg != "" {
+		if i := strings.LastIndex(pkg, ";"); i >= 0 {
+			name = pkg[i+1:]
+		} else {
+			name = path.Base(pkg)
+		}
+	} else if fd.GetPackage() != "" {
+		name = fd.GetPackage()
+	}
+
+	// replace characters that are not valid in identifiers
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// lowerFirst returns a name with the first letter in lower case.
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// qualifiedName returns the full name of a proto element in a package.
+func qualifiedName(pkg string, name string) string {
+	if pkg == "" {
+		return name
+	}
+
+	return pkg + "." + name
+}
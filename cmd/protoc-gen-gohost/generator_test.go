@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+	"google.golang.org/genproto/googleapis/api/annotations"
+
+	_ "github.com/eleniums/gohost/examples/test/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	_ "github.com/golang/protobuf/ptypes/timestamp"
+	assert "github.com/stretchr/testify/require"
+)
+
+// Field numbers of elements in descriptor.proto, used in the paths of source locations.
+const (
+	fileMessageTypePath = 4
+	fileServicePath     = 6
+	messageFieldPath    = 2
+	serviceMethodPath   = 2
+)
+
+func Test_Generate(t *testing.T) {
+	// arrange
+	req := &plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{"proto/test.proto"},
+		ProtoFile: []*descriptor.FileDescriptorProto{
+			loadTestDescriptor(t, "google/protobuf/descriptor.proto"),
+			loadTestDescriptor(t, "google/api/http.proto"),
+			loadTestDescriptor(t, "google/api/annotations.proto"),
+			loadTestDescriptor(t, "proto/test.proto"),
+		},
+	}
+
+	// act
+	files, err := generate(req)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "proto/test.pb.gohost.go", files[0].GetName())
+
+	content := files[0].GetContent()
+	assert.Contains(t, content, "package test\n")
+	assert.Contains(t, content, `const TestServiceName = "test.TestService"`)
+	assert.Contains(t, content, "func RegisterTestService(h *gohost.Hoster, impl TestServiceServer) {")
+	assert.Contains(t, content, "RegisterTestServiceServer(s, impl)")
+	assert.Contains(t, content, "h.RegisterHTTPGateway(RegisterTestServiceHandlerFromEndpoint)")
+	assert.Contains(t, content, "h.RegisterOpenAPIDoc(TestServiceName, testServiceOpenAPIDoc)")
+	assert.Contains(t, content, "h.RegisterHealthService(TestServiceName)")
+
+	// the document is the output of protoc-gen-swagger, apart from comments which are missing from the registered descriptor
+	expectedDoc, err := ioutil.ReadFile("../../examples/test/proto/test.swagger.json")
+	assert.NoError(t, err)
+	assert.Equal(t, withoutComments(t, string(expectedDoc)), withoutComments(t, generatedDocJSON(t, content, "testServiceOpenAPIDoc")))
+
+	doc := generatedDoc(t, content, "testServiceOpenAPIDoc")
+	assert.Len(t, doc.Paths, 4)
+	assert.Contains(t, doc.Paths["/v1/echo"], "get")
+	assert.Contains(t, doc.Paths["/v1/send"], "post")
+	assert.Contains(t, doc.Paths["/v1/large"], "get")
+	assert.Contains(t, doc.Paths["/v1/repeat"], "get")
+	assert.Contains(t, doc.Definitions, "testEchoResponse")
+	assert.Contains(t, doc.Definitions, "testTestResponse")
+}
+
+func Test_Generate_OpenAPI(t *testing.T) {
+	// arrange
+	req := &plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{"library.proto"},
+		ProtoFile: []*descriptor.FileDescriptorProto{
+			loadTestDescriptor(t, "google/protobuf/timestamp.proto"),
+			newLibraryDescriptor(t),
+		},
+	}
+
+	// act
+	files, err := generate(req)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "library.pb.gohost.go", files[0].GetName())
+
+	content := files[0].GetContent()
+	assert.Contains(t, content, "package libpb\n")
+	assert.Contains(t, content, "func RegisterLibraryService(h *gohost.Hoster, impl LibraryServiceServer) {")
+	assert.Contains(t, content, "func RegisterAdmin(h *gohost.Hoster, impl AdminServer) {")
+	assert.NotContains(t, content, "RegisterAdminHandlerFromEndpoint")
+	assert.NotContains(t, content, "adminOpenAPIDoc")
+
+	doc := generatedDoc(t, content, "libraryServiceOpenAPIDoc")
+	assert.Equal(t, "library.proto", doc.Info["title"])
+
+	assert.Len(t, doc.Paths, 3)
+	assert.Contains(t, doc.Paths["/v1/{name}"], "get")
+	assert.Contains(t, doc.Paths["/v2/{name}"], "get")
+	assert.Contains(t, doc.Paths["/v1/{book.name}"], "patch")
+	assert.Contains(t, doc.Definitions, "libraryBook")
+}
+
+func Test_Generate_InvalidPath(t *testing.T) {
+	// arrange
+	fd := newLibraryDescriptor(t)
+	setHTTPRule(t, fd.Service[0].Method[0], &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/{missing}"},
+	})
+	req := &plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{"library.proto"},
+		ProtoFile:      []*descriptor.FileDescriptorProto{fd},
+	}
+
+	// act
+	_, err := generate(req)
+
+	// assert
+	assert.EqualError(t, err, `no field "missing" found in GetBookRequest`)
+}
+
+func Test_GoPackageName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     *descriptor.FileDescriptorProto
+		expected string
+	}{
+		{"go_package with name", &descriptor.FileDescriptorProto{Name: proto.String("a.proto"), Package: proto.String("pkg"), Options: &descriptor.FileOptions{GoPackage: proto.String("example.com/a;apb")}}, "apb"},
+		{"go_package path", &descriptor.FileDescriptorProto{Name: proto.String("a.proto"), Package: proto.String("pkg"), Options: &descriptor.FileOptions{GoPackage: proto.String("example.com/a-b")}}, "a_b"},
+		{"proto package", &descriptor.FileDescriptorProto{Name: proto.String("a.proto"), Package: proto.String("foo.bar")}, "foo_bar"},
+		{"file name", &descriptor.FileDescriptorProto{Name: proto.String("proto/2fa.proto")}, "_2fa"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// act
+			name := goPackageName(tc.file)
+
+			// assert
+			assert.Equal(t, tc.expected, name)
+		})
+	}
+}
+
+func Test_CamelCase(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"HelloService", "HelloService"},
+		{"hello_service", "HelloService"},
+		{"hello_Service", "Hello_Service"},
+		{"_hello", "XHello"},
+		{"v2_api", "V2Api"},
+		{"Echo2service", "Echo2Service"},
+		{"v1beta_service", "V1BetaService"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// act
+			name := generator.CamelCase(tc.name)
+
+			// assert
+			assert.Equal(t, tc.expected, name)
+		})
+	}
+}
+
+// testDoc is an OpenAPI document with the operations and definitions left as JSON.
+type testDoc struct {
+	Info        map[string]string                     `json:"info"`
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]json.RawMessage            `json:"definitions"`
+}
+
+// generatedDocJSON is a helper function that returns the OpenAPI document assigned to a variable in generated code.
+func generatedDocJSON(t *testing.T, content string, name string) string {
+	match := regexp.MustCompile("(?s)var " + name + " = \\[\\]byte\\(`(.*?)`\\)").FindStringSubmatch(content)
+	assert.Len(t, match, 2)
+
+	return match[1]
+}
+
+// generatedDoc is a helper function that parses the OpenAPI document assigned to a variable in generated code.
+func generatedDoc(t *testing.T, content string, name string) testDoc {
+	var doc testDoc
+	err := json.Unmarshal([]byte(generatedDocJSON(t, content, name)), &doc)
+	assert.NoError(t, err)
+
+	return doc
+}
+
+// withoutComments is a helper function that parses an OpenAPI document and removes the summaries and descriptions taken from comments.
+func withoutComments(t *testing.T, doc string) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(doc), &v)
+	assert.NoError(t, err)
+
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			delete(v, "summary")
+			delete(v, "description")
+			for _, e := range v {
+				strip(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				strip(e)
+			}
+		}
+	}
+	strip(v)
+
+	return v
+}
+
+// loadTestDescriptor is a helper function that returns the descriptor of a proto file registered by generated code.
+func loadTestDescriptor(t *testing.T, file string) *descriptor.FileDescriptorProto {
+	r, err := gzip.NewReader(bytes.NewReader(proto.FileDescriptor(file)))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+
+	fd := &descriptor.FileDescriptorProto{}
+	err = proto.Unmarshal(b, fd)
+	assert.NoError(t, err)
+
+	// generated code leaves out the source code info that protoc sends to plugins
+	fd.SourceCodeInfo = &descriptor.SourceCodeInfo{}
+
+	return fd
+}
+
+// newLibraryDescriptor is a helper function that returns a proto file with a service with http annotations and a service without them.
+func newLibraryDescriptor(t *testing.T) *descriptor.FileDescriptorProto {
+	field := func(name string, number int32, typ descriptor.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptor.FieldDescriptorProto {
+		label := descriptor.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptor.FieldDescriptorProto_LABEL_REPEATED
+		}
+		fd := &descriptor.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+	method := func(name string, input string, rule *annotations.HttpRule) *descriptor.MethodDescriptorProto {
+		md := &descriptor.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(input),
+			OutputType: proto.String(".library.Book"),
+		}
+		if rule != nil {
+			setHTTPRule(t, md, rule)
+		}
+		return md
+	}
+
+	return &descriptor.FileDescriptorProto{
+		Name:       proto.String("library.proto"),
+		Package:    proto.String("library"),
+		Syntax:     proto.String("proto3"),
+		Options:    &descriptor.FileOptions{GoPackage: proto.String("example.com/library;libpb")},
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptor.EnumDescriptorProto{{
+			Name: proto.String("Genre"),
+			Value: []*descriptor.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("FICTION"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptor.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("name", 1, descriptor.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("genre", 2, descriptor.FieldDescriptorProto_TYPE_ENUM, ".library.Genre", false),
+					field("tags", 3, descriptor.FieldDescriptorProto_TYPE_STRING, "", true),
+					field("counts", 4, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".library.Book.CountsEntry", true),
+					field("published", 5, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp", false),
+					field("related", 6, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".library.Book", false),
+				},
+				NestedType: []*descriptor.DescriptorProto{{
+					Name: proto.String("CountsEntry"),
+					Field: []*descriptor.FieldDescriptorProto{
+						field("key", 1, descriptor.FieldDescriptorProto_TYPE_STRING, "", false),
+						field("value", 2, descriptor.FieldDescriptorProto_TYPE_INT64, "", false),
+					},
+					Options: &descriptor.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+			{
+				Name: proto.String("GetBookRequest"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("name", 1, descriptor.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("fields", 2, descriptor.FieldDescriptorProto_TYPE_STRING, "", true),
+					field("genre", 3, descriptor.FieldDescriptorProto_TYPE_ENUM, ".library.Genre", false),
+				},
+			},
+			{
+				Name: proto.String("UpdateBookRequest"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("book", 1, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".library.Book", false),
+				},
+			},
+		},
+		Service: []*descriptor.ServiceDescriptorProto{
+			{
+				Name: proto.String("LibraryService"),
+				Method: []*descriptor.MethodDescriptorProto{
+					method("GetBook", ".library.GetBookRequest", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=books/*}"},
+						AdditionalBindings: []*annotations.HttpRule{
+							{Pattern: &annotations.HttpRule_Get{Get: "/v2/{name}"}},
+						},
+					}),
+					method("UpdateBook", ".library.UpdateBookRequest", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Patch{Patch: "/v1/{book.name=books/*}"},
+						Body:    "book",
+					}),
+					method("ListBooks", ".library.GetBookRequest", nil),
+				},
+			},
+			{
+				Name: proto.String("Admin"),
+				Method: []*descriptor.MethodDescriptorProto{
+					method("Ping", ".library.GetBookRequest", nil),
+				},
+			},
+		},
+		SourceCodeInfo: &descriptor.SourceCodeInfo{
+			Location: []*descriptor.SourceCodeInfo_Location{
+				{Path: []int32{fileServicePath, 0}, LeadingComments: proto.String(" A library\n of books.\n")},
+				{Path: []int32{fileServicePath, 0, serviceMethodPath, 0}, LeadingComments: proto.String(" Get a book by name.\n")},
+				{Path: []int32{fileMessageTypePath, 0}, LeadingComments: proto.String(" A book in the library.\n")},
+				{Path: []int32{fileMessageTypePath, 0, messageFieldPath, 0}, LeadingComments: proto.String(" Name of the book.\n")},
+			},
+		},
+	}
+}
+
+// setHTTPRule is a helper function that sets the http annotation of a method.
+func setHTTPRule(t *testing.T, md *descriptor.MethodDescriptorProto, rule *annotations.HttpRule) {
+	md.Options = &descriptor.MethodOptions{}
+	err := proto.SetExtension(md.Options, annotations.E_Http, rule)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,52 @@
+// Command protoc-gen-gohost is a protoc plugin that generates a function for each service to register it with a gohost.Hoster.
+//
+// For a service HelloService, RegisterHelloService(h, impl) registers impl with the gRPC server, the HTTP gateway generated by protoc-gen-grpc-gateway (if any methods have http annotations), the OpenAPI document protoc-gen-swagger generates for the http annotations and the name of the service for the health service. The code is generated alongside the output of protoc-gen-go and protoc-gen-grpc-gateway, in the same package:
+//
+//	protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --gohost_out=. proto/hello.proto
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "protoc-gen-gohost: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run will read a code generator request from protoc on standard input and write the response to standard output.
+func run() error {
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read request: %v", err)
+	}
+
+	req := &plugin.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		return fmt.Errorf("failed to parse request: %v", err)
+	}
+
+	// errors in the proto files are reported to protoc in the response
+	resp := &plugin.CodeGeneratorResponse{}
+	files, err := generate(req)
+	if err != nil {
+		resp.Error = proto.String(err.Error())
+	}
+	resp.File = files
+
+	b, err = proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to write response: %v", err)
+	}
+	_, err = os.Stdout.Write(b)
+
+	return err
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/grpc-ecosystem/grpc-gateway/protoc-gen-grpc-gateway/descriptor"
+	"github.com/grpc-ecosystem/grpc-gateway/protoc-gen-swagger/genswagger"
+)
+
+// newOpenAPIDoc returns the OpenAPI document protoc-gen-swagger generates for a service, which is the index of the service in its file, so the document registered with a hoster matches the *.swagger.json files generated alongside it.
+func newOpenAPIDoc(reg *descriptor.Registry, file *descriptor.File, index int) ([]byte, error) {
+	// generate from a copy of the file with only the service, so each service has its own document
+	single := *file
+	single.Services = []*descriptor.Service{file.Services[index]}
+
+	files, err := genswagger.New(reg).Generate([]*descriptor.File{&single})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no OpenAPI document generated for service %v", file.Services[index].GetName())
+	}
+
+	return []byte(files[0].GetContent()), nil
+}
@@ -12,6 +12,7 @@ It has these top-level messages:
 	LargeRequest
 	TestResponse
 	EchoResponse
+	RepeatRequest
 */
 package test
 
@@ -108,11 +109,39 @@ func (m *EchoResponse) GetEcho() string {
 	return ""
 }
 
+// Repeat request.
+type RepeatRequest struct {
+	// Value to repeat.
+	Value string `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
+	// Number of times to repeat the value.
+	Count int64 `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *RepeatRequest) Reset()                    { *m = RepeatRequest{} }
+func (m *RepeatRequest) String() string            { return proto.CompactTextString(m) }
+func (*RepeatRequest) ProtoMessage()               {}
+func (*RepeatRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *RepeatRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *RepeatRequest) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*SendRequest)(nil), "test.SendRequest")
 	proto.RegisterType((*LargeRequest)(nil), "test.LargeRequest")
 	proto.RegisterType((*TestResponse)(nil), "test.TestResponse")
 	proto.RegisterType((*EchoResponse)(nil), "test.EchoResponse")
+	proto.RegisterType((*RepeatRequest)(nil), "test.RepeatRequest")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -134,6 +163,8 @@ type TestServiceClient interface {
 	Large(ctx context.Context, in *LargeRequest, opts ...grpc.CallOption) (*EchoResponse, error)
 	// Stream a bunch of requests.
 	Stream(ctx context.Context, opts ...grpc.CallOption) (TestService_StreamClient, error)
+	// Repeat will stream the value in the request back count times.
+	Repeat(ctx context.Context, in *RepeatRequest, opts ...grpc.CallOption) (TestService_RepeatClient, error)
 }
 
 type testServiceClient struct {
@@ -205,6 +236,38 @@ func (x *testServiceStreamClient) CloseAndRecv() (*TestResponse, error) {
 	return m, nil
 }
 
+func (c *testServiceClient) Repeat(ctx context.Context, in *RepeatRequest, opts ...grpc.CallOption) (TestService_RepeatClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_TestService_serviceDesc.Streams[1], c.cc, "/test.TestService/Repeat", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &testServiceRepeatClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TestService_RepeatClient interface {
+	Recv() (*EchoResponse, error)
+	grpc.ClientStream
+}
+
+type testServiceRepeatClient struct {
+	grpc.ClientStream
+}
+
+func (x *testServiceRepeatClient) Recv() (*EchoResponse, error) {
+	m := new(EchoResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for TestService service
 
 type TestServiceServer interface {
@@ -216,6 +279,8 @@ type TestServiceServer interface {
 	Large(context.Context, *LargeRequest) (*EchoResponse, error)
 	// Stream a bunch of requests.
 	Stream(TestService_StreamServer) error
+	// Repeat will stream the value in the request back count times.
+	Repeat(*RepeatRequest, TestService_RepeatServer) error
 }
 
 func RegisterTestServiceServer(s *grpc.Server, srv TestServiceServer) {
@@ -302,6 +367,27 @@ func (x *testServiceStreamServer) Recv() (*SendRequest, error) {
 	return m, nil
 }
 
+func _TestService_Repeat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RepeatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TestServiceServer).Repeat(m, &testServiceRepeatServer{stream})
+}
+
+type TestService_RepeatServer interface {
+	Send(*EchoResponse) error
+	grpc.ServerStream
+}
+
+type testServiceRepeatServer struct {
+	grpc.ServerStream
+}
+
+func (x *testServiceRepeatServer) Send(m *EchoResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _TestService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "test.TestService",
 	HandlerType: (*TestServiceServer)(nil),
@@ -325,6 +411,11 @@ var _TestService_serviceDesc = grpc.ServiceDesc{
 			Handler:       _TestService_Stream_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Repeat",
+			Handler:       _TestService_Repeat_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/test.proto",
 }
@@ -332,23 +423,26 @@ var _TestService_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("proto/test.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 284 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x91, 0x41, 0x4a, 0xc3, 0x40,
-	0x14, 0x86, 0x6d, 0x4d, 0x63, 0xfb, 0x92, 0x45, 0x3b, 0x88, 0x94, 0xe2, 0x42, 0x46, 0x90, 0xac,
-	0x1a, 0xb4, 0x07, 0x10, 0x04, 0x77, 0xae, 0x12, 0x2f, 0x30, 0xc6, 0x47, 0x12, 0x88, 0x33, 0x31,
-	0x6f, 0x92, 0x03, 0xb8, 0x72, 0xef, 0xd1, 0xbc, 0x82, 0x07, 0x91, 0x79, 0x49, 0x24, 0x0b, 0x11,
-	0x77, 0xef, 0x1f, 0xfe, 0xff, 0x9b, 0x7f, 0xde, 0xc0, 0xba, 0x6e, 0x8c, 0x35, 0xb1, 0x45, 0xb2,
-	0x7b, 0x1e, 0x85, 0xe7, 0xe6, 0xdd, 0x79, 0x6e, 0x4c, 0x5e, 0x61, 0xac, 0xea, 0x32, 0x56, 0x5a,
-	0x1b, 0xab, 0x6c, 0x69, 0x34, 0xf5, 0x1e, 0x79, 0x09, 0x41, 0x8a, 0xfa, 0x39, 0xc1, 0xd7, 0x16,
-	0xc9, 0x8a, 0x53, 0x58, 0x74, 0xaa, 0x6a, 0x71, 0x3b, 0xbb, 0x98, 0x45, 0xab, 0xa4, 0x17, 0xf2,
-	0x0a, 0xc2, 0x07, 0xd5, 0xe4, 0x38, 0xba, 0xce, 0xc0, 0xaf, 0x50, 0xe7, 0xb6, 0x60, 0xdb, 0x71,
-	0x32, 0x28, 0x19, 0x41, 0xf8, 0x88, 0x64, 0x13, 0xa4, 0xda, 0x68, 0x42, 0xb1, 0x85, 0x13, 0x6a,
-	0xb3, 0x0c, 0x89, 0xd8, 0xb8, 0x4c, 0x46, 0x29, 0x25, 0x84, 0xf7, 0x59, 0x61, 0x7e, 0x9c, 0x02,
-	0x3c, 0xcc, 0x0a, 0x33, 0x5c, 0xcb, 0xf3, 0xcd, 0xfb, 0x1c, 0x02, 0x87, 0x4b, 0xb1, 0xe9, 0xca,
-	0x0c, 0xc5, 0x2d, 0x78, 0x2e, 0x23, 0x36, 0x7b, 0x7e, 0xe3, 0xa4, 0xf6, 0x4e, 0xf4, 0x47, 0x53,
-	0xa4, 0x5c, 0xbf, 0x7d, 0x7e, 0x7d, 0xcc, 0x41, 0x2c, 0xe3, 0xee, 0x3a, 0x76, 0x40, 0x07, 0x70,
-	0xa1, 0x3f, 0x00, 0xd3, 0xf6, 0x23, 0x40, 0x32, 0x80, 0x5c, 0xf0, 0x0e, 0x16, 0xbc, 0x07, 0x31,
-	0xd8, 0xa7, 0x4b, 0xf9, 0xb5, 0xc3, 0x86, 0x11, 0x81, 0x58, 0x39, 0x44, 0xc5, 0xd1, 0x03, 0xf8,
-	0xa9, 0x6d, 0x50, 0xbd, 0xfc, 0xb7, 0xc6, 0x51, 0x34, 0x7b, 0xf2, 0xf9, 0xb3, 0x0e, 0xdf, 0x01,
-	0x00, 0x00, 0xff, 0xff, 0x00, 0xa9, 0xf5, 0x87, 0xe4, 0x01, 0x00, 0x00,
+	// 324 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x52, 0x41, 0x4a, 0x03, 0x41,
+	0x10, 0x74, 0x63, 0xb2, 0x26, 0x9d, 0x15, 0x92, 0x56, 0x24, 0x04, 0x0f, 0x32, 0x82, 0xe4, 0x94,
+	0x55, 0x73, 0xf4, 0x20, 0x08, 0xe2, 0xc5, 0xd3, 0xc6, 0x0f, 0x8c, 0x63, 0xb3, 0x09, 0xac, 0x33,
+	0xeb, 0xce, 0x6c, 0x1e, 0xe0, 0x17, 0x7c, 0x99, 0xf8, 0x05, 0x1f, 0x22, 0xd3, 0x93, 0xc8, 0x0a,
+	0x21, 0x78, 0xeb, 0x1a, 0xaa, 0xab, 0xaa, 0x8b, 0x81, 0x41, 0x59, 0x19, 0x67, 0x52, 0x47, 0xd6,
+	0x4d, 0x79, 0xc4, 0xb6, 0x9f, 0xc7, 0xa7, 0xb9, 0x31, 0x79, 0x41, 0xa9, 0x2c, 0x97, 0xa9, 0xd4,
+	0xda, 0x38, 0xe9, 0x96, 0x46, 0xdb, 0xc0, 0x11, 0xe7, 0xd0, 0x9f, 0x93, 0x7e, 0xc9, 0xe8, 0xad,
+	0x26, 0xeb, 0xf0, 0x18, 0x3a, 0x2b, 0x59, 0xd4, 0x34, 0x8a, 0xce, 0xa2, 0x49, 0x2f, 0x0b, 0x40,
+	0x5c, 0x40, 0xf2, 0x28, 0xab, 0x9c, 0x36, 0xac, 0x13, 0x88, 0x0b, 0xd2, 0xb9, 0x5b, 0x30, 0x6d,
+	0x3f, 0x5b, 0x23, 0x31, 0x81, 0xe4, 0x89, 0xac, 0xcb, 0xc8, 0x96, 0x46, 0x5b, 0xc2, 0x11, 0x1c,
+	0xd8, 0x5a, 0x29, 0xb2, 0x96, 0x89, 0xdd, 0x6c, 0x03, 0x85, 0x80, 0xe4, 0x5e, 0x2d, 0xcc, 0x2f,
+	0x13, 0xa1, 0x4d, 0x6a, 0x61, 0xd6, 0xb6, 0x3c, 0x8b, 0x1b, 0x38, 0xcc, 0xa8, 0x24, 0xe9, 0x76,
+	0x86, 0xf3, 0xaf, 0xca, 0xd4, 0xda, 0x8d, 0x5a, 0x9c, 0x25, 0x80, 0xeb, 0xcf, 0x16, 0xf4, 0x7d,
+	0x96, 0x39, 0x55, 0xab, 0xa5, 0x22, 0xbc, 0x85, 0xb6, 0x37, 0xc4, 0xe1, 0x94, 0x0b, 0x6a, 0xdc,
+	0x3c, 0xc6, 0xf0, 0xd4, 0xcc, 0x23, 0x06, 0xef, 0x5f, 0xdf, 0x1f, 0x2d, 0xc0, 0x6e, 0xba, 0xba,
+	0x4a, 0x7d, 0x1a, 0x2f, 0xe0, 0x97, 0x76, 0x08, 0x34, 0x4f, 0xdf, 0x08, 0x08, 0x16, 0xb0, 0x7e,
+	0xf1, 0x0e, 0x3a, 0x5c, 0x22, 0xae, 0xe9, 0xcd, 0x46, 0xb7, 0x66, 0x18, 0xb2, 0x44, 0x1f, 0x7b,
+	0x5e, 0xa2, 0xe0, 0xd5, 0x19, 0xc4, 0x73, 0x57, 0x91, 0x7c, 0xfd, 0x6f, 0x8c, 0xbd, 0x49, 0x84,
+	0x0f, 0x10, 0x87, 0x1e, 0xf1, 0x28, 0x30, 0xfe, 0xb4, 0xba, 0xd5, 0x1a, 0xd9, 0x3a, 0x41, 0xf0,
+	0xd6, 0x15, 0xd3, 0x2f, 0xa3, 0xe7, 0x98, 0xbf, 0xcc, 0xec, 0x67, 0x00, 0xca, 0x03, 0x7c, 0x32,
+	0x6a, 0x02, 0x00, 0x00,
 }
@@ -11,6 +11,7 @@ import (
 //go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --go_out=plugins=grpc:. proto/test.proto
 //go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --grpc-gateway_out=logtostderr=true:. proto/test.proto
 //go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --proto_path=./proto --swagger_out=logtostderr=true:. proto/test.proto
+//go:generate protoc -I. -I$GOPATH/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis --gohost_out=. proto/test.proto
 
 // Service contains the implementation for the gRPC service.
 type Service struct{}
@@ -55,3 +56,17 @@ func (s *Service) Stream(stream pb.TestService_StreamServer) error {
 		}
 	}
 }
+
+// Repeat will stream the value in the request back count times.
+func (s *Service) Repeat(in *pb.RepeatRequest, stream pb.TestService_RepeatServer) error {
+	for i := int64(0); i < in.Count; i++ {
+		err := stream.Send(&pb.EchoResponse{
+			Echo: in.Value,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package gohosttest starts a gohost.Hoster on in-memory listeners for tests, with clients connected to it.
+package gohosttest
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// BufferSize is the size of the in-memory buffer of each connection to the gRPC endpoint.
+	BufferSize = 1024 * 1024
+
+	// Host is the host name used in the URL of the HTTP endpoint. Requests for any host are sent to the HTTP endpoint.
+	Host = "gohost.test"
+
+	// StopTimeout is how long to wait for the hoster to stop when a test finishes.
+	StopTimeout = time.Second * 5
+)
+
+// Server is a hoster served on in-memory listeners, so tests do not need open ports or to wait for the endpoints to start. Calls made before an endpoint is ready wait for it. The gRPC endpoint is served on a bufconn listener, and the HTTP endpoint on a listener of synchronous pipes, which support the deadlines the HTTP server relies on.
+type Server struct {
+	// Hoster is the hoster being served. Settings such as TLS and interceptors are used the same way as on real listeners.
+	Hoster *gohost.Hoster
+
+	// ClientTLSConfig is used by Conn and HTTPClient when TLS is enabled on the hoster, such as to present a client certificate. Leave nil to skip verifying the server certificate.
+	ClientTLSConfig *tls.Config
+
+	// DialOptions are added to the options used to create Conn, such as client interceptors or per-RPC credentials.
+	DialOptions []grpc.DialOption
+
+	// GoldenHeaders are the response headers compared with golden files, in addition to Content-Type.
+	GoldenHeaders []string
+
+	// Conn is a client connection to the gRPC endpoint, set by Start.
+	Conn *grpc.ClientConn
+
+	// HTTPClient is a client that sends every request to the HTTP endpoint, set by Start.
+	HTTPClient *http.Client
+
+	// URL is the base URL of the HTTP endpoint (e.g. http://gohost.test), set by Start.
+	URL string
+
+	// grpcListener is the in-memory listener of the gRPC endpoint.
+	grpcListener *bufconn.Listener
+
+	// httpListener is the in-memory listener of the HTTP endpoint.
+	httpListener *pipeListener
+
+	// mu guards stopping and err.
+	mu sync.Mutex
+
+	// stopping is true once the test has finished and the listeners are being closed.
+	stopping bool
+
+	// err is the error returned by ListenAndServe before the test finished.
+	err error
+
+	// done is closed when ListenAndServe returns.
+	done chan struct{}
+
+	// t is the test that started the server, which fails if the hoster stopped early with an error.
+	t testing.TB
+
+	// stopOnce makes sure the server is only stopped once.
+	stopOnce sync.Once
+}
+
+// NewServer creates a server for a hoster. Set ClientTLSConfig, DialOptions and GoldenHeaders before calling Start, and call Stop when the test finishes.
+func NewServer(hoster *gohost.Hoster) *Server {
+	return &Server{
+		Hoster: hoster,
+	}
+}
+
+// Start will create a server for a hoster and start it. Call Stop on the server when the test finishes. See Server.Start.
+func Start(t testing.TB, hoster *gohost.Hoster) *Server {
+	s := NewServer(hoster)
+	s.Start(t)
+
+	return s
+}
+
+// Start will serve the hoster on in-memory listeners and connect the clients to it. The test fails immediately if the configuration is invalid, or when Stop is called if the hoster stopped with an error. Nothing is shared between servers, so tests using separate hosters can run in parallel.
+func (s *Server) Start(t testing.TB) {
+	t.Helper()
+
+	s.t = t
+	s.grpcListener = bufconn.Listen(BufferSize)
+	s.httpListener = newPipeListener()
+	s.done = make(chan struct{})
+
+	s.Hoster.GRPCListener = s.grpcListener
+	s.Hoster.HTTPListener = s.httpListener
+	s.Hoster.GRPCDialer = func(addr string, timeout time.Duration) (net.Conn, error) {
+		return s.grpcListener.Dial()
+	}
+	if s.Hoster.GRPCAddr == "" {
+		s.Hoster.GRPCAddr = Host
+	}
+
+	if err := s.Hoster.Validate(); err != nil {
+		t.Fatalf("failed to start hoster: %v", err)
+	}
+
+	go s.serve()
+
+	// connect the clients, which wait for the endpoints to accept connections
+	tlsConfig := s.ClientTLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithDialer(s.Hoster.GRPCDialer),
+	}
+	if s.Hoster.CertFile != "" && s.Hoster.KeyFile != "" {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		s.URL = "https://" + Host
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+		s.URL = "http://" + Host
+	}
+	opts = append(opts, s.DialOptions...)
+
+	conn, err := grpc.Dial(s.Hoster.GRPCAddr, opts...)
+	if err != nil {
+		s.Stop()
+		t.Fatalf("failed to dial gRPC endpoint: %v", err)
+	}
+	s.Conn = conn
+
+	s.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				return s.httpListener.Dial()
+			},
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// serve will run the hoster until it stops, closing the listeners so waiting calls fail if it stops early.
+func (s *Server) serve() {
+	err := s.Hoster.ListenAndServe()
+
+	s.mu.Lock()
+	if !s.stopping {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.grpcListener.Close()
+	s.httpListener.Close()
+	close(s.done)
+}
+
+// Stop will close the clients and listeners, wait for the hoster to stop and fail the test if it stopped early with an error. Defer it after calling Start.
+func (s *Server) Stop() {
+	s.stopOnce.Do(s.stop)
+}
+
+// stop will stop the server, if it was started.
+func (s *Server) stop() {
+	if s.done == nil {
+		return
+	}
+	t := s.t
+
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	if s.Conn != nil {
+		s.Conn.Close()
+	}
+	if s.HTTPClient != nil {
+		s.HTTPClient.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	s.grpcListener.Close()
+	s.httpListener.Close()
+
+	select {
+	case <-s.done:
+	case <-time.After(StopTimeout):
+		t.Errorf("hoster did not stop within %v", StopTimeout)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		t.Errorf("hoster stopped: %v", s.err)
+	}
+}
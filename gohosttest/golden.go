@@ -0,0 +1,247 @@
+package gohosttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Update is set by the -gohosttest.update flag to write golden files with the responses received, instead of comparing the responses with them.
+var Update = flag.Bool("gohosttest.update", false, "write golden files with the responses received instead of comparing with them")
+
+// GoldenRequest is an HTTP request sent to the HTTP endpoint by a contract test.
+type GoldenRequest struct {
+	// Method is the HTTP method (e.g. GET).
+	Method string `json:"method"`
+
+	// Path is the path and query of the request (e.g. /v1/echo?value=test).
+	Path string `json:"path"`
+
+	// Header contains request headers to send.
+	Header map[string]string `json:"header,omitempty"`
+
+	// Body is the JSON request body. Leave empty to send no body.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// GoldenResponse is the part of an HTTP response that is compared with a golden file.
+type GoldenResponse struct {
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+
+	// Header contains the Content-Type header and the headers in GoldenHeaders that were set.
+	Header map[string]string `json:"header,omitempty"`
+
+	// Body is the response body if it is a single JSON value.
+	Body json.RawMessage `json:"body,omitempty"`
+
+	// Stream contains the messages of a response body with more than one JSON value, such as from a server-streaming method.
+	Stream []json.RawMessage `json:"stream,omitempty"`
+
+	// Text is the response body if it is not JSON.
+	Text string `json:"text,omitempty"`
+}
+
+// goldenFile is the content of a golden file.
+type goldenFile struct {
+	// Request is the request sent.
+	Request GoldenRequest `json:"request"`
+
+	// Response is the response expected.
+	Response GoldenResponse `json:"response"`
+}
+
+// Golden will send a request to the HTTP endpoint and compare the response with a golden file, failing the test if the status, headers or JSON body differ. The request is saved in the golden file so it can be sent again by ReplayGolden. Run the tests with -gohosttest.update to write the golden file instead.
+func (s *Server) Golden(t testing.TB, file string, req GoldenRequest) {
+	t.Helper()
+
+	if *Update {
+		s.writeGolden(t, file, req)
+		return
+	}
+
+	golden := readGolden(t, file)
+	if !reflect.DeepEqual(normalizeJSON(t, golden.Request), normalizeJSON(t, req)) {
+		t.Errorf("request for golden file %v has changed, run with -gohosttest.update to write it again", file)
+		return
+	}
+	s.compareGolden(t, file, golden)
+}
+
+// ReplayGolden will send the request of every golden file matching a pattern (e.g. testdata/golden/*.json) to the HTTP endpoint, each in a subtest, and compare the responses with the golden files. Run the tests with -gohosttest.update to write the responses received to the golden files instead.
+func (s *Server) ReplayGolden(t *testing.T, pattern string) {
+	t.Helper()
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("invalid golden file pattern %q: %v", pattern, err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no golden files match %v", pattern)
+	}
+
+	for _, file := range files {
+		file := file
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		t.Run(name, func(t *testing.T) {
+			golden := readGolden(t, file)
+			if *Update {
+				s.writeGolden(t, file, golden.Request)
+				return
+			}
+			s.compareGolden(t, file, golden)
+		})
+	}
+}
+
+// compareGolden will send the request of a golden file and fail the test if the response differs from it.
+func (s *Server) compareGolden(t testing.TB, file string, golden *goldenFile) {
+	t.Helper()
+
+	got := normalizeJSON(t, s.sendGolden(t, golden.Request))
+	want := normalizeJSON(t, golden.Response)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("response does not match golden file %v, run with -gohosttest.update if the change is expected\nwant: %v\ngot:  %v", file, indentJSON(t, want), indentJSON(t, got))
+	}
+}
+
+// writeGolden will send a request and write it to a golden file with the response received.
+func (s *Server) writeGolden(t testing.TB, file string, req GoldenRequest) {
+	t.Helper()
+
+	golden := &goldenFile{
+		Request:  req,
+		Response: s.sendGolden(t, req),
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(golden); err != nil {
+		t.Fatalf("failed to encode golden file %v: %v", file, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("failed to create directory for golden file %v: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write golden file %v: %v", file, err)
+	}
+}
+
+// sendGolden will send a request to the HTTP endpoint and return the parts of the response that are compared.
+func (s *Server) sendGolden(t testing.TB, req GoldenRequest) GoldenResponse {
+	t.Helper()
+
+	var body io.Reader
+	if len(req.Body) > 0 {
+		body = bytes.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequest(req.Method, s.URL+req.Path, body)
+	if err != nil {
+		t.Fatalf("invalid golden request %v %v: %v", req.Method, req.Path, err)
+	}
+	for k, v := range req.Header {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := s.HTTPClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("failed to send golden request %v %v: %v", req.Method, req.Path, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response to golden request %v %v: %v", req.Method, req.Path, err)
+	}
+
+	got := GoldenResponse{
+		Status: resp.StatusCode,
+		Header: map[string]string{},
+	}
+	for _, k := range append([]string{"Content-Type"}, s.GoldenHeaders...) {
+		if v, ok := resp.Header[http.CanonicalHeaderKey(k)]; ok {
+			got.Header[http.CanonicalHeaderKey(k)] = strings.Join(v, ", ")
+		}
+	}
+
+	values, ok := decodeJSONValues(b)
+	switch {
+	case !ok:
+		got.Text = string(b)
+	case len(values) == 1:
+		got.Body = values[0]
+	case len(values) > 1:
+		got.Stream = values
+	}
+
+	return got
+}
+
+// readGolden will read a golden file.
+func readGolden(t testing.TB, file string) *goldenFile {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -gohosttest.update to write it: %v", err)
+	}
+	golden := &goldenFile{}
+	if err := json.Unmarshal(b, golden); err != nil {
+		t.Fatalf("failed to parse golden file %v: %v", file, err)
+	}
+
+	return golden
+}
+
+// decodeJSONValues returns the JSON values in a body, which has more than one for a stream. False is returned if the body is not JSON.
+func decodeJSONValues(b []byte) ([]json.RawMessage, bool) {
+	values := []json.RawMessage{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		var value json.RawMessage
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			return values, true
+		}
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+}
+
+// normalizeJSON returns a value converted to JSON and back, so values can be compared regardless of formatting and field order.
+func normalizeJSON(t testing.TB, v interface{}) interface{} {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode %T: %v", v, err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		t.Fatalf("failed to decode %T: %v", v, err)
+	}
+
+	return normalized
+}
+
+// indentJSON returns a normalized value as indented JSON, with the keys of objects sorted.
+func indentJSON(t testing.TB, v interface{}) string {
+	t.Helper()
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode %T: %v", v, err)
+	}
+
+	return string(b)
+}
@@ -0,0 +1,75 @@
+package gohosttest
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// errListenerClosed is returned when dialing or accepting on a closed listener.
+var errListenerClosed = errors.New("listener closed")
+
+// pipeListener is an in-memory listener with connections made by net.Pipe. Unlike bufconn, the connections support deadlines, which the HTTP server uses to stop reading when a response is aborted or a connection is hijacked.
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newPipeListener creates an in-memory listener.
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Accept waits for a connection to be dialed.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+// Close stops the listener. Connections already accepted stay open.
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+
+	return nil
+}
+
+// Addr returns the address of the listener.
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// Dial creates a connection to the listener, waiting for it to be accepted.
+func (l *pipeListener) Dial() (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		server.Close()
+		client.Close()
+		return nil, errListenerClosed
+	}
+}
+
+// pipeAddr is the address of a pipe listener.
+type pipeAddr struct{}
+
+// Network returns the name of the network.
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+// String returns the address.
+func (pipeAddr) String() string {
+	return "pipe"
+}
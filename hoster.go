@@ -1,12 +1,20 @@
 package gohost
 
 import (
+	"log"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/eleniums/async"
+	"github.com/golang/protobuf/proto"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
@@ -24,6 +32,24 @@ const (
 
 	// DefaultMaxRecvMsgSize is the default max receive message size, per gRPC
 	DefaultMaxRecvMsgSize = 1024 * 1024 * 4
+
+	// DefaultHealthMethods matches the methods of the gRPC health service, which are never rejected by in-flight limits by default.
+	DefaultHealthMethods = "/grpc.health.v1.Health/*"
+
+	// DefaultCompressionMinSize is the default minimum size of an HTTP response body before it is compressed.
+	DefaultCompressionMinSize = 1024
+
+	// DefaultWebSocketPath is the default path prefix of the WebSocket bridge on the HTTP endpoint.
+	DefaultWebSocketPath = "/ws/"
+
+	// DefaultOpenAPIPath is the default path prefix of the OpenAPI documents on the HTTP endpoint.
+	DefaultOpenAPIPath = "/openapi/"
+
+	// DefaultSSEHeartbeat is the default interval between heartbeat comments on an idle event stream.
+	DefaultSSEHeartbeat = time.Second * 15
+
+	// DefaultReadHeaderTimeout is the default amount of time allowed to read request headers on the HTTP and debug endpoints.
+	DefaultReadHeaderTimeout = time.Second * 10
 )
 
 // GRPCServer is used to register a gRPC server.
@@ -32,37 +58,277 @@ type GRPCServer func(s *grpc.Server)
 // HTTPGateway is used to register a HTTP gateway for forwarding requests to a gRPC endpoint.
 type HTTPGateway func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) (err error)
 
-// Hoster is used to serve gRPC and HTTP endpoints.
+// Hoster is used to serve gRPC and HTTP endpoints. Fields with a config tag can also be set from files, the environment or flags (see LoadConfig).
 type Hoster struct {
 	// GRPCAddr is the endpoint (host and port) on which to host the gRPC service. Default is 127.0.0.1:50051. May be left blank if no gRPC servers have been registered.
-	GRPCAddr string
+	GRPCAddr string `config:"grpc_addr" usage:"host and port to host the gRPC endpoint"`
 
 	// HTTPAddr is the endpoint (host and port) on which to host the HTTP service. Default is 127.0.0.1:9090. May be left blank if no HTTP gateways have been registered.
-	HTTPAddr string
+	HTTPAddr string `config:"http_addr" usage:"host and port to host the HTTP endpoint"`
 
 	// DebugAddr is the endpoint (host and port) on which to host the debug endpoint (/debug/pprof and /debug/vars). Default is 127.0.0.1:6060. May be left blank if EnableDebug is false.
-	DebugAddr string
+	DebugAddr string `config:"debug_addr" usage:"host and port to host the debug endpoint (/debug/pprof and /debug/vars)"`
+
+	// CertFile is the certificate file for use with TLS. May be left blank if using insecure mode. Can be changed by Reload, but TLS cannot be enabled or disabled without a restart.
+	CertFile string `config:"cert_file" reload:"live" usage:"cert file for enabling a TLS connection"`
 
-	// CertFile is the certificate file for use with TLS. May be left blank if using insecure mode.
-	CertFile string
+	// KeyFile is the private key file for use with TLS. May be left blank if using insecure mode. Can be changed by Reload, but TLS cannot be enabled or disabled without a restart.
+	KeyFile string `config:"key_file" reload:"live" usage:"key file for enabling a TLS connection"`
 
-	// KeyFile is the private key file for use with TLS. May be left blank if using insecure mode.
-	KeyFile string
+	// ClientCAFile is a file of PEM encoded certificate authorities used to verify client certificates on the gRPC endpoint. Client certificates are optional, but must be valid if presented. Use with MTLSAuthenticator to identify callers by certificate. May be left blank if client certificates are not used.
+	ClientCAFile string `config:"client_ca_file" usage:"file of certificate authorities used to verify client certificates on the gRPC endpoint"`
 
 	// InsecureSkipVerify will cause verification of the host name during a TLS handshake to be skipped if set to true.
-	InsecureSkipVerify bool
+	InsecureSkipVerify bool `config:"insecure_skip_verify" usage:"true to skip verifying the certificate chain and host name"`
 
 	// HTTPHandler is used to register a handler that can optionally be added to the HTTP endpoint. Leave blank to use default mux.
 	HTTPHandler func(mux *runtime.ServeMux) http.Handler
 
+	// GRPCListener is used by the gRPC endpoint instead of listening on GRPCAddr, such as an in-memory listener in tests (see the gohosttest package). ListenAndServe returns when it is closed.
+	GRPCListener net.Listener
+
+	// HTTPListener is used by the HTTP endpoint instead of listening on HTTPAddr. ListenAndServe returns when it is closed.
+	HTTPListener net.Listener
+
+	// GRPCDialer is used by the HTTP endpoint to connect to the gRPC endpoint at GRPCAddr, such as to reach an in-memory GRPCListener. Leave nil to connect over TCP.
+	GRPCDialer func(addr string, timeout time.Duration) (net.Conn, error)
+
+	// EnableDynamicGateway will add HTTP gateway routes for the google.api.http annotations of the registered gRPC methods when the HTTP endpoint starts, so no generated gateway code (*.pb.gw.go) is needed. Unary and server-streaming methods are supported. Routes added with RegisterHTTPGateway take precedence over dynamic routes with the same pattern.
+	EnableDynamicGateway bool `config:"enable_dynamic_gateway" usage:"true to build HTTP gateway routes from the http annotations of the gRPC methods"`
+
+	// DescriptorSetFile is the path of a compiled FileDescriptorSet (e.g. protoc --include_imports --descriptor_set_out) to read the http annotations of the dynamic gateway, and the services of the mock server, from. Message types of mocked methods that are not linked into the program are read from the set, so compile it with its imports. Leave blank to use the descriptors registered by the generated code of the services.
+	DescriptorSetFile string `config:"descriptor_set_file" usage:"path of a compiled FileDescriptorSet with the http annotations for the dynamic gateway and the services for the mock server"`
+
+	// EnableMock will serve every service in DescriptorSetFile on the gRPC endpoint, and on the HTTP endpoint through the dynamic gateway, with canned responses instead of an implementation. Responses come from the first fixture in MockFixturesFile matching the method and request, or are empty messages if none match. The descriptor set alone is enough, since messages of types that are not linked into the program are read and written with its descriptors. Services registered with RegisterGRPCServer are served by their implementation instead.
+	EnableMock bool `config:"enable_mock" usage:"true to serve the services in the descriptor set with canned responses"`
+
+	// MockFixturesFile is a YAML, JSON or TOML file of canned responses for the mock server, matched by method and request fields. Leave blank to respond with empty messages.
+	MockFixturesFile string `config:"mock_fixtures_file" usage:"YAML, JSON or TOML file of canned responses for the mock server"`
+
+	// MockLatency is added to every call to the mock server, before the latency of the fixture. Leave as zero to respond immediately.
+	MockLatency time.Duration `config:"mock_latency" usage:"latency added to every call to the mock server"`
+
+	// MockErrorPercent is the percentage (0 to 100) of calls to the mock server that fail with Unavailable, to test how clients handle errors. Leave as zero to not inject errors.
+	MockErrorPercent int `config:"mock_error_percent" usage:"percentage of calls to the mock server that fail with Unavailable"`
+
+	// Authenticators are used to identify the caller of every gRPC method, including requests forwarded by the HTTP gateway. They are tried in order and the first to find credentials it understands decides the result. The principal is attached to the context (see PrincipalFromContext). Leave empty to disable authentication.
+	Authenticators []Authenticator
+
+	// UnauthenticatedMethods is a list of full gRPC method names (e.g. /grpc.health.v1.Health/Check) that are allowed without credentials when Authenticators is set. Entries ending in * match any method with that prefix.
+	UnauthenticatedMethods []string `config:"unauthenticated_methods" usage:"comma separated list of gRPC methods allowed without credentials (a trailing * matches a prefix)"`
+
+	// PolicyFile is a YAML, JSON or TOML file of authorization policies for gRPC methods and HTTP routes, evaluated after authentication. Calls that are not allowed fail with PermissionDenied. Leave blank to disable authorization. Can be changed by Reload, and the file is read again on every reload.
+	PolicyFile string `config:"policy_file" reload:"live" usage:"YAML, JSON or TOML file of authorization policies for gRPC methods and HTTP routes"`
+
+	// AuditLogFile is a file that authorization decisions are appended to as JSON lines. Leave blank to only log denied calls to the standard logger.
+	AuditLogFile string `config:"audit_log_file" usage:"file to append authorization decisions to as JSON lines"`
+
+	// RateLimits are token bucket limits on gRPC methods and HTTP routes. Every matching limit must allow a request. Calls that exceed a limit fail with ResourceExhausted and RetryInfo, or 429 Too Many Requests and a Retry-After header on the HTTP endpoint. Leave empty to disable rate limiting. Can be changed by Reload, and set in a config file as a list of objects with method, route, key, rate and burst keys, or as a JSON array in an environment variable or flag.
+	RateLimits []RateLimit `config:"rate_limits" reload:"live" usage:"JSON array of rate limits with method, route, key, rate and burst keys"`
+
+	// RateLimitStore holds the token buckets for RateLimits. Set it to share limits between instances of a service. Leave blank to keep buckets in memory.
+	RateLimitStore RateLimitStore
+
+	// MaxInFlight is the maximum number of in-flight gRPC calls, including calls forwarded by the HTTP gateway. Calls over the limit fail immediately with Unavailable, or 503 Service Unavailable on the HTTP endpoint. Leave as zero for no limit.
+	MaxInFlight int `config:"max_in_flight" usage:"maximum number of in-flight gRPC calls before new calls are rejected (0 for no limit)"`
+
+	// ConcurrencyLimits are limits on the number of in-flight calls to specific gRPC methods. Calls over a limit are rejected like calls over MaxInFlight.
+	ConcurrencyLimits []ConcurrencyLimit
+
+	// AdaptiveLatencyTarget enables adaptive limiting when set. The in-flight limit is lowered when unary calls take longer than the target and raised back towards MaxInFlight when they do not. Requires MaxInFlight. Leave as zero to use a fixed limit.
+	AdaptiveLatencyTarget time.Duration `config:"adaptive_latency_target" usage:"latency above which the in-flight limit is lowered (0 for a fixed limit)"`
+
+	// CriticalMethods is a list of full gRPC method names that are never rejected by in-flight limits. Entries ending in * match any method with that prefix. Other calls can only be marked low priority with the x-priority header or metadata. Default is the gRPC health service.
+	CriticalMethods []string `config:"critical_methods" usage:"comma separated list of gRPC methods that are never rejected by in-flight limits (a trailing * matches a prefix)"`
+
+	// DefaultDeadline is the deadline given to gRPC calls that do not have one, including calls forwarded by the HTTP gateway without a timeout header. Leave as zero for no default.
+	DefaultDeadline time.Duration `config:"default_deadline" usage:"deadline for gRPC calls that do not have one (0 for no default)"`
+
+	// MaxDeadline is the longest deadline allowed for gRPC calls. Longer deadlines set by clients are shortened. Leave as zero for no limit.
+	MaxDeadline time.Duration `config:"max_deadline" usage:"longest deadline allowed for gRPC calls (0 for no limit)"`
+
+	// MethodDeadlines override DefaultDeadline and MaxDeadline for specific gRPC methods. The first matching entry is used.
+	MethodDeadlines []MethodDeadline
+
+	// EnableCompression will enable gzip compression on the gRPC and HTTP endpoints. gRPC clients choose whether to compress each call and responses use the same compressor. HTTP responses are compressed if the client accepts it and request bodies with a Content-Encoding are decompressed.
+	EnableCompression bool `config:"enable_compression" usage:"true to enable gzip compression on the gRPC and HTTP endpoints"`
+
+	// CompressionLevel is the gzip compression level of HTTP responses, from 1 (fastest) to 9 (smallest). gRPC messages always use the gzip default. Leave as zero to use the gzip default.
+	CompressionLevel int `config:"compression_level" usage:"gzip compression level from 1 to 9 (0 for gzip default)"`
+
+	// CompressionMinSize is the minimum size of an HTTP response body in bytes before it is compressed. Default is 1024.
+	CompressionMinSize int `config:"compression_min_size" usage:"minimum size of an HTTP response body before it is compressed"`
+
+	// CompressionContentTypes are the media types of HTTP responses that can be compressed. Entries ending in * match any media type with that prefix. Default is application/json and text/*.
+	CompressionContentTypes []string `config:"compression_content_types" usage:"comma separated list of HTTP response media types to compress (a trailing * matches a prefix)"`
+
+	// Compressors are additional codecs used when EnableCompression is true, after gzip. Their names are used as HTTP content codings (e.g. deflate or br). To make them available to gRPC clients, register them with encoding.RegisterCompressor in an init function, since gRPC registration is process-wide and not safe once servers are running.
+	Compressors []encoding.Compressor
+
+	// EnableWebSocket will enable a WebSocket bridge on the HTTP endpoint for the registered gRPC methods, including client and bidirectional streaming methods the HTTP gateway cannot serve. Connect to WebSocketPath followed by the full method name (e.g. /ws/test.TestService/Stream). Each message is sent as a JSON text frame and the final status of the call is sent in the close frame.
+	EnableWebSocket bool `config:"enable_websocket" usage:"true to enable the WebSocket bridge for gRPC methods on the HTTP endpoint"`
+
+	// WebSocketPath is the path prefix of the WebSocket bridge on the HTTP endpoint. Default is /ws/.
+	WebSocketPath string `config:"websocket_path" usage:"path prefix of the WebSocket bridge on the HTTP endpoint"`
+
+	// WebSocketOrigins is a list of origins (e.g. https://example.com) allowed to open WebSocket connections from a browser. Entries ending in * match any origin with that prefix. Connections without an Origin header are always allowed. Leave empty to only allow the origin of the HTTP endpoint itself. Can be changed by Reload.
+	WebSocketOrigins []string `config:"websocket_origins" reload:"live" usage:"comma separated list of origins allowed to open WebSocket connections (a trailing * matches a prefix)"`
+
+	// EnableGRPCWeb will serve gRPC-Web requests (application/grpc-web and application/grpc-web-text) for the registered gRPC methods on the HTTP endpoint, alongside the HTTP gateway routes, so browser clients can call the services directly. Requests are sent to the full method name (e.g. /test.TestService/Echo) and headers are forwarded as metadata. Messages of client-streaming methods must all be sent in the request body.
+	EnableGRPCWeb bool `config:"enable_grpc_web" usage:"true to serve gRPC-Web requests for gRPC methods on the HTTP endpoint"`
+
+	// GRPCWebOrigins is a list of origins (e.g. https://example.com) allowed to make cross-origin gRPC-Web requests from a browser, including CORS preflight requests. Entries ending in * match any origin with that prefix. Requests without an Origin header are always allowed. Leave empty to only allow the origin of the HTTP endpoint itself. Can be changed by Reload.
+	GRPCWebOrigins []string `config:"grpc_web_origins" reload:"live" usage:"comma separated list of origins allowed to make gRPC-Web requests (a trailing * matches a prefix)"`
+
+	// EnableSSE will send HTTP gateway responses as Server-Sent Events (text/event-stream) to requests that accept them, instead of JSON. Each message of a server-streaming method is sent as a message event when it arrives, and an error is sent as an error event with its gRPC status code and message.
+	EnableSSE bool `config:"enable_sse" usage:"true to send HTTP responses as Server-Sent Events to requests that accept text/event-stream"`
+
+	// SSEHeartbeat is how often a comment is sent on an event stream to keep idle connections open. Default is 15 seconds. Set to zero to disable heartbeats.
+	SSEHeartbeat time.Duration `config:"sse_heartbeat" usage:"interval between heartbeat comments on an event stream (0 to disable)"`
+
+	// SSEEventID returns the ID of the event for a message, which clients send back in the Last-Event-ID header when they reconnect. Leave blank to number the messages of each stream from 1.
+	SSEEventID func(ctx context.Context, msg proto.Message) string
+
+	// SSEResume is called when a client reconnects with a Last-Event-ID header and returns metadata to add to the gRPC call, so the service can resume the stream after that event. Return an error to reject the request with an error event. Leave blank to forward the header as last-event-id metadata.
+	SSEResume func(ctx context.Context, lastEventID string) (metadata.MD, error)
+
+	// PanicHandler is called when a panic is recovered on the gRPC or HTTP endpoint, after it has been counted and logged with Logger. Panics are always recovered and converted to an Internal error or a 500 response. Leave blank to only count and log panics.
+	PanicHandler PanicHandler
+
+	// Logger is used to log what happens in the background and is not returned to a caller, such as recovered panics, configuration reloads, denied calls and failures to write recordings or audit events. These are also counted on the debug endpoint at /debug/vars. Leave blank to log nothing.
+	Logger *log.Logger
+
+	// EnableFaults will inject the Faults into calls, to test how clients handle errors, delays, aborted streams and truncated responses. Fault injection can also be turned on and off, and the faults changed, while running with the /debug/faults route of the debug endpoint. Disabled by default.
+	EnableFaults bool `config:"enable_faults" usage:"true to inject faults into calls to test client resilience"`
+
+	// Faults are the faults injected into calls to gRPC methods and HTTP routes when EnableFaults is true. The first fault matching the method, and the first matching the route, are used.
+	Faults []Fault
+
+	// RecordingFile is a file that calls to the gRPC and HTTP endpoints are recorded to as JSON lines, with their metadata, messages and status, so they can be replayed against another instance (see Replayer). Calls forwarded by the HTTP endpoint are recorded as HTTP requests. Leave blank to disable recording.
+	RecordingFile string `config:"recording_file" usage:"file to record calls to the gRPC and HTTP endpoints to as JSON lines"`
+
+	// RecordingMaxSize is the size of the recording file in bytes before it is rotated. Default is 100 MB. Set to zero to never rotate the file.
+	RecordingMaxSize int `config:"recording_max_size" usage:"size of the recording file in bytes before it is rotated (0 to never rotate)"`
+
+	// RecordingMaxFiles is the number of rotated recording files kept, named after RecordingFile with the suffixes .1 (newest) to .N (oldest). Default is 5.
+	RecordingMaxFiles int `config:"recording_max_files" usage:"number of rotated recording files to keep"`
+
+	// RecordingRedact is a list of metadata keys, HTTP headers and message field names to redact from recorded calls, ignoring case. Entries ending in * match any name with that prefix. Metadata and headers are recorded with the value REDACTED and fields are left out of messages. Default is authorization, cookie and x-api-key.
+	RecordingRedact []string `config:"recording_redact" usage:"comma separated list of metadata keys, headers and message fields to redact from recorded calls (a trailing * matches a prefix)"`
+
+	// ShadowAddr is the endpoint (host and port) of a secondary gRPC service that a percentage of unary calls, including calls forwarded by the HTTP gateway, are mirrored to, such as a new version during a migration. Mirrored calls are sent in the background after the call has been handled, and their responses are discarded after being compared. Leave blank to disable mirroring.
+	ShadowAddr string `config:"shadow_addr" usage:"host and port of a gRPC endpoint to mirror unary calls to"`
+
+	// ShadowInsecure will connect to the shadow endpoint without TLS if set to true.
+	ShadowInsecure bool `config:"shadow_insecure" usage:"true to connect to the shadow endpoint without TLS"`
+
+	// ShadowPercent is the percentage (0 to 100) of unary calls mirrored to the shadow endpoint. Default is 100.
+	ShadowPercent int `config:"shadow_percent" usage:"percentage of unary calls to mirror to the shadow endpoint"`
+
+	// ShadowMethods is a list of full gRPC method names to mirror, such as methods without side effects. Entries ending in * match any method with that prefix. Leave empty to mirror every unary method.
+	ShadowMethods []string `config:"shadow_methods" usage:"comma separated list of gRPC methods to mirror to the shadow endpoint (a trailing * matches a prefix)"`
+
+	// ShadowTimeout is the deadline of calls mirrored to the shadow endpoint. Default is 5 seconds.
+	ShadowTimeout time.Duration `config:"shadow_timeout" usage:"deadline of calls mirrored to the shadow endpoint"`
+
+	// ShadowMaxInFlight is the maximum number of calls being mirrored at once. Calls over the limit are not mirrored and are counted as dropped, so a slow shadow endpoint never builds up work on this service. Default is 100. Set to zero for no limit.
+	ShadowMaxInFlight int `config:"shadow_max_in_flight" usage:"maximum number of calls mirrored to the shadow endpoint at once (0 for no limit)"`
+
+	// ShadowHandler is called with the result of each mirrored call, such as to log or export mismatches. It is called in the background, after the result has been counted on the debug endpoint at /debug/shadow. Leave blank to only count results.
+	ShadowHandler ShadowHandler
+
+	// EnableReflection will register the gRPC server reflection service, so tools such as grpc_cli and gohost call can find the methods and message types of the service without its proto files.
+	EnableReflection bool `config:"enable_reflection" usage:"true to register the gRPC server reflection service"`
+
+	// EnableHealth will register the gRPC health service (grpc.health.v1.Health), which reports the server ("") and every registered service as serving. Health checks are never rejected by in-flight limits by default (see CriticalMethods).
+	EnableHealth bool `config:"enable_health" usage:"true to register the gRPC health service"`
+
+	// OpenAPIPath is the path prefix of the OpenAPI documents added with RegisterOpenAPIDoc on the HTTP endpoint. Each document is served at OpenAPIPath followed by its name and .json (e.g. /openapi/hello.HelloService.json), and OpenAPIPath itself lists the documents. Default is /openapi/.
+	OpenAPIPath string `config:"openapi_path" usage:"path prefix of the OpenAPI documents on the HTTP endpoint"`
+
 	// EnableDebug will enable the debug endpoint (/debug/pprof and /debug/vars). The debug endpoint address is defined by DebugAddr.
-	EnableDebug bool
+	EnableDebug bool `config:"enable_debug" usage:"true to enable the debug endpoint (/debug/pprof and /debug/vars)"`
+
+	// MaxSendMsgSize will change the size of the message that can be sent from the service. Can be changed by Reload up to ReloadMaxMsgSizeCeiling if EnableReload is true.
+	MaxSendMsgSize int `config:"max_send_msg_size" reload:"live" usage:"max message size the service is allowed to send"`
+
+	// MaxRecvMsgSize will change the size of the message that can be received by the service. Can be changed by Reload up to ReloadMaxMsgSizeCeiling if EnableReload is true.
+	MaxRecvMsgSize int `config:"max_recv_msg_size" reload:"live" usage:"max message size the service is allowed to receive"`
+
+	// KeepaliveTime is the duration of inactivity after which the server pings a client to see if the connection is still alive. Leave as zero to use the gRPC default (2 hours).
+	KeepaliveTime time.Duration `config:"keepalive_time" usage:"duration of inactivity after which the server pings a client (0 for gRPC default)"`
+
+	// KeepaliveTimeout is how long the server waits for a response to a keepalive ping before closing the connection. Leave as zero to use the gRPC default (20 seconds).
+	KeepaliveTimeout time.Duration `config:"keepalive_timeout" usage:"how long to wait for a keepalive ping response before closing the connection (0 for gRPC default)"`
+
+	// KeepaliveMinTime is the minimum time clients should wait between keepalive pings. Clients that ping more often have their connection closed. Leave as zero to use the gRPC default (5 minutes).
+	KeepaliveMinTime time.Duration `config:"keepalive_min_time" usage:"minimum time clients must wait between keepalive pings (0 for gRPC default)"`
+
+	// KeepalivePermitWithoutStream will allow clients to send keepalive pings when there are no active streams if set to true.
+	KeepalivePermitWithoutStream bool `config:"keepalive_permit_without_stream" usage:"true to allow client keepalive pings when there are no active streams"`
+
+	// MaxConnectionIdle is how long a connection may be idle before it is closed with a GoAway. Leave as zero for no limit.
+	MaxConnectionIdle time.Duration `config:"max_connection_idle" usage:"how long a connection may be idle before it is closed (0 for no limit)"`
+
+	// MaxConnectionAge is the maximum time a connection may exist before it is closed with a GoAway. Leave as zero for no limit.
+	MaxConnectionAge time.Duration `config:"max_connection_age" usage:"maximum time a connection may exist before it is closed (0 for no limit)"`
+
+	// MaxConnectionAgeGrace is how long pending calls are given to complete after MaxConnectionAge is reached. Leave as zero for no limit.
+	MaxConnectionAgeGrace time.Duration `config:"max_connection_age_grace" usage:"how long pending calls may run after max connection age is reached (0 for no limit)"`
+
+	// MaxConcurrentStreams is the maximum number of concurrent streams allowed on each connection. Leave as zero for no limit.
+	MaxConcurrentStreams int `config:"max_concurrent_streams" usage:"maximum number of concurrent streams per connection (0 for no limit)"`
 
-	// MaxSendMsgSize will change the size of the message that can be sent from the service.
-	MaxSendMsgSize int
+	// InitialWindowSize is the initial flow control window size of each stream in bytes. Must be at least 65535. Leave as zero to use the gRPC default.
+	InitialWindowSize int `config:"initial_window_size" usage:"initial flow control window size of each stream in bytes (0 for gRPC default)"`
 
-	// MaxRecvMsgSize will change the size of the message that can be received by the service.
-	MaxRecvMsgSize int
+	// InitialConnWindowSize is the initial flow control window size of each connection in bytes. Must be at least 65535. Leave as zero to use the gRPC default.
+	InitialConnWindowSize int `config:"initial_conn_window_size" usage:"initial flow control window size of each connection in bytes (0 for gRPC default)"`
+
+	// ConnectionTimeout is how long new connections have to complete the handshake. Leave as zero to use the gRPC default (120 seconds).
+	ConnectionTimeout time.Duration `config:"connection_timeout" usage:"how long new connections have to complete the handshake (0 for gRPC default)"`
+
+	// HTTPReadTimeout is the maximum duration for reading an entire request, including the body, on the HTTP endpoint. It is cleared once a WebSocket connection or Server-Sent Events stream starts, so streams are not cut off. Leave as zero for no timeout.
+	HTTPReadTimeout time.Duration `config:"http_read_timeout" usage:"maximum duration for reading an entire request on the HTTP endpoint (0 for no timeout)"`
+
+	// HTTPReadHeaderTimeout is the maximum duration for reading request headers on the HTTP endpoint. Default is 10 seconds. Set to zero to use HTTPReadTimeout instead.
+	HTTPReadHeaderTimeout time.Duration `config:"http_read_header_timeout" usage:"maximum duration for reading request headers on the HTTP endpoint (0 to use http-read-timeout)"`
+
+	// HTTPWriteTimeout is the maximum duration before timing out writes of a response on the HTTP endpoint. It is cleared once a WebSocket connection or Server-Sent Events stream starts, so streams are not cut off. Leave as zero for no timeout.
+	HTTPWriteTimeout time.Duration `config:"http_write_timeout" usage:"maximum duration for writing a response on the HTTP endpoint (0 for no timeout)"`
+
+	// HTTPIdleTimeout is the maximum amount of time to wait for the next request on a keep-alive connection to the HTTP endpoint. Leave as zero to use HTTPReadTimeout instead.
+	HTTPIdleTimeout time.Duration `config:"http_idle_timeout" usage:"maximum time to wait for the next request on a keep-alive connection to the HTTP endpoint (0 to use http-read-timeout)"`
+
+	// HTTPMaxHeaderBytes is the maximum size of request headers on the HTTP endpoint. Leave as zero to use the net/http default (1 MB).
+	HTTPMaxHeaderBytes int `config:"http_max_header_bytes" usage:"maximum size of request headers on the HTTP endpoint (0 for net/http default)"`
+
+	// MaxRequestBodySize is the maximum size of a request body on the HTTP endpoint. Larger requests are rejected with 413 Request Entity Too Large before reaching the gateway. Leave as zero to use MaxRecvMsgSize. Can be changed by Reload.
+	MaxRequestBodySize int `config:"max_request_body_size" reload:"live" usage:"maximum size of a request body on the HTTP endpoint (0 to use max-recv-msg-size)"`
+
+	// DebugReadTimeout is the maximum duration for reading an entire request on the debug endpoint. Leave as zero for no timeout.
+	DebugReadTimeout time.Duration `config:"debug_read_timeout" usage:"maximum duration for reading an entire request on the debug endpoint (0 for no timeout)"`
+
+	// DebugReadHeaderTimeout is the maximum duration for reading request headers on the debug endpoint. Default is 10 seconds. Set to zero to use DebugReadTimeout instead.
+	DebugReadHeaderTimeout time.Duration `config:"debug_read_header_timeout" usage:"maximum duration for reading request headers on the debug endpoint (0 to use debug-read-timeout)"`
+
+	// DebugWriteTimeout is the maximum duration before timing out writes of a response on the debug endpoint. Must be longer than any CPU profile or trace requested from /debug/pprof. Leave as zero for no timeout.
+	DebugWriteTimeout time.Duration `config:"debug_write_timeout" usage:"maximum duration for writing a response on the debug endpoint (0 for no timeout)"`
+
+	// DebugIdleTimeout is the maximum amount of time to wait for the next request on a keep-alive connection to the debug endpoint. Leave as zero to use DebugReadTimeout instead.
+	DebugIdleTimeout time.Duration `config:"debug_idle_timeout" usage:"maximum time to wait for the next request on a keep-alive connection to the debug endpoint (0 to use debug-read-timeout)"`
+
+	// DebugMaxHeaderBytes is the maximum size of request headers on the debug endpoint. Leave as zero to use the net/http default (1 MB).
+	DebugMaxHeaderBytes int `config:"debug_max_header_bytes" usage:"maximum size of request headers on the debug endpoint (0 for net/http default)"`
+
+	// EnableReload will reload the configuration passed to LoadConfig when the process receives SIGHUP and, if ReloadInterval is set, when the config file changes. Message size limits are enforced by interceptors under a fixed transport limit of ReloadMaxMsgSizeCeiling so they can be changed while running.
+	EnableReload bool `config:"enable_reload" usage:"true to reload configuration on SIGHUP or when the config file changes"`
+
+	// ReloadInterval is how often to check the config file for changes when EnableReload is true. Leave as zero to only reload on SIGHUP.
+	ReloadInterval time.Duration `config:"reload_interval" usage:"how often to check the config file for changes (0 to only reload on SIGHUP)"`
+
+	// ReloadMaxMsgSizeCeiling is the largest message size the gRPC transport will buffer when EnableReload is true. Reload cannot raise MaxSendMsgSize or MaxRecvMsgSize above it. Leave as zero to use the message sizes at startup, so they can only be lowered without a restart.
+	ReloadMaxMsgSizeCeiling int `config:"reload_max_msg_size_ceiling" usage:"largest message size that max-send-msg-size and max-recv-msg-size can be reloaded to (0 to use the sizes at startup)"`
 
 	// UnaryInterceptors is an array of unary interceptors to be used by the service. They will be executed in order, from first to last.
 	UnaryInterceptors []grpc.UnaryServerInterceptor
@@ -75,6 +341,66 @@ type Hoster struct {
 
 	// httpGateways is an array of HTTP gateways to be hosted.
 	httpGateways []HTTPGateway
+
+	// healthServices are additional service names reported as serving by the health service.
+	healthServices []string
+
+	// openAPIDocs contains the OpenAPI documents served on the HTTP endpoint, by name.
+	openAPIDocs map[string][]byte
+
+	// configSource contains the sources passed to LoadConfig, which are used again by Reload.
+	configSource *configSource
+
+	// mu guards configuration fields while a reload is in progress.
+	mu sync.RWMutex
+
+	// live contains a *liveConfig with the settings used by running endpoints.
+	live atomic.Value
+
+	// faults contains a *faultState with the fault injection settings in use.
+	faults atomic.Value
+
+	// grpcServer is the gRPC server with the gRPC servers registered.
+	grpcServer *grpc.Server
+
+	// methods contains the methods registered with the gRPC server, by full method name.
+	methods map[string]*methodDesc
+
+	// httpRoutes contains the routes of the dynamic gateway.
+	httpRoutes []*httpRoute
+
+	// httpStreams tracks the connections of the HTTP endpoint, if timeouts need to be cleared for long-lived streams.
+	httpStreams *streamListener
+
+	// mock is the mock server, if EnableMock is set.
+	mock *mockServer
+
+	// gatewayToken is sent by the HTTP gateway with each call to prove the call came from it.
+	gatewayToken string
+
+	// rateLimitStore is the store used for rate limits, which is RateLimitStore or an in-memory store.
+	rateLimitStore RateLimitStore
+
+	// shedder tracks in-flight calls, if any in-flight limit is set.
+	shedder *loadShedder
+
+	// auditLog is the open audit log file, if AuditLogFile is set.
+	auditLog *auditLog
+
+	// recorder is the open recording file, if RecordingFile is set.
+	recorder *recorder
+
+	// shadow mirrors calls to the shadow endpoint, if ShadowAddr is set.
+	shadow *shadowMirror
+
+	// maxSendMsgSizeCeiling is the max send message size of the gRPC transport when EnableReload is true.
+	maxSendMsgSizeCeiling int
+
+	// maxRecvMsgSizeCeiling is the max receive message size of the gRPC transport when EnableReload is true.
+	maxRecvMsgSizeCeiling int
+
+	// restartRequired contains the config keys that changed on the last reload but could not be applied.
+	restartRequired []string
 }
 
 // NewHoster creates a new hoster instance with defaults set.
@@ -85,9 +411,41 @@ func NewHoster() *Hoster {
 		DebugAddr:      DefaultDebugAddr,
 		MaxSendMsgSize: DefaultMaxSendMsgSize,
 		MaxRecvMsgSize: DefaultMaxRecvMsgSize,
+
+		HTTPReadHeaderTimeout:  DefaultReadHeaderTimeout,
+		DebugReadHeaderTimeout: DefaultReadHeaderTimeout,
+
+		CriticalMethods: []string{DefaultHealthMethods},
+
+		CompressionMinSize:      DefaultCompressionMinSize,
+		CompressionContentTypes: []string{"application/json", "text/*"},
+
+		WebSocketPath: DefaultWebSocketPath,
+
+		OpenAPIPath: DefaultOpenAPIPath,
+
+		SSEHeartbeat: DefaultSSEHeartbeat,
+
+		RecordingMaxSize:  DefaultRecordingMaxSize,
+		RecordingMaxFiles: DefaultRecordingMaxFiles,
+		RecordingRedact:   []string{"authorization", "cookie", APIKeyHeader},
+
+		ShadowPercent:     100,
+		ShadowTimeout:     DefaultShadowTimeout,
+		ShadowMaxInFlight: DefaultShadowMaxInFlight,
 	}
 }
 
+// hasGRPCEndpoint returns true if anything is served on the gRPC endpoint.
+func (h *Hoster) hasGRPCEndpoint() bool {
+	return len(h.grpcServers) > 0 || h.EnableMock
+}
+
+// hasHTTPEndpoint returns true if anything is served on the HTTP endpoint.
+func (h *Hoster) hasHTTPEndpoint() bool {
+	return len(h.httpGateways) > 0 || h.EnableDynamicGateway || h.EnableMock || h.EnableWebSocket || h.EnableGRPCWeb
+}
+
 // RegisterGRPCServer will add a function for registering a gRPC server. The function is invoked when ListenAndServe is called.
 func (h *Hoster) RegisterGRPCServer(servers ...GRPCServer) {
 	h.grpcServers = append(h.grpcServers, servers...)
@@ -98,8 +456,122 @@ func (h *Hoster) RegisterHTTPGateway(gateways ...HTTPGateway) {
 	h.httpGateways = append(h.httpGateways, gateways...)
 }
 
-// ListenAndServe creates and starts the server.
+// RegisterHealthService will add names to be reported as serving by the health service when EnableHealth is true, in addition to the registered gRPC services.
+func (h *Hoster) RegisterHealthService(names ...string) {
+	h.healthServices = append(h.healthServices, names...)
+}
+
+// ListenAndServe validates the configuration, then creates and starts the server. No endpoints are started if validation fails.
 func (h *Hoster) ListenAndServe() error {
+	// validate configuration before binding anything
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
+	// load settings that may change while running
+	if err := h.initLive(); err != nil {
+		return err
+	}
+	h.initFaults()
+
+	// create a token for the HTTP gateway to identify itself to the gRPC endpoint
+	token, err := newGatewayToken()
+	if err != nil {
+		return err
+	}
+	h.gatewayToken = token
+
+	// track in-flight calls if there are limits
+	h.shedder = h.newLoadShedder()
+
+	// keep rate limit buckets in memory unless a shared store is set
+	h.rateLimitStore = h.RateLimitStore
+	if h.rateLimitStore == nil {
+		h.rateLimitStore = NewMemoryRateLimitStore()
+	}
+
+	// open the audit log for authorization decisions
+	audit, err := h.openAuditLog()
+	if err != nil {
+		return err
+	}
+	if audit != nil {
+		h.auditLog = audit
+		defer audit.close()
+	}
+
+	// open the recording file for calls to replay
+	rec, err := h.openRecorder()
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		h.recorder = rec
+		defer rec.close()
+	}
+
+	// connect to the shadow endpoint to mirror calls to
+	shadow, err := h.newShadowMirror()
+	if err != nil {
+		return err
+	}
+	if shadow != nil {
+		h.shadow = shadow
+		defer shadow.close()
+	}
+
+	// create the gRPC server so the HTTP endpoint knows the registered methods, and listen before the HTTP endpoint connects to it
+	var grpcListener net.Listener
+	if h.hasGRPCEndpoint() {
+		if h.EnableMock {
+			h.mock, err = h.newMockServer()
+			if err != nil {
+				return err
+			}
+		}
+
+		server, err := h.newGRPCServer()
+		if err != nil {
+			return err
+		}
+		h.grpcServer = server
+		h.methods = registeredMethods(server)
+
+		// add the mocked methods, which have the http annotations of the descriptor set already
+		if h.mock != nil {
+			for name, method := range h.mock.methods {
+				if _, ok := h.methods[name]; !ok {
+					h.methods[name] = method
+				}
+			}
+		}
+
+		// build the dynamic gateway from the http annotations of the methods
+		if h.EnableDynamicGateway || h.EnableMock {
+			if h.DescriptorSetFile != "" {
+				if err := applyDescriptorSet(h.methods, h.DescriptorSetFile); err != nil {
+					return err
+				}
+			}
+			h.httpRoutes, err = newHTTPRoutes(h.methods)
+			if err != nil {
+				return err
+			}
+		}
+
+		grpcListener, err = h.listenGRPC()
+		if err != nil {
+			return err
+		}
+	}
+
+	// watch for configuration changes
+	if h.EnableReload {
+		done := make(chan struct{})
+		defer close(done)
+		go h.watchConfig(done)
+	}
+
 	tasks := []async.Task{}
 
 	// serve debug endpoint
@@ -110,16 +582,16 @@ func (h *Hoster) ListenAndServe() error {
 	}
 
 	// serve HTTP endpoint
-	if len(h.httpGateways) > 0 {
+	if h.hasHTTPEndpoint() {
 		tasks = append(tasks, func() error {
 			return h.serveHTTP()
 		})
 	}
 
 	// serve gRPC endpoint
-	if len(h.grpcServers) > 0 {
+	if h.hasGRPCEndpoint() {
 		tasks = append(tasks, func() error {
-			return h.serveGRPC()
+			return h.serveGRPC(grpcListener)
 		})
 	}
 
@@ -0,0 +1,176 @@
+package gohost
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHeader is the HTTP header and gRPC metadata key used to send a static API key.
+const APIKeyHeader = "x-api-key"
+
+// ErrNoCredentials is returned by an Authenticator when a request does not contain credentials it understands, so the next authenticator should be tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	// Subject is the identity of the caller, such as the JWT subject, the API key name or the client certificate common name.
+	Subject string
+
+	// Method is the name of the authentication method that identified the caller (jwt, apikey or mtls).
+	Method string
+
+	// Roles are the roles granted to the caller.
+	Roles []string
+
+	// Scopes are the OAuth scopes granted to the caller.
+	Scopes []string
+
+	// Claims contains every claim in the token when authenticated by JWT.
+	Claims map[string]interface{}
+}
+
+// Authenticator is used to identify the caller of a gRPC method. Requests forwarded by the HTTP gateway are also authenticated this way, with the Authorization and x-api-key headers forwarded as metadata.
+type Authenticator interface {
+	// Authenticate returns the principal for the caller, ErrNoCredentials if the request does not contain credentials this authenticator understands, or any other error to reject the request.
+	Authenticate(ctx context.Context, md metadata.MD) (*Principal, error)
+}
+
+// principalKey is the context key for the authenticated principal.
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal attached to the context by authentication, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ContextWithPrincipal returns a copy of ctx with the principal attached. It is useful for testing handlers that call PrincipalFromContext.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// APIKeyAuthenticator authenticates callers with static API keys sent in the x-api-key header or metadata.
+type APIKeyAuthenticator struct {
+	// Keys maps each valid API key to the principal it identifies.
+	Keys map[string]Principal
+}
+
+// Authenticate returns the principal for the API key in the request.
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	values := md.Get(APIKeyHeader)
+	if len(values) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	// compare every key in constant time so timing does not reveal valid keys
+	var match *Principal
+	for key, p := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(values[0])) == 1 {
+			principal := p
+			match = &principal
+		}
+	}
+	if match == nil {
+		return nil, errors.New("invalid API key")
+	}
+
+	match.Method = "apikey"
+	return match, nil
+}
+
+// MTLSAuthenticator authenticates callers by the verified client certificate of a direct TLS connection to the gRPC endpoint. ClientCAFile must be set on the hoster so client certificates are verified. The subject is the common name of the certificate.
+type MTLSAuthenticator struct{}
+
+// Authenticate returns the principal for the verified client certificate of the connection.
+func (a MTLSAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	return &Principal{
+		Subject: cert.Subject.CommonName,
+		Method:  "mtls",
+	}, nil
+}
+
+// authenticate will identify the caller with each authenticator in order and attach the principal to the context. Methods in UnauthenticatedMethods are allowed through without a principal.
+func (h *Hoster) authenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authenticator := range h.Authenticators {
+		p, err := authenticator.Authenticate(ctx, md)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			if h.isUnauthenticatedMethod(method) {
+				return ctx, nil
+			}
+			return nil, status.Errorf(codes.Unauthenticated, "authentication failed: %v", err)
+		}
+
+		return ContextWithPrincipal(ctx, p), nil
+	}
+
+	if h.isUnauthenticatedMethod(method) {
+		return ctx, nil
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+// isUnauthenticatedMethod returns true if the full method name matches an entry in UnauthenticatedMethods. Entries ending in * match any method with that prefix.
+func (h *Hoster) isUnauthenticatedMethod(method string) bool {
+	for _, allowed := range h.UnauthenticatedMethods {
+		if matchPattern(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unaryAuthInterceptor will authenticate unary calls.
+func (h *Hoster) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := h.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamAuthInterceptor will authenticate streaming calls.
+func (h *Hoster) streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := h.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextServerStream is a server stream with a replaced context.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the replaced context.
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
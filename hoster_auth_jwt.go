@@ -0,0 +1,370 @@
+package gohost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// JWTAuthenticator authenticates callers with a bearer JWT in the Authorization header or metadata. Signatures are verified against keys in a local JWKS file, and tokens must have an exp claim unless AllowMissingExpiry is set. Supported algorithms are RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512, HS256, HS384 and HS512.
+type JWTAuthenticator struct {
+	// Issuer is the required value of the iss claim. Leave blank to accept any issuer.
+	Issuer string
+
+	// Audience is a value required in the aud claim. Leave blank to accept any audience.
+	Audience string
+
+	// RolesClaim is the claim containing the roles of the caller. Default is roles.
+	RolesClaim string
+
+	// Leeway is the allowed clock skew when checking the exp and nbf claims.
+	Leeway time.Duration
+
+	// AllowMissingExpiry accepts tokens without an exp claim, which never expire. By default they are rejected.
+	AllowMissingExpiry bool
+
+	// keys contains the keys from the JWKS file.
+	keys []jwk
+}
+
+// NewJWTAuthenticator creates a JWT authenticator with the keys in a JWKS file.
+func NewJWTAuthenticator(jwksFile string) (*JWTAuthenticator, error) {
+	data, err := ioutil.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file %v: %v", jwksFile, err)
+	}
+
+	return &JWTAuthenticator{
+		RolesClaim: "roles",
+		keys:       keys,
+	}, nil
+}
+
+// Authenticate returns the principal for the bearer token in the request.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, md metadata.MD) (*Principal, error) {
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	parts := strings.SplitN(values[0], " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{
+		Method: "jwt",
+		Claims: claims,
+	}
+	p.Subject, _ = claims["sub"].(string)
+	p.Roles = claimStrings(claims[a.RolesClaim])
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = claimStrings(claims["scp"])
+	}
+
+	return p, nil
+}
+
+// jwtAlgorithms are the signing algorithms accepted in tokens.
+var jwtAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "HS256", "HS384", "HS512"}
+
+// verify will check the signature and registered claims of a token and return its claims.
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	// the registered claims are checked below, so their types can be validated and exp can be required
+	parser := &jwt.Parser{
+		ValidMethods:         jwtAlgorithms,
+		SkipClaimsValidation: true,
+	}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.findKey(kid, t.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		return key.verificationKey(), nil
+	})
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	exp, hasExp, err := timeClaim(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	nbf, hasNbf, err := timeClaim(claims, "nbf")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := timeClaim(claims, "iat"); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !hasExp && !a.AllowMissingExpiry {
+		return nil, errors.New("token has no exp claim")
+	}
+	if hasExp && now.After(exp.Add(a.Leeway)) {
+		return nil, errors.New("token has expired")
+	}
+	if hasNbf && now.Before(nbf.Add(-a.Leeway)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return nil, fmt.Errorf("unexpected token issuer %v", claims["iss"])
+	}
+	if a.Audience != "" && !containsString(claimStrings(claims["aud"]), a.Audience) {
+		return nil, fmt.Errorf("token audience does not include %v", a.Audience)
+	}
+
+	return claims, nil
+}
+
+// tokenError returns the reason a token could not be parsed or verified.
+func tokenError(err error) error {
+	ve, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return fmt.Errorf("malformed token: %v", err)
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return errors.New("invalid token signature")
+	case ve.Inner != nil:
+		return ve.Inner
+	}
+
+	return err
+}
+
+// timeClaim returns a NumericDate claim as a time and whether it is present. Claims that are not numbers are an error.
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("token %v claim is not a number", name)
+	}
+
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// findKey returns the key with the key ID, or the only key usable with the algorithm if the token has no key ID.
+func (a *JWTAuthenticator) findKey(kid string, alg string) (*jwk, error) {
+	var found *jwk
+	for i := range a.keys {
+		key := &a.keys[i]
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		if !key.supports(alg) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("token does not identify which key to use")
+		}
+		found = key
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no key for token with kid %q and alg %q", kid, alg)
+	}
+
+	return found, nil
+}
+
+// ecdsaCurves maps each ECDSA algorithm to the curve it requires.
+var ecdsaCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+// jwk is a single key from a JWKS file.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+
+	rsaKey    *rsa.PublicKey
+	ecdsaKey  *ecdsa.PublicKey
+	secretKey []byte
+}
+
+// parseJWKS will parse the public and symmetric keys in a JWKS document.
+func parseJWKS(data []byte) ([]jwk, error) {
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+
+	for i := range doc.Keys {
+		if err := doc.Keys[i].parse(); err != nil {
+			return nil, fmt.Errorf("key %v (kid %q): %v", i, doc.Keys[i].Kid, err)
+		}
+	}
+
+	return doc.Keys, nil
+}
+
+// parse will decode the key material for the key type.
+func (k *jwk) parse() error {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent: %v", err)
+		}
+		k.rsaKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return errors.New("point is not on curve")
+		}
+		k.ecdsaKey = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+		if err != nil {
+			return fmt.Errorf("invalid secret: %v", err)
+		}
+		k.secretKey = secret
+	default:
+		return fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	return nil
+}
+
+// verificationKey returns the key in the form used to verify signatures.
+func (k *jwk) verificationKey() interface{} {
+	switch {
+	case k.rsaKey != nil:
+		return k.rsaKey
+	case k.ecdsaKey != nil:
+		return k.ecdsaKey
+	}
+
+	return k.secretKey
+}
+
+// supports returns true if the key can verify signatures made with the algorithm.
+func (k *jwk) supports(alg string) bool {
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS"):
+		return k.rsaKey != nil
+	case strings.HasPrefix(alg, "ES"):
+		return k.ecdsaKey != nil && k.ecdsaKey.Curve.Params().Name == ecdsaCurves[alg]
+	case strings.HasPrefix(alg, "HS"):
+		return k.secretKey != nil
+	}
+
+	return false
+}
+
+// decodeBigInt will decode a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// claimStrings returns a claim that is a string or an array of strings as a slice.
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for i := range v {
+			if s, ok := v[i].(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// containsString returns true if the slice contains the value.
+func containsString(values []string, value string) bool {
+	for i := range values {
+		if values[i] == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,277 @@
+package gohost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy is an authorization rule for a gRPC method or an HTTP route.
+type Policy struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Send). A trailing * matches any method with that prefix.
+	Method string `json:"method" yaml:"method" toml:"method"`
+
+	// Route is an HTTP method and path (e.g. POST /v1/send) on the HTTP endpoint. The HTTP method may be * to match any method and a trailing * on the path matches any path with that prefix.
+	Route string `json:"route" yaml:"route" toml:"route"`
+
+	// Roles are the roles allowed to call the method or route. The caller must have at least one of them. Leave empty to not require a role.
+	Roles []string `json:"roles" yaml:"roles" toml:"roles"`
+
+	// Scopes are the scopes required to call the method or route. The caller must have all of them. Leave empty to not require a scope.
+	Scopes []string `json:"scopes" yaml:"scopes" toml:"scopes"`
+}
+
+// policyFile is the content of a policy file.
+type policyFile struct {
+	// Default is the decision (allow or deny) for gRPC methods without a policy. Default is deny.
+	Default string `json:"default" yaml:"default" toml:"default"`
+
+	// Policies are evaluated in order and the first policy matching the method, and the first matching the route, are used.
+	Policies []Policy `json:"policies" yaml:"policies" toml:"policies"`
+}
+
+// loadPolicyFile will read and check a YAML, JSON or TOML policy file.
+func loadPolicyFile(file string) (*policyFile, error) {
+	pf := &policyFile{}
+	if err := unmarshalFile(file, "policy", pf); err != nil {
+		return nil, err
+	}
+
+	if pf.Default != "" && pf.Default != "allow" && pf.Default != "deny" {
+		return nil, fmt.Errorf("policy file %v: default must be allow or deny, not %q", file, pf.Default)
+	}
+	for i, p := range pf.Policies {
+		switch {
+		case (p.Method == "") == (p.Route == ""):
+			return nil, fmt.Errorf("policy file %v: policy %v must have either a method or a route", file, i)
+		case p.Method != "" && !strings.HasPrefix(p.Method, "/"):
+			return nil, fmt.Errorf("policy file %v: policy %v method %q must be a full method name starting with /", file, i, p.Method)
+		case p.Route != "" && len(strings.Fields(p.Route)) != 2:
+			return nil, fmt.Errorf("policy file %v: policy %v route %q must be an HTTP method and path", file, i, p.Route)
+		}
+	}
+
+	return pf, nil
+}
+
+// findPolicy returns the first policy matching the gRPC method or, if route is true, the HTTP route.
+func (pf *policyFile) findPolicy(value string, route bool) *Policy {
+	for i := range pf.Policies {
+		p := &pf.Policies[i]
+		if !route && p.Method != "" && matchPattern(p.Method, value) {
+			return p
+		}
+		if route && p.Route != "" && matchRoute(p.Route, value) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// authorize returns an empty reason if the principal is allowed to call the method through the route, or the reason it is not. The method must be allowed by its policy, or by the default if it has none. If the call came through the HTTP endpoint, the route must also be allowed by its policy if it has one.
+func (pf *policyFile) authorize(p *Principal, method string, route string) string {
+	policy := pf.findPolicy(method, false)
+	if policy == nil && pf.Default != "allow" {
+		return "no policy allows " + method
+	}
+	if reason := policy.check(p); reason != "" {
+		return reason
+	}
+
+	if route == "" {
+		return ""
+	}
+
+	return pf.findPolicy(route, true).check(p)
+}
+
+// check returns an empty reason if the principal satisfies the policy, or the reason it does not. A nil policy is always satisfied.
+func (p *Policy) check(principal *Principal) string {
+	if p == nil || (len(p.Roles) == 0 && len(p.Scopes) == 0) {
+		return ""
+	}
+	if principal == nil {
+		return "caller is not authenticated"
+	}
+
+	if len(p.Roles) > 0 {
+		found := false
+		for _, role := range p.Roles {
+			if containsString(principal.Roles, role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("caller does not have any of the roles %v", p.Roles)
+		}
+	}
+
+	missing := []string{}
+	for _, scope := range p.Scopes {
+		if !containsString(principal.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("caller is missing the scopes %v", missing)
+	}
+
+	return ""
+}
+
+// matchPattern returns true if the value equals the pattern or, if the pattern ends in *, starts with the rest of the pattern.
+func matchPattern(pattern string, value string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+
+	return pattern == value
+}
+
+// matchRoute returns true if an HTTP method and path match a route pattern.
+func matchRoute(pattern string, route string) bool {
+	p := strings.Fields(pattern)
+	r := strings.Fields(route)
+	if len(p) != 2 || len(r) != 2 {
+		return false
+	}
+
+	return (p[0] == "*" || strings.EqualFold(p[0], r[0])) && matchPattern(p[1], r[1])
+}
+
+// AuditEvent is an authorization decision written to the audit log.
+type AuditEvent struct {
+	// Time is when the decision was made.
+	Time time.Time `json:"time"`
+
+	// Method is the full gRPC method name.
+	Method string `json:"method"`
+
+	// Route is the HTTP method and path if the call came through the HTTP endpoint.
+	Route string `json:"route,omitempty"`
+
+	// Subject is the subject of the caller, if authenticated.
+	Subject string `json:"subject,omitempty"`
+
+	// RequestID is the value of the x-request-id metadata or header, if present.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Allowed is true if the call was allowed.
+	Allowed bool `json:"allowed"`
+
+	// Reason is why the call was denied.
+	Reason string `json:"reason,omitempty"`
+}
+
+// auditLog writes audit events as JSON lines.
+type auditLog struct {
+	mu   sync.Mutex
+	w    io.WriteCloser
+	logf func(format string, v ...interface{})
+}
+
+// openAuditLog will open the audit log file for appending, or return nil if AuditLogFile is not set.
+func (h *Hoster) openAuditLog() (*auditLog, error) {
+	if h.AuditLogFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.OpenFile(h.AuditLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+
+	return &auditLog{w: f, logf: h.logf}, nil
+}
+
+// write will append an event to the audit log.
+func (a *auditLog) write(event AuditEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		metrics.Add("audit_errors", 1)
+		a.logf("Failed to encode audit event: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		metrics.Add("audit_errors", 1)
+		a.logf("Failed to write audit event: %v", err)
+	}
+}
+
+// close will close the audit log file.
+func (a *auditLog) close() error {
+	return a.w.Close()
+}
+
+// authorize will check the current policies for a call and record the decision. It returns a PermissionDenied error with the reason if the call is not allowed.
+func (h *Hoster) authorize(ctx context.Context, method string) error {
+	policies := h.loadLive().policies
+	if policies == nil {
+		return nil
+	}
+
+	principal, _ := PrincipalFromContext(ctx)
+	event := AuditEvent{
+		Time:      time.Now(),
+		Method:    method,
+		RequestID: grpcRequestID(ctx),
+	}
+	if call := gatewayCallFromContext(ctx); call != nil {
+		event.Route = call.route
+	}
+	if principal != nil {
+		event.Subject = principal.Subject
+	}
+	event.Reason = policies.authorize(principal, method, event.Route)
+	event.Allowed = event.Reason == ""
+
+	if event.Allowed {
+		metrics.Add("authz_allowed", 1)
+	} else {
+		metrics.Add("authz_denied", 1)
+	}
+
+	if h.auditLog != nil {
+		h.auditLog.write(event)
+	} else if !event.Allowed {
+		h.logf("Denied %v for %q (request ID: %v): %v", method, event.Subject, event.RequestID, event.Reason)
+	}
+
+	if !event.Allowed {
+		return status.Errorf(codes.PermissionDenied, "permission denied: %v", event.Reason)
+	}
+
+	return nil
+}
+
+// unaryAuthzInterceptor will authorize unary calls.
+func (h *Hoster) unaryAuthzInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := h.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamAuthzInterceptor will authorize streaming calls.
+func (h *Hoster) streamAuthzInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := h.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,280 @@
+package gohost
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+
+	// register the gzip compressor with gRPC once, since registration is process-wide and not safe while servers are running
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// gzipName is the name of the gzip codec for gRPC and the HTTP content coding.
+const gzipName = "gzip"
+
+// gzipCompressor compresses HTTP bodies with gzip. gRPC messages use the gzip compressor registered by the grpc encoding/gzip package.
+type gzipCompressor struct {
+	level int
+}
+
+// Compress returns a writer that compresses to w.
+func (c *gzipCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+// Decompress returns a reader that decompresses r.
+func (c *gzipCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// Name returns gzip.
+func (c *gzipCompressor) Name() string {
+	return gzipName
+}
+
+// compressors returns the compressors enabled for the hoster, in order of preference.
+func (h *Hoster) compressors() []encoding.Compressor {
+	if !h.EnableCompression {
+		return nil
+	}
+
+	level := h.CompressionLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	return append([]encoding.Compressor{&gzipCompressor{level: level}}, h.Compressors...)
+}
+
+// findCompressor returns the compressor with a content coding name, or nil if there is none.
+func findCompressor(compressors []encoding.Compressor, name string) encoding.Compressor {
+	for _, c := range compressors {
+		if strings.EqualFold(c.Name(), name) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// negotiateCompressor returns the first compressor accepted by the Accept-Encoding header, or nil if none are.
+func negotiateCompressor(compressors []encoding.Compressor, acceptEncoding string) encoding.Compressor {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				ok = err == nil && q > 0
+			}
+		}
+		if name != "" {
+			accepted[name] = ok
+		}
+	}
+
+	for _, c := range compressors {
+		if ok, found := accepted[strings.ToLower(c.Name())]; (found && ok) || (!found && accepted["*"]) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// decompressRequest will decompress request bodies with a Content-Encoding of an enabled compressor. Requests with any other encoding are rejected with 415 Unsupported Media Type.
+func (h *Hoster) decompressRequest(next http.Handler) http.Handler {
+	compressors := h.compressors()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSpace(r.Header.Get("Content-Encoding"))
+		if name == "" || strings.EqualFold(name, "identity") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		c := findCompressor(compressors, name)
+		if c == nil {
+			writeHTTPError(w, http.StatusUnsupportedMediaType, codes.InvalidArgument, fmt.Sprintf("unsupported content encoding %q", name))
+			return
+		}
+
+		body, err := c.Decompress(r.Body)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, codes.InvalidArgument, fmt.Sprintf("invalid %v request body: %v", name, err))
+			return
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, r.Body}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// compressResponse will compress responses with the best compressor accepted by the client, if the content type is allowed and the body is at least CompressionMinSize bytes. Upgrade requests such as WebSocket connections are passed through.
+func (h *Hoster) compressResponse(next http.Handler) http.Handler {
+	compressors := h.compressors()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := negotiateCompressor(compressors, r.Header.Get("Accept-Encoding"))
+		w.Header().Add("Vary", "Accept-Encoding")
+		if c == nil || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			compressor:     c,
+			minSize:        h.CompressionMinSize,
+			contentTypes:   h.CompressionContentTypes,
+			status:         http.StatusOK,
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				// drop the buffered response so the panic can still be recovered with an error response
+				panic(p)
+			}
+			cw.close()
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressResponseWriter buffers the start of a response until it knows whether to compress it.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	compressor   encoding.Compressor
+	minSize      int
+	contentTypes []string
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	writer  io.Writer
+	closer  io.Closer
+}
+
+// WriteHeader records the status code until the response is started.
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+
+	w.status = code
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		w.start(false)
+	}
+}
+
+// Write buffers the body until it reaches the minimum size, then starts a compressed response.
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if !w.allowed() {
+			w.start(false)
+		} else if w.buf.Len()+len(b) < w.minSize {
+			return w.buf.Write(b)
+		} else {
+			w.start(true)
+		}
+	}
+
+	return w.writer.Write(b)
+}
+
+// Flush will start the response, compressed if the content type is allowed since a flushed response may be a stream, and flush it.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.start(w.allowed())
+	}
+
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify will pass through to the underlying response writer, which the gateway uses to cancel requests.
+func (w *compressResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// allowed returns true if the response can be compressed based on its headers.
+func (w *compressResponseWriter) allowed() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.contentTypes {
+		if matchPattern(allowed, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// start will write the header and buffered body, compressing the rest of the response if compress is true.
+func (w *compressResponseWriter) start(compress bool) {
+	w.decided = true
+	w.writer = w.ResponseWriter
+
+	if compress {
+		cw, err := w.compressor.Compress(w.ResponseWriter)
+		if err == nil {
+			w.Header().Set("Content-Encoding", w.compressor.Name())
+			w.Header().Del("Content-Length")
+			w.writer = cw
+			w.closer = cw
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() > 0 {
+		w.writer.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// close will write a buffered response that was too small to compress, or finish the compressed response.
+func (w *compressResponseWriter) close() {
+	if !w.decided {
+		w.start(false)
+	}
+
+	if w.closer != nil {
+		w.closer.Close()
+	}
+}
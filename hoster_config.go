@@ -0,0 +1,379 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// configTag is the struct tag on Hoster fields that names the configuration key for the field. Fields without this tag cannot be configured from files, the environment or flags.
+const configTag = "config"
+
+// usageTag is the struct tag on Hoster fields that contains the usage text for the flag bound to the field.
+const usageTag = "usage"
+
+// LoadConfig will load configuration into the hoster from a file, the environment and a flag set. Settings are applied in order of increasing precedence:
+//
+//  1. Defaults already set on the hoster (see NewHoster)
+//  2. Settings in file, if file is not empty
+//  3. Environment variables starting with envPrefix, if envPrefix is not empty
+//  4. Flags in fs that were explicitly set on the command line, if fs is not nil (see BindFlags)
+//
+// The sources are remembered so they can be loaded again by Reload. See LoadConfigFile, LoadEnv and BindFlags for details on each source.
+func (h *Hoster) LoadConfig(file string, envPrefix string, fs *flag.FlagSet) error {
+	// remember flags set on the command line so they can be reapplied last
+	flags := map[string]string{}
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			flags[strings.Replace(f.Name, "-", "_", -1)] = f.Value.String()
+		})
+	}
+
+	err := h.loadConfig(file, envPrefix, flags)
+	if err != nil {
+		return err
+	}
+
+	h.configSource = &configSource{
+		file:      file,
+		envPrefix: envPrefix,
+		flags:     flags,
+	}
+
+	return nil
+}
+
+// configSource contains the sources passed to LoadConfig.
+type configSource struct {
+	file      string
+	envPrefix string
+	flags     map[string]string
+}
+
+// loadConfig will load configuration from each source in order of precedence. Flags are keyed by config key and flags that do not match a hoster field are ignored.
+func (h *Hoster) loadConfig(file string, envPrefix string, flags map[string]string) error {
+	if file != "" {
+		if err := h.LoadConfigFile(file); err != nil {
+			return err
+		}
+	}
+
+	if envPrefix != "" {
+		if err := h.LoadEnv(envPrefix); err != nil {
+			return err
+		}
+	}
+
+	fields := h.configFields()
+	for key, value := range flags {
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		if err := setConfigString(field, value); err != nil {
+			return fmt.Errorf("invalid value for flag -%v: %v", strings.Replace(key, "_", "-", -1), err)
+		}
+	}
+
+	return nil
+}
+
+// LoadConfigFile will load configuration into the hoster from a YAML (.yaml or .yml), JSON (.json) or TOML (.toml) file. Keys are the snake case field names (e.g. grpc_addr for GRPCAddr). Durations are strings such as "30s". Keys that are not present leave the current value unchanged and unknown keys are an error.
+func (h *Hoster) LoadConfigFile(file string) error {
+	values := map[string]interface{}{}
+	if err := unmarshalFile(file, "config", &values); err != nil {
+		return err
+	}
+
+	fields := h.configFields()
+	for key, value := range values {
+		field, ok := fields[normalizeConfigKey(key)]
+		if !ok {
+			return fmt.Errorf("unknown config key %q in %v", key, file)
+		}
+
+		if err := setConfigValue(field, value); err != nil {
+			return fmt.Errorf("invalid value for config key %q in %v: %v", key, file, err)
+		}
+	}
+
+	return nil
+}
+
+// unmarshalFile will decode a YAML (.yaml or .yml), JSON (.json) or TOML (.toml) file into v, using the file extension to pick the format. The kind of file is used in error messages.
+func unmarshalFile(file string, kind string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %v file: %v", kind, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(v)
+	case ".toml":
+		_, err = toml.Decode(string(data), v)
+	default:
+		return fmt.Errorf("unsupported %v file extension %q", kind, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %v file %v: %v", kind, file, err)
+	}
+
+	return nil
+}
+
+// LoadEnv will load configuration into the hoster from environment variables. The variable name for a field is the prefix followed by the upper case config key (e.g. GOHOST_GRPC_ADDR for GRPCAddr with a prefix of GOHOST_). Lists are comma separated. Unset variables leave the current value unchanged.
+func (h *Hoster) LoadEnv(prefix string) error {
+	for key, field := range h.configFields() {
+		name := prefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setConfigString(field, value); err != nil {
+			return fmt.Errorf("invalid value for environment variable %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// BindFlags will define a flag in fs for every configurable hoster field. Flag names are the config keys with hyphens instead of underscores (e.g. -grpc-addr for GRPCAddr) and defaults are the current values of the hoster. Parsing fs sets the fields directly. Pass the same flag set to LoadConfig so explicitly set flags take precedence over files and the environment.
+func (h *Hoster) BindFlags(fs *flag.FlagSet) {
+	v := reflect.ValueOf(h).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get(configTag)
+		if key == "" {
+			continue
+		}
+
+		name := strings.Replace(key, "_", "-", -1)
+		usage := t.Field(i).Tag.Get(usageTag)
+		switch ptr := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			fs.StringVar(ptr, name, *ptr, usage)
+		case *bool:
+			fs.BoolVar(ptr, name, *ptr, usage)
+		case *int:
+			fs.IntVar(ptr, name, *ptr, usage)
+		case *time.Duration:
+			fs.DurationVar(ptr, name, *ptr, usage)
+		default:
+			fs.Var(&configFlag{field: v.Field(i)}, name, usage)
+		}
+	}
+}
+
+// configFields returns the settable hoster fields keyed by config key.
+func (h *Hoster) configFields() map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+
+	v := reflect.ValueOf(h).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get(configTag); key != "" {
+			fields[key] = v.Field(i)
+		}
+	}
+
+	return fields
+}
+
+// configFlag is a flag.Value for hoster fields that have no matching flag type in the flag package.
+type configFlag struct {
+	field reflect.Value
+}
+
+// String returns the current value of the field.
+func (f *configFlag) String() string {
+	if !f.field.IsValid() {
+		return ""
+	}
+
+	if items, ok := f.field.Interface().([]string); ok {
+		return strings.Join(items, ",")
+	}
+	if f.field.Type() == rateLimitsType {
+		b, _ := json.Marshal(f.field.Interface())
+		return string(b)
+	}
+
+	return fmt.Sprint(f.field.Interface())
+}
+
+// Set parses the value into the field.
+func (f *configFlag) Set(value string) error {
+	return setConfigString(f.field, value)
+}
+
+// durationType is used to detect time.Duration fields.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// rateLimitsType is used to detect the RateLimits field, which is set from JSON.
+var rateLimitsType = reflect.TypeOf([]RateLimit(nil))
+
+// setConfigString will parse a string into a field.
+func setConfigString(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int32 || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(n) {
+			return fmt.Errorf("%v is out of range", n)
+		}
+		field.SetInt(n)
+	case field.Type() == reflect.TypeOf([]string(nil)):
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case field.Type() == rateLimitsType:
+		return setRateLimits(field, []byte(value))
+	default:
+		return fmt.Errorf("unsupported field type %v", field.Type())
+	}
+
+	return nil
+}
+
+// setConfigValue will set a field from a value decoded from a config file.
+func setConfigValue(field reflect.Value, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return setConfigString(field, v)
+	case json.Number:
+		return setConfigString(field, v.String())
+	case bool:
+		if field.Kind() != reflect.Bool {
+			return fmt.Errorf("expected %v, got bool", field.Type())
+		}
+		field.SetBool(v)
+		return nil
+	case int:
+		return setConfigString(field, strconv.Itoa(v))
+	case int64:
+		return setConfigString(field, strconv.FormatInt(v, 10))
+	case uint64:
+		return setConfigString(field, strconv.FormatUint(v, 10))
+	case float64:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("expected %v, got %v", field.Type(), v)
+		}
+		return setConfigString(field, strconv.FormatInt(int64(v), 10))
+	case []map[string]interface{}:
+		if field.Type() != rateLimitsType {
+			return fmt.Errorf("expected %v, got list of tables", field.Type())
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return setRateLimits(field, b)
+	case []interface{}:
+		if field.Type() == rateLimitsType {
+			b, err := json.Marshal(jsonValue(v))
+			if err != nil {
+				return err
+			}
+			return setRateLimits(field, b)
+		}
+		if field.Type() != reflect.TypeOf([]string(nil)) {
+			return fmt.Errorf("expected %v, got list", field.Type())
+		}
+		items := make([]string, len(v))
+		for i := range v {
+			s, ok := v[i].(string)
+			if !ok {
+				return errors.New("list items must be strings")
+			}
+			items[i] = s
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	default:
+		return fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// setRateLimits will decode a JSON array of rate limits into a field. Unknown keys are an error.
+func setRateLimits(field reflect.Value, data []byte) error {
+	limits := []RateLimit{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&limits); err != nil {
+		return fmt.Errorf("invalid rate limits: %v", err)
+	}
+	field.Set(reflect.ValueOf(limits))
+
+	return nil
+}
+
+// jsonValue will convert the maps decoded from a YAML file, which have interface{} keys, so the value can be encoded as JSON.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i := range v {
+			items[i] = jsonValue(v[i])
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// normalizeConfigKey will convert a key from a config file to the form used in struct tags.
+func normalizeConfigKey(key string) string {
+	return strings.Replace(strings.ToLower(key), "-", "_", -1)
+}
@@ -0,0 +1,132 @@
+package gohost
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RequestTimeoutHeader is the HTTP header used to set the deadline of a request on the HTTP endpoint. The value is a duration such as 500ms or 2s, or a number of seconds. The gateway also accepts the Grpc-Timeout header.
+const RequestTimeoutHeader = "x-request-timeout"
+
+// MethodDeadline overrides DefaultDeadline and MaxDeadline for gRPC methods.
+type MethodDeadline struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Send). A trailing * matches any method with that prefix.
+	Method string
+
+	// Default is the deadline for calls to the method that do not have one. Leave as zero to use DefaultDeadline.
+	Default time.Duration
+
+	// Max is the longest deadline allowed for calls to the method. Leave as zero to use MaxDeadline.
+	Max time.Duration
+}
+
+// methodDeadlines returns the default and maximum deadline for a method, from the first matching MethodDeadline or the hoster defaults.
+func (h *Hoster) methodDeadlines(method string) (time.Duration, time.Duration) {
+	def, max := h.DefaultDeadline, h.MaxDeadline
+	for _, d := range h.MethodDeadlines {
+		if !matchPattern(d.Method, method) {
+			continue
+		}
+		if d.Default > 0 {
+			def = d.Default
+		}
+		if d.Max > 0 {
+			max = d.Max
+		}
+		break
+	}
+
+	return def, max
+}
+
+// applyDeadline returns a context with the default deadline for the method if the call has none, or with the deadline shortened to the maximum for the method if it is longer.
+func (h *Hoster) applyDeadline(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	def, max := h.methodDeadlines(method)
+
+	deadline, ok := ctx.Deadline()
+	switch {
+	case !ok && def > 0:
+		return context.WithTimeout(ctx, def)
+	case !ok && max > 0:
+		return context.WithTimeout(ctx, max)
+	case ok && max > 0 && time.Until(deadline) > max:
+		return context.WithTimeout(ctx, max)
+	}
+
+	return ctx, func() {}
+}
+
+// countDeadlineExceeded will count a call that failed because its deadline was exceeded.
+func countDeadlineExceeded(ctx context.Context, err error) {
+	if status.Code(err) == codes.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+		metrics.Add("deadline_exceeded", 1)
+	}
+}
+
+// unaryDeadlineInterceptor will apply the default and maximum deadlines to unary calls.
+func (h *Hoster) unaryDeadlineInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, cancel := h.applyDeadline(ctx, info.FullMethod)
+	defer cancel()
+
+	resp, err := handler(ctx, req)
+	countDeadlineExceeded(ctx, err)
+
+	return resp, err
+}
+
+// streamDeadlineInterceptor will apply the default and maximum deadlines to streaming calls.
+func (h *Hoster) streamDeadlineInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := h.applyDeadline(ss.Context(), info.FullMethod)
+	defer cancel()
+
+	err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	countDeadlineExceeded(ctx, err)
+
+	return err
+}
+
+// requestTimeoutHTTP will set the deadline of requests with a timeout header, which the gateway passes on to the gRPC call. Requests with an invalid timeout are rejected with 400 Bad Request.
+func requestTimeoutHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(RequestTimeoutHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout, err := parseRequestTimeout(value)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, codes.InvalidArgument, fmt.Sprintf("invalid %v header %q", RequestTimeoutHeader, value))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseRequestTimeout will parse a duration such as 500ms or a number of seconds, which must be positive.
+func parseRequestTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(value, 64)
+		if serr != nil {
+			return 0, err
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("timeout %v must be positive", timeout)
+	}
+
+	return timeout, nil
+}
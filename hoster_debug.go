@@ -2,13 +2,23 @@ package gohost
 
 import (
 	"errors"
+	"expvar"
 	"net/http"
 
 	// register debug http handlers
-	_ "expvar"
 	_ "net/http/pprof"
 )
 
+// metrics contains counters published on the debug endpoint at /debug/vars under the gohost key.
+var metrics = expvar.NewMap("gohost")
+
+// logf will log a message with Logger, if it is set.
+func (h *Hoster) logf(format string, v ...interface{}) {
+	if h.Logger != nil {
+		h.Logger.Printf(format, v...)
+	}
+}
+
 // serveDebug will start the debug endpoint.
 func (h *Hoster) serveDebug() error {
 	// validate parameters
@@ -16,5 +26,23 @@ func (h *Hoster) serveDebug() error {
 		return errors.New("debug address cannot be empty")
 	}
 
-	return http.ListenAndServe(h.DebugAddr, nil)
+	// add the effective configuration to the default handlers
+	mux := http.NewServeMux()
+	mux.Handle("/", http.DefaultServeMux)
+	mux.HandleFunc("/debug/config", h.handleDebugConfig)
+	mux.HandleFunc("/debug/faults", h.handleDebugFaults)
+	mux.HandleFunc("/debug/shadow", h.handleDebugShadow)
+	mux.HandleFunc("/debug/routes", h.handleDebugRoutes)
+
+	server := &http.Server{
+		Addr:              h.DebugAddr,
+		Handler:           mux,
+		ReadTimeout:       h.DebugReadTimeout,
+		ReadHeaderTimeout: h.DebugReadHeaderTimeout,
+		WriteTimeout:      h.DebugWriteTimeout,
+		IdleTimeout:       h.DebugIdleTimeout,
+		MaxHeaderBytes:    h.DebugMaxHeaderBytes,
+	}
+
+	return server.ListenAndServe()
 }
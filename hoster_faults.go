@@ -0,0 +1,508 @@
+package gohost
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// UniformDistribution spreads the random part of a fault delay evenly between zero and the jitter.
+	UniformDistribution = "uniform"
+
+	// ExponentialDistribution makes the random part of a fault delay exponential with a mean of the jitter, so most delays are short with a long tail.
+	ExponentialDistribution = "exponential"
+)
+
+// Fault describes errors, delays, aborted streams and truncated responses injected into calls to a gRPC method or HTTP route, to test how clients handle them.
+type Fault struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Echo). A trailing * matches any method with that prefix. Calls forwarded by the HTTP gateway are included.
+	Method string
+
+	// Route is an HTTP method and path (e.g. GET /v1/echo) on the HTTP endpoint. The HTTP method may be * to match any method and a trailing * on the path matches any path with that prefix.
+	Route string
+
+	// ErrorPercent is the percentage (0 to 100) of calls that fail with Code instead of being handled.
+	ErrorPercent int
+
+	// Code is the status code of injected errors and aborted streams. Default is Unavailable.
+	Code codes.Code
+
+	// Message is the status message of injected errors and aborted streams. Default is "injected fault".
+	Message string
+
+	// DelayPercent is the percentage (0 to 100) of calls that are delayed before being handled.
+	DelayPercent int
+
+	// Delay is the shortest delay of a delayed call.
+	Delay time.Duration
+
+	// DelayJitter is the random delay added to Delay, following DelayDistribution.
+	DelayJitter time.Duration
+
+	// DelayDistribution is the distribution of the random delay, either uniform (default) or exponential.
+	DelayDistribution string
+
+	// AbortPercent is the percentage (0 to 100) of gRPC streams that fail with Code after AbortAfter messages have been sent.
+	AbortPercent int
+
+	// AbortAfter is the number of messages sent by an aborted stream before it fails.
+	AbortAfter int
+
+	// TruncatePercent is the percentage (0 to 100) of HTTP responses whose connection is closed after TruncateAfter bytes of the body have been sent.
+	TruncatePercent int
+
+	// TruncateAfter is the number of body bytes sent by a truncated response before it is cut off.
+	TruncateAfter int
+}
+
+// faultJSON is the JSON form of a Fault used by the debug endpoint, with durations and codes as text.
+type faultJSON struct {
+	Method            string `json:"method,omitempty"`
+	Route             string `json:"route,omitempty"`
+	ErrorPercent      int    `json:"error_percent,omitempty"`
+	Code              string `json:"code,omitempty"`
+	Message           string `json:"message,omitempty"`
+	DelayPercent      int    `json:"delay_percent,omitempty"`
+	Delay             string `json:"delay,omitempty"`
+	DelayJitter       string `json:"delay_jitter,omitempty"`
+	DelayDistribution string `json:"delay_distribution,omitempty"`
+	AbortPercent      int    `json:"abort_percent,omitempty"`
+	AbortAfter        int    `json:"abort_after,omitempty"`
+	TruncatePercent   int    `json:"truncate_percent,omitempty"`
+	TruncateAfter     int    `json:"truncate_after,omitempty"`
+}
+
+// MarshalJSON encodes the fault with durations (e.g. 250ms) and the code name as text.
+func (f Fault) MarshalJSON() ([]byte, error) {
+	fj := faultJSON{
+		Method:            f.Method,
+		Route:             f.Route,
+		ErrorPercent:      f.ErrorPercent,
+		Message:           f.Message,
+		DelayPercent:      f.DelayPercent,
+		DelayDistribution: f.DelayDistribution,
+		AbortPercent:      f.AbortPercent,
+		AbortAfter:        f.AbortAfter,
+		TruncatePercent:   f.TruncatePercent,
+		TruncateAfter:     f.TruncateAfter,
+	}
+	if f.Code != codes.OK {
+		fj.Code = f.Code.String()
+	}
+	if f.Delay != 0 {
+		fj.Delay = f.Delay.String()
+	}
+	if f.DelayJitter != 0 {
+		fj.DelayJitter = f.DelayJitter.String()
+	}
+
+	return json.Marshal(fj)
+}
+
+// UnmarshalJSON decodes a fault with durations (e.g. 250ms) and the code (e.g. NotFound, NOT_FOUND or 5) as text.
+func (f *Fault) UnmarshalJSON(b []byte) error {
+	var fj faultJSON
+	if err := json.Unmarshal(b, &fj); err != nil {
+		return err
+	}
+
+	*f = Fault{
+		Method:            fj.Method,
+		Route:             fj.Route,
+		ErrorPercent:      fj.ErrorPercent,
+		Message:           fj.Message,
+		DelayPercent:      fj.DelayPercent,
+		DelayDistribution: fj.DelayDistribution,
+		AbortPercent:      fj.AbortPercent,
+		AbortAfter:        fj.AbortAfter,
+		TruncatePercent:   fj.TruncatePercent,
+		TruncateAfter:     fj.TruncateAfter,
+	}
+	var err error
+	if fj.Code != "" {
+		if f.Code, err = parseCode(fj.Code); err != nil {
+			return err
+		}
+	}
+	if fj.Delay != "" {
+		if f.Delay, err = time.ParseDuration(fj.Delay); err != nil {
+			return fmt.Errorf("invalid delay %q: %v", fj.Delay, err)
+		}
+	}
+	if fj.DelayJitter != "" {
+		if f.DelayJitter, err = time.ParseDuration(fj.DelayJitter); err != nil {
+			return fmt.Errorf("invalid delay jitter %q: %v", fj.DelayJitter, err)
+		}
+	}
+
+	return nil
+}
+
+// faultState contains the fault injection settings in use, which can be changed through the debug endpoint.
+type faultState struct {
+	// Enabled is true if faults are injected.
+	Enabled bool `json:"enabled"`
+
+	// Faults are matched in order and the first fault matching the method, and the first matching the route, are used.
+	Faults []Fault `json:"faults"`
+}
+
+// validateFaults returns the problems found in a list of faults.
+func validateFaults(faults []Fault) []error {
+	errs := []error{}
+	for i, f := range faults {
+		switch {
+		case (f.Method == "") == (f.Route == ""):
+			errs = append(errs, fmt.Errorf("fault %v must have either a method or a route", i))
+		case f.Method != "" && !strings.HasPrefix(f.Method, "/"):
+			errs = append(errs, fmt.Errorf("fault %v method %q must be a full method name starting with /", i, f.Method))
+		case f.Route != "" && len(strings.Fields(f.Route)) != 2:
+			errs = append(errs, fmt.Errorf("fault %v route %q must be an HTTP method and path", i, f.Route))
+		}
+
+		percents := []struct {
+			name  string
+			value int
+		}{
+			{"error percent", f.ErrorPercent},
+			{"delay percent", f.DelayPercent},
+			{"abort percent", f.AbortPercent},
+			{"truncate percent", f.TruncatePercent},
+		}
+		for _, p := range percents {
+			if p.value < 0 || p.value > 100 {
+				errs = append(errs, fmt.Errorf("fault %v %v %v must be between 0 and 100", i, p.name, p.value))
+			}
+		}
+
+		if f.Delay < 0 || f.DelayJitter < 0 {
+			errs = append(errs, fmt.Errorf("fault %v delay cannot be negative", i))
+		}
+		if f.DelayDistribution != "" && f.DelayDistribution != UniformDistribution && f.DelayDistribution != ExponentialDistribution {
+			errs = append(errs, fmt.Errorf("fault %v delay distribution must be %v or %v, not %q", i, UniformDistribution, ExponentialDistribution, f.DelayDistribution))
+		}
+		if f.AbortAfter < 0 || f.TruncateAfter < 0 {
+			errs = append(errs, fmt.Errorf("fault %v abort after and truncate after cannot be negative", i))
+		}
+		if f.AbortPercent > 0 && f.Route != "" {
+			errs = append(errs, fmt.Errorf("fault %v can only abort streams of gRPC methods", i))
+		}
+		if f.TruncatePercent > 0 && f.Method != "" {
+			errs = append(errs, fmt.Errorf("fault %v can only truncate responses of HTTP routes", i))
+		}
+	}
+
+	return errs
+}
+
+// initFaults will set the fault injection settings from EnableFaults and Faults.
+func (h *Hoster) initFaults() {
+	h.faults.Store(&faultState{
+		Enabled: h.EnableFaults,
+		Faults:  h.Faults,
+	})
+}
+
+// loadFaults returns the fault injection settings in use.
+func (h *Hoster) loadFaults() *faultState {
+	state, _ := h.faults.Load().(*faultState)
+	if state == nil {
+		return &faultState{}
+	}
+
+	return state
+}
+
+// findFault returns the first fault matching the gRPC method or, if route is true, the HTTP route, or nil if fault injection is disabled or none match.
+func (h *Hoster) findFault(value string, route bool) *Fault {
+	state := h.loadFaults()
+	if !state.Enabled {
+		return nil
+	}
+
+	for i := range state.Faults {
+		f := &state.Faults[i]
+		if !route && f.Method != "" && matchPattern(f.Method, value) {
+			return f
+		}
+		if route && f.Route != "" && matchRoute(f.Route, value) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// inject will delay the call and return an injected error, each with the configured probability.
+func (f *Fault) inject(ctx context.Context) error {
+	if rollPercent(f.DelayPercent) {
+		metrics.Add("faults_delayed", 1)
+		if err := waitContext(ctx, f.delay()); err != nil {
+			return err
+		}
+	}
+
+	if rollPercent(f.ErrorPercent) {
+		metrics.Add("faults_injected", 1)
+		return f.err()
+	}
+
+	return nil
+}
+
+// delay returns a random delay from the distribution of the fault.
+func (f *Fault) delay() time.Duration {
+	d := f.Delay
+	if f.DelayJitter > 0 {
+		if f.DelayDistribution == ExponentialDistribution {
+			d += time.Duration(rand.ExpFloat64() * float64(f.DelayJitter))
+		} else {
+			d += time.Duration(rand.Int63n(int64(f.DelayJitter) + 1))
+		}
+	}
+
+	return d
+}
+
+// err returns the error of an injected fault.
+func (f *Fault) err() error {
+	code := f.Code
+	if code == codes.OK {
+		code = codes.Unavailable
+	}
+	msg := f.Message
+	if msg == "" {
+		msg = "injected fault"
+	}
+
+	return status.Error(code, msg)
+}
+
+// rollPercent returns true with a probability of percent out of 100.
+func rollPercent(percent int) bool {
+	return percent > 0 && rand.Intn(100) < percent
+}
+
+// waitContext will wait for a duration, or return a DeadlineExceeded or Canceled error if the context is done first.
+func waitContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		}
+		return status.Error(codes.Canceled, ctx.Err().Error())
+	}
+}
+
+// unaryFaultInterceptor will inject faults into unary calls to matching methods.
+func (h *Hoster) unaryFaultInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	f := h.findFault(info.FullMethod, false)
+	if f == nil {
+		return handler(ctx, req)
+	}
+
+	if err := f.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamFaultInterceptor will inject faults into streams of matching methods, including aborting them part way through.
+func (h *Hoster) streamFaultInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	f := h.findFault(info.FullMethod, false)
+	if f == nil {
+		return handler(srv, ss)
+	}
+
+	if err := f.inject(ss.Context()); err != nil {
+		return err
+	}
+	if rollPercent(f.AbortPercent) {
+		ss = &abortingServerStream{ServerStream: ss, remaining: f.AbortAfter, err: f.err()}
+	}
+
+	return handler(srv, ss)
+}
+
+// abortingServerStream is a server stream that fails after sending a number of messages.
+type abortingServerStream struct {
+	grpc.ServerStream
+	remaining int
+	err       error
+}
+
+// SendMsg sends the message, or fails with the injected error if no messages remain.
+func (s *abortingServerStream) SendMsg(m interface{}) error {
+	if s.remaining == 0 {
+		metrics.Add("faults_aborted", 1)
+		return s.err
+	}
+	s.remaining--
+
+	return s.ServerStream.SendMsg(m)
+}
+
+// injectFaultsHTTP will inject faults into requests to matching routes. Errors are written in the same format as gateway errors.
+func (h *Hoster) injectFaultsHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := h.findFault(fmt.Sprintf("%v %v", r.Method, r.URL.Path), true)
+		if f == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := f.inject(r.Context()); err != nil {
+			s := status.Convert(err)
+			writeHTTPError(w, runtime.HTTPStatusFromCode(s.Code()), s.Code(), s.Message())
+			return
+		}
+		if rollPercent(f.TruncatePercent) {
+			w = &truncatingResponseWriter{ResponseWriter: w, remaining: f.TruncateAfter}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errResponseTruncated is returned by writes to a response after it has been truncated.
+var errResponseTruncated = errors.New("response truncated by fault injection")
+
+// truncatingResponseWriter sends part of the response body and then closes the connection, so the client receives an incomplete response. Writes after the cut off fail, and it can be written to from other goroutines, such as the heartbeat of an event stream.
+type truncatingResponseWriter struct {
+	http.ResponseWriter
+
+	mu        sync.Mutex
+	remaining int
+	truncated bool
+}
+
+// WriteHeader writes the status code, unless the response has been truncated.
+func (w *truncatingResponseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.truncated {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Write writes the part of the body that fits before the cut off, then truncates the response.
+func (w *truncatingResponseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.truncated {
+		return 0, errResponseTruncated
+	}
+	if len(b) <= w.remaining {
+		w.remaining -= len(b)
+		return w.ResponseWriter.Write(b)
+	}
+
+	n, _ := w.ResponseWriter.Write(b[:w.remaining])
+	w.truncate()
+	return n, errResponseTruncated
+}
+
+// truncate will send what has been written and close the connection without ending the response. Connections that cannot be hijacked, such as HTTP/2 streams, are left open and the response ends when the handler returns.
+func (w *truncatingResponseWriter) truncate() {
+	w.truncated = true
+	metrics.Add("faults_truncated", 1)
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+// Flush sends any buffered data to the client, unless the response has been truncated.
+func (w *truncatingResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.truncated {
+		flusher.Flush()
+	}
+}
+
+// CloseNotify will pass through to the underlying response writer, which the gateway uses to cancel requests.
+func (w *truncatingResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// Hijack will pass through to the underlying response writer, which the WebSocket bridge uses to take over the connection. The connection is not truncated once it has been hijacked.
+func (w *truncatingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok || w.truncated {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	return hj.Hijack()
+}
+
+// handleDebugFaults writes the fault injection settings as JSON. A PUT replaces the settings with the request body, such as {"enabled":true,"faults":[{"method":"/test.TestService/Echo","error_percent":50}]}, and a DELETE disables fault injection.
+func (h *Hoster) handleDebugFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		state := &faultState{}
+		if err := json.NewDecoder(r.Body).Decode(state); err != nil {
+			http.Error(w, fmt.Sprintf("invalid fault settings: %v", err), http.StatusBadRequest)
+			return
+		}
+		if errs := validateFaults(state.Faults); len(errs) > 0 {
+			http.Error(w, (&ValidationError{Errors: errs}).Error(), http.StatusBadRequest)
+			return
+		}
+		h.faults.Store(state)
+		h.logf("Fault injection set by debug endpoint (enabled: %v, faults: %v)", state.Enabled, len(state.Faults))
+	case http.MethodDelete:
+		h.faults.Store(&faultState{Faults: h.loadFaults().Faults})
+		h.logf("Fault injection disabled by debug endpoint")
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.loadFaults())
+}
@@ -0,0 +1,129 @@
+package gohost
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// gatewayTokenHeader is the metadata key the HTTP gateway uses to prove a call came from it, so the route and client address it forwards can be trusted.
+	gatewayTokenHeader = "x-gohost-gateway-token"
+
+	// httpRouteHeader is the metadata key the HTTP gateway uses to forward the HTTP method and path of a request.
+	httpRouteHeader = "x-gohost-http-route"
+
+	// forwardedForHeader is the metadata key the HTTP gateway uses to forward the client address of a request.
+	forwardedForHeader = "x-forwarded-for"
+)
+
+// gatewayCall describes a call forwarded by the HTTP gateway.
+type gatewayCall struct {
+	// route is the HTTP method and path of the request (e.g. GET /v1/echo).
+	route string
+
+	// clientIP is the address of the HTTP client.
+	clientIP string
+}
+
+// gatewayCallKey is the context key for a gatewayCall.
+type gatewayCallKey struct{}
+
+// gatewayCallFromContext returns the gateway call attached to the context, or nil if the call did not come from the HTTP gateway.
+func gatewayCallFromContext(ctx context.Context) *gatewayCall {
+	call, _ := ctx.Value(gatewayCallKey{}).(*gatewayCall)
+	return call
+}
+
+// newGatewayToken returns a random token for the HTTP gateway to send with each call.
+func newGatewayToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create gateway token: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// gatewayMetadata will add the gateway token, the route of the request and the metadata for resuming an event stream to each call made by the HTTP gateway.
+func (h *Hoster) gatewayMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	md := metadata.Pairs(
+		gatewayTokenHeader, h.gatewayToken,
+		httpRouteHeader, r.Method+" "+r.URL.Path,
+	)
+
+	return metadata.Join(md, sseResumeMetadata(r))
+}
+
+// gatewayHeaderMatcher will forward the API key, request ID and priority headers to the gRPC endpoint as metadata, along with the headers forwarded by default. Clients cannot set the gateway metadata through a Grpc-Metadata- header.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	switch strings.ToLower(key) {
+	case APIKeyHeader, RequestIDHeader, PriorityHeader:
+		return strings.ToLower(key), true
+	}
+
+	if strings.HasPrefix(strings.ToLower(key), strings.ToLower(runtime.MetadataHeaderPrefix)+"x-gohost-") {
+		return "", false
+	}
+
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayOutgoingHeaderMatcher will write the Retry-After header from gRPC header metadata to the HTTP response, and other header metadata with the Grpc-Metadata- prefix as the gateway does by default.
+func gatewayOutgoingHeaderMatcher(key string) (string, bool) {
+	if key == retryAfterHeader {
+		return "Retry-After", true
+	}
+
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// identifyGateway will attach a gatewayCall to the context if the call came from the HTTP gateway, and remove the gateway metadata so it is not seen by handlers.
+func (h *Hoster) identifyGateway(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(gatewayTokenHeader)) == 0 {
+		return ctx
+	}
+
+	token := md.Get(gatewayTokenHeader)
+	route := md.Get(httpRouteHeader)
+	md = md.Copy()
+	delete(md, gatewayTokenHeader)
+	delete(md, httpRouteHeader)
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	if h.gatewayToken == "" || len(token) != 1 || subtle.ConstantTimeCompare([]byte(token[0]), []byte(h.gatewayToken)) != 1 {
+		return ctx
+	}
+
+	call := &gatewayCall{}
+	if len(route) > 0 {
+		call.route = route[len(route)-1]
+	}
+
+	// the gateway appends the address of the client to any forwarded addresses
+	if forwarded := md.Get(forwardedForHeader); len(forwarded) > 0 {
+		addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+		call.clientIP = strings.TrimSpace(addrs[len(addrs)-1])
+	}
+
+	return context.WithValue(ctx, gatewayCallKey{}, call)
+}
+
+// unaryGatewayInterceptor will identify unary calls from the HTTP gateway.
+func (h *Hoster) unaryGatewayInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(h.identifyGateway(ctx), req)
+}
+
+// streamGatewayInterceptor will identify streaming calls from the HTTP gateway.
+func (h *Hoster) streamGatewayInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: h.identifyGateway(ss.Context())})
+}
@@ -1,52 +1,133 @@
 package gohost
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
-// serveGRPC will start the gRPC endpoint.
-func (h *Hoster) serveGRPC() error {
+// listenGRPC will start listening on the gRPC address, so the HTTP endpoint can connect as soon as it starts.
+func (h *Hoster) listenGRPC() (net.Listener, error) {
+	if h.GRPCListener != nil {
+		return h.GRPCListener, nil
+	}
+
 	// validate parameters
 	if h.GRPCAddr == "" {
-		return errors.New("grpc address cannot be empty")
+		return nil, errors.New("grpc address cannot be empty")
 	}
 
-	// configure server options
-	opts := []grpc.ServerOption{
-		grpc.MaxSendMsgSize(h.MaxSendMsgSize),
-		grpc.MaxRecvMsgSize(h.MaxRecvMsgSize),
+	lis, err := net.Listen("tcp", h.GRPCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
 	}
 
-	// add interceptors
-	if len(h.UnaryInterceptors) > 0 {
-		unaryInterceptorChain := grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(h.UnaryInterceptors...))
-		opts = append(opts, unaryInterceptorChain)
+	return lis, nil
+}
+
+// serveGRPC will start the gRPC endpoint.
+func (h *Hoster) serveGRPC(lis net.Listener) error {
+	return h.grpcServer.Serve(lis)
+}
+
+// newGRPCServer will create the gRPC server and register the gRPC servers with it.
+func (h *Hoster) newGRPCServer() (*grpc.Server, error) {
+	// configure server options, with panic recovery first so it covers every interceptor
+	opts := []grpc.ServerOption{}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{h.unaryRecoveryInterceptor, h.unaryGatewayInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{h.streamRecoveryInterceptor, h.streamGatewayInterceptor}
+
+	// record calls as the client sees them, including calls rejected by the interceptors that follow
+	if h.recorder != nil {
+		unaryInterceptors = append(unaryInterceptors, h.unaryRecordingInterceptor)
+		streamInterceptors = append(streamInterceptors, h.streamRecordingInterceptor)
 	}
-	if len(h.StreamInterceptors) > 0 {
-		streamInterceptorChain := grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(h.StreamInterceptors...))
-		opts = append(opts, streamInterceptorChain)
+
+	// reject calls over the in-flight limits before doing any other work
+	if h.shedder != nil {
+		unaryInterceptors = append(unaryInterceptors, h.unaryLoadShedInterceptor)
+		streamInterceptors = append(streamInterceptors, h.streamLoadShedInterceptor)
 	}
 
-	// add TLS credentials to options if necessary
-	if h.isTLSEnabled() {
-		creds, err := credentials.NewServerTLSFromFile(h.CertFile, h.KeyFile)
-		if err != nil {
-			return fmt.Errorf("failed to load TLS credentials: %v", err)
-		}
+	// apply default and maximum deadlines and count calls that exceed them
+	unaryInterceptors = append(unaryInterceptors, h.unaryDeadlineInterceptor)
+	streamInterceptors = append(streamInterceptors, h.streamDeadlineInterceptor)
 
-		opts = append(opts, grpc.Creds(creds))
+	if h.EnableReload {
+		// enforce message sizes with interceptors so they can be reloaded, under a transport limit so large messages are never buffered
+		sendCeiling, recvCeiling := h.setMsgSizeCeilings()
+		opts = append(opts, grpc.MaxSendMsgSize(sendCeiling), grpc.MaxRecvMsgSize(recvCeiling))
+		unaryInterceptors = append(unaryInterceptors, h.unaryMsgSizeInterceptor)
+		streamInterceptors = append(streamInterceptors, h.streamMsgSizeInterceptor)
+	} else {
+		opts = append(opts, grpc.MaxSendMsgSize(h.MaxSendMsgSize), grpc.MaxRecvMsgSize(h.MaxRecvMsgSize))
 	}
 
-	// start listening
-	lis, err := net.Listen("tcp", h.GRPCAddr)
-	if err != nil {
-		return fmt.Errorf("failed to listen: %v", err)
+	// add keepalive and connection management options
+	opts = append(opts, h.connectionOptions()...)
+
+	// add authentication before custom interceptors so they can use the principal
+	if len(h.Authenticators) > 0 {
+		unaryInterceptors = append(unaryInterceptors, h.unaryAuthInterceptor)
+		streamInterceptors = append(streamInterceptors, h.streamAuthInterceptor)
+	}
+
+	// add authorization after authentication, always installed so policies can be enabled by Reload
+	unaryInterceptors = append(unaryInterceptors, h.unaryAuthzInterceptor)
+	streamInterceptors = append(streamInterceptors, h.streamAuthzInterceptor)
+
+	// add rate limiting after authentication so limits can be counted by principal, always installed so limits can be changed by Reload
+	unaryInterceptors = append(unaryInterceptors, h.unaryRateLimitInterceptor)
+	streamInterceptors = append(streamInterceptors, h.streamRateLimitInterceptor)
+
+	// inject faults after the calls have been accepted, always installed so faults can be enabled by the debug endpoint
+	unaryInterceptors = append(unaryInterceptors, h.unaryFaultInterceptor)
+	streamInterceptors = append(streamInterceptors, h.streamFaultInterceptor)
+
+	// mirror calls to the shadow endpoint with the same response as the client
+	if h.shadow != nil {
+		unaryInterceptors = append(unaryInterceptors, h.unaryShadowInterceptor)
+	}
+
+	// add interceptors
+	unaryInterceptors = append(unaryInterceptors, h.UnaryInterceptors...)
+	streamInterceptors = append(streamInterceptors, h.StreamInterceptors...)
+	unaryInterceptorChain := grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...))
+	streamInterceptorChain := grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...))
+	opts = append(opts, unaryInterceptorChain, streamInterceptorChain)
+
+	// add TLS credentials to options if necessary, the certificate is only loaded when TLS is enabled
+	if h.loadLive().cert != nil {
+		tlsConfig := &tls.Config{
+			GetCertificate: h.getCertificate,
+		}
+
+		// verify client certificates if they are presented
+		if h.ClientCAFile != "" {
+			pool, err := loadCertPool(h.ClientCAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
 	// register servers
@@ -55,8 +136,164 @@ func (h *Hoster) serveGRPC() error {
 		h.grpcServers[i](server)
 	}
 
-	// start the gRPC endpoint
-	return server.Serve(lis)
+	// mock services after the real servers so they are only used for services without an implementation
+	if h.mock != nil {
+		h.mock.register(server)
+	}
+
+	// health and reflection services last, so they can report every other service
+	if h.EnableHealth {
+		registerHealth(server, h.healthServices)
+	}
+	if h.EnableReflection {
+		reflection.Register(server)
+	}
+
+	return server, nil
+}
+
+// registerHealth will register the gRPC health service, reporting the server, the services registered so far and any additional names as serving.
+func registerHealth(server *grpc.Server, names []string) {
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	for serviceName := range server.GetServiceInfo() {
+		hs.SetServingStatus(serviceName, healthpb.HealthCheckResponse_SERVING)
+	}
+	for _, name := range names {
+		hs.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(server, hs)
+}
+
+// connectionOptions returns server options for the keepalive and connection management settings that have been set.
+func (h *Hoster) connectionOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{}
+
+	params := keepalive.ServerParameters{
+		MaxConnectionIdle:     h.MaxConnectionIdle,
+		MaxConnectionAge:      h.MaxConnectionAge,
+		MaxConnectionAgeGrace: h.MaxConnectionAgeGrace,
+		Time:                  h.KeepaliveTime,
+		Timeout:               h.KeepaliveTimeout,
+	}
+	if params != (keepalive.ServerParameters{}) {
+		opts = append(opts, grpc.KeepaliveParams(params))
+	}
+
+	policy := keepalive.EnforcementPolicy{
+		MinTime:             h.KeepaliveMinTime,
+		PermitWithoutStream: h.KeepalivePermitWithoutStream,
+	}
+	if policy != (keepalive.EnforcementPolicy{}) {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(policy))
+	}
+
+	if h.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(h.MaxConcurrentStreams)))
+	}
+	if h.InitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(int32(h.InitialWindowSize)))
+	}
+	if h.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(int32(h.InitialConnWindowSize)))
+	}
+	if h.ConnectionTimeout > 0 {
+		opts = append(opts, grpc.ConnectionTimeout(h.ConnectionTimeout))
+	}
+
+	return opts
+}
+
+// setMsgSizeCeilings will fix the message size limits of the gRPC transport, which are ReloadMaxMsgSizeCeiling or the sizes at startup, and return them.
+func (h *Hoster) setMsgSizeCeilings() (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.maxSendMsgSizeCeiling = h.MaxSendMsgSize
+	h.maxRecvMsgSizeCeiling = h.MaxRecvMsgSize
+	if h.ReloadMaxMsgSizeCeiling > 0 {
+		h.maxSendMsgSizeCeiling = h.ReloadMaxMsgSizeCeiling
+		h.maxRecvMsgSizeCeiling = h.ReloadMaxMsgSizeCeiling
+	}
+
+	return h.maxSendMsgSizeCeiling, h.maxRecvMsgSizeCeiling
+}
+
+// unaryMsgSizeInterceptor will enforce the current message size limits on unary calls.
+func (h *Hoster) unaryMsgSizeInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	lc := h.loadLive()
+	if err := checkMsgSize("received", req, lc.maxRecvMsgSize); err != nil {
+		return nil, err
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	if err := checkMsgSize("sent", resp, lc.maxSendMsgSize); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// streamMsgSizeInterceptor will enforce the current message size limits on streaming calls.
+func (h *Hoster) streamMsgSizeInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &msgSizeServerStream{ServerStream: ss, h: h})
+}
+
+// msgSizeServerStream is a server stream that enforces the current message size limits.
+type msgSizeServerStream struct {
+	grpc.ServerStream
+	h *Hoster
+}
+
+// SendMsg will send a message if it is within the size limit.
+func (s *msgSizeServerStream) SendMsg(m interface{}) error {
+	if err := checkMsgSize("sent", m, s.h.loadLive().maxSendMsgSize); err != nil {
+		return err
+	}
+
+	return s.ServerStream.SendMsg(m)
+}
+
+// RecvMsg will receive a message and fail if it is over the size limit.
+func (s *msgSizeServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return checkMsgSize("received", m, s.h.loadLive().maxRecvMsgSize)
+}
+
+// checkMsgSize will return a ResourceExhausted error if the message is larger than max.
+func checkMsgSize(direction string, m interface{}, max int) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	if size := proto.Size(msg); size > max {
+		return status.Errorf(codes.ResourceExhausted, "grpc: %v message larger than max (%v vs. %v)", direction, size, max)
+	}
+
+	return nil
+}
+
+// loadCertPool will load a file of PEM encoded certificates into a pool.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA file %v", file)
+	}
+
+	return pool, nil
 }
 
 // isTLSEnabled will return true if TLS properties are set and ready to use.
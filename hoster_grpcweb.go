@@ -0,0 +1,420 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcWebContentType is the content type of binary gRPC-Web requests and responses.
+	grpcWebContentType = "application/grpc-web"
+
+	// grpcWebTextContentType is the content type of base64 encoded gRPC-Web requests and responses.
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// grpcWebTrailerFlag marks the frame containing the trailers of a gRPC-Web response.
+	grpcWebTrailerFlag = 0x80
+
+	// grpcWebCompressedFlag marks a frame containing a compressed message.
+	grpcWebCompressedFlag = 0x01
+
+	// grpcWebPreflightMaxAge is how long browsers can cache the result of a CORS preflight request, in seconds.
+	grpcWebPreflightMaxAge = "600"
+)
+
+// grpcWebSkipHeaders are request headers used by HTTP or gRPC-Web itself, which are not forwarded as metadata.
+var grpcWebSkipHeaders = map[string]bool{
+	"accept-encoding":   true,
+	"connection":        true,
+	"content-encoding":  true,
+	"content-length":    true,
+	"keep-alive":        true,
+	"te":                true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+	"x-grpc-web":        true,
+	"x-user-agent":      true,
+	"x-forwarded-host":  true,
+	"x-forwarded-proto": true,
+}
+
+// grpcWebSkipPrefixes are prefixes of request headers that are not forwarded as metadata. Headers starting with grpc- and x-gohost- are reserved.
+var grpcWebSkipPrefixes = []string{"grpc-", "x-gohost-", "access-control-", "sec-"}
+
+// grpcWebBridge will serve gRPC-Web requests for the registered gRPC methods, including CORS preflight requests. Other requests are passed to next.
+func (h *Hoster) grpcWebBridge(mux *runtime.ServeMux, cc *grpc.ClientConn, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, ok := h.methods[r.URL.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.grpcWebPreflight(w, r)
+			return
+		}
+
+		text, ok := grpcWebRequestType(r)
+		if !ok || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !originAllowed(r, h.loadLive().grpcWebOrigins) {
+			writeHTTPError(w, http.StatusForbidden, codes.PermissionDenied, fmt.Sprintf("origin %v not allowed", r.Header.Get("Origin")))
+			return
+		}
+
+		resp := &grpcWebResponse{w: w, text: text, origin: r.Header.Get("Origin")}
+
+		// forward the headers of the request as metadata, the same way as the gateway, along with the plain headers gRPC-Web clients use for metadata
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r)
+		if err != nil {
+			resp.finish(err, nil)
+			return
+		}
+		md, err := grpcWebMetadata(r)
+		if err != nil {
+			resp.finish(err, nil)
+			return
+		}
+		outgoing, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(outgoing, md))
+
+		h.bridgeGRPCWeb(ctx, r, resp, cc, method)
+	})
+}
+
+// grpcWebPreflight will respond to a CORS preflight request for a gRPC-Web method.
+func (h *Hoster) grpcWebPreflight(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !originAllowed(r, h.loadLive().grpcWebOrigins) {
+		writeHTTPError(w, http.StatusForbidden, codes.PermissionDenied, fmt.Sprintf("origin %v not allowed", origin))
+		return
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if origin != "" {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	header.Set("Access-Control-Allow-Methods", http.MethodPost)
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		header.Set("Access-Control-Allow-Headers", requested)
+	}
+	header.Set("Access-Control-Max-Age", grpcWebPreflightMaxAge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grpcWebRequestType returns whether a request is a base64 encoded gRPC-Web text request, and false for ok if it is not a gRPC-Web request with protobuf messages.
+func grpcWebRequestType(r *http.Request) (text bool, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false, false
+	}
+
+	switch mediaType {
+	case grpcWebContentType, grpcWebContentType + "+proto":
+		return false, true
+	case grpcWebTextContentType, grpcWebTextContentType + "+proto":
+		return true, true
+	}
+
+	return false, false
+}
+
+// grpcWebMetadata returns the metadata sent as plain headers by a gRPC-Web client. Values of binary headers (ending in -bin) are base64 decoded.
+func grpcWebMetadata(r *http.Request) (metadata.MD, error) {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		key = strings.ToLower(key)
+		if grpcWebSkipHeaders[key] || hasAnyPrefix(key, grpcWebSkipPrefixes) {
+			continue
+		}
+		if _, ok := gatewayHeaderMatcher(key); ok || key == forwardedForHeader {
+			// already forwarded by the gateway
+			continue
+		}
+
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				b, err := decodeBinaryHeader(value)
+				if err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, "invalid binary header %v: %v", key, err)
+				}
+				value = string(b)
+			}
+			md[key] = append(md[key], value)
+		}
+	}
+
+	return md, nil
+}
+
+// hasAnyPrefix returns true if s starts with any of the prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeBinaryHeader decodes the value of a binary header, which may or may not be padded.
+func decodeBinaryHeader(value string) ([]byte, error) {
+	if len(value)%4 == 0 {
+		return base64.StdEncoding.DecodeString(value)
+	}
+
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+// bridgeGRPCWeb will call a gRPC method with the messages in the request body and write the responses, followed by a trailer frame with the final status.
+func (h *Hoster) bridgeGRPCWeb(ctx context.Context, r *http.Request, resp *grpcWebResponse, cc *grpc.ClientConn, method *methodDesc) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	requests, err := readGRPCWebRequests(r.Body, resp.text, method)
+	if err != nil {
+		resp.finish(err, nil)
+		return
+	}
+
+	desc := &grpc.StreamDesc{
+		ClientStreams: method.clientStreams,
+		ServerStreams: method.serverStreams,
+	}
+	stream, err := cc.NewStream(ctx, desc, method.name)
+	if err != nil {
+		resp.finish(err, nil)
+		return
+	}
+
+	// a failed send ends the call, and its status is returned by RecvMsg
+	for _, req := range requests {
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	stream.CloseSend()
+
+	for {
+		msg := method.newOutput()
+		if err := stream.RecvMsg(msg); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			resp.start(stream)
+			resp.finish(err, stream.Trailer())
+			return
+		}
+
+		resp.start(stream)
+		if err := resp.send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readGRPCWebRequests returns the messages in the body of a gRPC-Web request. Methods that take a single request must be sent exactly one message.
+func readGRPCWebRequests(body io.Reader, text bool, method *methodDesc) ([]proto.Message, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to read request body: %v", err)
+	}
+
+	if text {
+		data, err = decodeGRPCWebText(data)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid base64 request body: %v", err)
+		}
+	}
+
+	var requests []proto.Message
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, status.Error(codes.InvalidArgument, "incomplete message frame")
+		}
+		flag := data[0]
+		length := binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(length) {
+			return nil, status.Error(codes.InvalidArgument, "incomplete message frame")
+		}
+		payload := data[5 : 5+length]
+		data = data[5+length:]
+
+		if flag&grpcWebCompressedFlag != 0 {
+			return nil, status.Error(codes.Unimplemented, "compressed messages are not supported")
+		}
+
+		req := method.newInput()
+		if err := proto.Unmarshal(payload, req); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid message: %v", err)
+		}
+		requests = append(requests, req)
+	}
+
+	if !method.clientStreams && len(requests) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "expected 1 message but received %v", len(requests))
+	}
+
+	return requests, nil
+}
+
+// decodeGRPCWebText decodes a base64 request body, which clients may send as several separately padded chunks.
+func decodeGRPCWebText(data []byte) ([]byte, error) {
+	data = bytes.Join(bytes.Fields(data), nil)
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("length %v is not a multiple of 4", len(data))
+	}
+
+	decoded := make([]byte, 0, base64.StdEncoding.DecodedLen(len(data)))
+	buf := make([]byte, 3)
+	for i := 0; i < len(data); i += 4 {
+		n, err := base64.StdEncoding.Decode(buf, data[i:i+4])
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, buf[:n]...)
+	}
+
+	return decoded, nil
+}
+
+// grpcWebResponse writes the frames of a gRPC-Web response.
+type grpcWebResponse struct {
+	w       http.ResponseWriter
+	text    bool
+	origin  string
+	started bool
+}
+
+// start will write the response headers, including the header metadata of the call if there is one, if they have not been written yet.
+func (r *grpcWebResponse) start(stream grpc.ClientStream) {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	header := r.w.Header()
+	exposed := []string{"grpc-status", "grpc-message"}
+	if stream != nil {
+		md, _ := stream.Header()
+		keys := make([]string, 0, len(md))
+		for key := range md {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range md[key] {
+				header.Add(key, encodeMetadataValue(key, value))
+			}
+		}
+		exposed = append(exposed, keys...)
+	}
+
+	if r.text {
+		header.Set("Content-Type", grpcWebTextContentType+"+proto")
+	} else {
+		header.Set("Content-Type", grpcWebContentType+"+proto")
+	}
+	if r.origin != "" {
+		header.Add("Vary", "Origin")
+		header.Set("Access-Control-Allow-Origin", r.origin)
+		header.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	}
+	r.w.WriteHeader(http.StatusOK)
+}
+
+// send will write a message frame.
+func (r *grpcWebResponse) send(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return r.writeFrame(0, b)
+}
+
+// finish will write the trailer frame with the status of the call and its trailer metadata, starting the response if necessary.
+func (r *grpcWebResponse) finish(err error, trailer metadata.MD) {
+	r.start(nil)
+
+	st := status.Convert(err)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&b, "grpc-message: %v\r\n", encodeGRPCMessage(st.Message()))
+	}
+	for key, values := range trailer {
+		for _, value := range values {
+			fmt.Fprintf(&b, "%v: %v\r\n", key, encodeMetadataValue(key, value))
+		}
+	}
+
+	r.writeFrame(grpcWebTrailerFlag, b.Bytes())
+}
+
+// writeFrame will write and flush a frame, base64 encoded for text responses.
+func (r *grpcWebResponse) writeFrame(flag byte, payload []byte) error {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+
+	if r.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+
+	if _, err := r.w.Write(frame); err != nil {
+		return err
+	}
+	if f, ok := r.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// encodeMetadataValue will base64 encode the value of binary metadata (keys ending in -bin).
+func encodeMetadataValue(key string, value string) string {
+	if strings.HasSuffix(key, "-bin") {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	return value
+}
+
+// encodeGRPCMessage will percent-encode a status message the same way as gRPC.
+func encodeGRPCMessage(msg string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
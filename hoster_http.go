@@ -1,30 +1,48 @@
 package gohost
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 )
 
 // serveHTTP will start the HTTP endpoint.
 func (h *Hoster) serveHTTP() error {
 	// validate parameters
-	if h.HTTPAddr == "" {
+	if h.HTTPAddr == "" && h.HTTPListener == nil {
 		return errors.New("http address cannot be empty")
 	}
 
+	// read settings that Reload may change from the live config
+	lc := h.loadLive()
+	tlsEnabled := lc.cert != nil
+
 	// configure dial options
 	opts := []grpc.DialOption{
-		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(h.MaxSendMsgSize), grpc.MaxCallRecvMsgSize(h.MaxRecvMsgSize)),
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(lc.maxSendMsgSize), grpc.MaxCallRecvMsgSize(lc.maxRecvMsgSize)),
+	}
+
+	if h.EnableReload {
+		// apply the current message sizes to each call so they can be reloaded
+		opts = append(opts, grpc.WithUnaryInterceptor(h.unaryClientMsgSizeInterceptor), grpc.WithStreamInterceptor(h.streamClientMsgSizeInterceptor))
 	}
 
-	if h.isTLSEnabled() {
+	if tlsEnabled {
 		// add TLS credentials
 		creds := credentials.NewTLS(&tls.Config{
 			InsecureSkipVerify: h.InsecureSkipVerify,
@@ -35,13 +53,37 @@ func (h *Hoster) serveHTTP() error {
 		opts = append(opts, grpc.WithInsecure())
 	}
 
+	// connect to the gRPC endpoint with a custom dialer, such as for an in-memory listener
+	if h.GRPCDialer != nil {
+		opts = append(opts, grpc.WithDialer(h.GRPCDialer))
+	}
+
 	// create context
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// connect to the gRPC endpoint for the dynamic gateway and bridges
+	var conn *grpc.ClientConn
+	if h.EnableDynamicGateway || h.EnableMock || h.EnableWebSocket || h.EnableGRPCWeb {
+		c, err := grpc.Dial(h.GRPCAddr, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to dial gRPC endpoint: %v", err)
+		}
+		defer c.Close()
+		conn = c
+	}
+
 	// register gateways
-	mux := runtime.NewServeMux()
+	muxOpts := []runtime.ServeMuxOption{
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(gatewayOutgoingHeaderMatcher),
+		runtime.WithMetadata(h.gatewayMetadata),
+	}
+	if h.EnableSSE {
+		muxOpts = append(muxOpts, runtime.WithForwardResponseOption(h.sseEventIDOption))
+	}
+	mux := runtime.NewServeMux(muxOpts...)
 	for i := range h.httpGateways {
 		err := h.httpGateways[i](ctx, mux, h.GRPCAddr, opts)
 		if err != nil {
@@ -49,16 +91,285 @@ func (h *Hoster) serveHTTP() error {
 		}
 	}
 
+	// add routes for the http annotations of the registered methods, after the generated gateways so their routes are matched first
+	if h.EnableDynamicGateway || h.EnableMock {
+		h.registerHTTPRoutes(mux, conn)
+	}
+
 	// register optional handler
 	var handler http.Handler = mux
 	if h.HTTPHandler != nil {
 		handler = h.HTTPHandler(mux)
 	}
 
+	// serve the registered OpenAPI documents
+	if len(h.openAPIDocs) > 0 {
+		handler = h.serveOpenAPI(handler)
+	}
+
+	// send responses as events to clients that accept them
+	if h.EnableSSE {
+		handler = h.serveSSE(handler)
+	}
+
+	// bridge WebSocket connections and gRPC-Web requests to gRPC methods
+	if h.EnableWebSocket {
+		handler = h.webSocketBridge(mux, conn, handler)
+	}
+	if h.EnableGRPCWeb {
+		handler = h.grpcWebBridge(mux, conn, handler)
+	}
+
+	// reject oversized requests before they reach the gateway or optional handler
+	handler = h.limitRequestBody(handler)
+
+	// record requests with their bodies decompressed and responses before they are compressed
+	if h.recorder != nil {
+		handler = h.recordHTTP(handler)
+	}
+
+	// decompress request bodies before the size limit is checked
+	if h.EnableCompression {
+		handler = h.decompressRequest(handler)
+	}
+
+	// pass the request timeout header on to the gRPC call as a deadline
+	handler = requestTimeoutHTTP(handler)
+
+	// apply rate limits for HTTP routes before doing any other work, always installed so limits can be changed by Reload
+	handler = h.rateLimitHTTP(handler)
+
+	// compress responses accepted by the client
+	if h.EnableCompression {
+		handler = h.compressResponse(handler)
+	}
+
+	// inject faults outside compression so truncated responses are cut off at the bytes sent, always installed so faults can be enabled by the debug endpoint
+	handler = h.injectFaultsHTTP(handler)
+
+	// recover from panics in the gateway or optional handler
+	handler = h.recoverHTTP(handler)
+
 	// start the HTTP endpoint
-	if h.isTLSEnabled() {
-		return http.ListenAndServeTLS(h.HTTPAddr, h.CertFile, h.KeyFile, handler)
+	server := &http.Server{
+		Addr:              h.HTTPAddr,
+		Handler:           handler,
+		ReadTimeout:       h.HTTPReadTimeout,
+		ReadHeaderTimeout: h.HTTPReadHeaderTimeout,
+		WriteTimeout:      h.HTTPWriteTimeout,
+		IdleTimeout:       h.HTTPIdleTimeout,
+		MaxHeaderBytes:    h.HTTPMaxHeaderBytes,
+	}
+
+	// track connections so the timeouts can be cleared for WebSocket connections and event streams
+	lis := h.HTTPListener
+	if h.hasStreamTimeouts() {
+		if lis == nil {
+			l, err := net.Listen("tcp", h.HTTPAddr)
+			if err != nil {
+				return fmt.Errorf("failed to listen: %v", err)
+			}
+			lis = l
+		}
+		h.httpStreams = newStreamListener(lis, h.HTTPListener == nil)
+		lis = h.httpStreams
+	}
+
+	if tlsEnabled {
+		server.TLSConfig = &tls.Config{
+			GetCertificate: h.getCertificate,
+		}
+		if lis != nil {
+			return server.ServeTLS(lis, "", "")
+		}
+		return server.ListenAndServeTLS("", "")
+	}
+	if lis != nil {
+		return server.Serve(lis)
 	}
 
-	return http.ListenAndServe(h.HTTPAddr, handler)
+	return server.ListenAndServe()
+}
+
+// hasStreamTimeouts returns true if the HTTP endpoint has timeouts that would cut off WebSocket connections or event streams.
+func (h *Hoster) hasStreamTimeouts() bool {
+	return (h.HTTPReadTimeout > 0 || h.HTTPWriteTimeout > 0) && (h.EnableWebSocket || h.EnableSSE)
+}
+
+// clearStreamDeadlines will remove the read and write timeouts from the connection of a request, so a long-lived stream is not cut off. The timeouts apply again to the next request on the connection.
+func (h *Hoster) clearStreamDeadlines(r *http.Request) {
+	if h.httpStreams != nil {
+		h.httpStreams.clearDeadlines(r.RemoteAddr)
+	}
+}
+
+// streamListener is a listener that tracks its open connections by remote address, so the deadlines set by the HTTP server can be cleared for a request.
+type streamListener struct {
+	net.Listener
+
+	// keepAlive enables TCP keep-alives on accepted connections, the same as the listener of http.Server.ListenAndServe.
+	keepAlive bool
+
+	mu    sync.Mutex
+	conns map[string][]*streamConn
+}
+
+// newStreamListener creates a listener that tracks the connections accepted by lis.
+func newStreamListener(lis net.Listener, keepAlive bool) *streamListener {
+	return &streamListener{
+		Listener:  lis,
+		keepAlive: keepAlive,
+		conns:     map[string][]*streamConn{},
+	}
+}
+
+// Accept waits for and returns the next connection.
+func (l *streamListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tc, ok := c.(*net.TCPConn); ok && l.keepAlive {
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(3 * time.Minute)
+	}
+
+	sc := &streamConn{Conn: c, l: l, addr: c.RemoteAddr().String()}
+	l.mu.Lock()
+	l.conns[sc.addr] = append(l.conns[sc.addr], sc)
+	l.mu.Unlock()
+
+	return sc, nil
+}
+
+// clearDeadlines will remove the deadlines of the connections from a remote address. Listeners that give every connection the same address, such as in-memory pipes, have all of their connections cleared.
+func (l *streamListener) clearDeadlines(addr string) {
+	l.mu.Lock()
+	conns := append([]*streamConn{}, l.conns[addr]...)
+	l.mu.Unlock()
+
+	for _, c := range conns {
+		c.SetDeadline(time.Time{})
+	}
+}
+
+// remove will stop tracking a connection.
+func (l *streamListener) remove(c *streamConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	conns := l.conns[c.addr]
+	for i := range conns {
+		if conns[i] == c {
+			conns = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(l.conns, c.addr)
+		return
+	}
+	l.conns[c.addr] = conns
+}
+
+// streamConn is a connection tracked by a streamListener until it is closed, including after it has been hijacked.
+type streamConn struct {
+	net.Conn
+
+	l    *streamListener
+	addr string
+	once sync.Once
+}
+
+// Close will stop tracking and close the connection.
+func (c *streamConn) Close() error {
+	c.once.Do(func() {
+		c.l.remove(c)
+	})
+
+	return c.Conn.Close()
+}
+
+// limitRequestBody will respond with 413 Request Entity Too Large if the request body is larger than the current limit. Bodies of unknown length are buffered up to the limit to check their size.
+func (h *Hoster) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(h.loadLive().maxRequestBodySize)
+
+		if r.ContentLength > limit {
+			writeBodyTooLarge(w, r.ContentLength, limit)
+			return
+		}
+
+		if r.ContentLength < 0 {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > limit {
+				writeBodyTooLarge(w, int64(len(body)), limit)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyTooLarge will write a 413 response.
+func writeBodyTooLarge(w http.ResponseWriter, size int64, limit int64) {
+	writeHTTPError(w, http.StatusRequestEntityTooLarge, codes.ResourceExhausted, fmt.Sprintf("request body larger than max (%v vs. %v)", size, limit))
+}
+
+// originAllowed returns true if a request has no Origin header, or its origin matches one of the allowed origins. If no origins are allowed, only the origin of the HTTP endpoint itself is allowed.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+
+	for _, pattern := range allowed {
+		if matchPattern(pattern, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeHTTPError will write an error response in the same JSON format as gateway errors.
+func writeHTTPError(w http.ResponseWriter, httpStatus int, code codes.Code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": msg,
+		"code":  code,
+	})
+}
+
+// unaryClientMsgSizeInterceptor will add the current message size limits to unary calls made by the HTTP gateway.
+func (h *Hoster) unaryClientMsgSizeInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(ctx, method, req, reply, cc, append(opts, h.msgSizeCallOptions()...)...)
+}
+
+// streamClientMsgSizeInterceptor will add the current message size limits to streaming calls made by the HTTP gateway.
+func (h *Hoster) streamClientMsgSizeInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(ctx, desc, cc, method, append(opts, h.msgSizeCallOptions()...)...)
+}
+
+// msgSizeCallOptions returns call options with the current message size limits.
+func (h *Hoster) msgSizeCallOptions() []grpc.CallOption {
+	lc := h.loadLive()
+	return []grpc.CallOption{
+		grpc.MaxCallSendMsgSize(lc.maxSendMsgSize),
+		grpc.MaxCallRecvMsgSize(lc.maxRecvMsgSize),
+	}
 }
@@ -0,0 +1,179 @@
+package gohost
+
+import (
+	"expvar"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// PriorityHeader is the HTTP header and gRPC metadata key used to lower the priority class of a request for load shedding.
+const PriorityHeader = "x-priority"
+
+const (
+	// PriorityCritical requests are never shed. Only methods in CriticalMethods are critical, since clients cannot raise their own priority.
+	PriorityCritical = "critical"
+
+	// PriorityNormal requests are shed when an in-flight limit is reached. This is the default.
+	PriorityNormal = "normal"
+
+	// PriorityLow requests are shed first, when lowPriorityShare of an in-flight limit is reached.
+	PriorityLow = "low"
+)
+
+// lowPriorityShare is the fraction of an in-flight limit that low priority requests may use.
+const lowPriorityShare = 0.8
+
+// adaptiveDecrease is the factor the adaptive limit is multiplied by when a call is slower than the target latency.
+const adaptiveDecrease = 0.9
+
+// ConcurrencyLimit is a limit on the number of in-flight calls to gRPC methods, including calls forwarded by the HTTP gateway.
+type ConcurrencyLimit struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Send). A trailing * matches any method with that prefix, and all matching methods share the limit.
+	Method string
+
+	// Max is the maximum number of in-flight calls.
+	Max int
+}
+
+// loadShedder tracks in-flight calls and rejects calls over the limits.
+type loadShedder struct {
+	mu       sync.Mutex
+	inFlight int
+	methods  map[string]int
+
+	// limit is the current overall limit, which changes with latency if adaptive limiting is enabled.
+	limit float64
+}
+
+// newLoadShedder creates a load shedder if any in-flight limit is set, or returns nil.
+func (h *Hoster) newLoadShedder() *loadShedder {
+	if h.MaxInFlight <= 0 && len(h.ConcurrencyLimits) == 0 {
+		return nil
+	}
+
+	metrics.Set("concurrency_limit", expvarInt(int64(h.MaxInFlight)))
+	return &loadShedder{
+		methods: map[string]int{},
+		limit:   float64(h.MaxInFlight),
+	}
+}
+
+// admit will count a call as in flight, or return false if it should be shed.
+func (h *Hoster) admit(method string, priority string) bool {
+	s := h.shedder
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	share := 1.0
+	if priority == PriorityLow {
+		share = lowPriorityShare
+	}
+
+	if priority != PriorityCritical {
+		if s.limit > 0 && float64(s.inFlight) >= math.Max(1, math.Floor(s.limit*share)) {
+			return false
+		}
+		for _, l := range h.ConcurrencyLimits {
+			if matchPattern(l.Method, method) && float64(s.methods[l.Method]) >= math.Max(1, math.Floor(float64(l.Max)*share)) {
+				return false
+			}
+		}
+	}
+
+	s.inFlight++
+	for _, l := range h.ConcurrencyLimits {
+		if matchPattern(l.Method, method) {
+			s.methods[l.Method]++
+		}
+	}
+	metrics.Add("in_flight", 1)
+
+	return true
+}
+
+// release will stop counting a call as in flight. If latency is greater than zero and adaptive limiting is enabled, the overall limit is decreased if the call was slower than the target or slowly increased if it was not.
+func (h *Hoster) release(method string, latency time.Duration) {
+	s := h.shedder
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	for _, l := range h.ConcurrencyLimits {
+		if matchPattern(l.Method, method) {
+			s.methods[l.Method]--
+		}
+	}
+	metrics.Add("in_flight", -1)
+
+	if h.AdaptiveLatencyTarget <= 0 || latency <= 0 {
+		return
+	}
+
+	if latency > h.AdaptiveLatencyTarget {
+		s.limit = math.Max(1, s.limit*adaptiveDecrease)
+	} else {
+		s.limit = math.Min(float64(h.MaxInFlight), s.limit+1/s.limit)
+	}
+	metrics.Set("concurrency_limit", expvarInt(int64(s.limit)))
+}
+
+// callPriority returns the priority class of a call from CriticalMethods or the priority metadata. The metadata is set by the client, so it can only lower the priority of a call.
+func (h *Hoster) callPriority(ctx context.Context, method string) string {
+	for _, critical := range h.CriticalMethods {
+		if matchPattern(critical, method) {
+			return PriorityCritical
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(PriorityHeader); len(values) > 0 && values[0] == PriorityLow {
+			return PriorityLow
+		}
+	}
+
+	return PriorityNormal
+}
+
+// shed will count a rejected call and return an Unavailable error, which the HTTP gateway converts to 503 Service Unavailable.
+func shed(method string) error {
+	metrics.Add("load_shed", 1)
+	return status.Errorf(codes.Unavailable, "server is overloaded, %v was not started", method)
+}
+
+// unaryLoadShedInterceptor will reject unary calls over the in-flight limits.
+func (h *Hoster) unaryLoadShedInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !h.admit(info.FullMethod, h.callPriority(ctx, info.FullMethod)) {
+		return nil, shed(info.FullMethod)
+	}
+
+	start := time.Now()
+	defer func() {
+		h.release(info.FullMethod, time.Since(start))
+	}()
+
+	return handler(ctx, req)
+}
+
+// streamLoadShedInterceptor will reject streaming calls over the in-flight limits. Streams count as in flight until they end, but do not affect the adaptive limit since their duration is not a measure of latency.
+func (h *Hoster) streamLoadShedInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !h.admit(info.FullMethod, h.callPriority(ss.Context(), info.FullMethod)) {
+		return shed(info.FullMethod)
+	}
+	defer h.release(info.FullMethod, 0)
+
+	return handler(srv, ss)
+}
+
+// expvarInt returns an expvar integer with a value.
+func expvarInt(value int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(value)
+	return v
+}
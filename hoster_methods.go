@@ -0,0 +1,166 @@
+package gohost
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+)
+
+// methodDesc describes a method registered with the gRPC server.
+type methodDesc struct {
+	// name is the full method name (e.g. /test.TestService/Stream).
+	name string
+
+	// clientStreams is true if the client sends a stream of messages.
+	clientStreams bool
+
+	// serverStreams is true if the server sends a stream of messages.
+	serverStreams bool
+
+	// input is the pointer type of the request message, or nil if requests are dynamic messages of inputName.
+	input reflect.Type
+
+	// output is the pointer type of the response message, or nil if responses are dynamic messages of outputName.
+	output reflect.Type
+
+	// inputName is the full name of the request message type.
+	inputName string
+
+	// outputName is the full name of the response message type.
+	outputName string
+
+	// codec reads and writes the dynamic messages of a method whose message types are not linked into the program.
+	codec *dynamic.Codec
+
+	// http is the google.api.http annotation of the method, or nil if it has none.
+	http *annotations.HttpRule
+}
+
+// newInput returns an empty request message.
+func (m *methodDesc) newInput() proto.Message {
+	if m.input == nil {
+		return dynamic.NewMessage(m.codec, m.inputName)
+	}
+
+	return reflect.New(m.input.Elem()).Interface().(proto.Message)
+}
+
+// newOutput returns an empty response message.
+func (m *methodDesc) newOutput() proto.Message {
+	if m.output == nil {
+		return dynamic.NewMessage(m.codec, m.outputName)
+	}
+
+	return reflect.New(m.output.Elem()).Interface().(proto.Message)
+}
+
+// registeredMethods returns the methods registered with a gRPC server, by full method name. Message types are found from the file descriptor registered by the generated code of each service, so methods of services without one are left out.
+func registeredMethods(server *grpc.Server) map[string]*methodDesc {
+	methods := map[string]*methodDesc{}
+	for serviceName, info := range server.GetServiceInfo() {
+		file, ok := info.Metadata.(string)
+		if !ok {
+			continue
+		}
+		fd, err := loadFileDescriptor(file)
+		if err != nil {
+			continue
+		}
+
+		for _, sd := range fd.Service {
+			if qualifiedName(fd.GetPackage(), sd.GetName()) != serviceName {
+				continue
+			}
+			for _, md := range sd.Method {
+				if method := newMethodDesc(serviceName, md, nil); method != nil {
+					methods[method.name] = method
+				}
+			}
+		}
+	}
+
+	return methods
+}
+
+// newMethodDesc returns the description of a method of a service. Message types linked into the program are used so interceptors receive generated messages, and otherwise messages are read and written with codec. Nil is returned if the message types are neither linked nor in the descriptor set of codec, which may be nil.
+func newMethodDesc(serviceName string, md *descriptor.MethodDescriptorProto, codec *dynamic.Codec) *methodDesc {
+	method := &methodDesc{
+		name:          "/" + serviceName + "/" + md.GetName(),
+		clientStreams: md.GetClientStreaming(),
+		serverStreams: md.GetServerStreaming(),
+		inputName:     strings.TrimPrefix(md.GetInputType(), "."),
+		outputName:    strings.TrimPrefix(md.GetOutputType(), "."),
+		http:          httpRule(md),
+	}
+
+	method.input = proto.MessageType(method.inputName)
+	method.output = proto.MessageType(method.outputName)
+	if method.input != nil && method.output != nil {
+		return method
+	}
+	if codec == nil || !codec.HasMessage(method.inputName) || !codec.HasMessage(method.outputName) {
+		return nil
+	}
+
+	// generated messages and dynamic messages are not mixed, so a method is served entirely from the descriptor set
+	method.input, method.output, method.codec = nil, nil, codec
+
+	return method
+}
+
+// httpRule returns the google.api.http annotation of a method, or nil if it has none.
+func httpRule(md *descriptor.MethodDescriptorProto) *annotations.HttpRule {
+	if md.Options == nil {
+		return nil
+	}
+
+	ext, err := proto.GetExtension(md.Options, annotations.E_Http)
+	if err != nil {
+		return nil
+	}
+	rule, _ := ext.(*annotations.HttpRule)
+
+	return rule
+}
+
+// loadFileDescriptor returns the descriptor of a proto file registered by generated code.
+func loadFileDescriptor(file string) (*descriptor.FileDescriptorProto, error) {
+	gz := proto.FileDescriptor(file)
+	if gz == nil {
+		return nil, fmt.Errorf("no descriptor registered for %v", file)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor for %v: %v", file, err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor for %v: %v", file, err)
+	}
+
+	fd := &descriptor.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor for %v: %v", file, err)
+	}
+
+	return fd, nil
+}
+
+// qualifiedName returns the full name of a proto element in a package.
+func qualifiedName(pkg string, name string) string {
+	if pkg == "" {
+		return name
+	}
+
+	return pkg + "." + name
+}
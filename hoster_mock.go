@@ -0,0 +1,426 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockFixture is a canned response of the mock server for calls to a method.
+type MockFixture struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Echo). A trailing * matches any method with that prefix.
+	Method string `json:"method" yaml:"method" toml:"method"`
+
+	// Request contains request fields, by their proto names, that must have the given values for the fixture to match. Nested messages and lists are compared field by field. Leave empty to match any request.
+	Request map[string]interface{} `json:"request" yaml:"request" toml:"request"`
+
+	// Response is the response message, in the JSON mapping of the output type. Leave empty to respond with an empty message.
+	Response map[string]interface{} `json:"response" yaml:"response" toml:"response"`
+
+	// Responses are the response messages sent by a server-streaming method. Leave empty to send Response once.
+	Responses []map[string]interface{} `json:"responses" yaml:"responses" toml:"responses"`
+
+	// Code is the status code (e.g. NotFound, NOT_FOUND or 5) to fail the call with. Leave blank to succeed.
+	Code string `json:"code" yaml:"code" toml:"code"`
+
+	// Message is the status message sent with Code.
+	Message string `json:"message" yaml:"message" toml:"message"`
+
+	// Latency is how long to wait before responding (e.g. 250ms), added to MockLatency. Leave blank to not wait.
+	Latency string `json:"latency" yaml:"latency" toml:"latency"`
+
+	// code is the parsed Code.
+	code codes.Code
+
+	// latency is the parsed Latency.
+	latency time.Duration
+}
+
+// mockFixturesFile is the content of a mock fixtures file.
+type mockFixturesFile struct {
+	// Fixtures are matched in order and the first fixture matching the method and request is used.
+	Fixtures []MockFixture `json:"fixtures" yaml:"fixtures" toml:"fixtures"`
+}
+
+// mockServer serves canned responses for the services in a descriptor set.
+type mockServer struct {
+	// services are the service descriptions registered with the gRPC server.
+	services []*grpc.ServiceDesc
+
+	// methods contains the methods of the services, by full method name.
+	methods map[string]*methodDesc
+
+	// fixtures are the canned responses, in the order they are matched.
+	fixtures []MockFixture
+
+	// latency is added to every call.
+	latency time.Duration
+
+	// errorPercent is the percentage of calls that fail with Unavailable.
+	errorPercent int
+}
+
+// newMockServer returns a mock server for the services in DescriptorSetFile, with the fixtures in MockFixturesFile. Messages of types that are not linked into the program are read and written with the descriptors in the set, so the set alone is enough to mock a service.
+func (h *Hoster) newMockServer() (*mockServer, error) {
+	set, err := loadDescriptorSet(h.DescriptorSetFile)
+	if err != nil {
+		return nil, err
+	}
+	types := dynamic.NewSet()
+	for _, fd := range set.File {
+		types.Add(fd)
+	}
+	codec := dynamic.NewCodec(types)
+
+	m := &mockServer{
+		methods:      map[string]*methodDesc{},
+		latency:      h.MockLatency,
+		errorPercent: h.MockErrorPercent,
+	}
+	for _, fd := range set.File {
+		for _, sd := range fd.Service {
+			serviceName := qualifiedName(fd.GetPackage(), sd.GetName())
+			desc := &grpc.ServiceDesc{
+				ServiceName: serviceName,
+				HandlerType: (*interface{})(nil),
+				Metadata:    fd.GetName(),
+			}
+			for _, md := range sd.Method {
+				method := newMethodDesc(serviceName, md, codec)
+				if method == nil {
+					return nil, fmt.Errorf("failed to mock /%v/%v: message types %v and %v are not in the descriptor set, which must be compiled with its imports", serviceName, md.GetName(), md.GetInputType(), md.GetOutputType())
+				}
+				m.methods[method.name] = method
+
+				if method.clientStreams || method.serverStreams {
+					desc.Streams = append(desc.Streams, grpc.StreamDesc{
+						StreamName:    md.GetName(),
+						Handler:       m.streamHandler(method),
+						ServerStreams: method.serverStreams,
+						ClientStreams: method.clientStreams,
+					})
+				} else {
+					desc.Methods = append(desc.Methods, grpc.MethodDesc{
+						MethodName: md.GetName(),
+						Handler:    m.unaryHandler(method),
+					})
+				}
+			}
+			m.services = append(m.services, desc)
+		}
+	}
+
+	if h.MockFixturesFile != "" {
+		m.fixtures, err = loadMockFixtures(h.MockFixturesFile, m.methods)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// loadMockFixtures will read and check a YAML, JSON or TOML mock fixtures file. Responses of fixtures for a single method are checked against its output type.
+func loadMockFixtures(file string, methods map[string]*methodDesc) ([]MockFixture, error) {
+	mf := &mockFixturesFile{}
+	if err := unmarshalFile(file, "mock fixtures", mf); err != nil {
+		return nil, err
+	}
+
+	for i := range mf.Fixtures {
+		f := &mf.Fixtures[i]
+		if !strings.HasPrefix(f.Method, "/") {
+			return nil, fmt.Errorf("mock fixtures file %v: fixture %v method %q must be a full method name starting with /", file, i, f.Method)
+		}
+
+		// YAML decodes nested maps with interface{} keys, which cannot be compared with or converted to JSON
+		f.Request = normalizeMockFields(f.Request)
+		f.Response = normalizeMockFields(f.Response)
+		for j := range f.Responses {
+			f.Responses[j] = normalizeMockFields(f.Responses[j])
+		}
+
+		if f.Code != "" {
+			code, err := parseCode(f.Code)
+			if err != nil {
+				return nil, fmt.Errorf("mock fixtures file %v: fixture %v: %v", file, i, err)
+			}
+			f.code = code
+		}
+		if f.Latency != "" {
+			latency, err := time.ParseDuration(f.Latency)
+			if err != nil || latency < 0 {
+				return nil, fmt.Errorf("mock fixtures file %v: fixture %v latency %q must be a positive duration", file, i, f.Latency)
+			}
+			f.latency = latency
+		}
+
+		if method, ok := methods[f.Method]; ok {
+			if _, err := f.messages(method); err != nil {
+				return nil, fmt.Errorf("mock fixtures file %v: fixture %v: %v", file, i, err)
+			}
+		}
+	}
+
+	return mf.Fixtures, nil
+}
+
+// register will add the services to a gRPC server, skipping services that are already registered so real implementations take precedence.
+func (m *mockServer) register(server *grpc.Server) {
+	registered := server.GetServiceInfo()
+	for _, desc := range m.services {
+		if _, ok := registered[desc.ServiceName]; ok {
+			continue
+		}
+		server.RegisterService(desc, m)
+	}
+}
+
+// unaryHandler returns the gRPC handler for a unary method.
+func (m *mockServer) unaryHandler(method *methodDesc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := method.newInput()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			responses, err := m.respond(ctx, method, req.(proto.Message))
+			if err != nil {
+				return nil, err
+			}
+			return responses[0], nil
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: method.name,
+		}
+
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// streamHandler returns the gRPC handler for a streaming method. Every request is read before responding, and fixtures are matched against the last request.
+func (m *mockServer) streamHandler(method *methodDesc) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		req := method.newInput()
+		if method.clientStreams {
+			for {
+				in := method.newInput()
+				err := stream.RecvMsg(in)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				req = in
+			}
+		} else if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+
+		responses, err := m.respond(stream.Context(), method, req)
+		if err != nil {
+			return err
+		}
+		if !method.serverStreams {
+			responses = responses[:1]
+		}
+		for _, resp := range responses {
+			if err := stream.SendMsg(resp); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// respond returns the response messages for a request, after waiting for the configured latency. An error is returned if the fixture has a status code or an error is injected.
+func (m *mockServer) respond(ctx context.Context, method *methodDesc, req proto.Message) ([]proto.Message, error) {
+	f := m.findFixture(method.name, req)
+
+	latency := m.latency
+	if f != nil {
+		latency += f.latency
+	}
+	if err := waitContext(ctx, latency); err != nil {
+		return nil, err
+	}
+
+	if rollPercent(m.errorPercent) {
+		return nil, status.Error(codes.Unavailable, "mock error injected")
+	}
+
+	if f == nil {
+		return []proto.Message{method.newOutput()}, nil
+	}
+	if f.code != codes.OK {
+		return nil, status.Error(f.code, f.Message)
+	}
+	responses, err := f.messages(method)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid mock fixture for %v: %v", method.name, err)
+	}
+
+	return responses, nil
+}
+
+// findFixture returns the first fixture matching a method and request, or nil if none match.
+func (m *mockServer) findFixture(method string, req proto.Message) *MockFixture {
+	var fields interface{}
+	for i := range m.fixtures {
+		f := &m.fixtures[i]
+		if !matchPattern(f.Method, method) {
+			continue
+		}
+		if len(f.Request) == 0 {
+			return f
+		}
+
+		// convert the request to JSON once, with default values so fixtures can match them
+		if fields == nil {
+			marshaler := jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+			s, err := marshaler.MarshalToString(req)
+			if err != nil {
+				return nil
+			}
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			if err := dec.Decode(&fields); err != nil {
+				return nil
+			}
+		}
+		if matchMockValue(f.Request, fields) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// messages returns the response messages of the fixture, in the output type of a method.
+func (f *MockFixture) messages(method *methodDesc) ([]proto.Message, error) {
+	values := f.Responses
+	if len(values) == 0 {
+		values = []map[string]interface{}{f.Response}
+	}
+
+	msgs := make([]proto.Message, len(values))
+	for i, value := range values {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert response to JSON: %v", err)
+		}
+		msg := method.newOutput()
+		if err := jsonpb.Unmarshal(bytes.NewReader(b), msg); err != nil {
+			return nil, fmt.Errorf("response is not a valid %v: %v", proto.MessageName(msg), err)
+		}
+		msgs[i] = msg
+	}
+
+	return msgs, nil
+}
+
+// matchMockValue returns true if every field of want has the same value in got. Scalars are compared by their text, so numbers and strings of 64-bit integers match.
+func matchMockValue(want interface{}, got interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !matchMockValue(v, g[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !matchMockValue(w[i], g[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return fmt.Sprint(want) == fmt.Sprint(got)
+	}
+}
+
+// normalizeMockFields returns fields with nested maps keyed by interface{} converted to maps keyed by string.
+func normalizeMockFields(fields map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		m[k] = normalizeMockValue(v)
+	}
+
+	return m
+}
+
+// normalizeMockValue returns a field value with maps keyed by interface{} converted to maps keyed by string, and lists of maps converted to lists of values.
+func normalizeMockValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = normalizeMockValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		return normalizeMockFields(t)
+	case []map[string]interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = normalizeMockFields(e)
+		}
+		return l
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = normalizeMockValue(e)
+		}
+		return l
+	default:
+		return t
+	}
+}
+
+// parseCode returns the status code with a name (e.g. NotFound or NOT_FOUND) or number.
+func parseCode(s string) (codes.Code, error) {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+
+	var code codes.Code
+	if _, err := strconv.Atoi(s); err != nil {
+		s = strconv.Quote(s)
+	}
+	if err := code.UnmarshalJSON([]byte(s)); err != nil {
+		return codes.OK, fmt.Errorf("invalid status code %q", strings.Trim(s, `"`))
+	}
+
+	return code, nil
+}
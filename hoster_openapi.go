@@ -0,0 +1,63 @@
+package gohost
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// openAPIDocInfo describes an OpenAPI document in the list served at OpenAPIPath.
+type openAPIDocInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// RegisterOpenAPIDoc will add an OpenAPI document (such as the swagger output of protoc) to be served on the HTTP endpoint at OpenAPIPath followed by the name and .json. Registering a document with the same name again replaces it.
+func (h *Hoster) RegisterOpenAPIDoc(name string, doc []byte) {
+	if h.openAPIDocs == nil {
+		h.openAPIDocs = map[string][]byte{}
+	}
+	h.openAPIDocs[name] = doc
+}
+
+// serveOpenAPI will respond to GET requests under OpenAPIPath with the registered documents, or with the list of documents for OpenAPIPath itself. Other requests are passed to next.
+func (h *Hoster) serveOpenAPI(next http.Handler) http.Handler {
+	prefix := strings.TrimSuffix(h.OpenAPIPath, "/") + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) && r.URL.Path != strings.TrimSuffix(prefix, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeHTTPError(w, http.StatusMethodNotAllowed, codes.Unimplemented, "method not allowed")
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		if name == "" || name == strings.TrimSuffix(prefix, "/") {
+			docs := []openAPIDocInfo{}
+			for name := range h.openAPIDocs {
+				docs = append(docs, openAPIDocInfo{Name: name, Path: prefix + name + ".json"})
+			}
+			sort.Slice(docs, func(i, j int) bool {
+				return docs[i].Name < docs[j].Name
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(docs)
+			return
+		}
+
+		doc, ok := h.openAPIDocs[strings.TrimSuffix(name, ".json")]
+		if !ok || !strings.HasSuffix(name, ".json") {
+			writeHTTPError(w, http.StatusNotFound, codes.NotFound, "unknown OpenAPI document "+name)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
@@ -0,0 +1,382 @@
+package gohost
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// retryAfterHeader is the HTTP header and gRPC metadata key used to tell a rate limited caller how many seconds to wait.
+const retryAfterHeader = "retry-after"
+
+// RateLimitKey selects what a rate limit counts requests by.
+type RateLimitKey string
+
+const (
+	// RateLimitByIP counts requests by the address of the client. Calls through the HTTP gateway are counted by the address of the HTTP client.
+	RateLimitByIP RateLimitKey = "ip"
+
+	// RateLimitByPrincipal counts requests by the subject of the authenticated caller (see Authenticators). Unauthenticated requests are counted by the address of the client.
+	RateLimitByPrincipal RateLimitKey = "principal"
+
+	// RateLimitByAPIKey counts requests by the subject of a caller authenticated with an API key (see APIKeyAuthenticator). Keys are never counted before they are verified, so other requests are counted by the address of the client.
+	RateLimitByAPIKey RateLimitKey = "apikey"
+
+	// RateLimitByMethod counts every request to the method or route together.
+	RateLimitByMethod RateLimitKey = "method"
+)
+
+// RateLimit is a token bucket limit on calls to gRPC methods or HTTP routes. Each distinct key gets its own bucket.
+type RateLimit struct {
+	// Method is a full gRPC method name (e.g. /test.TestService/Send) to limit on the gRPC endpoint, including calls forwarded by the HTTP gateway. A trailing * matches any method with that prefix.
+	Method string `json:"method,omitempty"`
+
+	// Route is an HTTP method and path (e.g. POST /v1/send) to limit on the HTTP endpoint. The HTTP method may be * to match any method and a trailing * on the path matches any path with that prefix.
+	Route string `json:"route,omitempty"`
+
+	// Key is what requests are counted by. Default is RateLimitByIP.
+	Key RateLimitKey `json:"key,omitempty"`
+
+	// Rate is the number of requests allowed per second.
+	Rate float64 `json:"rate"`
+
+	// Burst is the number of requests allowed at once. Leave as zero to use Rate rounded up.
+	Burst int `json:"burst,omitempty"`
+}
+
+// burst returns the size of the token bucket.
+func (l *RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return int(math.Max(1, math.Ceil(l.Rate)))
+}
+
+// RateLimitStore holds the token buckets for rate limits. Implement it to share limits between instances of a service.
+type RateLimitStore interface {
+	// Take will remove a token from every bucket if each of them has one, and otherwise leave them all unchanged. Buckets are refilled at their rate up to their burst. It returns true if the tokens were taken, or false and how long until every bucket has a token.
+	Take(ctx context.Context, buckets []RateLimitBucket) (bool, time.Duration, error)
+}
+
+// RateLimitBucket identifies a token bucket and how it is refilled.
+type RateLimitBucket struct {
+	// Key is the name of the bucket.
+	Key string
+
+	// Rate is how many tokens are added to the bucket per second.
+	Rate float64
+
+	// Burst is the most tokens the bucket can hold.
+	Burst int
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps token buckets in memory. It is used by default.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket is the state of a single token bucket.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	rate    float64
+	burst   int
+}
+
+// rateLimitSweepInterval is how often full buckets are removed from a MemoryRateLimitStore.
+const rateLimitSweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Take will remove a token from every bucket if each of them has one.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, buckets []RateLimitBucket) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	// check every bucket before taking any tokens, so a denied request does not use up the other limits
+	allowed := true
+	var wait time.Duration
+	found := make([]*tokenBucket, len(buckets))
+	for i, bucket := range buckets {
+		b, ok := s.buckets[bucket.Key]
+		if !ok {
+			b = &tokenBucket{tokens: float64(bucket.Burst), updated: now}
+			s.buckets[bucket.Key] = b
+		}
+		b.rate = bucket.Rate
+		b.burst = bucket.Burst
+		b.refill(now)
+		found[i] = b
+
+		if b.tokens < 1 {
+			allowed = false
+			if w := time.Duration((1 - b.tokens) / b.rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if !allowed {
+		return false, wait, nil
+	}
+
+	for _, b := range found {
+		b.tokens--
+	}
+
+	return true, 0, nil
+}
+
+// sweep will remove buckets that have refilled completely, since they are the same as a new bucket.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// refill will add the tokens earned since the bucket was last updated.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.burst), b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+}
+
+// rateLimitCaller contains the values a request can be counted by.
+type rateLimitCaller struct {
+	ip        string
+	principal string
+
+	// apiKey is the subject of a principal authenticated with an API key.
+	apiKey string
+}
+
+// setPrincipal will count the request by an authenticated principal, and by its API key if it was authenticated with one.
+func (c *rateLimitCaller) setPrincipal(p *Principal) {
+	c.principal = p.Subject
+	if p.Method == "apikey" {
+		c.apiKey = p.Subject
+	}
+}
+
+// bucketKey returns the key of the bucket a request is counted in.
+func (l *RateLimit) bucketKey(pattern string, caller rateLimitCaller) string {
+	var value string
+	switch l.Key {
+	case RateLimitByPrincipal:
+		value = "principal:" + caller.principal
+		if caller.principal == "" {
+			value = "ip:" + caller.ip
+		}
+	case RateLimitByAPIKey:
+		value = "apikey:" + caller.apiKey
+		if caller.apiKey == "" {
+			value = "ip:" + caller.ip
+		}
+	case RateLimitByMethod:
+		value = "method"
+	default:
+		value = "ip:" + caller.ip
+	}
+
+	return pattern + "|" + value
+}
+
+// takeRateLimits will take a token for each matching rate limit if every limit allows the request. It returns true if the request is allowed, or false and how long to wait. Store errors are counted and logged, and the request is allowed.
+func (h *Hoster) takeRateLimits(ctx context.Context, match func(l *RateLimit) (string, bool), caller rateLimitCaller) (bool, time.Duration) {
+	buckets := []RateLimitBucket{}
+	limits := h.loadLive().rateLimits
+	for i := range limits {
+		limit := &limits[i]
+		pattern, ok := match(limit)
+		if !ok {
+			continue
+		}
+
+		buckets = append(buckets, RateLimitBucket{
+			Key:   limit.bucketKey(pattern, caller),
+			Rate:  limit.Rate,
+			Burst: limit.burst(),
+		})
+	}
+	if len(buckets) == 0 {
+		return true, 0
+	}
+
+	allowed, wait, err := h.rateLimitStore.Take(ctx, buckets)
+	if err != nil {
+		metrics.Add("rate_limit_errors", 1)
+		h.logf("Failed to check rate limits: %v", err)
+		return true, 0
+	}
+	if !allowed {
+		metrics.Add("rate_limited", 1)
+	}
+
+	return allowed, wait
+}
+
+// checkGRPCRateLimits returns a ResourceExhausted error with RetryInfo if a rate limit for the method has been reached.
+func (h *Hoster) checkGRPCRateLimits(ctx context.Context, method string, setHeader func(metadata.MD) error) error {
+	caller := rateLimitCaller{}
+	if call := gatewayCallFromContext(ctx); call != nil {
+		caller.ip = call.clientIP
+	} else if p, ok := peer.FromContext(ctx); ok {
+		caller.ip = hostOnly(p.Addr.String())
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		caller.setPrincipal(p)
+	}
+
+	allowed, wait := h.takeRateLimits(ctx, func(l *RateLimit) (string, bool) {
+		return l.Method, l.Method != "" && matchPattern(l.Method, method)
+	}, caller)
+	if allowed {
+		return nil
+	}
+
+	// the gateway converts this header to a Retry-After header on the HTTP response
+	setHeader(metadata.Pairs(retryAfterHeader, retryAfterSeconds(wait)))
+
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded for %v", method)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(wait)}); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+// unaryRateLimitInterceptor will apply rate limits to unary calls.
+func (h *Hoster) unaryRateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	err := h.checkGRPCRateLimits(ctx, info.FullMethod, func(md metadata.MD) error {
+		return grpc.SetHeader(ctx, md)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamRateLimitInterceptor will apply rate limits to streaming calls when the stream is opened.
+func (h *Hoster) streamRateLimitInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := h.checkGRPCRateLimits(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// rateLimitHTTP will apply rate limits for HTTP routes, responding with 429 Too Many Requests and a Retry-After header when a limit has been reached.
+func (h *Hoster) rateLimitHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.hasRouteRateLimits() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.Method + " " + r.URL.Path
+		caller := rateLimitCaller{
+			ip: hostOnly(r.RemoteAddr),
+		}
+		if p := h.httpPrincipal(r); p != nil {
+			caller.setPrincipal(p)
+		}
+
+		allowed, wait := h.takeRateLimits(r.Context(), func(l *RateLimit) (string, bool) {
+			return l.Route, l.Route != "" && matchRoute(l.Route, route)
+		}, caller)
+		if !allowed {
+			w.Header().Set(retryAfterHeader, retryAfterSeconds(wait))
+			writeHTTPError(w, http.StatusTooManyRequests, codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded for %v", route))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasRouteRateLimits returns true if any rate limit applies to HTTP routes.
+func (h *Hoster) hasRouteRateLimits() bool {
+	limits := h.loadLive().rateLimits
+	for i := range limits {
+		if limits[i].Route != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// httpPrincipal returns the principal for the credentials in the headers of an HTTP request, or nil if the request cannot be authenticated.
+func (h *Hoster) httpPrincipal(r *http.Request) *Principal {
+	md := metadata.MD{}
+	for _, header := range []string{"authorization", APIKeyHeader} {
+		if value := r.Header.Get(header); value != "" {
+			md.Set(header, value)
+		}
+	}
+
+	for _, authenticator := range h.Authenticators {
+		p, err := authenticator.Authenticate(r.Context(), md)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		return p
+	}
+
+	return nil
+}
+
+// retryAfterSeconds returns the whole number of seconds to wait, rounded up and at least 1.
+func retryAfterSeconds(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return strconv.Itoa(seconds)
+}
+
+// hostOnly returns the host of an address with a port, or the address if it has no port.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
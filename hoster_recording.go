@@ -0,0 +1,586 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultRecordingMaxSize is the default size of the recording file in bytes before it is rotated.
+	DefaultRecordingMaxSize = 1024 * 1024 * 100
+
+	// DefaultRecordingMaxFiles is the default number of rotated recording files kept.
+	DefaultRecordingMaxFiles = 5
+
+	// RedactedValue replaces the values of redacted metadata and headers in recorded calls.
+	RedactedValue = "REDACTED"
+)
+
+// Recording is a call to the gRPC or HTTP endpoint written to the recording file (see RecordingFile). Calls forwarded by the HTTP endpoint are recorded as HTTP requests only.
+type Recording struct {
+	// Time is when the call started.
+	Time time.Time `json:"time"`
+
+	// Duration is how long the call took, in nanoseconds.
+	Duration time.Duration `json:"duration"`
+
+	// Method is the full gRPC method name of a gRPC call (e.g. /test.TestService/Echo).
+	Method string `json:"method,omitempty"`
+
+	// ClientStreams is true if the client of a gRPC call sends a stream of messages.
+	ClientStreams bool `json:"client_streams,omitempty"`
+
+	// ServerStreams is true if the server of a gRPC call sends a stream of messages.
+	ServerStreams bool `json:"server_streams,omitempty"`
+
+	// RequestType is the full name of the request message type of a gRPC call (e.g. test.SendRequest).
+	RequestType string `json:"request_type,omitempty"`
+
+	// ResponseType is the full name of the response message type of a gRPC call.
+	ResponseType string `json:"response_type,omitempty"`
+
+	// HTTPMethod is the method of an HTTP request (e.g. GET).
+	HTTPMethod string `json:"http_method,omitempty"`
+
+	// Path is the path and query of an HTTP request (e.g. /v1/echo?value=test).
+	Path string `json:"path,omitempty"`
+
+	// Metadata is the metadata of a gRPC call or the headers of an HTTP request. Redacted values are replaced with REDACTED.
+	Metadata map[string][]string `json:"metadata,omitempty"`
+
+	// Requests are the request messages of a gRPC call, or the body of an HTTP request, in the JSON mapping with proto field names. Redacted fields are left out.
+	Requests []json.RawMessage `json:"requests,omitempty"`
+
+	// Responses are the response messages of a gRPC call, or the JSON values of an HTTP response body, with one value for each message of a stream. Redacted fields are left out.
+	Responses []json.RawMessage `json:"responses,omitempty"`
+
+	// Body is the body of an HTTP request that is not JSON.
+	Body []byte `json:"body,omitempty"`
+
+	// ResponseBody is the body of an HTTP response that is not JSON.
+	ResponseBody []byte `json:"response_body,omitempty"`
+
+	// Truncated is true if a body, or the messages of a stream in one direction, were larger than the message size limit and were left out.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Redacted is true if a body that is not JSON was left out, since redaction rules are set and its fields cannot be found.
+	Redacted bool `json:"redacted,omitempty"`
+
+	// Code is the name of the status code of a gRPC call (e.g. NotFound).
+	Code string `json:"code,omitempty"`
+
+	// Message is the status message of a failed gRPC call.
+	Message string `json:"message,omitempty"`
+
+	// Status is the status code of an HTTP response.
+	Status int `json:"status,omitempty"`
+}
+
+// recorder writes recordings to a file as JSON lines, rotating the file when it reaches the max size.
+type recorder struct {
+	mu       sync.Mutex
+	file     string
+	maxSize  int64
+	maxFiles int
+	redact   []string
+	logf     func(format string, v ...interface{})
+	w        *os.File
+	size     int64
+}
+
+// openRecorder will open the recording file for appending, or return nil if RecordingFile is not set.
+func (h *Hoster) openRecorder() (*recorder, error) {
+	if h.RecordingFile == "" {
+		return nil, nil
+	}
+
+	r := &recorder{
+		file:     h.RecordingFile,
+		maxSize:  int64(h.RecordingMaxSize),
+		maxFiles: h.RecordingMaxFiles,
+		redact:   h.RecordingRedact,
+		logf:     h.logf,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// open will open the recording file for appending and find its current size.
+func (r *recorder) open() error {
+	f, err := os.OpenFile(r.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open recording file: %v", err)
+	}
+
+	r.w = f
+	r.size = info.Size()
+	return nil
+}
+
+// write will append a recording to the file, rotating the file first if the recording would take it over the max size.
+func (r *recorder) write(rec *Recording) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		metrics.Add("recording_errors", 1)
+		r.logf("Failed to encode recording: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(data)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			metrics.Add("recording_errors", 1)
+			r.logf("Failed to rotate recording file: %v", err)
+			if r.w == nil {
+				return
+			}
+		}
+	}
+
+	n, err := r.w.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		metrics.Add("recording_errors", 1)
+		r.logf("Failed to write recording: %v", err)
+	}
+	metrics.Add("calls_recorded", 1)
+}
+
+// rotate will rename the recording file with a .1 suffix, after renaming older files to the next suffix and removing the oldest, and open a new file.
+func (r *recorder) rotate() error {
+	if err := r.w.Close(); err != nil {
+		r.logf("Failed to close recording file: %v", err)
+	}
+	r.w = nil
+
+	if r.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%v.%v", r.file, r.maxFiles))
+		for i := r.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%v.%v", r.file, i), fmt.Sprintf("%v.%v", r.file, i+1))
+		}
+		if err := os.Rename(r.file, r.file+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.file); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// close will close the recording file.
+func (r *recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return nil
+	}
+
+	return r.w.Close()
+}
+
+// redacted returns true if a metadata key, header or field name matches a redaction rule.
+func (r *recorder) redacted(name string) bool {
+	return matchAnyFold(r.redact, name)
+}
+
+// matchAnyFold returns true if a name matches any of the patterns, ignoring case. A trailing * matches any name with that prefix.
+func matchAnyFold(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchPattern(strings.ToLower(p), strings.ToLower(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// metadata returns a copy of metadata or headers with redacted values replaced. Pseudo-headers starting with : are left out.
+func (r *recorder) metadata(md map[string][]string) map[string][]string {
+	recorded := map[string][]string{}
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		if r.redacted(key) {
+			values = []string{RedactedValue}
+		}
+		recorded[key] = append([]string(nil), values...)
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	return recorded
+}
+
+// message returns a message in the JSON mapping with proto field names, with redacted fields left out, or nil if it is not a proto message.
+func (r *recorder) message(m interface{}) json.RawMessage {
+	msg, ok := m.(proto.Message)
+	if !ok || msg == nil || reflect.ValueOf(msg).IsNil() {
+		return nil
+	}
+
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	s, err := marshaler.MarshalToString(msg)
+	if err != nil {
+		metrics.Add("recording_errors", 1)
+		r.logf("Failed to encode recorded message: %v", err)
+		return nil
+	}
+
+	return r.redactJSON(json.RawMessage(s))
+}
+
+// redactJSON returns a JSON value with redacted fields left out at any depth. A value that cannot be decoded is replaced with REDACTED, so nothing is recorded that may have a redacted field.
+func (r *recorder) redactJSON(data json.RawMessage) json.RawMessage {
+	if len(r.redact) == 0 {
+		return data
+	}
+
+	value, err := decodeJSON(data)
+	if err != nil {
+		return json.RawMessage(strconv.Quote(RedactedValue))
+	}
+	redacted, err := json.Marshal(removeFields(value, r.redact))
+	if err != nil {
+		return json.RawMessage(strconv.Quote(RedactedValue))
+	}
+
+	return redacted
+}
+
+// body returns a recorded HTTP body as JSON values with redacted fields left out, or as it is if it is not JSON. A body that is not JSON is left out if there are redaction rules, since its fields cannot be found, and the recording is marked as redacted.
+func (r *recorder) body(rec *Recording, data []byte) ([]json.RawMessage, []byte) {
+	if values, ok := splitJSONValues(data); ok {
+		for i := range values {
+			values[i] = r.redactJSON(values[i])
+		}
+		return values, nil
+	}
+	if len(r.redact) > 0 {
+		rec.Redacted = true
+		return nil, nil
+	}
+
+	return nil, data
+}
+
+// removeFields will remove the fields matching the patterns from a decoded JSON value at any depth.
+func removeFields(value interface{}, patterns []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if matchAnyFold(patterns, key) {
+				delete(v, key)
+				continue
+			}
+			v[key] = removeFields(field, patterns)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = removeFields(v[i], patterns)
+		}
+	}
+
+	return value
+}
+
+// newGRPCRecording returns a recording of a gRPC call with the metadata of the call and the message types and streaming of the method.
+func (h *Hoster) newGRPCRecording(ctx context.Context, method string, start time.Time) *Recording {
+	rec := &Recording{
+		Time:   start,
+		Method: method,
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		// the content type is set by the transport
+		md = md.Copy()
+		delete(md, "content-type")
+		rec.Metadata = h.recorder.metadata(md)
+	}
+	if desc, ok := h.methods[method]; ok {
+		rec.ClientStreams = desc.clientStreams
+		rec.ServerStreams = desc.serverStreams
+		rec.RequestType = proto.MessageName(desc.newInput())
+		rec.ResponseType = proto.MessageName(desc.newOutput())
+	}
+
+	return rec
+}
+
+// finishGRPCRecording will set the duration and status of a recording and write it.
+func (h *Hoster) finishGRPCRecording(rec *Recording, err error) {
+	rec.Duration = time.Since(rec.Time)
+	s := status.Convert(err)
+	rec.Code = s.Code().String()
+	rec.Message = s.Message()
+	h.recorder.write(rec)
+}
+
+// unaryRecordingInterceptor will record unary calls that did not come from the HTTP endpoint.
+func (h *Hoster) unaryRecordingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if gatewayCallFromContext(ctx) != nil {
+		return handler(ctx, req)
+	}
+
+	rec := h.newGRPCRecording(ctx, info.FullMethod, time.Now())
+	resp, err := handler(ctx, req)
+
+	if msg := h.recorder.message(req); msg != nil {
+		rec.Requests = append(rec.Requests, msg)
+		if rec.RequestType == "" {
+			rec.RequestType = proto.MessageName(req.(proto.Message))
+		}
+	}
+	if msg := h.recorder.message(resp); msg != nil && err == nil {
+		rec.Responses = append(rec.Responses, msg)
+		if rec.ResponseType == "" {
+			rec.ResponseType = proto.MessageName(resp.(proto.Message))
+		}
+	}
+	h.finishGRPCRecording(rec, err)
+
+	return resp, err
+}
+
+// streamRecordingInterceptor will record streaming calls that did not come from the HTTP endpoint, with every message received and sent.
+func (h *Hoster) streamRecordingInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if gatewayCallFromContext(ss.Context()) != nil {
+		return handler(srv, ss)
+	}
+
+	live := h.loadLive()
+	rec := h.newGRPCRecording(ss.Context(), info.FullMethod, time.Now())
+	rec.ClientStreams = info.IsClientStream
+	rec.ServerStreams = info.IsServerStream
+	stream := &recordingServerStream{
+		ServerStream: ss,
+		recorder:     h.recorder,
+		requests:     limitedMessages{limit: live.maxRecvMsgSize},
+		responses:    limitedMessages{limit: live.maxSendMsgSize},
+	}
+	err := handler(srv, stream)
+
+	rec.Requests = stream.requests.messages
+	rec.Responses = stream.responses.messages
+	rec.Truncated = stream.requests.overflow || stream.responses.overflow
+	h.finishGRPCRecording(rec, err)
+
+	return err
+}
+
+// recordingServerStream is a server stream that keeps the messages received and sent for a recording. Messages may be received and sent at the same time, so each only changes its own fields.
+type recordingServerStream struct {
+	grpc.ServerStream
+	recorder  *recorder
+	requests  limitedMessages
+	responses limitedMessages
+}
+
+// RecvMsg receives a message and keeps it as a request.
+func (s *recordingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && !s.requests.overflow {
+		if msg := s.recorder.message(m); msg != nil {
+			s.requests.add(msg)
+		}
+	}
+
+	return err
+}
+
+// SendMsg sends a message and keeps it as a response.
+func (s *recordingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil && !s.responses.overflow {
+		if msg := s.recorder.message(m); msg != nil {
+			s.responses.add(msg)
+		}
+	}
+
+	return err
+}
+
+// limitedMessages keeps the messages of a stream until their total size is more than limit bytes, like limitedBuffer does for HTTP bodies.
+type limitedMessages struct {
+	messages []json.RawMessage
+	size     int
+	limit    int
+	overflow bool
+}
+
+// add keeps a message if it fits within the limit, or drops every message once the limit has been passed.
+func (m *limitedMessages) add(msg json.RawMessage) {
+	if m.overflow {
+		return
+	}
+	if m.limit > 0 && m.size+len(msg) > m.limit {
+		m.overflow = true
+		m.messages = nil
+		return
+	}
+
+	m.size += len(msg)
+	m.messages = append(m.messages, msg)
+}
+
+// recordHTTP will record requests to the HTTP endpoint with their responses. WebSocket connections are not recorded.
+func (h *Hoster) recordHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		live := h.loadLive()
+		rec := &Recording{
+			Time:       time.Now(),
+			HTTPMethod: r.Method,
+			Path:       r.URL.RequestURI(),
+			Metadata:   h.recorder.metadata(r.Header),
+		}
+
+		// keep a copy of the body as it is read by the handler
+		body := &limitedBuffer{limit: live.maxRequestBodySize}
+		var tee *teeReadCloser
+		if r.Body != nil && r.Body != http.NoBody {
+			tee = &teeReadCloser{Reader: io.TeeReader(r.Body, body), Closer: r.Body}
+			r.Body = tee
+		}
+		rw := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK, body: limitedBuffer{limit: live.maxSendMsgSize}}
+
+		next.ServeHTTP(rw, r)
+
+		// read the rest of the body, such as for routes that do not use it, so the whole request is replayed
+		if tee != nil && !body.overflow {
+			io.Copy(ioutil.Discard, io.LimitReader(tee, int64(live.maxRequestBodySize)+1-int64(body.Len())))
+		}
+
+		rec.Duration = time.Since(rec.Time)
+		rec.Status = rw.status
+		rec.Truncated = body.overflow || rw.body.overflow
+		if !body.overflow && body.Len() > 0 {
+			rec.Requests, rec.Body = h.recorder.body(rec, body.Bytes())
+		}
+		if !rw.body.overflow && rw.body.Len() > 0 {
+			rec.Responses, rec.ResponseBody = h.recorder.body(rec, rw.body.Bytes())
+		}
+		h.recorder.write(rec)
+	})
+}
+
+// splitJSONValues returns the JSON values in data, such as the messages of a streamed gateway response, or false if data is not a sequence of JSON values.
+func splitJSONValues(data []byte) ([]json.RawMessage, bool) {
+	values := []json.RawMessage{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+
+	return values, len(values) > 0
+}
+
+// limitedBuffer is a buffer that stops keeping data once more than limit bytes have been written.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+// Write keeps the data if it fits within the limit. It never fails, so it can be used to copy a stream.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+
+	return b.Buffer.Write(p)
+}
+
+// teeReadCloser is a request body that copies what is read, closing the original body.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordingResponseWriter is a response writer that keeps a copy of the status and body of the response.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        limitedBuffer
+}
+
+// WriteHeader records the status code and writes it.
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the data and writes it.
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client.
+func (w *recordingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify returns a channel that receives a value when the client goes away.
+func (w *recordingResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
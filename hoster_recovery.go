@@ -0,0 +1,170 @@
+package gohost
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is the HTTP header and gRPC metadata key used to identify a request in logs.
+const RequestIDHeader = "x-request-id"
+
+// PanicInfo describes a panic recovered on the gRPC or HTTP endpoint.
+type PanicInfo struct {
+	// Method is the full gRPC method name (e.g. /test.TestService/Echo) or the HTTP method and path (e.g. GET /v1/echo).
+	Method string
+
+	// RequestID is the value of the x-request-id metadata or header, if present.
+	RequestID string
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+// PanicHandler is used to report a panic recovered on the gRPC or HTTP endpoint.
+type PanicHandler func(ctx context.Context, info PanicInfo)
+
+// unaryRecoveryInterceptor will convert a panic in a unary handler or interceptor into an Internal error.
+func (h *Hoster) unaryRecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.reportPanic(ctx, "grpc_panics", PanicInfo{
+				Method:    info.FullMethod,
+				RequestID: grpcRequestID(ctx),
+				Value:     p,
+				Stack:     debug.Stack(),
+			})
+			err = status.Errorf(codes.Internal, "panic in %v", info.FullMethod)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// streamRecoveryInterceptor will convert a panic in a stream handler or interceptor into an Internal error.
+func (h *Hoster) streamRecoveryInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.reportPanic(ss.Context(), "grpc_panics", PanicInfo{
+				Method:    info.FullMethod,
+				RequestID: grpcRequestID(ss.Context()),
+				Value:     p,
+				Stack:     debug.Stack(),
+			})
+			err = status.Errorf(codes.Internal, "panic in %v", info.FullMethod)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+// recoverHTTP will convert a panic in an HTTP handler into a 500 response, unless the response has already started.
+func (h *Hoster) recoverHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// let the server abort the response as intended
+				panic(p)
+			}
+
+			h.reportPanic(r.Context(), "http_panics", PanicInfo{
+				Method:    fmt.Sprintf("%v %v", r.Method, r.URL.Path),
+				RequestID: r.Header.Get(RequestIDHeader),
+				Value:     p,
+				Stack:     debug.Stack(),
+			})
+			if !rw.wroteHeader {
+				writeHTTPError(w, http.StatusInternalServerError, codes.Internal, fmt.Sprintf("panic in %v %v", r.Method, r.URL.Path))
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// reportPanic will log a recovered panic, count it and pass it to the panic handler.
+func (h *Hoster) reportPanic(ctx context.Context, counter string, info PanicInfo) {
+	h.logf("Recovered from panic in %v (request ID: %v): %v\n%s", info.Method, info.RequestID, info.Value, info.Stack)
+	metrics.Add(counter, 1)
+
+	if h.PanicHandler != nil {
+		h.PanicHandler(ctx, info)
+	}
+}
+
+// grpcRequestID returns the request ID from incoming gRPC metadata, if present.
+func grpcRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(RequestIDHeader); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// recoveryResponseWriter tracks whether a response has started so a panic does not write a second header.
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader records that the response has started.
+func (w *recoveryResponseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records that the response has started.
+func (w *recoveryResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush will flush the response if supported, which is needed for streaming gateway responses.
+func (w *recoveryResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// CloseNotify will pass through to the underlying response writer, which the gateway uses to cancel requests.
+func (w *recoveryResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// Hijack will pass through to the underlying response writer, which the WebSocket bridge uses to take over the connection.
+func (w *recoveryResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	w.wroteHeader = true
+	return hj.Hijack()
+}
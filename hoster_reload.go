@@ -0,0 +1,290 @@
+package gohost
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// reloadTag is the struct tag on Hoster fields that marks whether a field can be changed by Reload without a restart.
+const reloadTag = "reload"
+
+// liveConfig contains the settings used by running endpoints that can be changed by Reload.
+type liveConfig struct {
+	maxSendMsgSize     int
+	maxRecvMsgSize     int
+	maxRequestBodySize int
+	cert               *tls.Certificate
+	policies           *policyFile
+	webSocketOrigins   []string
+	grpcWebOrigins     []string
+	rateLimits         []RateLimit
+}
+
+// Reload will load the configuration sources passed to LoadConfig again, validate the result and apply settings that can change while running. The hoster is left unchanged if loading or validation fails. The config keys of changed settings that require a restart are returned. Settings missing from the sources keep their current value.
+func (h *Hoster) Reload() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.configSource == nil {
+		return nil, errors.New("no configuration source to reload, call LoadConfig first")
+	}
+
+	// load the configuration into a copy of the hoster
+	next := &Hoster{
+		GRPCListener: h.GRPCListener,
+		HTTPListener: h.HTTPListener,
+		grpcServers:  h.grpcServers,
+		httpGateways: h.httpGateways,
+	}
+	nextFields := next.configFields()
+	for key, field := range h.configFields() {
+		nextFields[key].Set(field)
+	}
+	err := next.loadConfig(h.configSource.file, h.configSource.envPrefix, h.configSource.flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	if err := h.checkMsgSizeCeilings(next); err != nil {
+		return nil, err
+	}
+
+	// load the certificate again even if the file names have not changed, since the files may have been replaced
+	var cert *tls.Certificate
+	if next.isTLSEnabled() {
+		c, err := tls.LoadX509KeyPair(next.CertFile, next.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS credentials: %v", err)
+		}
+		cert = &c
+	}
+
+	// load the policies again even if the file name has not changed, since the file may have been edited
+	var policies *policyFile
+	if next.PolicyFile != "" {
+		policies, err = loadPolicyFile(next.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// apply live settings and collect the rest
+	restart := []string{}
+	tlsToggled := h.isTLSEnabled() != next.isTLSEnabled()
+	cur := reflect.ValueOf(h).Elem()
+	nxt := reflect.ValueOf(next).Elem()
+	t := cur.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get(configTag)
+		if key == "" || reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			continue
+		}
+
+		live := t.Field(i).Tag.Get(reloadTag) == "live"
+		if (key == "cert_file" || key == "key_file") && tlsToggled {
+			live = false
+		}
+		if (key == "max_send_msg_size" || key == "max_recv_msg_size") && !h.EnableReload {
+			// without EnableReload the sizes are fixed transport limits set at startup
+			live = false
+		}
+		if !live {
+			restart = append(restart, key)
+			continue
+		}
+
+		cur.Field(i).Set(nxt.Field(i))
+	}
+	h.restartRequired = restart
+
+	lc := &liveConfig{
+		maxSendMsgSize:     h.MaxSendMsgSize,
+		maxRecvMsgSize:     h.MaxRecvMsgSize,
+		maxRequestBodySize: h.requestBodyLimit(),
+		cert:               h.loadLive().cert,
+		policies:           policies,
+		webSocketOrigins:   h.WebSocketOrigins,
+		grpcWebOrigins:     h.GRPCWebOrigins,
+		rateLimits:         h.RateLimits,
+	}
+	if !tlsToggled {
+		lc.cert = cert
+	}
+	h.live.Store(lc)
+
+	return restart, nil
+}
+
+// initLive will load the settings used by running endpoints.
+func (h *Hoster) initLive() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	lc := &liveConfig{
+		maxSendMsgSize:     h.MaxSendMsgSize,
+		maxRecvMsgSize:     h.MaxRecvMsgSize,
+		maxRequestBodySize: h.requestBodyLimit(),
+		webSocketOrigins:   h.WebSocketOrigins,
+		grpcWebOrigins:     h.GRPCWebOrigins,
+		rateLimits:         h.RateLimits,
+	}
+
+	if h.isTLSEnabled() {
+		cert, err := tls.LoadX509KeyPair(h.CertFile, h.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS credentials: %v", err)
+		}
+		lc.cert = &cert
+	}
+
+	if h.PolicyFile != "" {
+		policies, err := loadPolicyFile(h.PolicyFile)
+		if err != nil {
+			return err
+		}
+		lc.policies = policies
+	}
+
+	h.live.Store(lc)
+
+	return nil
+}
+
+// checkMsgSizeCeilings returns a *ValidationError if the message sizes of next are larger than the gRPC transport allows, since the transport limits cannot change without a restart.
+func (h *Hoster) checkMsgSizeCeilings(next *Hoster) error {
+	errs := []error{}
+	if h.maxSendMsgSizeCeiling > 0 && next.MaxSendMsgSize > h.maxSendMsgSizeCeiling {
+		errs = append(errs, fmt.Errorf("max send message size %v is larger than the transport limit of %v set at startup", next.MaxSendMsgSize, h.maxSendMsgSizeCeiling))
+	}
+	if h.maxRecvMsgSizeCeiling > 0 && next.MaxRecvMsgSize > h.maxRecvMsgSizeCeiling {
+		errs = append(errs, fmt.Errorf("max receive message size %v is larger than the transport limit of %v set at startup", next.MaxRecvMsgSize, h.maxRecvMsgSizeCeiling))
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// requestBodyLimit returns the maximum size of a request body on the HTTP endpoint.
+func (h *Hoster) requestBodyLimit() int {
+	if h.MaxRequestBodySize > 0 {
+		return h.MaxRequestBodySize
+	}
+
+	return h.MaxRecvMsgSize
+}
+
+// loadLive returns the settings used by running endpoints.
+func (h *Hoster) loadLive() *liveConfig {
+	lc, _ := h.live.Load().(*liveConfig)
+	if lc == nil {
+		return &liveConfig{}
+	}
+
+	return lc
+}
+
+// getCertificate returns the current TLS certificate for a handshake.
+func (h *Hoster) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := h.loadLive().cert
+	if cert == nil {
+		return nil, errors.New("no TLS certificate loaded")
+	}
+
+	return cert, nil
+}
+
+// watchConfig will reload the configuration on SIGHUP or when the config file changes, until done is closed.
+func (h *Hoster) watchConfig(done <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var file string
+	if h.configSource != nil {
+		file = h.configSource.file
+	}
+
+	var tick <-chan time.Time
+	if h.ReloadInterval > 0 && file != "" {
+		ticker := time.NewTicker(h.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	modTime := fileModTime(file)
+	for {
+		select {
+		case <-done:
+			return
+		case <-sighup:
+			h.reloadAndLog()
+		case <-tick:
+			if t := fileModTime(file); !t.Equal(modTime) {
+				modTime = t
+				h.reloadAndLog()
+			}
+		}
+	}
+}
+
+// reloadAndLog will reload the configuration, and count and log the outcome.
+func (h *Hoster) reloadAndLog() {
+	restart, err := h.Reload()
+	if err != nil {
+		metrics.Add("reload_errors", 1)
+		h.logf("Failed to reload configuration: %v", err)
+		return
+	}
+
+	metrics.Add("reloads", 1)
+	if len(restart) > 0 {
+		h.logf("Reloaded configuration, changes to these settings require a restart: %v", restart)
+		return
+	}
+
+	h.logf("Reloaded configuration")
+}
+
+// fileModTime returns the modification time of a file, or the zero time if it cannot be read.
+func fileModTime(file string) time.Time {
+	if file == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// handleDebugConfig writes the effective configuration and any settings waiting for a restart as JSON.
+func (h *Hoster) handleDebugConfig(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	config := map[string]interface{}{}
+	for key, field := range h.configFields() {
+		config[key] = field.Interface()
+	}
+	restart := append([]string{}, h.restartRequired...)
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"config":           config,
+		"restart_required": restart,
+	})
+}
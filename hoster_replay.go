@@ -0,0 +1,424 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// replaySkipHeaders are recorded headers that are not sent again, since they are set by the HTTP client or describe the original connection.
+var replaySkipHeaders = []string{"Accept-Encoding", "Connection", "Content-Length", "Te", "Transfer-Encoding", "Upgrade", "User-Agent"}
+
+// Replayer sends recorded calls to another instance of a service and compares its responses with the recorded ones, such as to check a refactor against real traffic. The message types of recorded gRPC calls must be linked into the program, such as by importing their generated package, or be in DescriptorSet.
+type Replayer struct {
+	// Conn is the connection to the gRPC endpoint that recorded gRPC calls are sent to. Leave nil to skip gRPC calls.
+	Conn *grpc.ClientConn
+
+	// URL is the base URL of the HTTP endpoint (e.g. http://127.0.0.1:9090) that recorded HTTP requests are sent to. Leave blank to skip HTTP requests.
+	URL string
+
+	// HTTPClient is used to send HTTP requests. Leave nil to use http.DefaultClient.
+	HTTPClient *http.Client
+
+	// DescriptorSet contains the message types of recorded gRPC calls that are not linked into the program, such as a set compiled with protoc --include_imports --descriptor_set_out or the files fetched from the server reflection service. Messages of these types are read and written with their descriptors. Leave nil to only use linked types.
+	DescriptorSet *descriptor.FileDescriptorSet
+
+	// Metadata is added to every call as metadata, or as headers for HTTP requests, replacing the recorded values. Use it to send credentials that were redacted. Redacted values that are not replaced are not sent.
+	Metadata map[string]string
+
+	// IgnoreFields is a list of message field names left out when comparing responses, ignoring case, such as fields that were redacted or timestamps. Entries ending in * match any name with that prefix.
+	IgnoreFields []string
+
+	// Timeout is the deadline of each call. Leave as zero for no deadline.
+	Timeout time.Duration
+}
+
+// ReplayResult is the outcome of replaying a recorded call.
+type ReplayResult struct {
+	// Recording is the recorded call.
+	Recording *Recording
+
+	// Skipped is true if the call was not sent because there is no endpoint for its kind of call.
+	Skipped bool
+
+	// Err is set if the call could not be replayed, such as if its message types are not linked into the program or in the descriptor set.
+	Err error
+
+	// Duration is how long the replayed call took.
+	Duration time.Duration
+
+	// Code is the name of the status code of a replayed gRPC call.
+	Code string
+
+	// Message is the status message of a replayed gRPC call that failed.
+	Message string
+
+	// Status is the status code of a replayed HTTP request.
+	Status int
+
+	// Responses are the response messages of a replayed gRPC call, or the JSON values of the response body of an HTTP request.
+	Responses []json.RawMessage
+
+	// ResponseBody is the response body of a replayed HTTP request that is not JSON.
+	ResponseBody []byte
+
+	// Diffs are the differences between the recorded and replayed responses (e.g. responses[0].echo: "a" != "b").
+	Diffs []string
+}
+
+// Matched returns true if the call was replayed and the response matched the recorded one.
+func (r *ReplayResult) Matched() bool {
+	return !r.Skipped && r.Err == nil && len(r.Diffs) == 0
+}
+
+// ReadRecordings reads the recordings written to a recording file.
+func ReadRecordings(r io.Reader) ([]*Recording, error) {
+	recordings := []*Recording{}
+	decoder := json.NewDecoder(r)
+	for {
+		rec := &Recording{}
+		err := decoder.Decode(rec)
+		if err == io.EOF {
+			return recordings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording %v: %v", len(recordings)+1, err)
+		}
+		recordings = append(recordings, rec)
+	}
+}
+
+// Replay sends a recorded call again and compares the response with the recorded one.
+func (r *Replayer) Replay(ctx context.Context, rec *Recording) *ReplayResult {
+	result := &ReplayResult{Recording: rec}
+	if rec.HTTPMethod != "" {
+		if r.URL == "" {
+			result.Skipped = true
+			return result
+		}
+		r.replayHTTP(ctx, rec, result)
+	} else {
+		if r.Conn == nil {
+			result.Skipped = true
+			return result
+		}
+		r.replayGRPC(ctx, rec, result)
+	}
+	if result.Err != nil {
+		return result
+	}
+
+	result.Diffs = r.compare(rec, result)
+	return result
+}
+
+// replayGRPC will send a recorded gRPC call and set the status and responses of the result.
+func (r *Replayer) replayGRPC(ctx context.Context, rec *Recording, result *ReplayResult) {
+	types := r.messageTypes()
+	requests := []proto.Message{}
+	for i := range rec.Requests {
+		msg, err := types.newMessage(rec.RequestType)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		if err := jsonpb.Unmarshal(bytes.NewReader(rec.Requests[i]), msg); err != nil {
+			result.Err = fmt.Errorf("failed to decode request %v: %v", i, err)
+			return
+		}
+		requests = append(requests, msg)
+	}
+	if _, err := types.newMessage(rec.ResponseType); err != nil {
+		result.Err = err
+		return
+	}
+	if !rec.ClientStreams && !rec.ServerStreams && len(requests) != 1 {
+		result.Err = fmt.Errorf("unary call has %v recorded requests", len(requests))
+		return
+	}
+
+	// send the recorded metadata, with redacted values replaced or left out
+	md := metadata.MD{}
+	for key, values := range rec.Metadata {
+		if key == "user-agent" || len(values) == 1 && values[0] == RedactedValue {
+			continue
+		}
+		md[key] = values
+	}
+	for key, value := range r.Metadata {
+		md[strings.ToLower(key)] = []string{value}
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	responses, err := r.callGRPC(ctx, rec, types, requests)
+	result.Duration = time.Since(start)
+
+	s := status.Convert(err)
+	result.Code = s.Code().String()
+	result.Message = s.Message()
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	for _, resp := range responses {
+		data, err := marshaler.MarshalToString(resp)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to encode response: %v", err)
+			return
+		}
+		result.Responses = append(result.Responses, json.RawMessage(data))
+	}
+}
+
+// callGRPC will make a unary or streaming call with the requests and return the responses received before the call ended.
+func (r *Replayer) callGRPC(ctx context.Context, rec *Recording, types *messageTypes, requests []proto.Message) ([]proto.Message, error) {
+	if !rec.ClientStreams && !rec.ServerStreams {
+		resp, _ := types.newMessage(rec.ResponseType)
+		if err := r.Conn.Invoke(ctx, rec.Method, requests[0], resp); err != nil {
+			return nil, err
+		}
+		return []proto.Message{resp}, nil
+	}
+
+	desc := &grpc.StreamDesc{
+		StreamName:    rec.Method[strings.LastIndex(rec.Method, "/")+1:],
+		ClientStreams: rec.ClientStreams,
+		ServerStreams: rec.ServerStreams,
+	}
+	stream, err := r.Conn.NewStream(ctx, desc, rec.Method)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range requests {
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	responses := []proto.Message{}
+	for {
+		resp, _ := types.newMessage(rec.ResponseType)
+		err := stream.RecvMsg(resp)
+		if err == io.EOF {
+			return responses, nil
+		}
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+}
+
+// messageTypes creates messages of the recorded message types, with the linked types or the descriptors of the types that are not linked.
+type messageTypes struct {
+	codec *dynamic.Codec
+}
+
+// messageTypes returns the message types of the replayer, indexing the descriptor set if there is one.
+func (r *Replayer) messageTypes() *messageTypes {
+	if r.DescriptorSet == nil {
+		return &messageTypes{}
+	}
+
+	set := dynamic.NewSet()
+	for _, fd := range r.DescriptorSet.File {
+		set.Add(fd)
+	}
+
+	return &messageTypes{codec: dynamic.NewCodec(set)}
+}
+
+// newMessage returns an empty message of a recorded message type, preferring the linked type.
+func (m *messageTypes) newMessage(name string) (proto.Message, error) {
+	if t := proto.MessageType(name); t != nil {
+		return reflect.New(t.Elem()).Interface().(proto.Message), nil
+	}
+	if m.codec != nil && m.codec.HasMessage(name) {
+		return dynamic.NewMessage(m.codec, name), nil
+	}
+
+	return nil, fmt.Errorf("message type %q is not linked into the program or in the descriptor set", name)
+}
+
+// replayHTTP will send a recorded HTTP request and set the status and response body of the result.
+func (r *Replayer) replayHTTP(ctx context.Context, rec *Recording, result *ReplayResult) {
+	var body []byte
+	switch {
+	case len(rec.Body) > 0:
+		body = rec.Body
+	case len(rec.Requests) > 0:
+		for i, value := range rec.Requests {
+			if i > 0 {
+				body = append(body, '\n')
+			}
+			body = append(body, value...)
+		}
+	}
+
+	req, err := http.NewRequest(rec.HTTPMethod, strings.TrimSuffix(r.URL, "/")+rec.Path, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err
+		return
+	}
+	for key, values := range rec.Metadata {
+		if matchAnyFold(replaySkipHeaders, key) || len(values) == 1 && values[0] == RedactedValue {
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	for key, value := range r.Metadata {
+		req.Header.Set(key, value)
+	}
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to read response: %v", err)
+		return
+	}
+
+	result.Status = resp.StatusCode
+	if values, ok := splitJSONValues(data); ok {
+		result.Responses = values
+	} else if len(data) > 0 {
+		result.ResponseBody = data
+	}
+}
+
+// compare returns the differences between the recorded response and the replayed one.
+func (r *Replayer) compare(rec *Recording, result *ReplayResult) []string {
+	diffs := []string{}
+	if rec.Code != result.Code {
+		diffs = append(diffs, fmt.Sprintf("code: %v != %v", rec.Code, result.Code))
+	}
+	if rec.Message != result.Message {
+		diffs = append(diffs, fmt.Sprintf("message: %q != %q", rec.Message, result.Message))
+	}
+	if rec.Status != result.Status {
+		diffs = append(diffs, fmt.Sprintf("status: %v != %v", rec.Status, result.Status))
+	}
+
+	// bodies that were too large to record, or were redacted, cannot be compared
+	if rec.Truncated || rec.Redacted {
+		return diffs
+	}
+	if !bytes.Equal(rec.ResponseBody, result.ResponseBody) {
+		diffs = append(diffs, fmt.Sprintf("response body: %q != %q", rec.ResponseBody, result.ResponseBody))
+	}
+	if len(rec.Responses) != len(result.Responses) {
+		diffs = append(diffs, fmt.Sprintf("responses: %v messages != %v messages", len(rec.Responses), len(result.Responses)))
+	}
+	for i := 0; i < len(rec.Responses) && i < len(result.Responses); i++ {
+		recorded, err := decodeJSON(rec.Responses[i])
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("responses[%v]: %v", i, err))
+			continue
+		}
+		replayed, err := decodeJSON(result.Responses[i])
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("responses[%v]: %v", i, err))
+			continue
+		}
+		diffJSON(fmt.Sprintf("responses[%v]", i), removeFields(recorded, r.IgnoreFields), removeFields(replayed, r.IgnoreFields), &diffs)
+	}
+
+	return diffs
+}
+
+// decodeJSON decodes a JSON value with numbers kept as text, so they are compared exactly.
+func decodeJSON(data json.RawMessage) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// diffJSON will add a difference for every field of two decoded JSON values that does not match, named by its path.
+func diffJSON(path string, recorded interface{}, replayed interface{}, diffs *[]string) {
+	recordedMap, ok1 := recorded.(map[string]interface{})
+	replayedMap, ok2 := replayed.(map[string]interface{})
+	if ok1 && ok2 {
+		keys := []string{}
+		for key := range recordedMap {
+			keys = append(keys, key)
+		}
+		for key := range replayedMap {
+			if _, ok := recordedMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffJSON(path+"."+key, recordedMap[key], replayedMap[key], diffs)
+		}
+		return
+	}
+
+	recordedList, ok1 := recorded.([]interface{})
+	replayedList, ok2 := replayed.([]interface{})
+	if ok1 && ok2 && len(recordedList) == len(replayedList) {
+		for i := range recordedList {
+			diffJSON(fmt.Sprintf("%v[%v]", path, i), recordedList[i], replayedList[i], diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		*diffs = append(*diffs, fmt.Sprintf("%v: %v != %v", path, formatJSON(recorded), formatJSON(replayed)))
+	}
+}
+
+// formatJSON returns a decoded JSON value as JSON text, or "missing" for a field that is not set.
+func formatJSON(value interface{}) string {
+	if value == nil {
+		return "missing"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
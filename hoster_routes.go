@@ -0,0 +1,96 @@
+package gohost
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Routes lists the gRPC methods and HTTP gateway routes served by a hoster, as written by the debug endpoint at /debug/routes.
+type Routes struct {
+	// Methods are the gRPC methods registered with the gRPC server, sorted by name.
+	Methods []MethodRoute `json:"methods"`
+
+	// HTTPRoutes are the HTTP gateway routes, sorted by path and HTTP method.
+	HTTPRoutes []HTTPRoute `json:"http_routes"`
+}
+
+// MethodRoute describes a gRPC method registered with the gRPC server.
+type MethodRoute struct {
+	// Name is the full method name (e.g. /test.TestService/Echo).
+	Name string `json:"name"`
+
+	// ClientStreams is true if the client sends a stream of messages.
+	ClientStreams bool `json:"client_streams"`
+
+	// ServerStreams is true if the server sends a stream of messages.
+	ServerStreams bool `json:"server_streams"`
+}
+
+// HTTPRoute describes an HTTP gateway route that forwards requests to a gRPC method.
+type HTTPRoute struct {
+	// HTTPMethod is the HTTP method of the route (e.g. GET).
+	HTTPMethod string `json:"http_method"`
+
+	// Path is the path template of the route (e.g. /v1/echo/{value}).
+	Path string `json:"path"`
+
+	// Body is the request field bound to the request body, * for the whole request, or empty if there is no body.
+	Body string `json:"body,omitempty"`
+
+	// GRPCMethod is the full name of the gRPC method called by the route.
+	GRPCMethod string `json:"grpc_method"`
+}
+
+// routes returns the gRPC methods and HTTP gateway routes being served. Routes of the dynamic gateway are listed as built, and routes of registered gateways are listed from the http annotations of the methods they were generated from.
+func (h *Hoster) routes() Routes {
+	routes := Routes{
+		Methods:    []MethodRoute{},
+		HTTPRoutes: []HTTPRoute{},
+	}
+
+	if h.grpcServer != nil {
+		for serviceName, info := range h.grpcServer.GetServiceInfo() {
+			for _, method := range info.Methods {
+				routes.Methods = append(routes.Methods, MethodRoute{
+					Name:          "/" + serviceName + "/" + method.Name,
+					ClientStreams: method.IsClientStream,
+					ServerStreams: method.IsServerStream,
+				})
+			}
+		}
+	}
+
+	httpRoutes := h.httpRoutes
+	if httpRoutes == nil && len(h.httpGateways) > 0 {
+		// invalid annotations are left out, since generated gateways cannot be built from them either
+		httpRoutes, _ = newHTTPRoutes(h.methods)
+	}
+	for _, route := range httpRoutes {
+		routes.HTTPRoutes = append(routes.HTTPRoutes, HTTPRoute{
+			HTTPMethod: route.httpMethod,
+			Path:       route.template,
+			Body:       route.body,
+			GRPCMethod: route.method.name,
+		})
+	}
+
+	sort.Slice(routes.Methods, func(i, j int) bool {
+		return routes.Methods[i].Name < routes.Methods[j].Name
+	})
+	sort.Slice(routes.HTTPRoutes, func(i, j int) bool {
+		a, b := routes.HTTPRoutes[i], routes.HTTPRoutes[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.HTTPMethod < b.HTTPMethod
+	})
+
+	return routes
+}
+
+// handleDebugRoutes writes the gRPC methods and HTTP gateway routes being served as JSON.
+func (h *Hoster) handleDebugRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.routes())
+}
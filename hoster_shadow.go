@@ -0,0 +1,376 @@
+package gohost
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultShadowTimeout is the default deadline of calls mirrored to the shadow endpoint.
+	DefaultShadowTimeout = time.Second * 5
+
+	// DefaultShadowMaxInFlight is the default maximum number of calls being mirrored to the shadow endpoint at once.
+	DefaultShadowMaxInFlight = 100
+
+	// shadowHeader is the metadata key added to mirrored calls, so a shadow that also mirrors calls does not mirror them again.
+	shadowHeader = "x-gohost-shadow"
+
+	// shadowRecentMismatches is the number of recent mismatches kept for the debug endpoint.
+	shadowRecentMismatches = 20
+)
+
+// ShadowResult compares a call mirrored to the shadow endpoint with the call on this service.
+type ShadowResult struct {
+	// Time is when the call started.
+	Time time.Time `json:"time"`
+
+	// Method is the full gRPC method name.
+	Method string `json:"method"`
+
+	// PrimaryCode is the name of the status code returned by this service (e.g. OK).
+	PrimaryCode string `json:"primary_code"`
+
+	// ShadowCode is the name of the status code returned by the shadow endpoint.
+	ShadowCode string `json:"shadow_code"`
+
+	// PrimaryLatency is how long the call took on this service.
+	PrimaryLatency time.Duration `json:"primary_latency"`
+
+	// ShadowLatency is how long the call took on the shadow endpoint.
+	ShadowLatency time.Duration `json:"shadow_latency"`
+
+	// Diffs are the differences between the status and response of this service and those of the shadow endpoint (e.g. responses[0].echo: "a" != "b").
+	Diffs []string `json:"diffs,omitempty"`
+}
+
+// Matched returns true if the shadow endpoint returned the same status and response.
+func (r *ShadowResult) Matched() bool {
+	return len(r.Diffs) == 0
+}
+
+// ShadowHandler is used to report the result of each call mirrored to the shadow endpoint.
+type ShadowHandler func(result ShadowResult)
+
+// shadowMirror sends copies of calls to the shadow endpoint and keeps statistics of the results.
+type shadowMirror struct {
+	conn     *grpc.ClientConn
+	timeout  time.Duration
+	handler  ShadowHandler
+	inFlight chan struct{}
+
+	mu     sync.Mutex
+	stats  map[string]*shadowStats
+	recent []ShadowResult
+}
+
+// shadowStats are the results of the calls to a method mirrored to the shadow endpoint.
+type shadowStats struct {
+	calls            int64
+	dropped          int64
+	mismatches       int64
+	statusMismatches int64
+	primaryLatency   time.Duration
+	shadowLatency    time.Duration
+}
+
+// newShadowMirror will connect to the shadow endpoint, or return nil if ShadowAddr is not set. The connection is made in the background, so calls are mirrored once it is ready.
+func (h *Hoster) newShadowMirror() (*shadowMirror, error) {
+	if h.ShadowAddr == "" {
+		return nil, nil
+	}
+
+	opts := []grpc.DialOption{}
+	if h.ShadowInsecure {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: h.InsecureSkipVerify,
+		})))
+	}
+	conn, err := grpc.Dial(h.ShadowAddr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial shadow endpoint: %v", err)
+	}
+
+	m := &shadowMirror{
+		conn:    conn,
+		timeout: h.ShadowTimeout,
+		handler: h.ShadowHandler,
+		stats:   map[string]*shadowStats{},
+	}
+	if h.ShadowMaxInFlight > 0 {
+		m.inFlight = make(chan struct{}, h.ShadowMaxInFlight)
+	}
+
+	return m, nil
+}
+
+// close will close the connection to the shadow endpoint.
+func (m *shadowMirror) close() error {
+	return m.conn.Close()
+}
+
+// shouldShadow returns true if a call to a method is chosen to be mirrored, from ShadowMethods and ShadowPercent.
+func (h *Hoster) shouldShadow(ctx context.Context, method string) bool {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(shadowHeader)) > 0 {
+		return false
+	}
+	if len(h.ShadowMethods) > 0 {
+		found := false
+		for _, pattern := range h.ShadowMethods {
+			if matchPattern(pattern, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return rollPercent(h.ShadowPercent)
+}
+
+// unaryShadowInterceptor will mirror a percentage of unary calls, including calls forwarded by the HTTP gateway, to the shadow endpoint after they have been handled. Mirrored calls run in the background and never change the response or delay it.
+func (h *Hoster) unaryShadowInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	msg, ok := req.(proto.Message)
+	if !ok || !h.shouldShadow(ctx, info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	// copy the request and metadata before the handler can change them
+	mirrored := proto.Clone(msg)
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = shadowMetadata(md)
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	result := ShadowResult{
+		Time:           start,
+		Method:         info.FullMethod,
+		PrimaryCode:    status.Code(err).String(),
+		PrimaryLatency: time.Since(start),
+	}
+
+	// drop the call rather than wait if too many calls are being mirrored
+	if !h.shadow.acquire() {
+		h.shadow.drop(info.FullMethod)
+		return resp, err
+	}
+	go h.shadow.mirror(h.methods[info.FullMethod], mirrored, md, resp, err, result)
+
+	return resp, err
+}
+
+// shadowMetadata returns the metadata to send with a mirrored call, without the keys set by the transport.
+func shadowMetadata(md metadata.MD) metadata.MD {
+	mirrored := metadata.MD{}
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || key == "content-type" || key == "user-agent" {
+			continue
+		}
+		mirrored[key] = append([]string(nil), values...)
+	}
+	mirrored[shadowHeader] = []string{"true"}
+
+	return mirrored
+}
+
+// acquire returns true if another call can be mirrored.
+func (m *shadowMirror) acquire() bool {
+	if m.inFlight == nil {
+		return true
+	}
+
+	select {
+	case m.inFlight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release will allow another call to be mirrored.
+func (m *shadowMirror) release() {
+	if m.inFlight != nil {
+		<-m.inFlight
+	}
+}
+
+// mirror will send a call to the shadow endpoint, compare the result with the result of the primary call and record it.
+func (m *shadowMirror) mirror(desc *methodDesc, req proto.Message, md metadata.MD, resp interface{}, respErr error, result ShadowResult) {
+	defer m.release()
+
+	// create the response message from the method, or from the primary response if the method has no generated code
+	var out proto.Message
+	switch {
+	case desc != nil:
+		out = desc.newOutput()
+	case resp != nil:
+		out = reflect.New(reflect.TypeOf(resp).Elem()).Interface().(proto.Message)
+	default:
+		return
+	}
+
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := m.conn.Invoke(ctx, result.Method, req, out)
+	result.ShadowLatency = time.Since(start)
+	result.ShadowCode = status.Code(err).String()
+	result.Diffs = compareShadow(resp, respErr, out, err)
+
+	m.record(result)
+	if m.handler != nil {
+		m.handler(result)
+	}
+}
+
+// compareShadow returns the differences between the status and response of the primary call and those of the mirrored call.
+func compareShadow(resp interface{}, respErr error, shadowResp proto.Message, shadowErr error) []string {
+	diffs := []string{}
+	primaryStatus := status.Convert(respErr)
+	shadowStatus := status.Convert(shadowErr)
+	if primaryStatus.Code() != shadowStatus.Code() {
+		diffs = append(diffs, fmt.Sprintf("code: %v != %v", primaryStatus.Code(), shadowStatus.Code()))
+	}
+	if primaryStatus.Message() != shadowStatus.Message() {
+		diffs = append(diffs, fmt.Sprintf("message: %q != %q", primaryStatus.Message(), shadowStatus.Message()))
+	}
+	if respErr != nil || shadowErr != nil {
+		return diffs
+	}
+
+	msg, ok := resp.(proto.Message)
+	if !ok || proto.Equal(msg, shadowResp) {
+		return diffs
+	}
+
+	// find the fields that differ
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	primaryJSON, err1 := marshaler.MarshalToString(msg)
+	shadowJSON, err2 := marshaler.MarshalToString(shadowResp)
+	primaryValue, err3 := decodeJSON(json.RawMessage(primaryJSON))
+	shadowValue, err4 := decodeJSON(json.RawMessage(shadowJSON))
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return append(diffs, "responses[0]: responses are not equal")
+	}
+	before := len(diffs)
+	diffJSON("responses[0]", primaryValue, shadowValue, &diffs)
+	if len(diffs) == before {
+		diffs = append(diffs, "responses[0]: responses are not equal")
+	}
+
+	return diffs
+}
+
+// record will add the result of a mirrored call to the statistics of its method.
+func (m *shadowMirror) record(result ShadowResult) {
+	metrics.Add("shadow_calls", 1)
+	if !result.Matched() {
+		metrics.Add("shadow_mismatches", 1)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.methodStats(result.Method)
+	stats.calls++
+	stats.primaryLatency += result.PrimaryLatency
+	stats.shadowLatency += result.ShadowLatency
+	if result.PrimaryCode != result.ShadowCode {
+		stats.statusMismatches++
+	}
+	if !result.Matched() {
+		stats.mismatches++
+		m.recent = append(m.recent, result)
+		if len(m.recent) > shadowRecentMismatches {
+			m.recent = m.recent[len(m.recent)-shadowRecentMismatches:]
+		}
+	}
+}
+
+// drop will count a call that was not mirrored because too many calls were in flight.
+func (m *shadowMirror) drop(method string) {
+	metrics.Add("shadow_dropped", 1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.methodStats(method).dropped++
+}
+
+// methodStats returns the statistics of a method, adding them if needed. The caller must hold mu.
+func (m *shadowMirror) methodStats(method string) *shadowStats {
+	stats, ok := m.stats[method]
+	if !ok {
+		stats = &shadowStats{}
+		m.stats[method] = stats
+	}
+
+	return stats
+}
+
+// handleDebugShadow writes the statistics of mirrored calls for each method and the most recent mismatches as JSON.
+func (h *Hoster) handleDebugShadow(w http.ResponseWriter, r *http.Request) {
+	if h.shadow == nil {
+		http.Error(w, "shadow mirroring is not enabled", http.StatusNotFound)
+		return
+	}
+
+	type methodJSON struct {
+		Calls            int64  `json:"calls"`
+		Dropped          int64  `json:"dropped"`
+		Mismatches       int64  `json:"mismatches"`
+		StatusMismatches int64  `json:"status_mismatches"`
+		PrimaryLatency   string `json:"primary_latency_avg"`
+		ShadowLatency    string `json:"shadow_latency_avg"`
+	}
+
+	h.shadow.mu.Lock()
+	methods := map[string]methodJSON{}
+	for name, stats := range h.shadow.stats {
+		method := methodJSON{
+			Calls:            stats.calls,
+			Dropped:          stats.dropped,
+			Mismatches:       stats.mismatches,
+			StatusMismatches: stats.statusMismatches,
+		}
+		if stats.calls > 0 {
+			method.PrimaryLatency = (stats.primaryLatency / time.Duration(stats.calls)).String()
+			method.ShadowLatency = (stats.shadowLatency / time.Duration(stats.calls)).String()
+		}
+		methods[name] = method
+	}
+	recent := append([]ShadowResult{}, h.shadow.recent...)
+	h.shadow.mu.Unlock()
+
+	// newest mismatches first
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].Time.After(recent[j].Time)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"methods":           methods,
+		"recent_mismatches": recent,
+	})
+}
@@ -0,0 +1,362 @@
+package gohost
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// LastEventIDHeader is the HTTP header sent by Server-Sent Events clients when they reconnect, and the gRPC metadata key it is forwarded as unless SSEResume is set.
+const LastEventIDHeader = "last-event-id"
+
+// eventStreamType is the media type of Server-Sent Events.
+const eventStreamType = "text/event-stream"
+
+// sseStreamKey is the context key for the sseResponseWriter of a request.
+type sseStreamKey struct{}
+
+// acceptsEventStream returns true if the request accepts Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header["Accept"] {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == eventStreamType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// serveSSE will convert gateway responses to Server-Sent Events for requests that accept them. Messages of server-streaming methods are sent as they arrive and errors are sent as an error event, so the response status is always 200.
+func (h *Hoster) serveSSE(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsEventStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &sseResponseWriter{ResponseWriter: w}
+
+		// let the service resume the stream after the last event the client received
+		if id := r.Header.Get(LastEventIDHeader); id != "" {
+			sw.resume = metadata.Pairs(LastEventIDHeader, id)
+			if h.SSEResume != nil {
+				md, err := h.SSEResume(r.Context(), id)
+				if err != nil {
+					sw.writeStatus(status.Convert(err))
+					return
+				}
+				sw.resume = md
+			}
+		}
+
+		// the stream lasts until the call ends, so the HTTP endpoint timeouts do not apply
+		h.clearStreamDeadlines(r)
+
+		// stop the heartbeat before finishing, even if the handler panics, so nothing is written after the handler returns
+		defer sw.finish()
+		defer sw.heartbeat(r.Context(), h.SSEHeartbeat)()
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sseStreamKey{}, sw)))
+	})
+}
+
+// sseEventIDOption is a gateway forward response option that sets the ID of the event for each message with SSEEventID.
+func (h *Hoster) sseEventIDOption(ctx context.Context, w http.ResponseWriter, msg proto.Message) error {
+	sw, ok := ctx.Value(sseStreamKey{}).(*sseResponseWriter)
+	if !ok || msg == nil || h.SSEEventID == nil {
+		return nil
+	}
+
+	sw.mu.Lock()
+	sw.nextID = h.SSEEventID(ctx, msg)
+	sw.mu.Unlock()
+
+	return nil
+}
+
+// sseResumeMetadata returns the metadata added to calls for a request that is resuming an event stream.
+func sseResumeMetadata(r *http.Request) metadata.MD {
+	sw, ok := r.Context().Value(sseStreamKey{}).(*sseResponseWriter)
+	if !ok {
+		return nil
+	}
+
+	return sw.resume
+}
+
+// sseResponseWriter converts the JSON written by the gateway to events. Streaming responses are newline delimited chunks with a result or an error, and other responses are a single message or error.
+type sseResponseWriter struct {
+	http.ResponseWriter
+
+	// resume is the metadata added to calls when the client sent a Last-Event-ID header.
+	resume metadata.MD
+
+	mu      sync.Mutex
+	status  int
+	started bool
+	buf     bytes.Buffer
+	nextID  string
+	count   int
+}
+
+// WriteHeader records the status code, which decides whether a single response is an error.
+func (w *sseResponseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write buffers the response and sends each complete chunk of a streaming response as an event.
+func (w *sseResponseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(b)
+	if !w.isStream() {
+		return len(b), nil
+	}
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf.Next(i + 1)
+		if err := w.writeChunk(bytes.TrimSpace(line)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush will flush the events written so far.
+func (w *sseResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flush()
+}
+
+// CloseNotify will pass through to the underlying response writer, which the gateway uses to cancel requests.
+func (w *sseResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	return make(chan bool)
+}
+
+// heartbeat will send a comment every interval to keep the connection open, until the returned function is called, the request context is done or a write fails.
+func (w *sseResponseWriter) heartbeat(ctx context.Context, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.mu.Lock()
+				w.start()
+				_, err := w.ResponseWriter.Write([]byte(": heartbeat\n\n"))
+				if err == nil {
+					w.flush()
+				}
+				w.mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// finish will send anything left in the buffer, which is the whole body of a response that is not streamed or the error that ended a stream.
+func (w *sseResponseWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := bytes.TrimSpace(w.buf.Bytes())
+	w.buf.Reset()
+	switch {
+	case len(data) == 0:
+	case w.isStream():
+		w.writeChunk(data)
+	case w.status >= http.StatusBadRequest:
+		w.writeEvent("error", "", sseErrorData(data))
+	default:
+		w.writeMessage(data)
+	}
+
+	w.start()
+	w.flush()
+}
+
+// writeStatus will send an error event for a status.
+func (w *sseResponseWriter) writeStatus(s *status.Status) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, _ := json.Marshal(sseError{Code: int(s.Code()), Message: s.Message()})
+	w.writeEvent("error", "", data)
+	w.flush()
+}
+
+// isStream returns true if the gateway is writing a streaming response.
+func (w *sseResponseWriter) isStream() bool {
+	return w.Header().Get("Transfer-Encoding") == "chunked"
+}
+
+// writeChunk will send a chunk of a streaming response as a message or error event.
+func (w *sseResponseWriter) writeChunk(line []byte) error {
+	if len(line) == 0 {
+		return nil
+	}
+
+	var chunk struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(line, &chunk); err != nil {
+		return err
+	}
+
+	if chunk.Error != nil {
+		return w.writeEvent("error", "", sseErrorData(chunk.Error))
+	}
+
+	return w.writeMessage(chunk.Result)
+}
+
+// writeMessage will send a message event with the ID set by SSEEventID, or the number of the message in the stream.
+func (w *sseResponseWriter) writeMessage(data []byte) error {
+	w.count++
+	id := w.nextID
+	if id == "" {
+		id = strconv.Itoa(w.count)
+	}
+	w.nextID = ""
+
+	return w.writeEvent("", id, data)
+}
+
+// writeEvent will send an event, starting the response if necessary.
+func (w *sseResponseWriter) writeEvent(event string, id string, data []byte) error {
+	w.start()
+
+	var b bytes.Buffer
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	_, err := w.ResponseWriter.Write(b.Bytes())
+	return err
+}
+
+// start will write the event stream headers if they have not been written yet.
+func (w *sseResponseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	header := w.Header()
+	header.Set("Content-Type", eventStreamType)
+	header.Set("Cache-Control", "no-cache")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+// flush will flush the underlying response writer, if the response has started.
+func (w *sseResponseWriter) flush() {
+	if !w.started {
+		return
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sseError is the data of an error event.
+type sseError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// sseErrorData converts an error written by the gateway, or by the hoster on the HTTP endpoint, to the data of an error event.
+func sseErrorData(data []byte) []byte {
+	var body struct {
+		GRPCCode *int            `json:"grpc_code"`
+		Code     int             `json:"code"`
+		Message  string          `json:"message"`
+		Error    string          `json:"error"`
+		Details  json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return data
+	}
+
+	e := sseError{
+		Code:    body.Code,
+		Message: body.Message,
+	}
+	if body.GRPCCode != nil {
+		e.Code = *body.GRPCCode
+	}
+	if e.Message == "" {
+		e.Message = body.Error
+	}
+	if len(body.Details) > 0 && string(body.Details) != "[]" && string(body.Details) != "null" {
+		e.Details = body.Details
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return data
+	}
+
+	return b
+}
@@ -0,0 +1,489 @@
+package gohost
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/eleniums/gohost/internal/dynamic"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/utilities"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpRoute is an HTTP binding of a gRPC method, built from its google.api.http annotation.
+type httpRoute struct {
+	// method is the gRPC method called by the route.
+	method *methodDesc
+
+	// httpMethod is the HTTP method of the route (e.g. GET).
+	httpMethod string
+
+	// template is the path template of the route (e.g. /v1/echo/{value}).
+	template string
+
+	// pattern is the compiled path template.
+	pattern runtime.Pattern
+
+	// fields are the request fields bound to path parameters.
+	fields []string
+
+	// body is the request field bound to the request body, * for the whole request, or empty if there is no body.
+	body string
+
+	// queryFilter excludes the fields bound to the path and body from query parameters.
+	queryFilter *utilities.DoubleArray
+}
+
+// applyDescriptorSet will replace the HTTP annotations of the registered methods with those in a compiled FileDescriptorSet (e.g. protoc --include_imports --descriptor_set_out). Methods that are not in the set keep the annotations of their registered descriptor.
+func applyDescriptorSet(methods map[string]*methodDesc, file string) error {
+	set, err := loadDescriptorSet(file)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range set.File {
+		for _, sd := range fd.Service {
+			for _, md := range sd.Method {
+				name := "/" + qualifiedName(fd.GetPackage(), sd.GetName()) + "/" + md.GetName()
+				if method, ok := methods[name]; ok {
+					method.http = httpRule(md)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadDescriptorSet will read a compiled FileDescriptorSet.
+func loadDescriptorSet(file string) (*descriptor.FileDescriptorSet, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+	}
+
+	set := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %v: %v", file, err)
+	}
+
+	return set, nil
+}
+
+// newHTTPRoutes returns the routes for the HTTP annotations of the methods, including additional bindings. Client and bidirectional streaming methods are left out, since they cannot be served over plain HTTP.
+func newHTTPRoutes(methods map[string]*methodDesc) ([]*httpRoute, error) {
+	var routes []*httpRoute
+	for _, method := range methods {
+		if method.http == nil || method.clientStreams {
+			continue
+		}
+
+		rules := append([]*annotations.HttpRule{method.http}, method.http.AdditionalBindings...)
+		for _, rule := range rules {
+			route, err := newHTTPRoute(method, rule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid http annotation on %v: %v", method.name, err)
+			}
+			routes = append(routes, route)
+		}
+	}
+
+	// the gateway serves the first route that matches, so register more specific routes first and keep the order the same on every run
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].less(routes[j])
+	})
+
+	return routes, nil
+}
+
+// less returns true if the route should be matched before another. Literal path segments come before variables, and variables before multi-segment wildcards, comparing from the start of the path. Remaining ties are ordered by method name and template.
+func (r *httpRoute) less(other *httpRoute) bool {
+	a, b := templateSegments(r.template), templateSegments(other.template)
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ra, rb := segmentRank(a[i]), segmentRank(b[i]); ra != rb {
+			return ra < rb
+		}
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	if r.method.name != other.method.name {
+		return r.method.name < other.method.name
+	}
+
+	return r.template < other.template
+}
+
+// templateSegments splits a path template into segments, keeping variables that match several segments (e.g. {name=items/*}) whole.
+func templateSegments(template string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i, c := range template {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				if i > start {
+					segments = append(segments, template[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(template) {
+		segments = append(segments, template[start:])
+	}
+
+	return segments
+}
+
+// segmentRank returns 0 for a literal path segment, 1 for a segment that matches any single segment and 2 for a segment that can match several.
+func segmentRank(segment string) int {
+	switch {
+	case strings.Contains(segment, "**"):
+		return 2
+	case strings.HasPrefix(segment, "{"), segment == "*":
+		return 1
+	}
+
+	return 0
+}
+
+// newHTTPRoute returns the route for an HTTP rule of a method.
+func newHTTPRoute(method *methodDesc, rule *annotations.HttpRule) (*httpRoute, error) {
+	route := &httpRoute{
+		method: method,
+		body:   rule.Body,
+	}
+
+	switch p := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		route.httpMethod, route.template = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		route.httpMethod, route.template = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		route.httpMethod, route.template = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		route.httpMethod, route.template = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		route.httpMethod, route.template = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		route.httpMethod, route.template = p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("no pattern")
+	}
+
+	pattern, fields, err := compilePathTemplate(route.template)
+	if err != nil {
+		return nil, err
+	}
+	route.pattern = pattern
+	route.fields = fields
+
+	if route.body != "" && route.body != "*" {
+		if _, err := bodyField(method.newInput(), route.body); err != nil {
+			return nil, err
+		}
+	}
+
+	var seqs [][]string
+	if route.body != "" && route.body != "*" {
+		seqs = append(seqs, strings.Split(route.body, "."))
+	}
+	for _, field := range fields {
+		seqs = append(seqs, strings.Split(field, "."))
+	}
+	route.queryFilter = utilities.NewDoubleArray(seqs)
+
+	return route, nil
+}
+
+// compilePathTemplate compiles a path template (e.g. /v1/{name=shelves/*}/books:list) into a gateway pattern, and returns the fields bound to its variables.
+func compilePathTemplate(template string) (runtime.Pattern, []string, error) {
+	if !strings.HasPrefix(template, "/") {
+		return runtime.Pattern{}, nil, fmt.Errorf("path template %q must start with /", template)
+	}
+
+	path := template[1:]
+	verb := ""
+	if i := strings.LastIndex(path, ":"); i >= 0 && !strings.ContainsAny(path[i:], "/}") {
+		path, verb = path[:i], path[i+1:]
+	}
+
+	var ops []int
+	var pool []string
+	var fields []string
+	constant := func(s string) int {
+		for i := range pool {
+			if pool[i] == s {
+				return i
+			}
+		}
+		pool = append(pool, s)
+		return len(pool) - 1
+	}
+	segment := func(s string) error {
+		switch {
+		case s == "*":
+			ops = append(ops, int(utilities.OpPush), 0)
+		case s == "**":
+			ops = append(ops, int(utilities.OpPushM), 0)
+		case s == "" || strings.ContainsAny(s, "{}=*"):
+			return fmt.Errorf("invalid segment %q in path template %q", s, template)
+		default:
+			ops = append(ops, int(utilities.OpLitPush), constant(s))
+		}
+		return nil
+	}
+
+	for path != "" {
+		if !strings.HasPrefix(path, "{") {
+			s := path
+			if i := strings.Index(path, "/"); i >= 0 {
+				s, path = path[:i], path[i+1:]
+			} else {
+				path = ""
+			}
+			if err := segment(s); err != nil {
+				return runtime.Pattern{}, nil, err
+			}
+			continue
+		}
+
+		// a variable binds a field to one or more segments, which default to a single segment
+		end := strings.Index(path, "}")
+		if end < 0 {
+			return runtime.Pattern{}, nil, fmt.Errorf("unclosed variable in path template %q", template)
+		}
+		field, segments := path[1:end], "*"
+		if i := strings.Index(field, "="); i >= 0 {
+			field, segments = field[:i], field[i+1:]
+		}
+		if field == "" {
+			return runtime.Pattern{}, nil, fmt.Errorf("unnamed variable in path template %q", template)
+		}
+
+		parts := strings.Split(segments, "/")
+		for _, s := range parts {
+			if err := segment(s); err != nil {
+				return runtime.Pattern{}, nil, err
+			}
+		}
+		ops = append(ops, int(utilities.OpConcatN), len(parts), int(utilities.OpCapture), constant(field))
+		fields = append(fields, field)
+
+		path = path[end+1:]
+		if path != "" {
+			if !strings.HasPrefix(path, "/") {
+				return runtime.Pattern{}, nil, fmt.Errorf("variable must be a whole segment in path template %q", template)
+			}
+			path = path[1:]
+		}
+	}
+
+	pattern, err := runtime.NewPattern(1, ops, pool, verb)
+	if err != nil {
+		return runtime.Pattern{}, nil, fmt.Errorf("invalid path template %q: %v", template, err)
+	}
+
+	return pattern, fields, nil
+}
+
+// registerHTTPRoutes will add the routes built from HTTP annotations to the gateway.
+func (h *Hoster) registerHTTPRoutes(mux *runtime.ServeMux, cc *grpc.ClientConn) {
+	for _, route := range h.httpRoutes {
+		mux.Handle(route.httpMethod, route.pattern, route.handler(mux, cc))
+	}
+}
+
+// handler returns a gateway handler that calls the method of the route, the same way as the handlers generated by protoc-gen-grpc-gateway.
+func (r *httpRoute) handler(mux *runtime.ServeMux, cc *grpc.ClientConn) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+
+		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		ctx, err := runtime.AnnotateContext(ctx, mux, req)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		in, err := r.newRequest(inboundMarshaler, req, pathParams)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		var md runtime.ServerMetadata
+		if r.method.serverStreams {
+			stream, err := r.openStream(ctx, cc, in)
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+				return
+			}
+			md.HeaderMD, err = stream.Header()
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+				return
+			}
+			ctx = runtime.NewServerMetadataContext(ctx, md)
+
+			runtime.ForwardResponseStream(ctx, mux, outboundMarshaler, w, req, func() (proto.Message, error) {
+				out := r.method.newOutput()
+				err := stream.RecvMsg(out)
+				return out, err
+			}, mux.GetForwardResponseOptions()...)
+			return
+		}
+
+		out := r.method.newOutput()
+		err = cc.Invoke(ctx, r.method.name, in, out, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		runtime.ForwardResponseMessage(ctx, mux, outboundMarshaler, w, req, out, mux.GetForwardResponseOptions()...)
+	}
+}
+
+// openStream will call a server-streaming method with a request.
+func (r *httpRoute) openStream(ctx context.Context, cc *grpc.ClientConn, in proto.Message) (grpc.ClientStream, error) {
+	stream, err := cc.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, r.method.name)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// newRequest returns the request message for an HTTP request, populated from the body, path parameters and query parameters.
+func (r *httpRoute) newRequest(marshaler runtime.Marshaler, req *http.Request, pathParams map[string]string) (proto.Message, error) {
+	in := r.method.newInput()
+
+	switch r.body {
+	case "":
+	case "*":
+		if err := marshaler.NewDecoder(req.Body).Decode(in); err != nil && err != io.EOF {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	default:
+		field, err := bodyField(in, r.body)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if err := marshaler.NewDecoder(req.Body).Decode(field); err != nil && err != io.EOF {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	for _, field := range r.fields {
+		value, ok := pathParams[field]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "missing parameter %s", field)
+		}
+		if err := populateFieldFromPath(in, field, value); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", field, err)
+		}
+	}
+
+	if r.body != "*" {
+		if err := populateQueryParameters(in, req.URL.Query(), r.queryFilter); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	return in, nil
+}
+
+// bodyField returns a pointer to the field of a message with a proto name, allocating it if it is a nil message.
+func bodyField(msg proto.Message, name string) (interface{}, error) {
+	if m, ok := msg.(*dynamic.Message); ok {
+		if !m.HasField(name) {
+			return nil, fmt.Errorf("no field %v in %v", name, proto.MessageName(m))
+		}
+		return &dynamicField{msg: m, name: name}, nil
+	}
+
+	v := reflect.ValueOf(msg).Elem()
+	props := proto.GetProperties(v.Type())
+	for i, prop := range props.Prop {
+		if prop.OrigName != name {
+			continue
+		}
+
+		f := v.Field(i)
+		if f.Kind() != reflect.Ptr {
+			return f.Addr().Interface(), nil
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return f.Interface(), nil
+	}
+
+	return nil, fmt.Errorf("no field %v in %v", name, v.Type())
+}
+
+// dynamicField is the field of a dynamic message bound to the request body. Marshalers decode it as JSON, which is then set on the message.
+type dynamicField struct {
+	msg  *dynamic.Message
+	name string
+}
+
+// UnmarshalJSON will set the field to a JSON value.
+func (f *dynamicField) UnmarshalJSON(b []byte) error {
+	return f.msg.SetFieldJSON(f.name, b)
+}
+
+// populateFieldFromPath will set a request field from a path parameter, like runtime.PopulateFieldFromPath does for generated messages.
+func populateFieldFromPath(msg proto.Message, field string, value string) error {
+	if m, ok := msg.(*dynamic.Message); ok {
+		return m.SetField(strings.Split(field, "."), []string{value})
+	}
+
+	return runtime.PopulateFieldFromPath(msg, field, value)
+}
+
+// populateQueryParameters will set request fields from query parameters that are not excluded by filter, like runtime.PopulateQueryParameters does for generated messages.
+func populateQueryParameters(msg proto.Message, values url.Values, filter *utilities.DoubleArray) error {
+	m, ok := msg.(*dynamic.Message)
+	if !ok {
+		return runtime.PopulateQueryParameters(msg, values, filter)
+	}
+
+	for key, items := range values {
+		path := strings.Split(key, ".")
+		if filter.HasCommonPrefix(path) {
+			continue
+		}
+		if err := m.SetField(path, items); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
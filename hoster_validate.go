@@ -0,0 +1,386 @@
+package gohost
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minWindowSize is the smallest flow control window size accepted by gRPC. Smaller values are silently ignored by gRPC, so they are rejected here instead.
+const minWindowSize = 65535
+
+// ValidationError contains every problem found while validating a hoster configuration.
+type ValidationError struct {
+	// Errors is the list of problems found, in the order they were checked.
+	Errors []error
+}
+
+// Error returns all problems joined into a single message.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		msgs[i] = e.Errors[i].Error()
+	}
+
+	return fmt.Sprintf("invalid configuration: %v", strings.Join(msgs, "; "))
+}
+
+// endpoint is an address the hoster will bind, used to detect conflicts.
+type endpoint struct {
+	name string
+	host string
+	port int
+}
+
+// Validate checks the configuration of every endpoint that will be served and returns a *ValidationError containing all problems found, or nil if the configuration is valid.
+func (h *Hoster) Validate() error {
+	errs := []error{}
+	endpoints := []endpoint{}
+
+	// validate addresses of enabled endpoints
+	addAddr := func(name, addr string) {
+		if addr == "" {
+			errs = append(errs, fmt.Errorf("%v address cannot be empty", name))
+			return
+		}
+
+		host, port, err := parseAddr(addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v address %q is invalid: %v", name, addr, err))
+			return
+		}
+
+		endpoints = append(endpoints, endpoint{name: name, host: host, port: port})
+	}
+	if h.hasGRPCEndpoint() && h.GRPCListener == nil {
+		addAddr("grpc", h.GRPCAddr)
+	} else if len(h.httpGateways) > 0 && h.GRPCAddr == "" {
+		errs = append(errs, errors.New("grpc address cannot be empty when HTTP gateways are registered"))
+	}
+	if h.hasHTTPEndpoint() && h.HTTPListener == nil {
+		addAddr("http", h.HTTPAddr)
+	}
+	if h.EnableDebug {
+		addAddr("debug", h.DebugAddr)
+	}
+
+	// check for port conflicts between endpoints
+	for i := range endpoints {
+		for j := i + 1; j < len(endpoints); j++ {
+			if endpoints[i].conflicts(endpoints[j]) {
+				errs = append(errs, fmt.Errorf("%v and %v endpoints both use port %v", endpoints[i].name, endpoints[j].name, endpoints[i].port))
+			}
+		}
+	}
+
+	// validate message sizes
+	if h.MaxSendMsgSize <= 0 || h.MaxSendMsgSize > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("max send message size %v must be between 1 and %v", h.MaxSendMsgSize, math.MaxInt32))
+	}
+	if h.MaxRecvMsgSize <= 0 || h.MaxRecvMsgSize > math.MaxInt32 {
+		errs = append(errs, fmt.Errorf("max receive message size %v must be between 1 and %v", h.MaxRecvMsgSize, math.MaxInt32))
+	}
+	if h.EnableReload && h.ReloadMaxMsgSizeCeiling != 0 {
+		min := h.MaxSendMsgSize
+		if h.MaxRecvMsgSize > min {
+			min = h.MaxRecvMsgSize
+		}
+		if h.ReloadMaxMsgSizeCeiling < min || h.ReloadMaxMsgSizeCeiling > math.MaxInt32 {
+			errs = append(errs, fmt.Errorf("reload max message size ceiling %v must be between %v and %v", h.ReloadMaxMsgSizeCeiling, min, math.MaxInt32))
+		}
+	}
+
+	// validate HTTP limits
+	if h.HTTPMaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("http max header bytes %v cannot be negative", h.HTTPMaxHeaderBytes))
+	}
+	if h.DebugMaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("debug max header bytes %v cannot be negative", h.DebugMaxHeaderBytes))
+	}
+	if h.MaxRequestBodySize < 0 {
+		errs = append(errs, fmt.Errorf("max request body size %v cannot be negative", h.MaxRequestBodySize))
+	}
+
+	// validate timeouts, keepalive and connection management settings
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"keepalive time", h.KeepaliveTime},
+		{"keepalive timeout", h.KeepaliveTimeout},
+		{"keepalive min time", h.KeepaliveMinTime},
+		{"max connection idle", h.MaxConnectionIdle},
+		{"max connection age", h.MaxConnectionAge},
+		{"max connection age grace", h.MaxConnectionAgeGrace},
+		{"connection timeout", h.ConnectionTimeout},
+		{"http read timeout", h.HTTPReadTimeout},
+		{"http read header timeout", h.HTTPReadHeaderTimeout},
+		{"http write timeout", h.HTTPWriteTimeout},
+		{"http idle timeout", h.HTTPIdleTimeout},
+		{"debug read timeout", h.DebugReadTimeout},
+		{"debug read header timeout", h.DebugReadHeaderTimeout},
+		{"debug write timeout", h.DebugWriteTimeout},
+		{"debug idle timeout", h.DebugIdleTimeout},
+		{"adaptive latency target", h.AdaptiveLatencyTarget},
+		{"default deadline", h.DefaultDeadline},
+		{"max deadline", h.MaxDeadline},
+		{"sse heartbeat", h.SSEHeartbeat},
+		{"mock latency", h.MockLatency},
+		{"shadow timeout", h.ShadowTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%v %v cannot be negative", d.name, d.value))
+		}
+	}
+	if h.MaxConcurrentStreams < 0 || int64(h.MaxConcurrentStreams) > math.MaxUint32 {
+		errs = append(errs, fmt.Errorf("max concurrent streams %v must be between 0 and %v", h.MaxConcurrentStreams, uint32(math.MaxUint32)))
+	}
+	if h.InitialWindowSize != 0 && (h.InitialWindowSize < minWindowSize || h.InitialWindowSize > math.MaxInt32) {
+		errs = append(errs, fmt.Errorf("initial window size %v must be 0 or between %v and %v", h.InitialWindowSize, minWindowSize, math.MaxInt32))
+	}
+	if h.InitialConnWindowSize != 0 && (h.InitialConnWindowSize < minWindowSize || h.InitialConnWindowSize > math.MaxInt32) {
+		errs = append(errs, fmt.Errorf("initial connection window size %v must be 0 or between %v and %v", h.InitialConnWindowSize, minWindowSize, math.MaxInt32))
+	}
+
+	// validate reload settings
+	if h.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("reload interval %v cannot be negative", h.ReloadInterval))
+	}
+
+	// validate TLS files
+	errs = append(errs, h.validateTLS()...)
+	if h.ClientCAFile != "" {
+		if !h.isTLSEnabled() {
+			errs = append(errs, errors.New("client CA file requires cert file and key file to be set"))
+		}
+		if _, err := loadCertPool(h.ClientCAFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// validate compression
+	if h.CompressionLevel < 0 || h.CompressionLevel > 9 {
+		errs = append(errs, fmt.Errorf("compression level %v must be between 0 and 9", h.CompressionLevel))
+	}
+	if h.CompressionMinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression min size %v cannot be negative", h.CompressionMinSize))
+	}
+
+	// validate WebSocket bridge
+	if h.EnableWebSocket {
+		if !h.hasGRPCEndpoint() {
+			errs = append(errs, errors.New("websocket bridge requires a registered gRPC server"))
+		}
+		if !strings.HasPrefix(h.WebSocketPath, "/") {
+			errs = append(errs, fmt.Errorf("websocket path %q must start with /", h.WebSocketPath))
+		}
+	}
+	if len(h.openAPIDocs) > 0 && !strings.HasPrefix(h.OpenAPIPath, "/") {
+		errs = append(errs, fmt.Errorf("openapi path %q must start with /", h.OpenAPIPath))
+	}
+	if h.EnableDynamicGateway && !h.hasGRPCEndpoint() {
+		errs = append(errs, errors.New("dynamic gateway requires a registered gRPC server"))
+	}
+	if h.EnableGRPCWeb && !h.hasGRPCEndpoint() {
+		errs = append(errs, errors.New("grpc-web requires a registered gRPC server"))
+	}
+
+	// validate mock server
+	if h.EnableMock {
+		if h.DescriptorSetFile == "" {
+			errs = append(errs, errors.New("mock server requires a descriptor set file"))
+		}
+		if h.MockErrorPercent < 0 || h.MockErrorPercent > 100 {
+			errs = append(errs, fmt.Errorf("mock error percent %v must be between 0 and 100", h.MockErrorPercent))
+		}
+	}
+
+	// validate faults
+	errs = append(errs, validateFaults(h.Faults)...)
+
+	// validate recording
+	if h.RecordingMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("recording max size %v cannot be negative", h.RecordingMaxSize))
+	}
+	if h.RecordingMaxFiles < 0 {
+		errs = append(errs, fmt.Errorf("recording max files %v cannot be negative", h.RecordingMaxFiles))
+	}
+
+	// validate shadow mirroring
+	if h.ShadowAddr != "" {
+		if _, _, err := parseAddr(h.ShadowAddr); err != nil {
+			errs = append(errs, fmt.Errorf("shadow address %q is invalid: %v", h.ShadowAddr, err))
+		}
+		if h.ShadowPercent < 0 || h.ShadowPercent > 100 {
+			errs = append(errs, fmt.Errorf("shadow percent %v must be between 0 and 100", h.ShadowPercent))
+		}
+		if h.ShadowMaxInFlight < 0 {
+			errs = append(errs, fmt.Errorf("shadow max in flight %v cannot be negative", h.ShadowMaxInFlight))
+		}
+	}
+
+	// validate deadlines
+	if h.DefaultDeadline > 0 && h.MaxDeadline > 0 && h.DefaultDeadline > h.MaxDeadline {
+		errs = append(errs, fmt.Errorf("default deadline %v cannot be longer than max deadline %v", h.DefaultDeadline, h.MaxDeadline))
+	}
+	for i, d := range h.MethodDeadlines {
+		if !strings.HasPrefix(d.Method, "/") {
+			errs = append(errs, fmt.Errorf("method deadline %v method %q must be a full method name starting with /", i, d.Method))
+		}
+		if d.Default < 0 || d.Max < 0 {
+			errs = append(errs, fmt.Errorf("method deadline %v for %v cannot be negative", i, d.Method))
+		}
+		if d.Default > 0 && d.Max > 0 && d.Default > d.Max {
+			errs = append(errs, fmt.Errorf("method deadline %v for %v default %v cannot be longer than max %v", i, d.Method, d.Default, d.Max))
+		}
+	}
+
+	// validate in-flight limits
+	if h.MaxInFlight < 0 {
+		errs = append(errs, fmt.Errorf("max in flight %v cannot be negative", h.MaxInFlight))
+	}
+	if h.AdaptiveLatencyTarget > 0 && h.MaxInFlight <= 0 {
+		errs = append(errs, errors.New("adaptive latency target requires max in flight to be set"))
+	}
+	for i, l := range h.ConcurrencyLimits {
+		if !strings.HasPrefix(l.Method, "/") {
+			errs = append(errs, fmt.Errorf("concurrency limit %v method %q must be a full method name starting with /", i, l.Method))
+		}
+		if l.Max <= 0 {
+			errs = append(errs, fmt.Errorf("concurrency limit %v for %v must have a positive max", i, l.Method))
+		}
+	}
+
+	// validate rate limits
+	for i, l := range h.RateLimits {
+		name := l.Method
+		if name == "" {
+			name = l.Route
+		}
+		switch {
+		case (l.Method == "") == (l.Route == ""):
+			errs = append(errs, fmt.Errorf("rate limit %v must have either a method or a route", i))
+		case l.Method != "" && !strings.HasPrefix(l.Method, "/"):
+			errs = append(errs, fmt.Errorf("rate limit %v method %q must be a full method name starting with /", i, l.Method))
+		case l.Route != "" && len(strings.Fields(l.Route)) != 2:
+			errs = append(errs, fmt.Errorf("rate limit %v route %q must be an HTTP method and path", i, l.Route))
+		}
+		switch l.Key {
+		case "", RateLimitByIP, RateLimitByPrincipal, RateLimitByAPIKey, RateLimitByMethod:
+		default:
+			errs = append(errs, fmt.Errorf("rate limit %v for %v has unknown key %q", i, name, l.Key))
+		}
+		if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+			errs = append(errs, fmt.Errorf("rate limit %v for %v must have a positive rate", i, name))
+		}
+		if l.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate limit %v for %v burst %v cannot be negative", i, name, l.Burst))
+		}
+	}
+
+	// validate authorization policies
+	if h.PolicyFile != "" {
+		if _, err := loadPolicyFile(h.PolicyFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// validateTLS will check that the cert and key files exist, match and are currently valid.
+func (h *Hoster) validateTLS() []error {
+	if h.CertFile == "" && h.KeyFile == "" {
+		return nil
+	}
+	if h.CertFile == "" {
+		return []error{errors.New("cert file cannot be empty when key file is set")}
+	}
+	if h.KeyFile == "" {
+		return []error{errors.New("key file cannot be empty when cert file is set")}
+	}
+
+	errs := []error{}
+	for _, file := range []string{h.CertFile, h.KeyFile} {
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("unable to read TLS file: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	cert, err := tls.LoadX509KeyPair(h.CertFile, h.KeyFile)
+	if err != nil {
+		return []error{fmt.Errorf("failed to load TLS key pair: %v", err)}
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return []error{fmt.Errorf("failed to parse TLS certificate: %v", err)}
+	}
+
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		errs = append(errs, fmt.Errorf("TLS certificate expired on %v", leaf.NotAfter.Format(time.RFC3339)))
+	}
+	if now.Before(leaf.NotBefore) {
+		errs = append(errs, fmt.Errorf("TLS certificate is not valid until %v", leaf.NotBefore.Format(time.RFC3339)))
+	}
+
+	return errs
+}
+
+// parseAddr will split an address into host and port and verify the port is in range.
+func parseAddr(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		p, lookupErr := net.LookupPort("tcp", portStr)
+		if lookupErr != nil {
+			return "", 0, fmt.Errorf("unknown port %q", portStr)
+		}
+		port = p
+	}
+	if port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("port %v is out of range", port)
+	}
+
+	return host, port, nil
+}
+
+// conflicts returns true if both endpoints would attempt to bind the same port on an overlapping host.
+func (e endpoint) conflicts(other endpoint) bool {
+	// port 0 requests a random free port, so it never conflicts
+	if e.port == 0 || e.port != other.port {
+		return false
+	}
+
+	return e.host == other.host || isUnspecifiedHost(e.host) || isUnspecifiedHost(other.host)
+}
+
+// isUnspecifiedHost returns true if the host binds all interfaces.
+func isUnspecifiedHost(host string) bool {
+	if host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,211 @@
+package gohost
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// webSocketNormalClosure is the close code sent when a bridged call succeeds.
+	webSocketNormalClosure = 1000
+
+	// webSocketStatusOffset is added to the gRPC status code of a failed call to make its close code, which puts it in the range reserved for applications (e.g. 4005 for NotFound).
+	webSocketStatusOffset = 4000
+
+	// maxCloseReasonSize is the longest close reason that fits in a close frame with its code.
+	maxCloseReasonSize = 123
+)
+
+// webSocketMarshaler encodes messages on the WebSocket bridge the same way as the HTTP gateway.
+var webSocketMarshaler = &runtime.JSONPb{OrigName: true}
+
+// closeFrameCodec sends a close frame with a payload, since the websocket package only closes with a normal status.
+var closeFrameCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		return v.([]byte), websocket.CloseFrame, nil
+	},
+}
+
+// webSocketBridge will upgrade requests under WebSocketPath and bridge them to the gRPC method named by the rest of the path. Other requests are passed to next.
+func (h *Hoster) webSocketBridge(mux *runtime.ServeMux, cc *grpc.ClientConn, next http.Handler) http.Handler {
+	prefix := strings.TrimSuffix(h.WebSocketPath, "/") + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := "/" + strings.TrimPrefix(r.URL.Path, prefix)
+		method, ok := h.methods[name]
+		if !ok {
+			writeHTTPError(w, http.StatusNotFound, codes.Unimplemented, fmt.Sprintf("unknown method %v", name))
+			return
+		}
+
+		// forward the headers of the upgrade request as metadata, the same way as the gateway
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, status.Code(err), status.Convert(err).Message())
+			return
+		}
+
+		server := websocket.Server{
+			Handshake: h.checkWebSocketOrigin,
+			Handler: func(ws *websocket.Conn) {
+				h.clearStreamDeadlines(r)
+				h.bridgeWebSocket(ctx, ws, cc, method)
+			},
+		}
+		server.ServeHTTP(w, r)
+	})
+}
+
+// checkWebSocketOrigin will reject connections from browsers on origins that are not allowed.
+func (h *Hoster) checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	if !originAllowed(r, h.loadLive().webSocketOrigins) {
+		return fmt.Errorf("origin %v not allowed", r.Header.Get("Origin"))
+	}
+
+	return nil
+}
+
+// bridgeWebSocket will call a gRPC method with the messages received on a WebSocket connection and send back the responses, followed by a close frame with the final status.
+func (h *Hoster) bridgeWebSocket(ctx context.Context, ws *websocket.Conn, cc *grpc.ClientConn, method *methodDesc) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ws.MaxPayloadBytes = h.loadLive().maxRequestBodySize
+	s := &webSocketStream{ws: ws}
+
+	desc := &grpc.StreamDesc{
+		ClientStreams: method.clientStreams,
+		ServerStreams: method.serverStreams,
+	}
+	stream, err := cc.NewStream(ctx, desc, method.name)
+	if err != nil {
+		s.close(err)
+		return
+	}
+
+	go s.forwardRequests(stream, method, cancel)
+
+	for {
+		resp := method.newOutput()
+		if err := stream.RecvMsg(resp); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			s.close(err)
+			return
+		}
+
+		if err := s.send(resp); err != nil {
+			s.close(status.Errorf(codes.Internal, "failed to send message: %v", err))
+			return
+		}
+
+		if !method.serverStreams {
+			s.close(nil)
+			return
+		}
+	}
+}
+
+// webSocketStream is a WebSocket connection bridged to a gRPC call.
+type webSocketStream struct {
+	ws        *websocket.Conn
+	closeOnce sync.Once
+}
+
+// forwardRequests will send each message received on the connection to the gRPC call. An empty message ends the stream of requests, and methods that take a single request end after the first message. The call is canceled if the connection is closed first.
+func (s *webSocketStream) forwardRequests(stream grpc.ClientStream, method *methodDesc, cancel context.CancelFunc) {
+	for {
+		var data []byte
+		err := websocket.Message.Receive(s.ws, &data)
+		if err == websocket.ErrFrameTooLarge {
+			s.close(status.Errorf(codes.ResourceExhausted, "message larger than max (%v)", s.ws.MaxPayloadBytes))
+			cancel()
+			return
+		}
+		if err != nil {
+			cancel()
+			return
+		}
+
+		if len(data) == 0 {
+			stream.CloseSend()
+			return
+		}
+
+		req := method.newInput()
+		if err := webSocketMarshaler.Unmarshal(data, req); err != nil {
+			s.close(status.Errorf(codes.InvalidArgument, "invalid message: %v", err))
+			cancel()
+			return
+		}
+
+		// a failed send ends the call, and its status is returned to the receiving side
+		if err := stream.SendMsg(req); err != nil {
+			return
+		}
+
+		if !method.clientStreams {
+			stream.CloseSend()
+			return
+		}
+	}
+}
+
+// send will send a message as a JSON text frame.
+func (s *webSocketStream) send(m proto.Message) error {
+	b, err := webSocketMarshaler.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return websocket.Message.Send(s.ws, string(b))
+}
+
+// close will send the status of the call in a close frame, if one has not already been sent.
+func (s *webSocketStream) close(err error) {
+	s.closeOnce.Do(func() {
+		closeFrameCodec.Send(s.ws, closePayload(err))
+	})
+}
+
+// closePayload returns the payload of a close frame for the status of a call. The close code is 1000 for success or 4000 plus the gRPC status code, and the reason is the status message.
+func closePayload(err error) []byte {
+	code := webSocketNormalClosure
+	reason := ""
+	if err != nil {
+		st := status.Convert(err)
+		code = webSocketStatusOffset + int(st.Code())
+		reason = st.Message()
+	}
+
+	// truncate long messages without splitting a character
+	if len(reason) > maxCloseReasonSize {
+		reason = reason[:maxCloseReasonSize]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+
+	b := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(b, uint16(code))
+
+	return append(b, reason...)
+}
@@ -0,0 +1,976 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// wire types of the protobuf encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// wrapperTypes are the well-known wrapper messages, which are written in JSON as the value they wrap.
+var wrapperTypes = map[string]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// Codec converts between JSON and the protobuf encoding of messages in a descriptor set, following the proto3 JSON mapping. Timestamp, Duration and the wrapper types are written in their JSON form, and other well-known types are written as regular messages.
+type Codec struct {
+	set *Set
+
+	// OrigName writes fields with their proto names instead of their JSON names.
+	OrigName bool
+
+	// EmitDefaults writes fields that are not set with their default values.
+	EmitDefaults bool
+
+	// EnumsAsInts writes enum values as numbers instead of names.
+	EnumsAsInts bool
+
+	// AllowUnknownFields skips fields that are not in the message type instead of failing.
+	AllowUnknownFields bool
+}
+
+// NewCodec returns a codec for the messages in a descriptor set.
+func NewCodec(set *Set) *Codec {
+	return &Codec{set: set}
+}
+
+// HasMessage returns true if the descriptor set of the codec has a message type, by full name with or without a leading dot.
+func (c *Codec) HasMessage(typeName string) bool {
+	return c.set.HasMessage(typeName)
+}
+
+// Marshal will encode a JSON object as a message of the named type.
+func (c *Codec) Marshal(typeName string, data json.RawMessage) ([]byte, error) {
+	md, err := c.message(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case typeName == "google.protobuf.Timestamp":
+		return marshalTimestamp(data)
+	case typeName == "google.protobuf.Duration":
+		return marshalDuration(data)
+	case wrapperTypes[typeName]:
+		return c.marshalFields(md, map[string]json.RawMessage{"value": data})
+	}
+
+	var fields map[string]json.RawMessage
+	if err := decodeJSON(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid value for %v: %v", typeName, err)
+	}
+
+	return c.marshalFields(md, fields)
+}
+
+// marshalFields will encode JSON fields, keyed by JSON name or proto name, as a message.
+func (c *Codec) marshalFields(md *descriptor.DescriptorProto, fields map[string]json.RawMessage) ([]byte, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b []byte
+	for _, key := range keys {
+		fd := findField(md, key)
+		if fd == nil && c.AllowUnknownFields {
+			continue
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q in %v", key, md.GetName())
+		}
+
+		var err error
+		b, err = c.marshalField(b, fd, c.set.proto3[md], fields[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for field %q: %v", key, err)
+		}
+	}
+
+	return b, nil
+}
+
+// marshalField will append the encoding of a field to b. Null values leave the field unset.
+func (c *Codec) marshalField(b []byte, fd *descriptor.FieldDescriptorProto, proto3 bool, data json.RawMessage) ([]byte, error) {
+	if isNull(data) {
+		return b, nil
+	}
+	if fd.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		v, err := c.marshalValue(nil, fd, data)
+		if err != nil {
+			return nil, err
+		}
+
+		// proto3 leaves scalars with default values off the wire, unless they are part of a oneof
+		if proto3 && fd.OneofIndex == nil && fd.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE && isZero(v[len(appendTag(nil, fd.GetNumber(), wireVarint)):]) {
+			return b, nil
+		}
+
+		return append(b, v...), nil
+	}
+
+	// maps are repeated entries with the key as field 1 and the value as field 2
+	if entry := c.mapEntry(fd); entry != nil {
+		var values map[string]json.RawMessage
+		if err := decodeJSON(data, &values); err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			k, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+			e, err := c.marshalValue(nil, entry.Field[0], k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid map key %q: %v", key, err)
+			}
+			if !isNull(values[key]) {
+				if e, err = c.marshalValue(e, entry.Field[1], values[key]); err != nil {
+					return nil, err
+				}
+			}
+			b = appendTag(b, fd.GetNumber(), wireBytes)
+			b = appendBytes(b, e)
+		}
+
+		return b, nil
+	}
+
+	var values []json.RawMessage
+	if err := decodeJSON(data, &values); err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		var err error
+		if b, err = c.marshalValue(b, fd, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// marshalValue will append the tag and encoding of a single value of a field to b.
+func (c *Codec) marshalValue(b []byte, fd *descriptor.FieldDescriptorProto, data json.RawMessage) ([]byte, error) {
+	num := fd.GetNumber()
+
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		m, err := c.Marshal(trimDot(fd.GetTypeName()), data)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(appendTag(b, num, wireBytes), m), nil
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		var s string
+		if err := decodeJSON(data, &s); err != nil {
+			return nil, err
+		}
+		return appendBytes(appendTag(b, num, wireBytes), []byte(s)), nil
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		var s string
+		if err := decodeJSON(data, &s); err != nil {
+			return nil, err
+		}
+		v, err := decodeBase64(s)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(appendTag(b, num, wireBytes), v), nil
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		v, err := parseBool(data)
+		if err != nil {
+			return nil, err
+		}
+		var x uint64
+		if v {
+			x = 1
+		}
+		return appendVarint(appendTag(b, num, wireVarint), x), nil
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		v, err := c.parseEnum(trimDot(fd.GetTypeName()), data)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(appendTag(b, num, wireVarint), uint64(int64(v))), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_INT64:
+		v, err := parseInt(data, bitSize(fd))
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(appendTag(b, num, wireVarint), uint64(v)), nil
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_UINT64:
+		v, err := parseUint(data, bitSize(fd))
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(appendTag(b, num, wireVarint), v), nil
+	case descriptor.FieldDescriptorProto_TYPE_SINT32, descriptor.FieldDescriptorProto_TYPE_SINT64:
+		v, err := parseInt(data, bitSize(fd))
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(appendTag(b, num, wireVarint), uint64(v<<1)^uint64(v>>63)), nil
+	case descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		v, err := parseUint(data, 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed32(appendTag(b, num, wireFixed32), uint32(v)), nil
+	case descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		v, err := parseInt(data, 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed32(appendTag(b, num, wireFixed32), uint32(v)), nil
+	case descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		v, err := parseUint(data, 64)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed64(appendTag(b, num, wireFixed64), v), nil
+	case descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		v, err := parseInt(data, 64)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed64(appendTag(b, num, wireFixed64), uint64(v)), nil
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		v, err := parseFloat(data, 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed32(appendTag(b, num, wireFixed32), math.Float32bits(float32(v))), nil
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		v, err := parseFloat(data, 64)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixed64(appendTag(b, num, wireFixed64), math.Float64bits(v)), nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %v", fd.GetType())
+	}
+}
+
+// Unmarshal will decode the protobuf encoding of a message of the named type into a value that marshals to JSON.
+func (c *Codec) Unmarshal(typeName string, b []byte) (interface{}, error) {
+	md, err := c.message(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := c.unmarshalFields(md, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %v: %v", typeName, err)
+	}
+
+	switch {
+	case typeName == "google.protobuf.Timestamp":
+		return formatTimestamp(values)
+	case typeName == "google.protobuf.Duration":
+		return formatDuration(values)
+	case wrapperTypes[typeName]:
+		if v, ok := values[1]; ok {
+			return v, nil
+		}
+		return c.defaultValue(md.Field[0])
+	}
+
+	obj := jsonObject{}
+	for _, fd := range md.Field {
+		v, ok := values[fd.GetNumber()]
+		if !ok {
+			// fields of a oneof that is not set are left out even with defaults, like jsonpb does
+			if !c.EmitDefaults || fd.OneofIndex != nil {
+				continue
+			}
+			if v, err = c.emptyValue(fd); err != nil {
+				return nil, err
+			}
+		}
+
+		name := jsonName(fd)
+		if c.OrigName {
+			name = fd.GetName()
+		}
+		obj = append(obj, jsonField{name: name, value: v})
+	}
+
+	return obj, nil
+}
+
+// unmarshalFields will decode the fields of a message, keyed by field number. Repeated fields are decoded to lists or maps, and unknown fields are skipped.
+func (c *Codec) unmarshalFields(md *descriptor.DescriptorProto, b []byte) (map[int32]interface{}, error) {
+	fields := map[int32]*descriptor.FieldDescriptorProto{}
+	for _, fd := range md.Field {
+		fields[fd.GetNumber()] = fd
+	}
+
+	values := map[int32]interface{}{}
+	messages := map[int32][]byte{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid tag")
+		}
+		b = b[n:]
+		num, wire := int32(tag>>3), int(tag&7)
+
+		raw, rest, err := consumeValue(b, wire)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+
+		fd, ok := fields[num]
+		if !ok {
+			continue
+		}
+
+		// occurrences of a singular message are merged, which is the same as decoding them together
+		if fd.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE && fd.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			messages[num] = append(messages[num], raw...)
+			continue
+		}
+
+		if fd.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			v, err := c.unmarshalValue(fd, wire, raw)
+			if err != nil {
+				return nil, err
+			}
+			values[num] = v
+			continue
+		}
+
+		if entry := c.mapEntry(fd); entry != nil {
+			m, _ := values[num].(jsonObject)
+			entryValues, err := c.unmarshalFields(entry, raw)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := entryValues[1]
+			if !ok {
+				if key, err = c.defaultValue(entry.Field[0]); err != nil {
+					return nil, err
+				}
+			}
+			value, ok := entryValues[2]
+			if !ok {
+				if value, err = c.defaultValue(entry.Field[1]); err != nil {
+					return nil, err
+				}
+			}
+			values[num] = m.set(fmt.Sprint(key), value)
+			continue
+		}
+
+		list, _ := values[num].([]interface{})
+		if wire == wireBytes && isPackable(fd) {
+			// packed scalars are a single value of concatenated encodings
+			for len(raw) > 0 {
+				elem, rest, err := consumeValue(raw, packedWireType(fd))
+				if err != nil {
+					return nil, err
+				}
+				raw = rest
+				v, err := c.unmarshalValue(fd, packedWireType(fd), elem)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+		} else {
+			v, err := c.unmarshalValue(fd, wire, raw)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		values[num] = list
+	}
+
+	for num, raw := range messages {
+		v, err := c.Unmarshal(trimDot(fields[num].GetTypeName()), raw)
+		if err != nil {
+			return nil, err
+		}
+		values[num] = v
+	}
+
+	return values, nil
+}
+
+// unmarshalValue will decode a single value of a field from its encoding.
+func (c *Codec) unmarshalValue(fd *descriptor.FieldDescriptorProto, wire int, raw []byte) (interface{}, error) {
+	if fd.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+		return c.Unmarshal(trimDot(fd.GetTypeName()), raw)
+	}
+
+	var x uint64
+	switch wire {
+	case wireVarint:
+		x, _ = binary.Uvarint(raw)
+	case wireFixed32:
+		x = uint64(binary.LittleEndian.Uint32(raw))
+	case wireFixed64:
+		x = binary.LittleEndian.Uint64(raw)
+	}
+
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return string(raw), nil
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return x != 0, nil
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return c.enumName(trimDot(fd.GetTypeName()), int32(x)), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(x), nil
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(x), nil
+	case descriptor.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(x)>>1) ^ -int32(x&1), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return strconv.FormatInt(int64(x), 10), nil
+	case descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		return strconv.FormatUint(x, 10), nil
+	case descriptor.FieldDescriptorProto_TYPE_SINT64:
+		return strconv.FormatInt(int64(x>>1)^-int64(x&1), 10), nil
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return formatFloat(float64(math.Float32frombits(uint32(x))), 32), nil
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return formatFloat(math.Float64frombits(x), 64), nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %v", fd.GetType())
+	}
+}
+
+// defaultValue returns the JSON value of a field that is not set, which is used for map entries and wrappers without a value.
+func (c *Codec) defaultValue(fd *descriptor.FieldDescriptorProto) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		return c.Unmarshal(trimDot(fd.GetTypeName()), nil)
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return "", nil
+	}
+
+	return c.unmarshalValue(fd, wireVarint, []byte{0})
+}
+
+// emptyValue returns the JSON value written for a field that is not set when EmitDefaults is set. Lists and maps are empty and messages are null.
+func (c *Codec) emptyValue(fd *descriptor.FieldDescriptorProto) (interface{}, error) {
+	switch {
+	case c.mapEntry(fd) != nil:
+		return jsonObject{}, nil
+	case fd.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED:
+		return []interface{}{}, nil
+	case fd.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		return nil, nil
+	}
+
+	return c.defaultValue(fd)
+}
+
+// message returns the descriptor of a message by full name.
+func (c *Codec) message(typeName string) (*descriptor.DescriptorProto, error) {
+	md, ok := c.set.messages[typeName]
+	if !ok {
+		return nil, fmt.Errorf("message type %v not found", typeName)
+	}
+
+	return md, nil
+}
+
+// mapEntry returns the descriptor of the entries of a map field, or nil if the field is not a map.
+func (c *Codec) mapEntry(fd *descriptor.FieldDescriptorProto) *descriptor.DescriptorProto {
+	if fd.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+		return nil
+	}
+	md, ok := c.set.messages[trimDot(fd.GetTypeName())]
+	if !ok || !md.GetOptions().GetMapEntry() || len(md.Field) != 2 {
+		return nil
+	}
+
+	return md
+}
+
+// parseEnum returns the number of an enum value written as its name or number. Numbers may also be written as strings, which is how path and query parameters are set.
+func (c *Codec) parseEnum(typeName string, data json.RawMessage) (int32, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		v, err := parseInt(data, 32)
+		return int32(v), err
+	}
+
+	ed, ok := c.set.enums[typeName]
+	if !ok {
+		return 0, fmt.Errorf("enum type %v not found", typeName)
+	}
+	for _, value := range ed.Value {
+		if value.GetName() == name {
+			return value.GetNumber(), nil
+		}
+	}
+	if v, err := strconv.ParseInt(name, 10, 32); err == nil {
+		return int32(v), nil
+	}
+
+	return 0, fmt.Errorf("unknown value %q for enum %v", name, typeName)
+}
+
+// enumName returns the name of an enum value, or its number if the value is unknown or EnumsAsInts is set.
+func (c *Codec) enumName(typeName string, number int32) interface{} {
+	if c.EnumsAsInts {
+		return number
+	}
+	if ed, ok := c.set.enums[typeName]; ok {
+		for _, value := range ed.Value {
+			if value.GetNumber() == number {
+				return value.GetName()
+			}
+		}
+	}
+
+	return number
+}
+
+// findField returns the field of a message with a JSON name or proto name, or nil if there is none.
+func findField(md *descriptor.DescriptorProto, name string) *descriptor.FieldDescriptorProto {
+	for _, fd := range md.Field {
+		if jsonName(fd) == name || fd.GetName() == name {
+			return fd
+		}
+	}
+
+	return nil
+}
+
+// jsonName returns the JSON name of a field, which is the lower camel case proto name unless set otherwise.
+func jsonName(fd *descriptor.FieldDescriptorProto) string {
+	if fd.JsonName != nil {
+		return fd.GetJsonName()
+	}
+
+	parts := strings.Split(fd.GetName(), "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// isPackable returns true if repeated values of a field may be packed, which is every scalar type except strings and bytes.
+func isPackable(fd *descriptor.FieldDescriptorProto) bool {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return false
+	}
+
+	return true
+}
+
+// packedWireType returns the wire type of the values of a packed field.
+func packedWireType(fd *descriptor.FieldDescriptorProto) int {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_FIXED32, descriptor.FieldDescriptorProto_TYPE_SFIXED32, descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return wireFixed32
+	case descriptor.FieldDescriptorProto_TYPE_FIXED64, descriptor.FieldDescriptorProto_TYPE_SFIXED64, descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return wireFixed64
+	}
+
+	return wireVarint
+}
+
+// bitSize returns the size of an integer field in bits.
+func bitSize(fd *descriptor.FieldDescriptorProto) int {
+	switch fd.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_SINT32:
+		return 32
+	}
+
+	return 64
+}
+
+// consumeValue returns the encoding of a value of a wire type at the start of b, and the rest of b. Length-delimited values are returned without their length.
+func consumeValue(b []byte, wire int) ([]byte, []byte, error) {
+	switch wire {
+	case wireVarint:
+		_, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, nil, errors.New("invalid varint")
+		}
+		return b[:n], b[n:], nil
+	case wireFixed32:
+		if len(b) < 4 {
+			return nil, nil, errors.New("unexpected end of message")
+		}
+		return b[:4], b[4:], nil
+	case wireFixed64:
+		if len(b) < 8 {
+			return nil, nil, errors.New("unexpected end of message")
+		}
+		return b[:8], b[8:], nil
+	case wireBytes:
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return nil, nil, errors.New("unexpected end of message")
+		}
+		return b[n : n+int(size)], b[n+int(size):], nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported wire type %v", wire)
+	}
+}
+
+// isZero returns true if every byte of an encoded value is zero, which is the encoding of the default value of every scalar type.
+func isZero(v []byte) bool {
+	for _, x := range v {
+		if x != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// appendVarint will append a varint to b.
+func appendVarint(b []byte, x uint64) []byte {
+	return append(b, proto.EncodeVarint(x)...)
+}
+
+// appendFixed32 will append a little-endian 32-bit value to b.
+func appendFixed32(b []byte, x uint32) []byte {
+	var v [4]byte
+	binary.LittleEndian.PutUint32(v[:], x)
+	return append(b, v[:]...)
+}
+
+// appendFixed64 will append a little-endian 64-bit value to b.
+func appendFixed64(b []byte, x uint64) []byte {
+	var v [8]byte
+	binary.LittleEndian.PutUint64(v[:], x)
+	return append(b, v[:]...)
+}
+
+// appendTag will append the tag of a field to b.
+func appendTag(b []byte, num int32, wire int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+// appendBytes will append a length-delimited value to b.
+func appendBytes(b []byte, v []byte) []byte {
+	return append(appendVarint(b, uint64(len(v))), v...)
+}
+
+// marshalTimestamp will encode an RFC 3339 string as a Timestamp.
+func marshalTimestamp(data json.RawMessage) ([]byte, error) {
+	var s string
+	if err := decodeJSON(data, &s); err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendSecondsNanos(nil, t.Unix(), int32(t.Nanosecond())), nil
+}
+
+// marshalDuration will encode a string of seconds with an s suffix (e.g. 1.5s) as a Duration.
+func marshalDuration(data json.RawMessage) ([]byte, error) {
+	var s string
+	if err := decodeJSON(data, &s); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(s, "s") {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+
+	value := strings.TrimSuffix(s, "s")
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+	whole, frac := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, frac = value[:i], value[i+1:]
+	}
+	if len(frac) > 9 {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+
+	seconds, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+	var nanos int64
+	if frac != "" {
+		if nanos, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if negative {
+		seconds, nanos = -seconds, -nanos
+	}
+
+	return appendSecondsNanos(nil, seconds, int32(nanos)), nil
+}
+
+// appendSecondsNanos will append the fields of a Timestamp or Duration to b.
+func appendSecondsNanos(b []byte, seconds int64, nanos int32) []byte {
+	if seconds != 0 {
+		b = appendVarint(appendTag(b, 1, wireVarint), uint64(seconds))
+	}
+	if nanos != 0 {
+		b = appendVarint(appendTag(b, 2, wireVarint), uint64(int64(nanos)))
+	}
+
+	return b
+}
+
+// formatTimestamp returns the RFC 3339 string of the decoded fields of a Timestamp.
+func formatTimestamp(values map[int32]interface{}) (interface{}, error) {
+	seconds, nanos, err := secondsNanos(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339Nano), nil
+}
+
+// formatDuration returns the string of seconds of the decoded fields of a Duration.
+func formatDuration(values map[int32]interface{}) (interface{}, error) {
+	seconds, nanos, err := secondsNanos(values)
+	if err != nil {
+		return nil, err
+	}
+
+	sign := ""
+	if seconds < 0 || nanos < 0 {
+		sign, seconds, nanos = "-", -seconds, -nanos
+	}
+	s := fmt.Sprintf("%v%d", sign, seconds)
+	if nanos != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0")
+	}
+
+	return s + "s", nil
+}
+
+// secondsNanos returns the decoded fields of a Timestamp or Duration.
+func secondsNanos(values map[int32]interface{}) (int64, int32, error) {
+	var seconds int64
+	if s, ok := values[1].(string); ok {
+		var err error
+		if seconds, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	nanos, _ := values[2].(int32)
+
+	return seconds, nanos, nil
+}
+
+// parseInt returns a signed integer written as a JSON number or string.
+func parseInt(data json.RawMessage, bitSize int) (int64, error) {
+	s, err := numberString(data)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseInt(s, 10, bitSize)
+	if err != nil {
+		// integers may be written with an exponent or zero fraction (e.g. 1e3)
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || f != math.Trunc(f) {
+			return 0, err
+		}
+		return strconv.ParseInt(strconv.FormatFloat(f, 'f', -1, 64), 10, bitSize)
+	}
+
+	return v, nil
+}
+
+// parseUint returns an unsigned integer written as a JSON number or string.
+func parseUint(data json.RawMessage, bitSize int) (uint64, error) {
+	s, err := numberString(data)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(s, 10, bitSize)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || f != math.Trunc(f) {
+			return 0, err
+		}
+		return strconv.ParseUint(strconv.FormatFloat(f, 'f', -1, 64), 10, bitSize)
+	}
+
+	return v, nil
+}
+
+// parseFloat returns a floating point number written as a JSON number or string, including NaN, Infinity and -Infinity.
+func parseFloat(data json.RawMessage, bitSize int) (float64, error) {
+	s, err := numberString(data)
+	if err != nil {
+		return 0, err
+	}
+
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+
+	return strconv.ParseFloat(s, bitSize)
+}
+
+// parseBool returns a boolean written as a JSON boolean or string, which is how map keys are written.
+func parseBool(data json.RawMessage) (bool, error) {
+	var v bool
+	if err := json.Unmarshal(data, &v); err == nil {
+		return v, nil
+	}
+
+	var s string
+	if err := decodeJSON(data, &s); err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(s)
+}
+
+// numberString returns the text of a JSON number or string.
+func numberString(data json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s, nil
+	}
+
+	var n json.Number
+	if err := decodeJSON(data, &n); err != nil {
+		return "", err
+	}
+
+	return n.String(), nil
+}
+
+// formatFloat returns a floating point number as a JSON number, or a string for NaN and infinities.
+func formatFloat(v float64, bitSize int) interface{} {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+
+	return json.Number(strconv.FormatFloat(v, 'g', -1, bitSize))
+}
+
+// decodeBase64 returns the bytes of a standard or URL-safe base64 string, with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// decodeJSON will decode JSON into v, keeping numbers as json.Number.
+func decodeJSON(data json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
+
+// isNull returns true if a JSON value is null.
+func isNull(data json.RawMessage) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
+
+// jsonObject is a JSON object that keeps its fields in order, so messages are written in field order.
+type jsonObject []jsonField
+
+// jsonField is a field of a JSON object.
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+// set returns the object with a field set, replacing any field with the same name.
+func (o jsonObject) set(name string, value interface{}) jsonObject {
+	for i := range o {
+		if o[i].name == name {
+			o[i].value = value
+			return o
+		}
+	}
+
+	return append(o, jsonField{name: name, value: value})
+}
+
+// MarshalJSON writes the fields of the object in order.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
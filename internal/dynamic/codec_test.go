@@ -0,0 +1,174 @@
+package dynamic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Codec_Marshal(t *testing.T) {
+	// arrange
+	codec := newTestCodec(t, "google/protobuf/descriptor.proto")
+	input := `{
+		"name": "values",
+		"number": 2,
+		"label": "LABEL_REPEATED",
+		"type": 9,
+		"json_name": "values",
+		"defaultValue": null,
+		"options": {"packed": true, "deprecated": "true"}
+	}`
+
+	// act
+	b, err := codec.Marshal("google.protobuf.FieldDescriptorProto", []byte(input))
+
+	// assert
+	assert.NoError(t, err)
+	field := &descriptor.FieldDescriptorProto{}
+	assert.NoError(t, proto.Unmarshal(b, field))
+	assert.Equal(t, "values", field.GetName())
+	assert.Equal(t, int32(2), field.GetNumber())
+	assert.Equal(t, descriptor.FieldDescriptorProto_LABEL_REPEATED, field.GetLabel())
+	assert.Equal(t, descriptor.FieldDescriptorProto_TYPE_STRING, field.GetType())
+	assert.Equal(t, "values", field.GetJsonName())
+	assert.Nil(t, field.DefaultValue)
+	assert.True(t, field.GetOptions().GetPacked())
+	assert.True(t, field.GetOptions().GetDeprecated())
+}
+
+func Test_Codec_Marshal_Invalid(t *testing.T) {
+	// arrange
+	codec := newTestCodec(t, "google/protobuf/descriptor.proto")
+
+	// act
+	_, unknownFieldErr := codec.Marshal("google.protobuf.FieldDescriptorProto", []byte(`{"missing":1}`))
+	_, unknownEnumErr := codec.Marshal("google.protobuf.FieldDescriptorProto", []byte(`{"label":"LABEL_MISSING"}`))
+	_, overflowErr := codec.Marshal("google.protobuf.FieldDescriptorProto", []byte(`{"number":4294967296}`))
+	_, typeErr := codec.Marshal("google.protobuf.FieldDescriptorProto", []byte(`{"name":1}`))
+	_, unknownTypeErr := codec.Marshal("google.protobuf.Missing", []byte(`{}`))
+
+	// assert
+	assert.EqualError(t, unknownFieldErr, `unknown field "missing" in FieldDescriptorProto`)
+	assert.EqualError(t, unknownEnumErr, `invalid value for field "label": unknown value "LABEL_MISSING" for enum google.protobuf.FieldDescriptorProto.Label`)
+	assert.Error(t, overflowErr)
+	assert.Error(t, typeErr)
+	assert.EqualError(t, unknownTypeErr, "message type google.protobuf.Missing not found")
+}
+
+func Test_Codec_Unmarshal(t *testing.T) {
+	// arrange - packed and unpacked repeated fields, nested messages, enums and 64-bit integers
+	codec := newTestCodec(t, "google/protobuf/descriptor.proto")
+	file := &descriptor.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Dependency: []string{"a.proto", "b.proto"},
+		MessageType: []*descriptor.DescriptorProto{{
+			Name: proto.String("Test"),
+			Field: []*descriptor.FieldDescriptorProto{{
+				Name:  proto.String("value"),
+				Label: descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:  descriptor.FieldDescriptorProto_TYPE_SINT64.Enum(),
+			}},
+		}},
+		Options: &descriptor.FileOptions{
+			JavaPackage:    proto.String("test"),
+			OptimizeFor:    descriptor.FileOptions_CODE_SIZE.Enum(),
+			CcEnableArenas: proto.Bool(true),
+		},
+		SourceCodeInfo: &descriptor.SourceCodeInfo{
+			Location: []*descriptor.SourceCodeInfo_Location{{
+				Path: []int32{4, 0, -1},
+				Span: []int32{1, 2, 3},
+			}},
+		},
+	}
+	b, err := proto.Marshal(file)
+	assert.NoError(t, err)
+	expected, err := (&jsonpb.Marshaler{}).MarshalToString(file)
+	assert.NoError(t, err)
+
+	// act
+	v, err := codec.Unmarshal("google.protobuf.FileDescriptorProto", b)
+
+	// assert
+	assert.NoError(t, err)
+	actual := marshalJSON(t, v)
+	assert.JSONEq(t, expected, actual)
+}
+
+func Test_Codec_WellKnownTypes(t *testing.T) {
+	// arrange
+	codec := newTestCodec(t, "google/protobuf/timestamp.proto", "google/protobuf/duration.proto", "google/protobuf/wrappers.proto", "google/protobuf/struct.proto")
+	tests := []struct {
+		typeName string
+		json     string
+		message  proto.Message
+	}{
+		{"google.protobuf.Timestamp", `"2018-07-01T10:20:30.5Z"`, &timestamp.Timestamp{Seconds: time.Date(2018, 7, 1, 10, 20, 30, 0, time.UTC).Unix(), Nanos: 500000000}},
+		{"google.protobuf.Duration", `"-1.000000002s"`, &duration.Duration{Seconds: -1, Nanos: -2}},
+		{"google.protobuf.Duration", `"0s"`, &duration.Duration{}},
+		{"google.protobuf.Int64Value", `"-5"`, &wrappers.Int64Value{Value: -5}},
+		{"google.protobuf.FloatValue", `1.5`, &wrappers.FloatValue{Value: 1.5}},
+		{"google.protobuf.BytesValue", `"dGVzdA=="`, &wrappers.BytesValue{Value: []byte("test")}},
+		{"google.protobuf.BoolValue", `false`, &wrappers.BoolValue{}},
+		{"google.protobuf.Struct", `{"fields":{"a":{"listValue":{"values":[{"stringValue":"b"},{"numberValue":1}]}}}}`, &structpb.Struct{Fields: map[string]*structpb.Value{
+			"a": {Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: []*structpb.Value{
+				{Kind: &structpb.Value_StringValue{StringValue: "b"}},
+				{Kind: &structpb.Value_NumberValue{NumberValue: 1}},
+			}}}},
+		}}},
+	}
+
+	for _, test := range tests {
+		// act
+		b, marshalErr := codec.Marshal(test.typeName, []byte(test.json))
+		expected, err := proto.Marshal(test.message)
+		assert.NoError(t, err)
+		v, unmarshalErr := codec.Unmarshal(test.typeName, expected)
+
+		// assert
+		assert.NoError(t, marshalErr, test.json)
+		assert.Equal(t, string(expected), string(b), test.json)
+		assert.NoError(t, unmarshalErr, test.json)
+		assert.JSONEq(t, test.json, marshalJSON(t, v))
+	}
+}
+
+// newTestCodec is a helper function that creates a codec for the descriptors of proto files linked into the test.
+func newTestCodec(t *testing.T, files ...string) *Codec {
+	set := NewSet()
+	for _, file := range files {
+		gz := proto.FileDescriptor(file)
+		assert.NotNil(t, gz, file)
+		r, err := gzip.NewReader(bytes.NewReader(gz))
+		assert.NoError(t, err)
+		b, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+
+		fd := &descriptor.FileDescriptorProto{}
+		assert.NoError(t, proto.Unmarshal(b, fd))
+		set.Add(fd)
+	}
+
+	return NewCodec(set)
+}
+
+// marshalJSON is a helper function that marshals a decoded message to JSON.
+func marshalJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+
+	return string(b)
+}
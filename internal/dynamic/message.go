@@ -0,0 +1,210 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// Message is a message of a type in a descriptor set, kept in its protobuf encoding. It marshals itself, so the gRPC proto codec sends and receives it as is, and it is read and written as JSON by jsonpb with the codec, so it can be used wherever generated messages are.
+type Message struct {
+	codec    *Codec
+	typeName string
+	data     []byte
+}
+
+// NewMessage returns an empty message of the named type.
+func NewMessage(codec *Codec, typeName string) *Message {
+	return &Message{
+		codec:    codec,
+		typeName: trimDot(typeName),
+	}
+}
+
+// Reset clears the message.
+func (m *Message) Reset() {
+	m.data = nil
+}
+
+// String returns the message as JSON.
+func (m *Message) String() string {
+	b, err := m.MarshalJSONPB(&jsonpb.Marshaler{})
+	if err != nil {
+		return fmt.Sprintf("<%v: %v>", m.typeName, err)
+	}
+
+	return string(b)
+}
+
+// ProtoMessage marks the message as a protobuf message.
+func (*Message) ProtoMessage() {}
+
+// XXX_MessageName returns the full name of the message type, which is used by proto.MessageName.
+func (m *Message) XXX_MessageName() string {
+	return m.typeName
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *Message) Marshal() ([]byte, error) {
+	return m.data, nil
+}
+
+// Unmarshal will set the message from its protobuf encoding, which must be a valid message of the type.
+func (m *Message) Unmarshal(b []byte) error {
+	if _, err := m.codec.Unmarshal(m.typeName, b); err != nil {
+		return err
+	}
+	m.data = append([]byte(nil), b...)
+
+	return nil
+}
+
+// Merge will merge another message of the same type into the message, which is used by proto.Merge and proto.Clone.
+func (m *Message) Merge(src proto.Message) {
+	s, ok := src.(*Message)
+	if !ok {
+		return
+	}
+
+	// proto.Clone merges into a zero message, which takes the type of the source
+	if m.codec == nil {
+		m.codec, m.typeName = s.codec, s.typeName
+	}
+	if s.typeName != m.typeName {
+		return
+	}
+
+	// encodings of the same type are merged by appending them
+	m.data = append(append([]byte(nil), m.data...), s.data...)
+}
+
+// MarshalJSONPB returns the message as JSON, with the options of the jsonpb marshaler.
+func (m *Message) MarshalJSONPB(marshaler *jsonpb.Marshaler) ([]byte, error) {
+	c := *m.codec
+	c.OrigName = marshaler.OrigName
+	c.EmitDefaults = marshaler.EmitDefaults
+	c.EnumsAsInts = marshaler.EnumsAsInts
+
+	v, err := c.Unmarshal(m.typeName, m.data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if marshaler.Indent == "" {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", marshaler.Indent); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSONPB will merge JSON into the message, with the options of the jsonpb unmarshaler.
+func (m *Message) UnmarshalJSONPB(unmarshaler *jsonpb.Unmarshaler, b []byte) error {
+	c := *m.codec
+	c.AllowUnknownFields = unmarshaler.AllowUnknownFields
+
+	data, err := c.Marshal(m.typeName, b)
+	if err != nil {
+		return err
+	}
+	m.data = append(m.data, data...)
+
+	return nil
+}
+
+// HasField returns true if the message type has a field with a proto name.
+func (m *Message) HasField(name string) bool {
+	md, err := m.codec.message(m.typeName)
+	if err != nil {
+		return false
+	}
+
+	return findProtoField(md, name) != nil
+}
+
+// SetFieldJSON will set a field, by proto name, to a JSON value.
+func (m *Message) SetFieldJSON(name string, value json.RawMessage) error {
+	fields, err := json.Marshal(map[string]json.RawMessage{name: value})
+	if err != nil {
+		return err
+	}
+
+	return m.merge(fields)
+}
+
+// SetField will set a field, by the proto names of the fields on its path (e.g. item.name), to path or query parameter values. Repeated fields are set to every value and other fields must have exactly one. Paths that do not name a field are ignored, like the gateway does for generated messages.
+func (m *Message) SetField(path []string, values []string) error {
+	md, err := m.codec.message(m.typeName)
+	if err != nil {
+		return err
+	}
+
+	var fd *descriptor.FieldDescriptorProto
+	for i, name := range path {
+		if fd = findProtoField(md, name); fd == nil {
+			return nil
+		}
+		if i == len(path)-1 {
+			break
+		}
+		if fd.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE || fd.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			return fmt.Errorf("unexpected nested field %v in %v", path[i+1], strings.Join(path[:i+1], "."))
+		}
+		if md, err = m.codec.message(trimDot(fd.GetTypeName())); err != nil {
+			return err
+		}
+	}
+
+	// every type is read from a JSON string, so the values are set as they are
+	var value interface{}
+	if fd.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		value = values
+	} else if len(values) != 1 {
+		return fmt.Errorf("too many values for field %v: %v", strings.Join(path, "."), values)
+	} else {
+		value = values[0]
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	fields, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return m.merge(fields)
+}
+
+// merge will encode JSON fields and merge them into the message.
+func (m *Message) merge(fields []byte) error {
+	data, err := m.codec.Marshal(m.typeName, fields)
+	if err != nil {
+		return err
+	}
+	m.data = append(m.data, data...)
+
+	return nil
+}
+
+// findProtoField returns the field of a message with a proto name, or nil if there is none.
+func findProtoField(md *descriptor.DescriptorProto, name string) *descriptor.FieldDescriptorProto {
+	for _, fd := range md.Field {
+		if fd.GetName() == name {
+			return fd
+		}
+	}
+
+	return nil
+}
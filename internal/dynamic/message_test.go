@@ -0,0 +1,119 @@
+package dynamic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Message_JSONPB(t *testing.T) {
+	// arrange
+	codec := newTestCodec(t, "google/protobuf/descriptor.proto")
+	msg := NewMessage(codec, ".google.protobuf.FieldDescriptorProto")
+
+	// act
+	err := jsonpb.UnmarshalString(`{"name":"values","number":2,"label":"LABEL_REPEATED","unknown":1}`, msg)
+	lenientErr := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(strings.NewReader(`{"name":"values","number":2,"label":"LABEL_REPEATED","unknown":1}`), msg)
+	s, marshalErr := (&jsonpb.Marshaler{EnumsAsInts: true}).MarshalToString(msg)
+	b, protoErr := proto.Marshal(msg)
+	clone := proto.Clone(msg)
+
+	// assert
+	assert.Error(t, err)
+	assert.NoError(t, lenientErr)
+	assert.NoError(t, marshalErr)
+	assert.JSONEq(t, `{"name":"values","number":2,"label":3}`, s)
+	assert.NoError(t, protoErr)
+	field := &descriptor.FieldDescriptorProto{}
+	assert.NoError(t, proto.Unmarshal(b, field))
+	assert.Equal(t, "values", field.GetName())
+	assert.Equal(t, descriptor.FieldDescriptorProto_LABEL_REPEATED, field.GetLabel())
+	assert.Equal(t, "google.protobuf.FieldDescriptorProto", proto.MessageName(msg))
+	assert.Equal(t, msg.String(), clone.String())
+}
+
+func Test_Message_EmitDefaults(t *testing.T) {
+	// arrange - a proto3 message with a field of every kind
+	set := NewSet()
+	set.Add(&descriptor.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptor.DescriptorProto{{
+			Name: proto.String("Test"),
+			Field: []*descriptor.FieldDescriptorProto{
+				newTestField("value", 1, descriptor.FieldDescriptorProto_TYPE_STRING, ""),
+				newTestField("count", 2, descriptor.FieldDescriptorProto_TYPE_INT64, ""),
+				newTestField("kind", 3, descriptor.FieldDescriptorProto_TYPE_ENUM, ".test.Kind"),
+				newTestField("child", 4, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".test.Test"),
+			},
+		}},
+		EnumType: []*descriptor.EnumDescriptorProto{{
+			Name:  proto.String("Kind"),
+			Value: []*descriptor.EnumValueDescriptorProto{{Name: proto.String("KIND_UNKNOWN"), Number: proto.Int32(0)}},
+		}},
+	})
+	msg := NewMessage(NewCodec(set), "test.Test")
+	msg.SetField([]string{"child", "value"}, []string{"a"})
+
+	// act
+	s, err := (&jsonpb.Marshaler{OrigName: true, EmitDefaults: true}).MarshalToString(msg)
+
+	// assert
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":"","count":"0","kind":"KIND_UNKNOWN","child":{"value":"a","count":"0","kind":"KIND_UNKNOWN","child":null}}`, s)
+}
+
+func Test_Message_SetField(t *testing.T) {
+	// arrange
+	codec := newTestCodec(t, "google/protobuf/descriptor.proto")
+	msg := NewMessage(codec, "google.protobuf.FieldDescriptorProto")
+
+	// act
+	numberErr := msg.SetField([]string{"number"}, []string{"5"})
+	labelErr := msg.SetField([]string{"label"}, []string{"3"})
+	nestedErr := msg.SetField([]string{"options", "packed"}, []string{"true"})
+	missingErr := msg.SetField([]string{"missing"}, []string{"x"})
+	tooManyErr := msg.SetField([]string{"name"}, []string{"a", "b"})
+	scalarErr := msg.SetField([]string{"name", "value"}, []string{"a"})
+	jsonErr := msg.SetFieldJSON("json_name", []byte(`"n"`))
+	b, err := proto.Marshal(msg)
+
+	// assert
+	assert.NoError(t, numberErr)
+	assert.NoError(t, labelErr)
+	assert.NoError(t, nestedErr)
+	assert.NoError(t, missingErr)
+	assert.Error(t, tooManyErr)
+	assert.Error(t, scalarErr)
+	assert.NoError(t, jsonErr)
+	assert.NoError(t, err)
+	field := &descriptor.FieldDescriptorProto{}
+	assert.NoError(t, proto.Unmarshal(b, field))
+	assert.Equal(t, int32(5), field.GetNumber())
+	assert.Equal(t, descriptor.FieldDescriptorProto_LABEL_REPEATED, field.GetLabel())
+	assert.True(t, field.GetOptions().GetPacked())
+	assert.Equal(t, "n", field.GetJsonName())
+	assert.True(t, msg.HasField("json_name"))
+	assert.False(t, msg.HasField("jsonName"))
+}
+
+// newTestField is a helper function that returns the descriptor of a singular field.
+func newTestField(name string, number int32, fieldType descriptor.FieldDescriptorProto_Type, typeName string) *descriptor.FieldDescriptorProto {
+	fd := &descriptor.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   fieldType.Enum(),
+	}
+	if typeName != "" {
+		fd.TypeName = proto.String(typeName)
+	}
+
+	return fd
+}
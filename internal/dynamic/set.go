@@ -0,0 +1,152 @@
+// Package dynamic reads and writes messages of the types in a descriptor set, so services can be called and served without their generated code.
+package dynamic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// Set indexes the services, messages and enums of proto files by full name (e.g. test.TestService).
+type Set struct {
+	files    map[string]*descriptor.FileDescriptorProto
+	services map[string]*descriptor.ServiceDescriptorProto
+	messages map[string]*descriptor.DescriptorProto
+	enums    map[string]*descriptor.EnumDescriptorProto
+	proto3   map[*descriptor.DescriptorProto]bool
+}
+
+// NewSet creates an empty descriptor set.
+func NewSet() *Set {
+	return &Set{
+		files:    map[string]*descriptor.FileDescriptorProto{},
+		services: map[string]*descriptor.ServiceDescriptorProto{},
+		messages: map[string]*descriptor.DescriptorProto{},
+		enums:    map[string]*descriptor.EnumDescriptorProto{},
+		proto3:   map[*descriptor.DescriptorProto]bool{},
+	}
+}
+
+// LoadSetFile returns the descriptors in a compiled FileDescriptorSet (e.g. protoc --include_imports --descriptor_set_out).
+func LoadSetFile(file string) (*Set, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+	}
+
+	fds := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, fds); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %v: %v", file, err)
+	}
+
+	set := NewSet()
+	for _, fd := range fds.File {
+		set.Add(fd)
+	}
+
+	return set, nil
+}
+
+// Add will index the services, messages and enums of a file.
+func (s *Set) Add(fd *descriptor.FileDescriptorProto) {
+	s.files[fd.GetName()] = fd
+	for _, sd := range fd.Service {
+		s.services[QualifiedName(fd.GetPackage(), sd.GetName())] = sd
+	}
+	for _, md := range fd.MessageType {
+		s.addMessage(fd.GetPackage(), md, fd.GetSyntax() == "proto3")
+	}
+	for _, ed := range fd.EnumType {
+		s.enums[QualifiedName(fd.GetPackage(), ed.GetName())] = ed
+	}
+}
+
+// addMessage will index a message and the messages and enums nested in it, along with the syntax of the file that defines them.
+func (s *Set) addMessage(prefix string, md *descriptor.DescriptorProto, proto3 bool) {
+	name := QualifiedName(prefix, md.GetName())
+	s.messages[name] = md
+	s.proto3[md] = proto3
+	for _, nested := range md.NestedType {
+		s.addMessage(name, nested, proto3)
+	}
+	for _, ed := range md.EnumType {
+		s.enums[QualifiedName(name, ed.GetName())] = ed
+	}
+}
+
+// HasFile returns true if a file with a name has been added.
+func (s *Set) HasFile(name string) bool {
+	_, ok := s.files[name]
+	return ok
+}
+
+// Files returns the files that have been added, sorted by name.
+func (s *Set) Files() []*descriptor.FileDescriptorProto {
+	files := make([]*descriptor.FileDescriptorProto, 0, len(s.files))
+	for _, fd := range s.files {
+		files = append(files, fd)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].GetName() < files[j].GetName()
+	})
+
+	return files
+}
+
+// HasMessage returns true if the set has a message type, by full name with or without a leading dot.
+func (s *Set) HasMessage(typeName string) bool {
+	_, ok := s.messages[trimDot(typeName)]
+	return ok
+}
+
+// FindMethod returns a method and its full name (e.g. /test.TestService/Echo), by a name that may be written as /package.Service/Method, package.Service/Method or package.Service.Method.
+func (s *Set) FindMethod(name string) (*descriptor.MethodDescriptorProto, string, error) {
+	serviceName, methodName, err := SplitMethodName(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sd, ok := s.services[serviceName]
+	if !ok {
+		return nil, "", fmt.Errorf("service %v not found", serviceName)
+	}
+	for _, md := range sd.Method {
+		if md.GetName() == methodName {
+			return md, "/" + serviceName + "/" + methodName, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("method %v not found in service %v", methodName, serviceName)
+}
+
+// SplitMethodName returns the service and method of a full method name.
+func SplitMethodName(name string) (string, string, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		i = strings.LastIndex(name, ".")
+	}
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid method name %q, expected package.Service/Method", name)
+	}
+
+	return name[:i], name[i+1:], nil
+}
+
+// QualifiedName returns the full name of a proto element in a package or message.
+func QualifiedName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
+
+// trimDot returns a type name without its leading dot (e.g. .test.SendRequest).
+func trimDot(typeName string) string {
+	return strings.TrimPrefix(typeName, ".")
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/gohosttest"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_GohostTest_Golden(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	server := gohosttest.Start(t, newGoldenHoster())
+	defer server.Stop()
+
+	// act and assert - compare unary, streaming and error responses with their golden files
+	server.Golden(t, "../testdata/golden/echo.json", gohosttest.GoldenRequest{
+		Method: "GET",
+		Path:   "/v1/echo?value=test",
+	})
+	server.Golden(t, "../testdata/golden/send.json", gohosttest.GoldenRequest{
+		Method: "POST",
+		Path:   "/v1/send",
+		Header: map[string]string{"Content-Type": "application/json"},
+		Body:   json.RawMessage(`{"value":"test"}`),
+	})
+	server.Golden(t, "../testdata/golden/repeat.json", gohosttest.GoldenRequest{
+		Method: "GET",
+		Path:   "/v1/repeat?value=test&count=2",
+	})
+	server.Golden(t, "../testdata/golden/echo_not_found.json", gohosttest.GoldenRequest{
+		Method: "GET",
+		Path:   "/v1/echo?value=missing",
+	})
+}
+
+func Test_GohostTest_ReplayGolden(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	server := gohosttest.Start(t, newGoldenHoster())
+	defer server.Stop()
+
+	// act and assert - send the requests saved in the golden files again
+	server.ReplayGolden(t, "../testdata/golden/*.json")
+}
+
+func Test_GohostTest_Golden_Changed(t *testing.T) {
+	t.Parallel()
+	if *gohosttest.Update {
+		t.Skip("golden files are written instead of compared")
+	}
+
+	// arrange
+	server := gohosttest.Start(t, newGoldenHoster())
+	defer server.Stop()
+
+	// write a golden file for a response with a different JSON shape
+	dir, err := ioutil.TempDir("", "gohost-golden")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "echo.json")
+	err = ioutil.WriteFile(file, []byte(`{
+  "request": {"method": "GET", "path": "/v1/echo?value=test"},
+  "response": {"status": 200, "header": {"Content-Type": "application/json"}, "body": {"value": "test"}}
+}`), 0644)
+	assert.NoError(t, err)
+
+	// act
+	recorder := &failureRecorder{TB: t}
+	server.Golden(recorder, file, gohosttest.GoldenRequest{
+		Method: "GET",
+		Path:   "/v1/echo?value=test",
+	})
+
+	// assert
+	assert.Len(t, recorder.failures, 1)
+	assert.Contains(t, recorder.failures[0], "does not match golden file")
+}
+
+// newGoldenHoster is a helper function that creates a hoster with the test service and its HTTP gateway, where Echo fails with NotFound for the value missing.
+func newGoldenHoster() *gohost.Hoster {
+	hoster := newGohostTestHoster()
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if send, ok := req.(*pb.SendRequest); ok && send.Value == "missing" {
+			return nil, status.Error(codes.NotFound, "value not found")
+		}
+		return handler(ctx, req)
+	})
+
+	return hoster
+}
+
+// failureRecorder is a testing.TB that records failures instead of failing the test.
+type failureRecorder struct {
+	testing.TB
+	failures []string
+}
+
+// Errorf records a failure.
+func (r *failureRecorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_GohostTest_Start(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+
+	// act
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// call the service at the gRPC and HTTP endpoints without waiting for them to start
+	grpcResp, grpcErr := pb.NewTestServiceClient(server.Conn).Echo(context.Background(), &pb.SendRequest{Value: "test"})
+	httpResp, httpErr := server.HTTPClient.Get(server.URL + "/v1/echo?value=test")
+
+	// assert
+	assert.NoError(t, grpcErr)
+	assert.Equal(t, "test", grpcResp.Echo)
+	assert.NoError(t, httpErr)
+	body, err := ioutil.ReadAll(httpResp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"test"}`, string(body))
+}
+
+func Test_GohostTest_Start_TLSAndInterceptors(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	received := make(chan []string, 2)
+
+	hoster := newGohostTestHoster()
+	hoster.CertFile = "../testdata/test.crt"
+	hoster.KeyFile = "../testdata/test.key"
+	hoster.InsecureSkipVerify = true
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received <- md.Get("x-client")
+		return handler(ctx, req)
+	})
+
+	server := gohosttest.NewServer(hoster)
+	server.DialOptions = []grpc.DialOption{
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, "x-client", "grpc"), method, req, reply, cc, opts...)
+		}),
+	}
+
+	// act
+	server.Start(t)
+	defer server.Stop()
+
+	// call the service at both endpoints over TLS, with a client interceptor on the gRPC connection
+	grpcResp, grpcErr := pb.NewTestServiceClient(server.Conn).Echo(context.Background(), &pb.SendRequest{Value: "test"})
+	httpReq, err := http.NewRequest(http.MethodGet, server.URL+"/v1/echo?value=test", nil)
+	assert.NoError(t, err)
+	httpReq.Header.Set("Grpc-Metadata-X-Client", "http")
+	httpResp, httpErr := server.HTTPClient.Do(httpReq)
+
+	// assert
+	assert.Equal(t, "https://"+gohosttest.Host, server.URL)
+	assert.NoError(t, grpcErr)
+	assert.Equal(t, "test", grpcResp.Echo)
+	assert.Equal(t, []string{"grpc"}, <-received)
+	assert.NoError(t, httpErr)
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.NotNil(t, httpResp.TLS)
+	assert.Equal(t, []string{"http"}, <-received)
+}
+
+func Test_GohostTest_Start_Parallel(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 5; i++ {
+		value := fmt.Sprint("value", i)
+		t.Run(value, func(t *testing.T) {
+			t.Parallel()
+
+			// arrange
+			server := gohosttest.Start(t, newGohostTestHoster())
+			defer server.Stop()
+
+			// act
+			resp, err := pb.NewTestServiceClient(server.Conn).Echo(context.Background(), &pb.SendRequest{Value: value})
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, value, resp.Echo)
+		})
+	}
+}
+
+// newGohostTestHoster is a helper function that creates a hoster with the test service and its HTTP gateway registered, without addresses of its own.
+func newGohostTestHoster() *gohost.Hoster {
+	service := test.NewService()
+
+	hoster := gohost.NewHoster()
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	return hoster
+}
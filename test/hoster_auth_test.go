@@ -0,0 +1,347 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Auth_APIKey(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	principals := make(chan *gohost.Principal, 1)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{
+			Keys: map[string]gohost.Principal{
+				"secret": {Subject: "client-1", Roles: []string{"admin"}},
+			},
+		},
+	}
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, _ := gohost.PrincipalFromContext(ctx)
+		principals <- p
+		return handler(ctx, req)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint without, with a bad and with a good API key
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errMissing := client.Echo(context.Background(), &grpcReq)
+	_, errInvalid := client.Echo(metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "wrong"), &grpcReq)
+	grpcResp, err := client.Echo(metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "secret"), &grpcReq)
+
+	// assert
+	assert.Equal(t, codes.Unauthenticated, status.Code(errMissing))
+	assert.Equal(t, codes.Unauthenticated, status.Code(errInvalid))
+	assert.NoError(t, err)
+	assert.Equal(t, "test", grpcResp.Echo)
+	p := <-principals
+	assert.Equal(t, "client-1", p.Subject)
+	assert.Equal(t, "apikey", p.Method)
+	assert.Equal(t, []string{"admin"}, p.Roles)
+}
+
+func Test_Hoster_ListenAndServe_Auth_UnauthenticatedMethods(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{},
+	}
+	hoster.UnauthenticatedMethods = []string{"/test.TestService/Echo", "/test.TestService/Str*"}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint without credentials
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errEcho := client.Echo(context.Background(), &grpcReq)
+	_, errSend := client.Send(context.Background(), &grpcReq)
+	stream, err := client.Stream(context.Background())
+	assert.NoError(t, err)
+	_, errStream := stream.CloseAndRecv()
+
+	// assert
+	assert.NoError(t, errEcho)
+	assert.Equal(t, codes.Unauthenticated, status.Code(errSend))
+	assert.NoError(t, errStream)
+}
+
+func Test_Hoster_ListenAndServe_Auth_JWT_HTTP(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwksFile := writeJWKS(t, "key-1", &key.PublicKey)
+	defer os.RemoveAll(filepath.Dir(jwksFile))
+
+	authenticator, err := gohost.NewJWTAuthenticator(jwksFile)
+	assert.NoError(t, err)
+	authenticator.Issuer = "test-issuer"
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.Authenticators = []gohost.Authenticator{authenticator}
+
+	validToken := signJWT(t, key, "key-1", map[string]interface{}{
+		"sub": "user-1",
+		"iss": "test-issuer",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	expiredToken := signJWT(t, key, "key-1", map[string]interface{}{
+		"sub": "user-1",
+		"iss": "test-issuer",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	wrongIssuerToken := signJWT(t, key, "key-1", map[string]interface{}{
+		"sub": "user-1",
+		"iss": "other-issuer",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with each token
+	statusCodes := []int{}
+	for _, token := range []string{"", validToken, expiredToken, wrongIssuerToken, validToken + "x"} {
+		httpClient := http.Client{
+			Timeout: httpClientTimeout,
+		}
+		httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+		assert.NoError(t, err)
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		doResp, err := httpClient.Do(httpReq)
+		assert.NoError(t, err)
+		statusCodes = append(statusCodes, doResp.StatusCode)
+	}
+
+	// assert
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusOK, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized}, statusCodes)
+}
+
+func Test_JWTAuthenticator_Authenticate_Claims(t *testing.T) {
+	// arrange
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwksFile := writeJWKS(t, "key-1", &key.PublicKey)
+	defer os.RemoveAll(filepath.Dir(jwksFile))
+
+	authenticator, err := gohost.NewJWTAuthenticator(jwksFile)
+	assert.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tokens := []map[string]interface{}{
+		{"sub": "user-1", "exp": exp},
+		{"sub": "user-1"},
+		{"sub": "user-1", "exp": "never"},
+		{"sub": "user-1", "exp": exp, "nbf": "now"},
+		{"sub": "user-1", "exp": exp, "iat": true},
+	}
+
+	// act
+	errs := []string{}
+	for _, claims := range tokens {
+		md := metadata.Pairs("authorization", "Bearer "+signJWT(t, key, "key-1", claims))
+		_, err := authenticator.Authenticate(context.Background(), md)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			errs = append(errs, "")
+		}
+	}
+
+	authenticator.AllowMissingExpiry = true
+	md := metadata.Pairs("authorization", "Bearer "+signJWT(t, key, "key-1", map[string]interface{}{"sub": "user-1"}))
+	p, errAllowed := authenticator.Authenticate(context.Background(), md)
+
+	// assert
+	assert.Equal(t, []string{
+		"",
+		"token has no exp claim",
+		"token exp claim is not a number",
+		"token nbf claim is not a number",
+		"token iat claim is not a number",
+	}, errs)
+	assert.NoError(t, errAllowed)
+	assert.Equal(t, "user-1", p.Subject)
+}
+
+func Test_JWTAuthenticator_Authenticate_Signature(t *testing.T) {
+	// arrange
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwksFile := writeJWKS(t, "key-1", &key.PublicKey)
+	defer os.RemoveAll(filepath.Dir(jwksFile))
+
+	authenticator, err := gohost.NewJWTAuthenticator(jwksFile)
+	assert.NoError(t, err)
+
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-1"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`)) + "."
+
+	// act
+	_, errOtherKey := authenticator.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer "+signJWT(t, otherKey, "key-1", claims)))
+	_, errUnknownKey := authenticator.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer "+signJWT(t, key, "key-2", claims)))
+	_, errNone := authenticator.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer "+none))
+	_, errMalformed := authenticator.Authenticate(context.Background(), metadata.Pairs("authorization", "Bearer not-a-token"))
+
+	// assert
+	assert.EqualError(t, errOtherKey, "invalid token signature")
+	assert.EqualError(t, errUnknownKey, `no key for token with kid "key-2" and alg "RS256"`)
+	assert.Error(t, errNone)
+	assert.Contains(t, errMalformed.Error(), "malformed token")
+}
+
+func Test_Hoster_ListenAndServe_Auth_MTLS(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.CertFile = "../testdata/test.crt"
+	hoster.KeyFile = "../testdata/test.key"
+	hoster.ClientCAFile = "../testdata/test.crt"
+	hoster.Authenticators = []gohost.Authenticator{gohost.MTLSAuthenticator{}}
+
+	subjects := make(chan string, 1)
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, _ := gohost.PrincipalFromContext(ctx)
+		subjects <- p.Subject
+		return handler(ctx, req)
+	})
+
+	clientCert, err := tls.LoadX509KeyPair("../testdata/test.crt", "../testdata/test.key")
+	assert.NoError(t, err)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint with and without a client certificate
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	anonConn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
+	assert.NoError(t, err)
+	_, errAnon := pb.NewTestServiceClient(anonConn).Echo(context.Background(), &grpcReq)
+
+	certConn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}})))
+	assert.NoError(t, err)
+	_, errCert := pb.NewTestServiceClient(certConn).Echo(context.Background(), &grpcReq)
+
+	// assert
+	assert.Equal(t, codes.Unauthenticated, status.Code(errAnon))
+	assert.NoError(t, errCert)
+	assert.Equal(t, "Test Common Name", <-subjects)
+}
+
+// writeJWKS is a helper function that writes a JWKS file containing an RSA public key to a temporary directory.
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+	data, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+
+	return writeTempFile(t, "jwks.json", string(data))
+}
+
+// signJWT is a helper function that creates an RS256 signed token.
+func signJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
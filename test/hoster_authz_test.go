@@ -0,0 +1,217 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+const testPolicies = `
+default: deny
+policies:
+  - method: /test.TestService/Echo
+  - method: /test.TestService/Send
+    roles: [admin]
+  - route: GET /v1/*
+    scopes: [read]
+`
+
+func Test_Hoster_ListenAndServe_Authz_GRPC(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	policyFile := writeTempFile(t, "policy.yaml", testPolicies)
+	defer os.RemoveAll(filepath.Dir(policyFile))
+	auditFile := filepath.Join(filepath.Dir(policyFile), "audit.log")
+
+	hoster := newTestHoster(grpcAddr, "", service, withAPIKeys)
+	hoster.PolicyFile = policyFile
+	hoster.AuditLogFile = auditFile
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint as an admin and as a user
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	adminCtx := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "admin-key")
+	userCtx := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "user-key", gohost.RequestIDHeader, "request-1")
+
+	_, errAdminSend := client.Send(adminCtx, &grpcReq)
+	_, errUserSend := client.Send(userCtx, &grpcReq)
+	_, errUserEcho := client.Echo(userCtx, &grpcReq)
+	stream, err := client.Stream(adminCtx)
+	assert.NoError(t, err)
+	_, errStream := stream.CloseAndRecv()
+
+	// assert
+	assert.NoError(t, errAdminSend)
+	assert.Equal(t, codes.PermissionDenied, status.Code(errUserSend))
+	assert.Contains(t, status.Convert(errUserSend).Message(), "[admin]")
+	assert.NoError(t, errUserEcho)
+	assert.Equal(t, codes.PermissionDenied, status.Code(errStream))
+
+	events := readAuditLog(t, auditFile)
+	assert.Len(t, events, 4)
+	assert.Equal(t, "/test.TestService/Send", events[1].Method)
+	assert.Equal(t, "user", events[1].Subject)
+	assert.Equal(t, "request-1", events[1].RequestID)
+	assert.False(t, events[1].Allowed)
+	assert.NotEmpty(t, events[1].Reason)
+	assert.True(t, events[2].Allowed)
+}
+
+func Test_Hoster_ListenAndServe_Authz_HTTPRoute(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	policyFile := writeTempFile(t, "policy.yaml", testPolicies)
+	defer os.RemoveAll(filepath.Dir(policyFile))
+
+	hoster := newTestHoster(grpcAddr, "", service, withAPIKeys)
+	hoster.PolicyFile = policyFile
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint as a user with and without the read scope
+	statusCodes := []int{}
+	for _, key := range []string{"reader-key", "user-key"} {
+		httpClient := http.Client{
+			Timeout: httpClientTimeout,
+		}
+		httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+		assert.NoError(t, err)
+		httpReq.Header.Set(gohost.APIKeyHeader, key)
+		httpReq.Header.Set("Grpc-Metadata-X-Gohost-Http-Route", "GET /other")
+		doResp, err := httpClient.Do(httpReq)
+		assert.NoError(t, err)
+		statusCodes = append(statusCodes, doResp.StatusCode)
+	}
+
+	// assert
+	assert.Equal(t, []int{http.StatusOK, http.StatusForbidden}, statusCodes)
+}
+
+func Test_Hoster_Reload_Policies(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	policyFile := writeTempFile(t, "policy.yaml", testPolicies)
+	defer os.RemoveAll(filepath.Dir(policyFile))
+	configFile := filepath.Join(filepath.Dir(policyFile), "config.yaml")
+	err := ioutil.WriteFile(configFile, []byte(fmt.Sprintf("policy_file: %v\n", policyFile)), 0600)
+	assert.NoError(t, err)
+
+	hoster := newTestHoster(grpcAddr, "", service, withAPIKeys)
+	err = hoster.LoadConfig(configFile, "", nil)
+	assert.NoError(t, err)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint before and after changing the policies
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	userCtx := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "user-key")
+	_, errBefore := client.Send(userCtx, &grpcReq)
+
+	err = ioutil.WriteFile(policyFile, []byte("default: allow\n"), 0600)
+	assert.NoError(t, err)
+	restart, err := hoster.Reload()
+	assert.NoError(t, err)
+
+	_, errAfter := client.Send(userCtx, &grpcReq)
+
+	// assert
+	assert.Empty(t, restart)
+	assert.Equal(t, codes.PermissionDenied, status.Code(errBefore))
+	assert.NoError(t, errAfter)
+}
+
+func Test_Hoster_Validate_PolicyFile(t *testing.T) {
+	// arrange
+	policyFile := writeTempFile(t, "policy.yaml", "default: maybe\npolicies:\n  - roles: [admin]\n")
+	defer os.RemoveAll(filepath.Dir(policyFile))
+
+	hoster := gohost.NewHoster()
+	hoster.PolicyFile = policyFile
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "default must be allow or deny")
+}
+
+// withAPIKeys is a helper function that configures a hoster with API keys for an admin, a user and a user with the read scope.
+func withAPIKeys(hoster *gohost.Hoster) {
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{
+			Keys: map[string]gohost.Principal{
+				"admin-key":  {Subject: "admin", Roles: []string{"admin"}},
+				"user-key":   {Subject: "user", Roles: []string{"user"}},
+				"reader-key": {Subject: "reader", Roles: []string{"user"}, Scopes: []string{"read"}},
+			},
+		},
+	}
+}
+
+// readAuditLog is a helper function that reads the events in an audit log file.
+func readAuditLog(t *testing.T, file string) []gohost.AuditEvent {
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	events := []gohost.AuditEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := gohost.AuditEvent{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	assert.NoError(t, scanner.Err())
+
+	return events
+}
@@ -0,0 +1,220 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Compression_HTTPResponse(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withCompression)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with large and small responses
+	largeResp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/large?length=10000", httpAddr), "gzip, deflate")
+	smallResp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), "gzip")
+	plainResp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/large?length=10000", httpAddr), "")
+	refusedResp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/large?length=10000", httpAddr), "gzip;q=0")
+
+	// assert
+	assert.Equal(t, http.StatusOK, largeResp.StatusCode)
+	assert.Equal(t, "gzip", largeResp.Header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(largeResp.Body)
+	assert.NoError(t, err)
+	var largeBody pb.EchoResponse
+	err = json.NewDecoder(reader).Decode(&largeBody)
+	assert.NoError(t, err)
+	assert.Len(t, largeBody.Echo, 10000)
+
+	assert.Equal(t, http.StatusOK, smallResp.StatusCode)
+	assert.Empty(t, smallResp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", smallResp.Header.Get("Vary"))
+	assert.Empty(t, plainResp.Header.Get("Content-Encoding"))
+	assert.Empty(t, refusedResp.Header.Get("Content-Encoding"))
+}
+
+func Test_Hoster_ListenAndServe_Compression_ContentTypes(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withCompression)
+	hoster.CompressionContentTypes = []string{"text/plain"}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a large JSON response
+	resp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/large?length=10000", httpAddr), "gzip")
+
+	// assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+}
+
+func Test_Hoster_ListenAndServe_Compression_HTTPRequest(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withCompression)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a gzip and an unsupported request body
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(`{"value":"test"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	gzipReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/v1/send", httpAddr), bytes.NewReader(compressed.Bytes()))
+	assert.NoError(t, err)
+	gzipReq.Header.Set("Content-Encoding", "gzip")
+	gzipResp, err := httpClient.Do(gzipReq)
+	assert.NoError(t, err)
+
+	brReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/v1/send", httpAddr), strings.NewReader(`{"value":"test"}`))
+	assert.NoError(t, err)
+	brReq.Header.Set("Content-Encoding", "br")
+	brResp, err := httpClient.Do(brReq)
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, gzipResp.StatusCode)
+	body, err := ioutil.ReadAll(gzipResp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"success":true`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, brResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_Compression_RecoverPanic(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withCompression)
+	hoster.HTTPHandler = func(mux *runtime.ServeMux) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test panic")
+		})
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the panicking handler accepting a compressed response
+	resp := getWithEncoding(t, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), "gzip")
+
+	// assert
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_Compression_GRPC(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.EnableCompression = true
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint with gzip compression
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcResp, err := client.Large(context.Background(), &pb.LargeRequest{Length: 10000}, grpc.UseCompressor("gzip"))
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, grpcResp.Echo, 10000)
+}
+
+func Test_Hoster_Validate_Compression(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.CompressionLevel = 10
+	hoster.CompressionMinSize = -1
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+// withCompression is a helper function that configures a hoster with the HTTP gateway and compression enabled.
+func withCompression(hoster *gohost.Hoster) {
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.EnableCompression = true
+}
+
+// getWithEncoding is a helper function that makes a GET request with an Accept-Encoding header and returns the raw response.
+func getWithEncoding(t *testing.T, url string, acceptEncoding string) *http.Response {
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+		Transport: &http.Transport{
+			DisableCompression: true,
+		},
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	if acceptEncoding != "" {
+		httpReq.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := httpClient.Do(httpReq)
+	assert.NoError(t, err)
+
+	return resp
+}
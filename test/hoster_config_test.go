@@ -0,0 +1,198 @@
+package test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eleniums/gohost"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_LoadConfigFile_YAML(t *testing.T) {
+	assertLoadConfigFile(t, "../testdata/config.yaml")
+}
+
+func Test_Hoster_LoadConfigFile_JSON(t *testing.T) {
+	assertLoadConfigFile(t, "../testdata/config.json")
+}
+
+func Test_Hoster_LoadConfigFile_TOML(t *testing.T) {
+	assertLoadConfigFile(t, "../testdata/config.toml")
+}
+
+func Test_Hoster_LoadConfigFile_UnknownKey(t *testing.T) {
+	// arrange
+	file := writeTempFile(t, "config.yaml", "grpc_adr: 127.0.0.1:50052\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadConfigFile(file)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_LoadConfigFile_UnsupportedExtension(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadConfigFile("../testdata/test.crt")
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_LoadEnv(t *testing.T) {
+	// arrange
+	os.Setenv("GOHOSTTEST_GRPC_ADDR", "127.0.0.1:50053")
+	os.Setenv("GOHOSTTEST_ENABLE_DEBUG", "true")
+	os.Setenv("GOHOSTTEST_MAX_SEND_MSG_SIZE", "2048")
+	defer os.Unsetenv("GOHOSTTEST_GRPC_ADDR")
+	defer os.Unsetenv("GOHOSTTEST_ENABLE_DEBUG")
+	defer os.Unsetenv("GOHOSTTEST_MAX_SEND_MSG_SIZE")
+
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadEnv("GOHOSTTEST_")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:50053", hoster.GRPCAddr)
+	assert.Equal(t, gohost.DefaultHTTPAddr, hoster.HTTPAddr)
+	assert.True(t, hoster.EnableDebug)
+	assert.Equal(t, 2048, hoster.MaxSendMsgSize)
+}
+
+func Test_Hoster_LoadConfigFile_RateLimits(t *testing.T) {
+	// arrange
+	yamlFile := writeTempFile(t, "config.yaml", "rate_limits:\n  - route: POST /v1/send\n    key: apikey\n    rate: 5\n    burst: 10\n")
+	defer os.RemoveAll(filepath.Dir(yamlFile))
+	tomlFile := writeTempFile(t, "config.toml", "[[rate_limits]]\nroute = \"POST /v1/send\"\nkey = \"apikey\"\nrate = 5.0\nburst = 10\n")
+	defer os.RemoveAll(filepath.Dir(tomlFile))
+	unknownFile := writeTempFile(t, "config.yaml", "rate_limits:\n  - path: /v1/send\n")
+	defer os.RemoveAll(filepath.Dir(unknownFile))
+
+	yamlHoster := gohost.NewHoster()
+	tomlHoster := gohost.NewHoster()
+
+	// act
+	yamlErr := yamlHoster.LoadConfigFile(yamlFile)
+	tomlErr := tomlHoster.LoadConfigFile(tomlFile)
+	unknownErr := gohost.NewHoster().LoadConfigFile(unknownFile)
+
+	// assert
+	expected := []gohost.RateLimit{{Route: "POST /v1/send", Key: gohost.RateLimitByAPIKey, Rate: 5, Burst: 10}}
+	assert.NoError(t, yamlErr)
+	assert.Equal(t, expected, yamlHoster.RateLimits)
+	assert.NoError(t, tomlErr)
+	assert.Equal(t, expected, tomlHoster.RateLimits)
+	assert.Error(t, unknownErr)
+}
+
+func Test_Hoster_LoadEnv_RateLimits(t *testing.T) {
+	// arrange
+	os.Setenv("GOHOSTTEST_RATE_LIMITS", `[{"method":"/test.TestService/Echo","rate":2}]`)
+	defer os.Unsetenv("GOHOSTTEST_RATE_LIMITS")
+
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadEnv("GOHOSTTEST_")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []gohost.RateLimit{{Method: "/test.TestService/Echo", Rate: 2}}, hoster.RateLimits)
+}
+
+func Test_Hoster_LoadEnv_InvalidValue(t *testing.T) {
+	// arrange
+	os.Setenv("GOHOSTTEST_MAX_SEND_MSG_SIZE", "big")
+	defer os.Unsetenv("GOHOSTTEST_MAX_SEND_MSG_SIZE")
+
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadEnv("GOHOSTTEST_")
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_BindFlags(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	hoster.BindFlags(fs)
+
+	// act
+	err := fs.Parse([]string{"-grpc-addr", "127.0.0.1:50054", "-enable-debug", "-max-recv-msg-size", "512"})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:50054", hoster.GRPCAddr)
+	assert.True(t, hoster.EnableDebug)
+	assert.Equal(t, 512, hoster.MaxRecvMsgSize)
+	assert.Equal(t, gohost.DefaultHTTPAddr, fs.Lookup("http-addr").DefValue)
+}
+
+func Test_Hoster_LoadConfig_Precedence(t *testing.T) {
+	// arrange
+	os.Setenv("GOHOSTTEST_HTTP_ADDR", "127.0.0.1:9093")
+	os.Setenv("GOHOSTTEST_MAX_RECV_MSG_SIZE", "4096")
+	defer os.Unsetenv("GOHOSTTEST_HTTP_ADDR")
+	defer os.Unsetenv("GOHOSTTEST_MAX_RECV_MSG_SIZE")
+
+	hoster := gohost.NewHoster()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	hoster.BindFlags(fs)
+	err := fs.Parse([]string{"-max-recv-msg-size", "8192"})
+	assert.NoError(t, err)
+
+	// act
+	err = hoster.LoadConfig("../testdata/config.yaml", "GOHOSTTEST_", fs)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:50052", hoster.GRPCAddr)
+	assert.Equal(t, "127.0.0.1:9093", hoster.HTTPAddr)
+	assert.Equal(t, gohost.DefaultDebugAddr, hoster.DebugAddr)
+	assert.Equal(t, 8192, hoster.MaxRecvMsgSize)
+}
+
+// assertLoadConfigFile is a helper function that loads a config file containing the same settings in any format and verifies the result.
+func assertLoadConfigFile(t *testing.T, file string) {
+	// arrange
+	hoster := gohost.NewHoster()
+
+	// act
+	err := hoster.LoadConfigFile(file)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:50052", hoster.GRPCAddr)
+	assert.Equal(t, "127.0.0.1:9092", hoster.HTTPAddr)
+	assert.Equal(t, gohost.DefaultDebugAddr, hoster.DebugAddr)
+	assert.True(t, hoster.EnableDebug)
+	assert.Equal(t, 1024, hoster.MaxRecvMsgSize)
+	assert.Equal(t, gohost.DefaultMaxSendMsgSize, hoster.MaxSendMsgSize)
+}
+
+// writeTempFile is a helper function that writes contents to a new file in a temporary directory.
+func writeTempFile(t *testing.T, name string, contents string) string {
+	dir, err := ioutil.TempDir("", "gohost")
+	assert.NoError(t, err)
+
+	file := filepath.Join(dir, name)
+	err = ioutil.WriteFile(file, []byte(contents), 0600)
+	assert.NoError(t, err)
+
+	return file
+}
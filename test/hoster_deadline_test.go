@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Deadline_DefaultAndMax(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	remaining := make(chan time.Duration, 3)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.DefaultDeadline = time.Second * 5
+	hoster.MaxDeadline = time.Second * 10
+	hoster.MethodDeadlines = []gohost.MethodDeadline{
+		{Method: "/test.TestService/Send", Max: time.Second * 2},
+	}
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		if ok {
+			remaining <- time.Until(deadline)
+		} else {
+			remaining <- 0
+		}
+		return handler(ctx, req)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint without a deadline and with a long deadline
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	longCtx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	_, errDefault := client.Echo(context.Background(), &grpcReq)
+	_, errMax := client.Echo(longCtx, &grpcReq)
+	_, errMethodMax := client.Send(longCtx, &grpcReq)
+
+	// assert
+	assert.NoError(t, errDefault)
+	assert.NoError(t, errMax)
+	assert.NoError(t, errMethodMax)
+	assert.InDelta(t, time.Second*5, <-remaining, float64(time.Second))
+	assert.InDelta(t, time.Second*10, <-remaining, float64(time.Second))
+	assert.InDelta(t, time.Second*2, <-remaining, float64(time.Second))
+}
+
+func Test_Hoster_ListenAndServe_Deadline_Exceeded(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	exceededBefore := metricValue("deadline_exceeded")
+
+	hoster := newTestHoster(grpcAddr, "", service, withWaiting)
+	hoster.DefaultDeadline = time.Millisecond * 50
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint without a deadline
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	_, err = client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, exceededBefore+1, metricValue("deadline_exceeded"))
+}
+
+func Test_Hoster_ListenAndServe_Deadline_HTTPRequestTimeout(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, "", service, withWaiting)
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a valid and an invalid timeout
+	statusCodes := []int{}
+	for _, timeout := range []string{"50ms", "0.05", "soon"} {
+		httpClient := http.Client{
+			Timeout: httpClientTimeout,
+		}
+		httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+		assert.NoError(t, err)
+		httpReq.Header.Set(gohost.RequestTimeoutHeader, timeout)
+		start := time.Now()
+		doResp, err := httpClient.Do(httpReq)
+		assert.NoError(t, err)
+		assert.True(t, time.Since(start) < time.Second)
+		statusCodes = append(statusCodes, doResp.StatusCode)
+	}
+
+	// assert
+	assert.Equal(t, []int{http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusBadRequest}, statusCodes)
+}
+
+func Test_Hoster_Validate_Deadlines(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.DefaultDeadline = time.Minute
+	hoster.MaxDeadline = time.Second
+	hoster.MethodDeadlines = []gohost.MethodDeadline{
+		{Method: "test.TestService/Echo"},
+		{Method: "/test.TestService/Send", Default: time.Minute, Max: time.Second},
+		{Method: "/test.TestService/Large", Default: -time.Second},
+	}
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 4)
+}
+
+// withWaiting is a helper function that configures a hoster to wait for the deadline of every call.
+func withWaiting(hoster *gohost.Hoster) {
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	})
+}
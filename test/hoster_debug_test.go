@@ -1,6 +1,7 @@
 package test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/gohosttest"
 
 	assert "github.com/stretchr/testify/require"
 )
@@ -110,3 +112,40 @@ func Test_Hoster_ListenAndServe_Debug_EmptyAddress(t *testing.T) {
 	// assert
 	assert.Error(t, err)
 }
+
+func Test_Hoster_ListenAndServe_Debug_Routes(t *testing.T) {
+	// arrange
+	debugAddr := getAddr(t)
+
+	hoster := newGohostTestHoster()
+	hoster.EnableDebug = true
+	hoster.DebugAddr = debugAddr
+	hoster.EnableHealth = true
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// make sure the debug endpoint has time to start
+	time.Sleep(serviceStartDelay)
+
+	// act
+	resp := debugRequest(t, debugAddr, http.MethodGet, "/debug/routes", "")
+	var routes gohost.Routes
+	err := json.Unmarshal([]byte(resp.body), &routes)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	assert.Contains(t, routes.Methods, gohost.MethodRoute{Name: "/grpc.health.v1.Health/Check"})
+	assert.Contains(t, routes.Methods, gohost.MethodRoute{Name: "/test.TestService/Echo"})
+	assert.Contains(t, routes.Methods, gohost.MethodRoute{Name: "/test.TestService/Repeat", ServerStreams: true})
+	assert.Contains(t, routes.Methods, gohost.MethodRoute{Name: "/test.TestService/Stream", ClientStreams: true})
+
+	assert.Equal(t, []gohost.HTTPRoute{
+		{HTTPMethod: "GET", Path: "/v1/echo", GRPCMethod: "/test.TestService/Echo"},
+		{HTTPMethod: "GET", Path: "/v1/large", GRPCMethod: "/test.TestService/Large"},
+		{HTTPMethod: "GET", Path: "/v1/repeat", GRPCMethod: "/test.TestService/Repeat"},
+		{HTTPMethod: "POST", Path: "/v1/send", GRPCMethod: "/test.TestService/Send"},
+	}, routes.HTTPRoutes)
+}
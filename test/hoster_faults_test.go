@@ -0,0 +1,259 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Faults_GRPC(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.EnableFaults = true
+	hoster.Faults = []gohost.Fault{
+		{Method: "/test.TestService/Echo", ErrorPercent: 100, Code: codes.NotFound, Message: "gone"},
+		{Method: "/test.TestService/Repeat", AbortPercent: 100, AbortAfter: 1},
+		{Method: "/test.TestService/Send", DelayPercent: 100, Delay: time.Millisecond * 100, DelayJitter: time.Millisecond * 10},
+	}
+
+	// act
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// call a method that fails, a stream that is aborted after one message and a method that is delayed
+	_, echoErr := client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+
+	stream, err := client.Repeat(context.Background(), &pb.RepeatRequest{Value: "test", Count: 3})
+	assert.NoError(t, err)
+	var received int
+	var streamErr error
+	for {
+		_, err := stream.Recv()
+		if err != nil {
+			streamErr = err
+			break
+		}
+		received++
+	}
+
+	start := time.Now()
+	_, sendErr := client.Send(context.Background(), &pb.SendRequest{Value: "test"})
+	elapsed := time.Since(start)
+
+	// assert
+	assert.Equal(t, codes.NotFound, status.Code(echoErr))
+	assert.Equal(t, "gone", status.Convert(echoErr).Message())
+	assert.Equal(t, 1, received)
+	assert.Equal(t, codes.Unavailable, status.Code(streamErr))
+	assert.NoError(t, sendErr)
+	assert.True(t, elapsed >= time.Millisecond*100)
+}
+
+func Test_Hoster_ListenAndServe_Faults_HTTP(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.EnableFaults = true
+	hoster.Faults = []gohost.Fault{
+		{Route: "GET /v1/echo", ErrorPercent: 100, Code: codes.ResourceExhausted},
+		{Route: "GET /v1/repeat", TruncatePercent: 100, TruncateAfter: 10},
+	}
+
+	// act
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// call a route that fails, and a route whose response is cut off
+	errorResp, err := server.HTTPClient.Get(server.URL + "/v1/echo?value=test")
+	assert.NoError(t, err)
+	errorBody, err := ioutil.ReadAll(errorResp.Body)
+	assert.NoError(t, err)
+
+	truncatedResp, err := server.HTTPClient.Get(server.URL + "/v1/repeat?value=test&count=3")
+	assert.NoError(t, err)
+	truncatedBody, truncatedErr := ioutil.ReadAll(truncatedResp.Body)
+
+	// assert
+	assert.Equal(t, http.StatusTooManyRequests, errorResp.StatusCode)
+	assert.JSONEq(t, fmt.Sprintf(`{"error":"injected fault","code":%v}`, int(codes.ResourceExhausted)), string(errorBody))
+	assert.Equal(t, http.StatusOK, truncatedResp.StatusCode)
+	assert.Equal(t, io.ErrUnexpectedEOF, truncatedErr)
+	assert.Len(t, truncatedBody, 10)
+}
+
+func Test_Hoster_ListenAndServe_Faults_Disabled(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.Faults = []gohost.Fault{
+		{Method: "/test.TestService/Echo", ErrorPercent: 100},
+	}
+
+	// act
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	resp, err := pb.NewTestServiceClient(server.Conn).Echo(context.Background(), &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "test", resp.Echo)
+}
+
+func Test_Hoster_ListenAndServe_Faults_DebugEndpoint(t *testing.T) {
+	// arrange
+	debugAddr := getAddr(t)
+
+	logs := &logBuffer{}
+	hoster := newGohostTestHoster()
+	hoster.EnableDebug = true
+	hoster.DebugAddr = debugAddr
+	hoster.Logger = log.New(logs, "", 0)
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// make sure the debug endpoint has time to start
+	time.Sleep(serviceStartDelay)
+
+	// act - enable a fault, read the settings back, then disable fault injection
+	enableResp := debugRequest(t, debugAddr, http.MethodPut, "/debug/faults", `{"enabled":true,"faults":[{"method":"/test.TestService/Echo","error_percent":100,"code":"PERMISSION_DENIED","delay_percent":100,"delay":"1ms"}]}`)
+	_, enabledErr := client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+
+	getResp := debugRequest(t, debugAddr, http.MethodGet, "/debug/faults", "")
+
+	invalidResp := debugRequest(t, debugAddr, http.MethodPut, "/debug/faults", `{"enabled":true,"faults":[{"error_percent":200}]}`)
+
+	disableResp := debugRequest(t, debugAddr, http.MethodDelete, "/debug/faults", "")
+	_, disabledErr := client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.Equal(t, http.StatusOK, enableResp.StatusCode)
+	assert.Equal(t, codes.PermissionDenied, status.Code(enabledErr))
+
+	assert.Equal(t, http.StatusOK, getResp.StatusCode)
+	assert.JSONEq(t, `{"enabled":true,"faults":[{"method":"/test.TestService/Echo","error_percent":100,"code":"PermissionDenied","delay_percent":100,"delay":"1ms"}]}`, getResp.body)
+
+	assert.Equal(t, http.StatusBadRequest, invalidResp.StatusCode)
+
+	assert.Equal(t, http.StatusOK, disableResp.StatusCode)
+	assert.Contains(t, disableResp.body, `"enabled":false`)
+	assert.NoError(t, disabledErr)
+
+	assert.Equal(t, "Fault injection set by debug endpoint (enabled: true, faults: 1)\nFault injection disabled by debug endpoint\n", logs.String())
+}
+
+func Test_Hoster_ListenAndServe_Faults_WebSocket(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+	hoster.EnableFaults = true
+	hoster.Faults = []gohost.Fault{
+		{Route: "GET /ws/test.TestService/Echo", TruncatePercent: 100, TruncateAfter: 1},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a unary method over a WebSocket connection on a route that truncates responses, which does not apply to the upgraded connection
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Echo", "", nil)
+	err := websocket.Message.Send(ws, `{"value":"test"}`)
+	assert.NoError(t, err)
+	var resp string
+	err = websocket.Message.Receive(ws, &resp)
+	assert.NoError(t, err)
+	code, _ := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.JSONEq(t, `{"echo":"test"}`, resp)
+	assert.Equal(t, 1000, code)
+}
+
+func Test_Hoster_Validate_Faults(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.Faults = []gohost.Fault{
+		{Method: "/test.TestService/Echo", ErrorPercent: 101},
+		{Method: "/test.TestService/Echo", Route: "GET /v1/echo"},
+		{Route: "GET /v1/echo", AbortPercent: 50, DelayDistribution: "normal"},
+	}
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 4)
+}
+
+// debugResponse is a response from the debug endpoint with its body read.
+type debugResponse struct {
+	*http.Response
+	body string
+}
+
+// debugRequest is a helper function that sends a request to a route of the debug endpoint.
+func debugRequest(t *testing.T, debugAddr string, method string, path string, body string) debugResponse {
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	req, err := http.NewRequest(method, "http://"+debugAddr+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return debugResponse{Response: resp, body: string(b)}
+}
+
+// logBuffer is a helper that collects the output of a logger used by the hoster's goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write appends to the buffer.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// String returns everything written so far.
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
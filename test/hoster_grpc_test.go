@@ -8,12 +8,17 @@ import (
 
 	"github.com/eleniums/gohost"
 	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/eleniums/gohost/examples/test/proto"
 	assert "github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
 func Test_Hoster_ListenAndServe_GRPC_Successful(t *testing.T) {
@@ -417,3 +422,158 @@ func Test_Hoster_ListenAndServe_GRPC_StreamInterceptor(t *testing.T) {
 	assert.NotNil(t, testResp)
 	assert.True(t, testResp.Success)
 }
+
+func Test_Hoster_ListenAndServe_GRPC_ConnectionOptions(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	expectedValue := "test"
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	hoster.KeepaliveTime = time.Minute
+	hoster.KeepaliveTimeout = time.Second * 10
+	hoster.KeepaliveMinTime = time.Second * 30
+	hoster.KeepalivePermitWithoutStream = true
+	hoster.MaxConnectionIdle = time.Minute * 5
+	hoster.MaxConnectionAge = time.Hour
+	hoster.MaxConnectionAgeGrace = time.Second * 30
+	hoster.MaxConcurrentStreams = 10
+	hoster.InitialWindowSize = 1024 * 1024
+	hoster.InitialConnWindowSize = 1024 * 1024
+	hoster.ConnectionTimeout = time.Second * 5
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: expectedValue,
+	}
+	grpcResp, err := client.Echo(context.Background(), &grpcReq)
+
+	// assert
+	assert.NoError(t, err)
+	assert.NotNil(t, grpcResp)
+	assert.Equal(t, expectedValue, grpcResp.Echo)
+}
+
+func Test_Hoster_ListenAndServe_GRPC_MaxConnectionAge(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	hoster.MaxConnectionAge = time.Millisecond * 100
+	hoster.MaxConnectionAgeGrace = time.Millisecond * 100
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// open a stream and hold it past the max connection age
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	stream, err := client.Stream(context.Background())
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 500)
+	_, err = stream.CloseAndRecv()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_ListenAndServe_GRPC_Health(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.EnableHealth = true
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := healthpb.NewHealthClient(server.Conn)
+
+	// act
+	serverResp, serverErr := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	serviceResp, serviceErr := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test.TestService"})
+	_, unknownErr := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test.UnknownService"})
+
+	// assert
+	assert.NoError(t, serverErr)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, serverResp.Status)
+	assert.NoError(t, serviceErr)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, serviceResp.Status)
+	assert.Equal(t, codes.NotFound, status.Code(unknownErr))
+}
+
+func Test_Hoster_ListenAndServe_GRPC_Health_RegisteredNames(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.EnableHealth = true
+	hoster.RegisterHealthService("test.Backend")
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := healthpb.NewHealthClient(server.Conn)
+
+	// act
+	nameResp, nameErr := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test.Backend"})
+	serviceResp, serviceErr := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test.TestService"})
+
+	// assert
+	assert.NoError(t, nameErr)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, nameResp.Status)
+	assert.NoError(t, serviceErr)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, serviceResp.Status)
+}
+
+func Test_Hoster_ListenAndServe_GRPC_Reflection(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.EnableReflection = true
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	stream, err := rpb.NewServerReflectionClient(server.Conn).ServerReflectionInfo(context.Background())
+	assert.NoError(t, err)
+
+	// act
+	err = stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+
+	// assert
+	assert.NoError(t, err)
+	services := []string{}
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		services = append(services, service.Name)
+	}
+	assert.Contains(t, services, "test.TestService")
+	assert.Contains(t, services, "grpc.reflection.v1alpha.ServerReflection")
+}
@@ -0,0 +1,278 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_GRPCWeb_Unary(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withGRPCWeb)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a unary method with gRPC-Web, and the same method through the HTTP gateway
+	resp, msgs, trailers := grpcWebCall(t, httpAddr, "/test.TestService/Echo", false, nil, &pb.SendRequest{Value: "test"})
+	gatewayResp, err := http.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+	assert.Len(t, msgs, 1)
+	var echo pb.EchoResponse
+	assert.NoError(t, proto.Unmarshal(msgs[0], &echo))
+	assert.Equal(t, "test", echo.Echo)
+	assert.Equal(t, "0", trailers["grpc-status"])
+
+	assert.Equal(t, http.StatusOK, gatewayResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_GRPCWeb_TextStream(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withGRPCWeb)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a server-streaming method with gRPC-Web text
+	resp, msgs, trailers := grpcWebCall(t, httpAddr, "/test.TestService/Repeat", true, nil, &pb.RepeatRequest{Value: "test", Count: 3})
+
+	// assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc-web-text+proto", resp.Header.Get("Content-Type"))
+	assert.Len(t, msgs, 3)
+	for _, msg := range msgs {
+		var echo pb.EchoResponse
+		assert.NoError(t, proto.Unmarshal(msg, &echo))
+		assert.Equal(t, "test", echo.Echo)
+	}
+	assert.Equal(t, "0", trailers["grpc-status"])
+}
+
+func Test_Hoster_ListenAndServe_GRPCWeb_StatusAndMetadata(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	received := make(chan metadata.MD, 1)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withGRPCWeb)
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received <- md
+		grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", "done"))
+		return nil, status.Error(codes.PermissionDenied, "not allowed: 100%")
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a method that fails, with metadata sent as plain headers
+	header := http.Header{}
+	header.Set("x-custom", "value")
+	header.Set("x-data-bin", base64.StdEncoding.EncodeToString([]byte{1, 2, 3}))
+	header.Set(gohost.RequestIDHeader, "abc123")
+	header.Set("x-gohost-gateway-token", "forged")
+	resp, msgs, trailers := grpcWebCall(t, httpAddr, "/test.TestService/Echo", false, header, &pb.SendRequest{Value: "test"})
+
+	// assert
+	md := <-received
+	assert.Equal(t, []string{"value"}, md.Get("x-custom"))
+	assert.Equal(t, []string{"\x01\x02\x03"}, md.Get("x-data-bin"))
+	assert.Equal(t, []string{"abc123"}, md.Get(gohost.RequestIDHeader))
+	assert.NotContains(t, md.Get("x-gohost-gateway-token"), "forged")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, msgs)
+	assert.Equal(t, fmt.Sprint(int(codes.PermissionDenied)), trailers["grpc-status"])
+	assert.Equal(t, "not allowed: 100%25", trailers["grpc-message"])
+	assert.Equal(t, "done", trailers["x-trailer"])
+}
+
+func Test_Hoster_ListenAndServe_GRPCWeb_CORS(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withGRPCWeb)
+	hoster.GRPCWebOrigins = []string{"https://allowed.example.com"}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// send preflight requests from origins that are and are not allowed, then call the method from both
+	allowedPreflight := grpcWebPreflight(t, httpAddr, "https://allowed.example.com")
+	deniedPreflight := grpcWebPreflight(t, httpAddr, "https://evil.example.com")
+
+	header := http.Header{}
+	header.Set("Origin", "https://allowed.example.com")
+	allowedResp, _, trailers := grpcWebCall(t, httpAddr, "/test.TestService/Echo", false, header, &pb.SendRequest{Value: "test"})
+
+	header.Set("Origin", "https://evil.example.com")
+	deniedResp, _, _ := grpcWebCall(t, httpAddr, "/test.TestService/Echo", false, header, &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.Equal(t, http.StatusNoContent, allowedPreflight.StatusCode)
+	assert.Equal(t, "https://allowed.example.com", allowedPreflight.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.MethodPost, allowedPreflight.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type,x-grpc-web", allowedPreflight.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, http.StatusForbidden, deniedPreflight.StatusCode)
+
+	assert.Equal(t, http.StatusOK, allowedResp.StatusCode)
+	assert.Equal(t, "https://allowed.example.com", allowedResp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, allowedResp.Header.Get("Access-Control-Expose-Headers"), "grpc-status")
+	assert.Equal(t, "0", trailers["grpc-status"])
+	assert.Equal(t, http.StatusForbidden, deniedResp.StatusCode)
+}
+
+func Test_Hoster_Validate_GRPCWeb(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableGRPCWeb = true
+	hoster.HTTPAddr = ""
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+// withGRPCWeb is a helper function that configures a hoster with the HTTP gateway and gRPC-Web enabled.
+func withGRPCWeb(hoster *gohost.Hoster) {
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.EnableGRPCWeb = true
+}
+
+// grpcWebCall is a helper function that calls a method with gRPC-Web and returns the response, the messages received and the trailers.
+func grpcWebCall(t *testing.T, httpAddr string, method string, text bool, header http.Header, msgs ...proto.Message) (*http.Response, [][]byte, map[string]string) {
+	var body bytes.Buffer
+	for _, msg := range msgs {
+		b, err := proto.Marshal(msg)
+		assert.NoError(t, err)
+		body.Write(grpcWebFrame(0, b))
+	}
+
+	contentType := "application/grpc-web+proto"
+	reqBody := body.Bytes()
+	if text {
+		contentType = "application/grpc-web-text"
+		reqBody = []byte(base64.StdEncoding.EncodeToString(reqBody))
+	}
+
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v%v", httpAddr, method), bytes.NewReader(reqBody))
+	assert.NoError(t, err)
+	for k, v := range header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("X-Grpc-Web", "1")
+	resp, err := httpClient.Do(httpReq)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil, nil
+	}
+
+	if text {
+		var decoded []byte
+		for i := 0; i+4 <= len(data); i += 4 {
+			b, err := base64.StdEncoding.DecodeString(string(data[i : i+4]))
+			assert.NoError(t, err)
+			decoded = append(decoded, b...)
+		}
+		data = decoded
+	}
+
+	var received [][]byte
+	trailers := map[string]string{}
+	for len(data) >= 5 {
+		flag := data[0]
+		length := binary.BigEndian.Uint32(data[1:5])
+		payload := data[5 : 5+length]
+		data = data[5+length:]
+		if flag&0x80 == 0 {
+			received = append(received, payload)
+			continue
+		}
+		for _, line := range strings.Split(string(payload), "\r\n") {
+			if i := strings.Index(line, ":"); i > 0 {
+				trailers[line[:i]] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+
+	return resp, received, trailers
+}
+
+// grpcWebFrame is a helper function that returns a gRPC-Web frame.
+func grpcWebFrame(flag byte, payload []byte) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// grpcWebPreflight is a helper function that sends a CORS preflight request for the Echo method from an origin.
+func grpcWebPreflight(t *testing.T, httpAddr string, origin string) *http.Response {
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	httpReq, err := http.NewRequest(http.MethodOptions, fmt.Sprintf("http://%v/test.TestService/Echo", httpAddr), nil)
+	assert.NoError(t, err)
+	httpReq.Header.Set("Origin", origin)
+	httpReq.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	httpReq.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+	resp, err := httpClient.Do(httpReq)
+	assert.NoError(t, err)
+
+	return resp
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net"
 	"net/http"
 	"testing"
 	"time"
@@ -361,3 +362,111 @@ func Test_Hoster_ListenAndServe_HTTP_MaxSendMsgSize_Fail(t *testing.T) {
 	assert.NotNil(t, httpResp)
 	assert.Empty(t, httpResp.Echo)
 }
+
+func Test_Hoster_ListenAndServe_HTTP_MaxRequestBodySize(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	hoster.MaxRequestBodySize = 16
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a small and a large body
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	smallResp, err := httpClient.Post(fmt.Sprintf("http://%v/v1/send", httpAddr), "application/json", bytes.NewBufferString(`{"value":"a"}`))
+	assert.NoError(t, err)
+	largeResp, err := httpClient.Post(fmt.Sprintf("http://%v/v1/send", httpAddr), "application/json", bytes.NewBufferString(`{"value":"this value is too large"}`))
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, smallResp.StatusCode)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, largeResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_HTTP_MaxRequestBodySize_Chunked(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	largeValue := string(make([]byte, largeMessageLength))
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	hoster.MaxRecvMsgSize = largeMessageLength / 2
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a body of unknown length
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	payload, err := json.Marshal(&pb.SendRequest{Value: largeValue})
+	assert.NoError(t, err)
+	postReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%v/v1/send", httpAddr), ioutil.NopCloser(bytes.NewReader(payload)))
+	assert.NoError(t, err)
+	doResp, err := httpClient.Do(postReq)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, doResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_HTTP_ReadHeaderTimeout(t *testing.T) {
+	// arrange
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	hoster.HTTPReadHeaderTimeout = time.Millisecond * 100
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// send partial headers and wait for the server to close the connection
+	conn, err := net.Dial("tcp", httpAddr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /v1/echo HTTP/1.1\r\nHost: test\r\n"))
+	assert.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(httpClientTimeout))
+	_, err = ioutil.ReadAll(conn)
+
+	// assert
+	assert.NoError(t, err)
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_LoadShed_MaxInFlight(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	unblock := make(chan struct{})
+	shedBefore := metricValue("load_shed")
+
+	hoster := newTestHoster(grpcAddr, "", service, withBlocking(unblock))
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.MaxInFlight = 1
+	hoster.CriticalMethods = []string{"/test.TestService/Send"}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// hold the only slot with a blocked call, then call the service at the gRPC and HTTP endpoints
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := client.Echo(context.Background(), &pb.SendRequest{Value: "block"})
+		blocked <- err
+	}()
+	time.Sleep(serviceStartDelay)
+
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errNormal := client.Echo(context.Background(), &grpcReq)
+	_, errCriticalMethod := client.Send(context.Background(), &grpcReq)
+	_, errCriticalPriority := client.Echo(metadata.AppendToOutgoingContext(context.Background(), gohost.PriorityHeader, gohost.PriorityCritical), &grpcReq)
+
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	httpResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+	assert.NoError(t, err)
+
+	close(unblock)
+	errBlocked := <-blocked
+	_, errAfter := client.Echo(context.Background(), &grpcReq)
+
+	// assert
+	assert.Equal(t, codes.Unavailable, status.Code(errNormal))
+	assert.NoError(t, errCriticalMethod)
+	assert.Equal(t, codes.Unavailable, status.Code(errCriticalPriority))
+	assert.Equal(t, http.StatusServiceUnavailable, httpResp.StatusCode)
+	assert.NoError(t, errBlocked)
+	assert.NoError(t, errAfter)
+	assert.Equal(t, shedBefore+3, metricValue("load_shed"))
+}
+
+func Test_Hoster_ListenAndServe_LoadShed_ConcurrencyLimits(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	hoster := newTestHoster(grpcAddr, "", service, withBlocking(unblock))
+	hoster.ConcurrencyLimits = []gohost.ConcurrencyLimit{
+		{Method: "/test.TestService/Echo", Max: 1},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// hold the only slot for Echo with a blocked call, then call the service at the gRPC endpoint
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	go client.Echo(context.Background(), &pb.SendRequest{Value: "block"})
+	time.Sleep(serviceStartDelay)
+
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errEcho := client.Echo(context.Background(), &grpcReq)
+	_, errSend := client.Send(context.Background(), &grpcReq)
+
+	// assert
+	assert.Equal(t, codes.Unavailable, status.Code(errEcho))
+	assert.NoError(t, errSend)
+}
+
+func Test_Hoster_ListenAndServe_LoadShed_LowPriority(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	hoster := newTestHoster(grpcAddr, "", service, withBlocking(unblock))
+	hoster.MaxInFlight = 5
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// hold 4 of 5 slots with blocked calls, then call the service at the gRPC endpoint with low and normal priority
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	for i := 0; i < 4; i++ {
+		go client.Echo(context.Background(), &pb.SendRequest{Value: "block"})
+	}
+	time.Sleep(serviceStartDelay)
+
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errLow := client.Echo(metadata.AppendToOutgoingContext(context.Background(), gohost.PriorityHeader, gohost.PriorityLow), &grpcReq)
+	_, errNormal := client.Echo(context.Background(), &grpcReq)
+
+	// assert
+	assert.Equal(t, codes.Unavailable, status.Code(errLow))
+	assert.NoError(t, errNormal)
+}
+
+func Test_Hoster_ListenAndServe_LoadShed_Adaptive(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		time.Sleep(time.Millisecond * 5)
+		return handler(ctx, req)
+	})
+	hoster.MaxInFlight = 10
+	hoster.AdaptiveLatencyTarget = time.Millisecond
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// make slow calls to the service at the gRPC endpoint
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	for i := 0; i < 10; i++ {
+		_, err := client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+		assert.NoError(t, err)
+	}
+
+	// assert
+	assert.True(t, metricValue("concurrency_limit") < 10)
+}
+
+func Test_Hoster_Validate_LoadShed(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.MaxInFlight = -1
+	hoster.AdaptiveLatencyTarget = time.Second
+	hoster.ConcurrencyLimits = []gohost.ConcurrencyLimit{
+		{Method: "test.TestService/Echo", Max: 1},
+		{Method: "/test.TestService/Send"},
+	}
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 4)
+}
+
+// withBlocking is a helper function that configures a hoster to block calls with the value "block" until unblock is closed.
+func withBlocking(unblock chan struct{}) func(hoster *gohost.Hoster) {
+	return func(hoster *gohost.Hoster) {
+		hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if r, ok := req.(*pb.SendRequest); ok && r.Value == "block" {
+				<-unblock
+			}
+			return handler(ctx, req)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Mock_GRPC(t *testing.T) {
+	// arrange
+	grpcAddr := getAddr(t)
+	httpAddr := getAddr(t)
+
+	hoster, file := newMockHoster(t, grpcAddr, httpAddr)
+	defer os.Remove(file)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call methods with and without a matching fixture
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewTestServiceClient(conn)
+
+	matched, err := client.Echo(context.Background(), &pb.SendRequest{Value: "hello"})
+	assert.NoError(t, err)
+	unmatched, err := client.Echo(context.Background(), &pb.SendRequest{Value: "other"})
+	assert.NoError(t, err)
+	_, notFoundErr := client.Echo(context.Background(), &pb.SendRequest{Value: "missing"})
+	send, err := client.Send(context.Background(), &pb.SendRequest{Value: "any"})
+	assert.NoError(t, err)
+
+	repeat, err := client.Repeat(context.Background(), &pb.RepeatRequest{Value: "any", Count: 3})
+	assert.NoError(t, err)
+	var echoes []string
+	for {
+		resp, err := repeat.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		echoes = append(echoes, resp.Echo)
+	}
+
+	stream, err := client.Stream(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&pb.SendRequest{Value: "one"}))
+	assert.NoError(t, stream.Send(&pb.SendRequest{Value: "two"}))
+	streamResp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, "hello from mock", matched.Echo)
+	assert.Empty(t, unmatched.Echo)
+	assert.Equal(t, codes.NotFound, status.Code(notFoundErr))
+	assert.Equal(t, "value not found", status.Convert(notFoundErr).Message())
+	assert.True(t, send.Success)
+	assert.Equal(t, []string{"one", "two", "three"}, echoes)
+	assert.False(t, streamResp.Success)
+}
+
+func Test_Hoster_ListenAndServe_Mock_HTTP(t *testing.T) {
+	// arrange
+	grpcAddr := getAddr(t)
+	httpAddr := getAddr(t)
+
+	hoster, file := newMockHoster(t, grpcAddr, httpAddr)
+	defer os.Remove(file)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the mocked methods through the routes of their http annotations
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	echoResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=hello", httpAddr))
+	assert.NoError(t, err)
+	echoBody, err := ioutil.ReadAll(echoResp.Body)
+	assert.NoError(t, err)
+
+	notFoundResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=missing", httpAddr))
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, echoResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"hello from mock"}`, string(echoBody))
+	assert.Equal(t, http.StatusNotFound, notFoundResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_Mock_LatencyAndErrors(t *testing.T) {
+	// arrange
+	grpcAddr := getAddr(t)
+	httpAddr := getAddr(t)
+
+	hoster, file := newMockHoster(t, grpcAddr, httpAddr)
+	defer os.Remove(file)
+
+	failing, failingFile := newMockHoster(t, getAddr(t), getAddr(t))
+	defer os.Remove(failingFile)
+	failing.MockErrorPercent = 100
+
+	// act - start the services
+	go hoster.ListenAndServe()
+	go failing.ListenAndServe()
+
+	// make sure services have time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a fixture with latency, with and without a deadline that is too short, and a service where every call fails
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewTestServiceClient(conn)
+
+	start := time.Now()
+	slow, err := client.Echo(context.Background(), &pb.SendRequest{Value: "slow"})
+	elapsed := time.Since(start)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, deadlineErr := client.Echo(ctx, &pb.SendRequest{Value: "slow"})
+
+	failingConn, err := grpc.Dial(failing.GRPCAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer failingConn.Close()
+	_, injectedErr := pb.NewTestServiceClient(failingConn).Echo(context.Background(), &pb.SendRequest{Value: "hello"})
+
+	// assert
+	assert.Equal(t, "slow", slow.Echo)
+	assert.True(t, elapsed >= time.Millisecond*200)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(deadlineErr))
+	assert.Equal(t, codes.Unavailable, status.Code(injectedErr))
+}
+
+func Test_Hoster_ListenAndServe_Mock_RegisteredService(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+	httpAddr := getAddr(t)
+
+	hoster, file := newMockHoster(t, grpcAddr, httpAddr)
+	defer os.Remove(file)
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a method that has a fixture, which the registered service should serve instead
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	resp, err := pb.NewTestServiceClient(conn).Echo(context.Background(), &pb.SendRequest{Value: "hello"})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", resp.Echo)
+}
+
+func Test_Hoster_ListenAndServe_Mock_DescriptorSetOnly(t *testing.T) {
+	// arrange - rename the messages of the test service so their types are not linked into the program
+	grpcAddr := getAddr(t)
+	httpAddr := getAddr(t)
+
+	file := writeDescriptorSet(t, &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{loadUnlinkedTestDescriptor(t)},
+	})
+	defer os.Remove(file)
+
+	hoster, _ := newMockHoster(t, grpcAddr, httpAddr)
+	hoster.DescriptorSetFile = file
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the mocked methods with messages that have the same encoding
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewTestServiceClient(conn)
+
+	matched, err := client.Echo(context.Background(), &pb.SendRequest{Value: "hello"})
+	assert.NoError(t, err)
+	repeat, err := client.Repeat(context.Background(), &pb.RepeatRequest{Value: "any", Count: 3})
+	assert.NoError(t, err)
+	var echoes []string
+	for {
+		resp, err := repeat.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		echoes = append(echoes, resp.Echo)
+	}
+
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	echoResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=hello", httpAddr))
+	assert.NoError(t, err)
+	echoBody, err := ioutil.ReadAll(echoResp.Body)
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, "hello from mock", matched.Echo)
+	assert.Equal(t, []string{"one", "two", "three"}, echoes)
+	assert.Equal(t, http.StatusOK, echoResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"hello from mock"}`, string(echoBody))
+}
+
+func Test_Hoster_Validate_Mock(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableMock = true
+	hoster.MockErrorPercent = 101
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+// newMockHoster is a helper function that creates a hoster that mocks the test service with the test fixtures. The descriptor set file returned should be removed by the caller.
+func newMockHoster(t *testing.T, grpcAddr string, httpAddr string) (*gohost.Hoster, string) {
+	file := writeDescriptorSet(t, &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{loadTestDescriptor(t)},
+	})
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.HTTPAddr = httpAddr
+	hoster.EnableMock = true
+	hoster.DescriptorSetFile = file
+	hoster.MockFixturesFile = "../testdata/mock_fixtures.yaml"
+
+	return hoster, file
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
+	"golang.org/x/net/context"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_OpenAPI(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := newGohostTestHoster()
+	hoster.OpenAPIPath = "/docs"
+	hoster.RegisterOpenAPIDoc("test.TestService", []byte(`{"swagger":"2.0"}`))
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// act
+	listStatus, list := getOpenAPI(t, server, http.MethodGet, "/docs/")
+	docStatus, doc := getOpenAPI(t, server, http.MethodGet, "/docs/test.TestService.json")
+	missingStatus, _ := getOpenAPI(t, server, http.MethodGet, "/docs/test.MissingService.json")
+	postStatus, _ := getOpenAPI(t, server, http.MethodPost, "/docs/test.TestService.json")
+	echoStatus, _ := getOpenAPI(t, server, http.MethodGet, "/v1/echo?value=test")
+
+	// assert
+	assert.Equal(t, http.StatusOK, listStatus)
+	assert.JSONEq(t, `[{"name":"test.TestService","path":"/docs/test.TestService.json"}]`, list)
+	assert.Equal(t, http.StatusOK, docStatus)
+	assert.Equal(t, `{"swagger":"2.0"}`, doc)
+	assert.Equal(t, http.StatusNotFound, missingStatus)
+	assert.Equal(t, http.StatusMethodNotAllowed, postStatus)
+	assert.Equal(t, http.StatusOK, echoStatus)
+}
+
+func Test_Hoster_Validate_OpenAPIPath(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.OpenAPIPath = "docs"
+	hoster.RegisterOpenAPIDoc("test.TestService", []byte(`{}`))
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.EqualError(t, err, `invalid configuration: openapi path "docs" must start with /`)
+}
+
+func Test_Hoster_RegisterTestService(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableHealth = true
+	pb.RegisterTestService(hoster, test.NewService())
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// act
+	echoResp, echoErr := pb.NewTestServiceClient(server.Conn).Echo(context.Background(), &pb.SendRequest{Value: "test"})
+	gatewayStatus, gatewayBody := getOpenAPI(t, server, http.MethodGet, "/v1/echo?value=test")
+	docStatus, docBody := getOpenAPI(t, server, http.MethodGet, "/openapi/"+pb.TestServiceName+".json")
+	healthResp, healthErr := healthpb.NewHealthClient(server.Conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.TestServiceName})
+
+	// assert
+	assert.NoError(t, echoErr)
+	assert.Equal(t, "test", echoResp.Echo)
+	assert.Equal(t, http.StatusOK, gatewayStatus)
+	assert.JSONEq(t, `{"echo":"test"}`, gatewayBody)
+
+	assert.Equal(t, http.StatusOK, docStatus)
+	var doc struct {
+		Info struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(docBody), &doc))
+	assert.Equal(t, "proto/test.proto", doc.Info.Title)
+	assert.Contains(t, doc.Paths["/v1/echo"], "get")
+	assert.Contains(t, doc.Paths["/v1/send"], "post")
+
+	assert.NoError(t, healthErr)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthResp.Status)
+}
+
+// getOpenAPI is a helper function that sends a request to the HTTP endpoint and returns the status and body of the response.
+func getOpenAPI(t *testing.T, server *gohosttest.Server, method string, path string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(""))
+	assert.NoError(t, err)
+
+	resp, err := server.HTTPClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp.StatusCode, string(body)
+}
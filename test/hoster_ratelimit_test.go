@@ -0,0 +1,349 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_RateLimit_GRPC(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.RateLimits = []gohost.RateLimit{
+		{Method: "/test.TestService/Echo", Key: gohost.RateLimitByIP, Rate: 0.1},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint until the limit is reached
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errFirst := client.Echo(context.Background(), &grpcReq)
+	var header metadata.MD
+	_, errSecond := client.Echo(context.Background(), &grpcReq, grpc.Header(&header))
+	_, errOther := client.Send(context.Background(), &grpcReq)
+
+	// assert
+	assert.NoError(t, errFirst)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errSecond))
+	details := status.Convert(errSecond).Details()
+	assert.Len(t, details, 1)
+	retryInfo, ok := details[0].(*errdetails.RetryInfo)
+	assert.True(t, ok)
+	assert.True(t, retryInfo.RetryDelay.Seconds > 0)
+	assert.Equal(t, []string{"10"}, header.Get("retry-after"))
+	assert.NoError(t, errOther)
+}
+
+func Test_Hoster_ListenAndServe_RateLimit_Principal(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{
+			Keys: map[string]gohost.Principal{
+				"key-1": {Subject: "client-1"},
+				"key-2": {Subject: "client-2"},
+			},
+		},
+	}
+	hoster.RateLimits = []gohost.RateLimit{
+		{Method: "/test.TestService/*", Key: gohost.RateLimitByPrincipal, Rate: 0.1},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint as two different callers
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	ctx1 := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "key-1")
+	ctx2 := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "key-2")
+	_, errFirst1 := client.Echo(ctx1, &grpcReq)
+	_, errFirst2 := client.Send(ctx2, &grpcReq)
+	_, errSecond1 := client.Send(ctx1, &grpcReq)
+	stream, err := client.Stream(ctx2)
+	assert.NoError(t, err)
+	_, errSecond2 := stream.CloseAndRecv()
+
+	// assert
+	assert.NoError(t, errFirst1)
+	assert.NoError(t, errFirst2)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errSecond1))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errSecond2))
+}
+
+func Test_Hoster_ListenAndServe_RateLimit_HTTP(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.RateLimits = []gohost.RateLimit{
+		{Route: "GET /v1/echo", Rate: 0.5, Burst: 2},
+		{Method: "/test.TestService/Send", Key: gohost.RateLimitByMethod, Rate: 0.2},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint until the route and method limits are reached
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	responses := []*http.Response{}
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+		assert.NoError(t, err)
+		responses = append(responses, resp)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Post(fmt.Sprintf("http://%v/v1/send", httpAddr), "application/json", nil)
+		assert.NoError(t, err)
+		responses = append(responses, resp)
+	}
+
+	// assert
+	assert.Equal(t, http.StatusOK, responses[0].StatusCode)
+	assert.Equal(t, http.StatusOK, responses[1].StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, responses[2].StatusCode)
+	assert.Equal(t, "2", responses[2].Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, responses[3].StatusCode)
+	assert.Equal(t, http.StatusTooManyRequests, responses[4].StatusCode)
+	assert.Equal(t, "5", responses[4].Header.Get("Retry-After"))
+}
+
+func Test_Hoster_ListenAndServe_RateLimit_UnverifiedAPIKey(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{
+			Keys: map[string]gohost.Principal{
+				"key-1": {Subject: "client-1"},
+			},
+		},
+	}
+	hoster.RateLimits = []gohost.RateLimit{
+		{Route: "GET /v1/echo", Key: gohost.RateLimitByAPIKey, Rate: 0.1},
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint with a different invalid key each time, then with a valid key
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	statusCodes := []int{}
+	for _, key := range []string{"random-1", "random-2", "key-1"} {
+		httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+		assert.NoError(t, err)
+		httpReq.Header.Set(gohost.APIKeyHeader, key)
+		resp, err := httpClient.Do(httpReq)
+		assert.NoError(t, err)
+		statusCodes = append(statusCodes, resp.StatusCode)
+	}
+
+	// assert
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusOK}, statusCodes)
+}
+
+func Test_Hoster_ListenAndServe_RateLimit_Store(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	store := &recordingRateLimitStore{}
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.Authenticators = []gohost.Authenticator{
+		&gohost.APIKeyAuthenticator{
+			Keys: map[string]gohost.Principal{
+				"key-1": {Subject: "client-1"},
+			},
+		},
+	}
+	hoster.RateLimits = []gohost.RateLimit{
+		{Method: "/test.TestService/Echo", Key: gohost.RateLimitByAPIKey, Rate: 5},
+	}
+	hoster.RateLimitStore = store
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), gohost.APIKeyHeader, "key-1")
+	_, err = client.Echo(ctx, &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/test.TestService/Echo|apikey:client-1"}, store.keys)
+	assert.Equal(t, []int{5}, store.bursts)
+}
+
+func Test_MemoryRateLimitStore_Take(t *testing.T) {
+	// arrange
+	store := gohost.NewMemoryRateLimitStore()
+	ctx := context.Background()
+	key := []gohost.RateLimitBucket{{Key: "key", Rate: 100, Burst: 2}}
+	other := []gohost.RateLimitBucket{{Key: "other", Rate: 100, Burst: 2}}
+
+	// act
+	ok1, _, err1 := store.Take(ctx, key)
+	ok2, _, err2 := store.Take(ctx, key)
+	ok3, wait3, err3 := store.Take(ctx, key)
+	okOther, _, errOther := store.Take(ctx, other)
+	time.Sleep(time.Millisecond * 20)
+	ok4, _, err4 := store.Take(ctx, key)
+
+	// assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NoError(t, err3)
+	assert.NoError(t, errOther)
+	assert.NoError(t, err4)
+	assert.True(t, ok1)
+	assert.True(t, ok2)
+	assert.False(t, ok3)
+	assert.True(t, wait3 > 0 && wait3 <= time.Millisecond*10)
+	assert.True(t, okOther)
+	assert.True(t, ok4)
+}
+
+func Test_MemoryRateLimitStore_Take_AllOrNothing(t *testing.T) {
+	// arrange
+	store := gohost.NewMemoryRateLimitStore()
+	ctx := context.Background()
+	wide := gohost.RateLimitBucket{Key: "wide", Rate: 0.1, Burst: 2}
+	narrow := gohost.RateLimitBucket{Key: "narrow", Rate: 0.1, Burst: 1}
+
+	// act
+	ok1, _, err1 := store.Take(ctx, []gohost.RateLimitBucket{wide, narrow})
+	ok2, wait2, err2 := store.Take(ctx, []gohost.RateLimitBucket{wide, narrow})
+	ok3, _, err3 := store.Take(ctx, []gohost.RateLimitBucket{wide})
+	ok4, _, err4 := store.Take(ctx, []gohost.RateLimitBucket{wide})
+
+	// assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NoError(t, err3)
+	assert.NoError(t, err4)
+	assert.True(t, ok1)
+	assert.False(t, ok2)
+	assert.True(t, wait2 > time.Second*9)
+	assert.True(t, ok3)
+	assert.False(t, ok4)
+}
+
+func Test_Hoster_Validate_RateLimits(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.RateLimits = []gohost.RateLimit{
+		{Method: "/test.TestService/Echo", Route: "GET /v1/echo", Rate: 1},
+		{Method: "test.TestService/Echo", Rate: 1},
+		{Route: "/v1/echo", Rate: 1},
+		{Method: "/test.TestService/Echo", Key: "user", Rate: 1},
+		{Method: "/test.TestService/Echo"},
+		{Method: "/test.TestService/Echo", Rate: 1, Burst: -1},
+	}
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 6)
+}
+
+// recordingRateLimitStore is a rate limit store that records the buckets used and always allows requests.
+type recordingRateLimitStore struct {
+	mu     sync.Mutex
+	keys   []string
+	bursts []int
+}
+
+// Take will record the keys and bursts of the buckets.
+func (s *recordingRateLimitStore) Take(ctx context.Context, buckets []gohost.RateLimitBucket) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range buckets {
+		s.keys = append(s.keys, b.Key)
+		s.bursts = append(s.bursts, b.Burst)
+	}
+	return true, 0, nil
+}
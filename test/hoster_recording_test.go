@@ -0,0 +1,354 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/gohosttest"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Recording(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recording.log")
+
+	hoster := newGohostTestHoster()
+	hoster.RecordingFile = file
+	hoster.RecordingRedact = append(hoster.RecordingRedact, "success")
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// act - make unary and streaming gRPC calls, and HTTP requests that are forwarded to gRPC calls
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret", "x-custom", "custom")
+	_, err = client.Echo(ctx, &pb.SendRequest{Value: "test"})
+	assert.NoError(t, err)
+
+	stream, err := client.Repeat(context.Background(), &pb.RepeatRequest{Value: "test", Count: 2})
+	assert.NoError(t, err)
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	resp, err := server.HTTPClient.Get(server.URL + "/v1/echo?value=http")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = server.HTTPClient.Post(server.URL+"/v1/send", "application/json", strings.NewReader(`{"value":"test"}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	recordings := readRecordings(t, file, 4)
+
+	// assert
+	assert.Len(t, recordings, 4)
+
+	echo := recordings[0]
+	assert.Equal(t, "/test.TestService/Echo", echo.Method)
+	assert.Equal(t, "test.SendRequest", echo.RequestType)
+	assert.Equal(t, "test.EchoResponse", echo.ResponseType)
+	assert.Equal(t, []string{gohost.RedactedValue}, echo.Metadata["authorization"])
+	assert.Equal(t, []string{"custom"}, echo.Metadata["x-custom"])
+	assert.Len(t, echo.Requests, 1)
+	assert.JSONEq(t, `{"value":"test"}`, string(echo.Requests[0]))
+	assert.Len(t, echo.Responses, 1)
+	assert.JSONEq(t, `{"echo":"test"}`, string(echo.Responses[0]))
+	assert.Equal(t, "OK", echo.Code)
+
+	repeat := recordings[1]
+	assert.Equal(t, "/test.TestService/Repeat", repeat.Method)
+	assert.True(t, repeat.ServerStreams)
+	assert.False(t, repeat.ClientStreams)
+	assert.Len(t, repeat.Requests, 1)
+	assert.Len(t, repeat.Responses, 2)
+
+	// HTTP requests are recorded after the response is sent, so they may be in either order
+	httpEcho, httpSend := recordings[2], recordings[3]
+	if httpEcho.HTTPMethod != "GET" {
+		httpEcho, httpSend = httpSend, httpEcho
+	}
+	assert.Equal(t, "GET", httpEcho.HTTPMethod)
+	assert.Equal(t, "/v1/echo?value=http", httpEcho.Path)
+	assert.Equal(t, 200, httpEcho.Status)
+	assert.Len(t, httpEcho.Responses, 1)
+	assert.JSONEq(t, `{"echo":"http"}`, string(httpEcho.Responses[0]))
+
+	// the body of Send is not used by the route, and its response only has the redacted success field
+	assert.Equal(t, "POST", httpSend.HTTPMethod)
+	assert.Len(t, httpSend.Requests, 1)
+	assert.JSONEq(t, `{"value":"test"}`, string(httpSend.Requests[0]))
+	assert.Len(t, httpSend.Responses, 1)
+	assert.JSONEq(t, `{}`, string(httpSend.Responses[0]))
+}
+
+func Test_Hoster_ListenAndServe_Recording_Rotate(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recording.log")
+
+	hoster := newGohostTestHoster()
+	hoster.RecordingFile = file
+	hoster.RecordingMaxSize = 1
+	hoster.RecordingMaxFiles = 2
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// act - every call is larger than the max size, so each is written to a new file
+	for i := 0; i < 4; i++ {
+		_, err := client.Echo(context.Background(), &pb.SendRequest{Value: fmt.Sprint(i)})
+		assert.NoError(t, err)
+	}
+
+	// assert
+	current := readRecordings(t, file, 1)
+	newest := readRecordings(t, file+".1", 1)
+	oldest := readRecordings(t, file+".2", 1)
+	_, err = os.Stat(file + ".3")
+
+	assert.JSONEq(t, `{"value":"3"}`, string(current[0].Requests[0]))
+	assert.JSONEq(t, `{"value":"2"}`, string(newest[0].Requests[0]))
+	assert.JSONEq(t, `{"value":"1"}`, string(oldest[0].Requests[0]))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_Hoster_ListenAndServe_Recording_RedactNonJSON(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recording.log")
+
+	hoster := newGohostTestHoster()
+	hoster.RecordingFile = file
+	hoster.RecordingRedact = []string{"password"}
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+
+	// act - send a body that is not JSON, so its fields cannot be redacted
+	resp, err := server.HTTPClient.Post(server.URL+"/v1/send", "text/plain", strings.NewReader("value=test&password=secret"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	recordings := readRecordings(t, file, 1)
+
+	// assert
+	assert.Len(t, recordings, 1)
+	assert.True(t, recordings[0].Redacted)
+	assert.Empty(t, recordings[0].Body)
+	assert.Empty(t, recordings[0].Requests)
+	assert.Len(t, recordings[0].Responses, 1)
+}
+
+func Test_Hoster_ListenAndServe_Recording_StreamLimit(t *testing.T) {
+	t.Parallel()
+
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost-recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recording.log")
+
+	hoster := newGohostTestHoster()
+	hoster.RecordingFile = file
+	hoster.MaxSendMsgSize = 40
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// act - stream responses that fit in a message but not in the recording together
+	stream, err := client.Repeat(context.Background(), &pb.RepeatRequest{Value: "test", Count: 5})
+	assert.NoError(t, err)
+	var received int
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		received++
+	}
+
+	recordings := readRecordings(t, file, 1)
+
+	// assert
+	assert.Equal(t, 5, received)
+	assert.Len(t, recordings, 1)
+	assert.True(t, recordings[0].Truncated)
+	assert.Len(t, recordings[0].Requests, 1)
+	assert.Empty(t, recordings[0].Responses)
+}
+
+func Test_Replayer_Replay(t *testing.T) {
+	t.Parallel()
+
+	// arrange - record calls on one server
+	dir, err := ioutil.TempDir("", "gohost-recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recording.log")
+
+	hoster := newGohostTestHoster()
+	hoster.RecordingFile = file
+	recorded := gohosttest.Start(t, hoster)
+	defer recorded.Stop()
+	client := pb.NewTestServiceClient(recorded.Conn)
+
+	_, err = client.Echo(context.Background(), &pb.SendRequest{Value: "test"})
+	assert.NoError(t, err)
+	_, err = client.Send(context.Background(), &pb.SendRequest{Value: "test"})
+	assert.NoError(t, err)
+	resp, err := recorded.HTTPClient.Get(recorded.URL + "/v1/echo?value=http")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	recordings := readRecordings(t, file, 3)
+
+	// replay against a server that behaves the same, and one that changed the response of Echo
+	same := gohosttest.Start(t, newGohostTestHoster())
+	defer same.Stop()
+
+	changedHoster := newGohostTestHoster()
+	changedHoster.UnaryInterceptors = append(changedHoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == "/test.TestService/Echo" {
+			return &pb.EchoResponse{Echo: "changed"}, nil
+		}
+		return handler(ctx, req)
+	})
+	changed := gohosttest.Start(t, changedHoster)
+	defer changed.Stop()
+
+	// act
+	sameResults := replayAll(gohost.Replayer{Conn: same.Conn, URL: same.URL, HTTPClient: same.HTTPClient}, recordings)
+	changedResults := replayAll(gohost.Replayer{Conn: changed.Conn, URL: changed.URL, HTTPClient: changed.HTTPClient}, recordings)
+	grpcOnlyResults := replayAll(gohost.Replayer{Conn: same.Conn}, recordings)
+
+	// assert
+	for _, result := range sameResults {
+		assert.NoError(t, result.Err)
+		assert.True(t, result.Matched(), "diffs: %v", result.Diffs)
+	}
+
+	assert.Equal(t, []string{`responses[0].echo: "test" != "changed"`}, changedResults[0].Diffs)
+	assert.True(t, changedResults[1].Matched())
+	assert.Equal(t, []string{`responses[0].echo: "http" != "changed"`}, changedResults[2].Diffs)
+
+	assert.True(t, grpcOnlyResults[0].Matched())
+	assert.True(t, grpcOnlyResults[2].Skipped)
+}
+
+func Test_Replayer_Replay_DescriptorSet(t *testing.T) {
+	t.Parallel()
+
+	// arrange - recorded calls with message types that are not linked into the program
+	recordings := []*gohost.Recording{
+		{
+			Method:       "/test.TestService/Echo",
+			RequestType:  "test.UnlinkedSendRequest",
+			ResponseType: "test.UnlinkedEchoResponse",
+			Requests:     []json.RawMessage{json.RawMessage(`{"value":"test"}`)},
+			Responses:    []json.RawMessage{json.RawMessage(`{"echo":"test"}`)},
+			Code:         "OK",
+		},
+		{
+			Method:        "/test.TestService/Repeat",
+			ServerStreams: true,
+			RequestType:   "test.UnlinkedRepeatRequest",
+			ResponseType:  "test.UnlinkedEchoResponse",
+			Requests:      []json.RawMessage{json.RawMessage(`{"value":"test","count":"2"}`)},
+			Responses:     []json.RawMessage{json.RawMessage(`{"echo":"test"}`), json.RawMessage(`{"echo":"other"}`)},
+			Code:          "OK",
+		},
+	}
+
+	server := gohosttest.Start(t, newGohostTestHoster())
+	defer server.Stop()
+	set := &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{loadUnlinkedTestDescriptor(t)},
+	}
+
+	// act
+	results := replayAll(gohost.Replayer{Conn: server.Conn, DescriptorSet: set}, recordings)
+	linkedResults := replayAll(gohost.Replayer{Conn: server.Conn}, recordings)
+
+	// assert
+	assert.NoError(t, results[0].Err)
+	assert.True(t, results[0].Matched(), "diffs: %v", results[0].Diffs)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, []string{`responses[1].echo: "other" != "test"`}, results[1].Diffs)
+	assert.EqualError(t, linkedResults[0].Err, `message type "test.UnlinkedSendRequest" is not linked into the program or in the descriptor set`)
+}
+
+func Test_Hoster_Validate_Recording(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.RecordingMaxSize = -1
+	hoster.RecordingMaxFiles = -1
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+// readRecordings is a helper function that reads a recording file, waiting for HTTP requests that are recorded after the response has been sent.
+func readRecordings(t *testing.T, file string, count int) []*gohost.Recording {
+	var recordings []*gohost.Recording
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond * 10) {
+		f, err := os.Open(file)
+		assert.NoError(t, err)
+		recordings, err = gohost.ReadRecordings(f)
+		f.Close()
+		assert.NoError(t, err)
+		if len(recordings) >= count {
+			break
+		}
+	}
+
+	return recordings
+}
+
+// replayAll is a helper function that replays every recording.
+func replayAll(replayer gohost.Replayer, recordings []*gohost.Recording) []*gohost.ReplayResult {
+	results := []*gohost.ReplayResult{}
+	for _, rec := range recordings {
+		results = append(results, replayer.Replay(context.Background(), rec))
+	}
+
+	return results
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_GRPC_RecoverPanic(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	reported := make(chan gohost.PanicInfo, 1)
+	panicsBefore := metricValue("grpc_panics")
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		panic("test panic")
+	})
+	hoster.PanicHandler = func(ctx context.Context, info gohost.PanicInfo) {
+		reported <- info
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), gohost.RequestIDHeader, "request-1")
+	_, err = client.Echo(ctx, &pb.SendRequest{Value: "test"})
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	info := <-reported
+	assert.Equal(t, "/test.TestService/Echo", info.Method)
+	assert.Equal(t, "request-1", info.RequestID)
+	assert.Equal(t, "test panic", info.Value)
+	assert.NotEmpty(t, info.Stack)
+	assert.Equal(t, panicsBefore+1, metricValue("grpc_panics"))
+
+	// the server should still be running
+	_, err = client.Send(ctx, &pb.SendRequest{Value: "test"})
+	assert.Error(t, err)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func Test_Hoster_ListenAndServe_HTTP_RecoverPanic(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	reported := make(chan gohost.PanicInfo, 1)
+	panicsBefore := metricValue("http_panics")
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+
+	hoster.HTTPAddr = httpAddr
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.HTTPHandler = func(mux *runtime.ServeMux) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test panic")
+		})
+	}
+	hoster.PanicHandler = func(ctx context.Context, info gohost.PanicInfo) {
+		reported <- info
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the HTTP endpoint
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+	assert.NoError(t, err)
+	httpReq.Header.Set(gohost.RequestIDHeader, "request-2")
+	doResp, err := httpClient.Do(httpReq)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, doResp.StatusCode)
+	info := <-reported
+	assert.Equal(t, "GET /v1/echo", info.Method)
+	assert.Equal(t, "request-2", info.RequestID)
+	assert.Equal(t, panicsBefore+1, metricValue("http_panics"))
+}
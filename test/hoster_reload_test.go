@@ -0,0 +1,268 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_Reload_NoSource(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+
+	// act
+	_, err := hoster.Reload()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_Reload_LiveAndRestartSettings(t *testing.T) {
+	// arrange
+	file := writeTempFile(t, "config.yaml", "grpc_addr: 127.0.0.1:50052\nmax_recv_msg_size: 1024\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+	err := hoster.LoadConfig(file, "", nil)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(file, []byte("grpc_addr: 127.0.0.1:50053\nmax_recv_msg_size: 2048\n"), 0600)
+	assert.NoError(t, err)
+
+	// act
+	restart, err := hoster.Reload()
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"grpc_addr", "max_recv_msg_size"}, restart)
+	assert.Equal(t, "127.0.0.1:50052", hoster.GRPCAddr)
+	assert.Equal(t, 1024, hoster.MaxRecvMsgSize)
+}
+
+func Test_Hoster_Reload_InvalidConfig(t *testing.T) {
+	// arrange
+	file := writeTempFile(t, "config.yaml", "max_recv_msg_size: 1024\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+	err := hoster.LoadConfig(file, "", nil)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(file, []byte("max_recv_msg_size: 0\n"), 0600)
+	assert.NoError(t, err)
+
+	// act
+	_, err = hoster.Reload()
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, 1024, hoster.MaxRecvMsgSize)
+}
+
+func Test_Hoster_Reload_MaxRecvMsgSize(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	largeValue := string(make([]byte, largeMessageLength))
+
+	file := writeTempFile(t, "config.yaml", "max_recv_msg_size: 1\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.EnableReload = true
+	hoster.ReloadMaxMsgSizeCeiling = gohost.DefaultMaxRecvMsgSize
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	err := hoster.LoadConfig(file, "", nil)
+	assert.NoError(t, err)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the gRPC endpoint before and after reloading
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: largeValue,
+	}
+	_, errBefore := client.Send(context.Background(), &grpcReq, grpc.MaxCallSendMsgSize(math.MaxInt32))
+
+	err = ioutil.WriteFile(file, []byte(fmt.Sprintf("max_recv_msg_size: %v\n", gohost.DefaultMaxRecvMsgSize)), 0600)
+	assert.NoError(t, err)
+	_, err = hoster.Reload()
+	assert.NoError(t, err)
+
+	grpcResp, errAfter := client.Send(context.Background(), &grpcReq, grpc.MaxCallSendMsgSize(math.MaxInt32))
+
+	// assert
+	assert.Error(t, errBefore)
+	assert.NoError(t, errAfter)
+	assert.True(t, grpcResp.Success)
+}
+
+func Test_Hoster_Reload_MaxMsgSizeCeiling(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	largeValue := string(make([]byte, largeMessageLength))
+
+	file := writeTempFile(t, "config.yaml", "max_recv_msg_size: 100\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.EnableReload = true
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	err := hoster.LoadConfig(file, "", nil)
+	assert.NoError(t, err)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// raise the limit above the size at startup and call the service at the gRPC endpoint
+	err = ioutil.WriteFile(file, []byte(fmt.Sprintf("max_recv_msg_size: %v\n", math.MaxInt32)), 0600)
+	assert.NoError(t, err)
+	_, errReload := hoster.Reload()
+
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: largeValue,
+	}
+	_, errSend := client.Send(context.Background(), &grpcReq, grpc.MaxCallSendMsgSize(math.MaxInt32))
+
+	// assert
+	assert.EqualError(t, errReload, fmt.Sprintf("invalid configuration: max receive message size %v is larger than the transport limit of 100 set at startup", math.MaxInt32))
+	assert.Equal(t, 100, hoster.MaxRecvMsgSize)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errSend))
+}
+
+func Test_Hoster_Validate_ReloadMaxMsgSizeCeiling(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.EnableReload = true
+	hoster.ReloadMaxMsgSizeCeiling = 1024
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.EqualError(t, err, fmt.Sprintf("invalid configuration: reload max message size ceiling 1024 must be between %v and %v", gohost.DefaultMaxRecvMsgSize, math.MaxInt32))
+}
+
+func Test_Hoster_Reload_RateLimitsAndOrigins(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	grpcAddr := getAddr(t)
+
+	file := writeTempFile(t, "config.yaml", "websocket_origins: https://old.example.com\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	err := hoster.LoadConfig(file, "", nil)
+	assert.NoError(t, err)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// add a rate limit and call the service at the gRPC endpoint until it is reached
+	config := `websocket_origins: [https://new.example.com]
+grpc_web_origins: [https://new.example.com]
+rate_limits:
+  - method: /test.TestService/Echo
+    rate: 0.1
+`
+	err = ioutil.WriteFile(file, []byte(config), 0600)
+	assert.NoError(t, err)
+	restart, errReload := hoster.Reload()
+
+	conn, err := grpc.Dial(grpcAddr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	client := pb.NewTestServiceClient(conn)
+	grpcReq := pb.SendRequest{
+		Value: "test",
+	}
+	_, errFirst := client.Echo(context.Background(), &grpcReq)
+	_, errSecond := client.Echo(context.Background(), &grpcReq)
+
+	// assert
+	assert.NoError(t, errReload)
+	assert.Empty(t, restart)
+	assert.Equal(t, []string{"https://new.example.com"}, hoster.WebSocketOrigins)
+	assert.Equal(t, []string{"https://new.example.com"}, hoster.GRPCWebOrigins)
+	assert.Equal(t, []gohost.RateLimit{{Method: "/test.TestService/Echo", Rate: 0.1}}, hoster.RateLimits)
+	assert.NoError(t, errFirst)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(errSecond))
+}
+
+func Test_Hoster_ListenAndServe_Debug_Config(t *testing.T) {
+	// arrange
+	debugAddr := getAddr(t)
+
+	hoster := gohost.NewHoster()
+	hoster.DebugAddr = debugAddr
+	hoster.EnableDebug = true
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the service at the debug endpoint
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	doResp, err := httpClient.Get(fmt.Sprintf("http://%v/debug/config", debugAddr))
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(doResp.Body)
+	assert.NoError(t, err)
+	httpResp := struct {
+		Config          map[string]interface{} `json:"config"`
+		RestartRequired []string               `json:"restart_required"`
+	}{}
+	err = json.Unmarshal(body, &httpResp)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, debugAddr, httpResp.Config["debug_addr"])
+	assert.Equal(t, true, httpResp.Config["enable_debug"])
+	assert.Empty(t, httpResp.RestartRequired)
+}
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/eleniums/gohost/gohosttest"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_Shadow(t *testing.T) {
+	t.Parallel()
+
+	// arrange - a shadow that changes the response for one value and fails for another
+	shadowMetadata := make(chan metadata.MD, 1)
+	shadow, shadowAddr := startShadow(t, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if send, ok := req.(*pb.SendRequest); ok {
+			switch send.Value {
+			case "changed":
+				return &pb.EchoResponse{Echo: "different"}, nil
+			case "missing":
+				return nil, status.Error(codes.NotFound, "value not found")
+			case "metadata":
+				md, _ := metadata.FromIncomingContext(ctx)
+				shadowMetadata <- md
+			}
+		}
+		return handler(ctx, req)
+	})
+	defer shadow.Stop()
+
+	results := make(chan gohost.ShadowResult, 10)
+	hoster := newGohostTestHoster()
+	hoster.ShadowAddr = shadowAddr
+	hoster.ShadowInsecure = true
+	hoster.ShadowHandler = func(result gohost.ShadowResult) {
+		results <- result
+	}
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// act - make calls that match, differ and fail on the shadow, then call through the HTTP gateway
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-custom", "custom")
+	sameResp, sameErr := client.Echo(context.Background(), &pb.SendRequest{Value: "same"})
+	same := waitShadowResult(t, results)
+
+	changedResp, changedErr := client.Echo(context.Background(), &pb.SendRequest{Value: "changed"})
+	changed := waitShadowResult(t, results)
+
+	_, missingErr := client.Echo(context.Background(), &pb.SendRequest{Value: "missing"})
+	missing := waitShadowResult(t, results)
+
+	_, metadataErr := client.Echo(ctx, &pb.SendRequest{Value: "metadata"})
+	waitShadowResult(t, results)
+
+	httpResp, httpErr := server.HTTPClient.Post(server.URL+"/v1/send", "application/json", strings.NewReader(`{"value":"test"}`))
+	httpResult := waitShadowResult(t, results)
+
+	// assert - the client always receives the response of this service
+	assert.NoError(t, sameErr)
+	assert.Equal(t, "same", sameResp.Echo)
+	assert.Equal(t, "/test.TestService/Echo", same.Method)
+	assert.True(t, same.Matched(), "diffs: %v", same.Diffs)
+	assert.Equal(t, "OK", same.ShadowCode)
+
+	assert.NoError(t, changedErr)
+	assert.Equal(t, "changed", changedResp.Echo)
+	assert.Equal(t, []string{`responses[0].echo: "changed" != "different"`}, changed.Diffs)
+
+	assert.NoError(t, missingErr)
+	assert.Equal(t, "OK", missing.PrimaryCode)
+	assert.Equal(t, "NotFound", missing.ShadowCode)
+	assert.Equal(t, []string{"code: OK != NotFound", `message: "" != "value not found"`}, missing.Diffs)
+
+	assert.NoError(t, metadataErr)
+	md := <-shadowMetadata
+	assert.Equal(t, []string{"custom"}, md.Get("x-custom"))
+	assert.Equal(t, []string{"true"}, md.Get("x-gohost-shadow"))
+
+	assert.NoError(t, httpErr)
+	httpResp.Body.Close()
+	assert.Equal(t, "/test.TestService/Send", httpResult.Method)
+	assert.True(t, httpResult.Matched(), "diffs: %v", httpResult.Diffs)
+}
+
+func Test_Hoster_ListenAndServe_Shadow_DebugEndpoint(t *testing.T) {
+	// arrange - a shadow that is slower than this service
+	release := make(chan struct{})
+	shadow, shadowAddr := startShadow(t, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		<-release
+		return handler(ctx, req)
+	})
+	defer shadow.Stop()
+
+	debugAddr := getAddr(t)
+	results := make(chan gohost.ShadowResult, 10)
+	hoster := newGohostTestHoster()
+	hoster.EnableDebug = true
+	hoster.DebugAddr = debugAddr
+	hoster.ShadowAddr = shadowAddr
+	hoster.ShadowInsecure = true
+	hoster.ShadowMaxInFlight = 1
+	hoster.ShadowMethods = []string{"/test.TestService/Echo"}
+	hoster.ShadowHandler = func(result gohost.ShadowResult) {
+		results <- result
+	}
+
+	server := gohosttest.Start(t, hoster)
+	defer server.Stop()
+	client := pb.NewTestServiceClient(server.Conn)
+
+	// make sure the debug endpoint has time to start
+	time.Sleep(serviceStartDelay)
+
+	// act - the second call is not mirrored while the first is waiting on the shadow, and Send is not mirrored at all
+	start := time.Now()
+	_, firstErr := client.Echo(context.Background(), &pb.SendRequest{Value: "first"})
+	_, secondErr := client.Echo(context.Background(), &pb.SendRequest{Value: "second"})
+	_, sendErr := client.Send(context.Background(), &pb.SendRequest{Value: "test"})
+	elapsed := time.Since(start)
+
+	close(release)
+	first := waitShadowResult(t, results)
+
+	resp := debugRequest(t, debugAddr, http.MethodGet, "/debug/shadow", "")
+	var stats struct {
+		Methods map[string]struct {
+			Calls   int64 `json:"calls"`
+			Dropped int64 `json:"dropped"`
+		} `json:"methods"`
+	}
+	err := json.Unmarshal([]byte(resp.body), &stats)
+
+	// assert
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	assert.NoError(t, sendErr)
+	assert.True(t, elapsed < time.Second, "calls waited on the shadow endpoint: %v", elapsed)
+	assert.True(t, first.Matched())
+	assert.True(t, first.ShadowLatency > first.PrimaryLatency)
+
+	assert.NoError(t, err)
+	assert.Len(t, stats.Methods, 1)
+	assert.Equal(t, int64(1), stats.Methods["/test.TestService/Echo"].Calls)
+	assert.Equal(t, int64(1), stats.Methods["/test.TestService/Echo"].Dropped)
+}
+
+func Test_Hoster_Validate_Shadow(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.ShadowAddr = "missing-port"
+	hoster.ShadowPercent = 101
+	hoster.ShadowMaxInFlight = -1
+	hoster.ShadowTimeout = -1
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 4)
+}
+
+// startShadow is a helper function that serves the test service on an open port with an interceptor, and returns the server and its address. Stop the server when the test finishes.
+func startShadow(t *testing.T, interceptor grpc.UnaryServerInterceptor) (*grpc.Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(interceptor))
+	pb.RegisterTestServiceServer(server, test.NewService())
+	go server.Serve(lis)
+
+	return server, lis.Addr().String()
+}
+
+// waitShadowResult is a helper function that waits for the result of a mirrored call.
+func waitShadowResult(t *testing.T, results chan gohost.ShadowResult) gohost.ShadowResult {
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(httpClientTimeout):
+		t.Fatal("timed out waiting for mirrored call")
+		return gohost.ShadowResult{}
+	}
+}
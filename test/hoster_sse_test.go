@@ -0,0 +1,362 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_SSE_Stream(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a server-streaming method and a unary method as event streams, and the streaming method as JSON
+	streamResp, streamBody := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=3", httpAddr), nil)
+	_, unaryBody := getEventStream(t, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+	jsonResp, err := http.Get(fmt.Sprintf("http://%v/v1/repeat?value=test&count=3", httpAddr))
+	assert.NoError(t, err)
+	jsonBody, err := ioutil.ReadAll(jsonResp.Body)
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, streamResp.StatusCode)
+	assert.Equal(t, "text/event-stream", streamResp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", streamResp.Header.Get("Cache-Control"))
+	events := parseEvents(streamBody)
+	assert.Len(t, events, 3)
+	for i, event := range events {
+		assert.Equal(t, fmt.Sprint(i+1), event.id)
+		assert.Empty(t, event.event)
+		assert.JSONEq(t, `{"echo":"test"}`, event.data)
+	}
+
+	unaryEvents := parseEvents(unaryBody)
+	assert.Len(t, unaryEvents, 1)
+	assert.JSONEq(t, `{"echo":"test"}`, unaryEvents[0].data)
+
+	assert.NotEqual(t, "text/event-stream", jsonResp.Header.Get("Content-Type"))
+	assert.Equal(t, 3, strings.Count(string(jsonBody), `"result"`))
+}
+
+func Test_Hoster_ListenAndServe_SSE_Error(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &failingServerStream{ServerStream: ss, remaining: 2})
+	})
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "call failed")
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a server-streaming method that fails part way through, and a unary method that fails
+	streamResp, streamBody := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=3", httpAddr), nil)
+	unaryResp, unaryBody := getEventStream(t, fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr), nil)
+
+	// assert
+	assert.Equal(t, http.StatusOK, streamResp.StatusCode)
+	events := parseEvents(streamBody)
+	assert.Len(t, events, 3)
+	assert.Equal(t, "2", events[1].id)
+	assert.Equal(t, "error", events[2].event)
+	assert.Empty(t, events[2].id)
+	assert.JSONEq(t, fmt.Sprintf(`{"code":%v,"message":"stream stopped"}`, int(codes.Aborted)), events[2].data)
+
+	assert.Equal(t, http.StatusOK, unaryResp.StatusCode)
+	unaryEvents := parseEvents(unaryBody)
+	assert.Len(t, unaryEvents, 1)
+	assert.Equal(t, "error", unaryEvents[0].event)
+	assert.JSONEq(t, fmt.Sprintf(`{"code":%v,"message":"call failed"}`, int(codes.Internal)), unaryEvents[0].data)
+}
+
+func Test_Hoster_ListenAndServe_SSE_Resume(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	lastEventIDs := make(chan []string, 1)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		lastEventIDs <- md.Get(gohost.LastEventIDHeader)
+		return handler(srv, ss)
+	})
+	hoster.SSEEventID = func(ctx context.Context, msg proto.Message) string {
+		return "event-" + msg.(*pb.EchoResponse).Echo
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// reconnect to a server-streaming method with the ID of the last event received
+	header := http.Header{}
+	header.Set("Last-Event-ID", "event-test")
+	_, body := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1", httpAddr), header)
+
+	// assert
+	assert.Equal(t, []string{"event-test"}, <-lastEventIDs)
+	events := parseEvents(body)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "event-test", events[0].id)
+}
+
+func Test_Hoster_ListenAndServe_SSE_ResumeHook(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	offsets := make(chan []string, 1)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		offsets <- md.Get("x-offset")
+		return handler(srv, ss)
+	})
+	hoster.SSEResume = func(ctx context.Context, lastEventID string) (metadata.MD, error) {
+		if lastEventID == "expired" {
+			return nil, status.Error(codes.OutOfRange, "event expired")
+		}
+		return metadata.Pairs("x-offset", lastEventID), nil
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// reconnect with an event ID the hook accepts and one it rejects
+	header := http.Header{}
+	header.Set("Last-Event-ID", "2")
+	_, acceptedBody := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1", httpAddr), header)
+
+	header.Set("Last-Event-ID", "expired")
+	rejectedResp, rejectedBody := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1", httpAddr), header)
+
+	// assert
+	assert.Equal(t, []string{"2"}, <-offsets)
+	assert.Len(t, parseEvents(acceptedBody), 1)
+
+	assert.Equal(t, http.StatusOK, rejectedResp.StatusCode)
+	rejectedEvents := parseEvents(rejectedBody)
+	assert.Len(t, rejectedEvents, 1)
+	assert.Equal(t, "error", rejectedEvents[0].event)
+	assert.JSONEq(t, fmt.Sprintf(`{"code":%v,"message":"event expired"}`, int(codes.OutOfRange)), rejectedEvents[0].data)
+}
+
+func Test_Hoster_ListenAndServe_SSE_Heartbeat(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.SSEHeartbeat = time.Millisecond * 20
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		time.Sleep(time.Millisecond * 200)
+		return handler(srv, ss)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a server-streaming method that is slow to respond
+	_, body := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1", httpAddr), nil)
+
+	// assert
+	assert.True(t, strings.HasPrefix(body, ": heartbeat\n\n"))
+	assert.Len(t, parseEvents(body), 1)
+}
+
+func Test_Hoster_ListenAndServe_SSE_HeartbeatPanic(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.SSEHeartbeat = time.Millisecond * 10
+	hoster.HTTPHandler = func(mux *runtime.ServeMux) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("panic") != "" {
+				time.Sleep(time.Millisecond * 50)
+				panic("test panic")
+			}
+			mux.ServeHTTP(w, r)
+		})
+	}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a handler that panics after sending heartbeats, then call the service again
+	_, panicBody := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1&panic=1", httpAddr), nil)
+	time.Sleep(time.Millisecond * 50)
+	_, body := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=1", httpAddr), nil)
+
+	// assert
+	assert.True(t, strings.HasPrefix(panicBody, ": heartbeat\n\n"))
+	assert.Len(t, parseEvents(body), 1)
+}
+
+func Test_Hoster_ListenAndServe_SSE_Timeouts(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withSSE)
+	hoster.HTTPReadTimeout = time.Millisecond * 100
+	hoster.HTTPWriteTimeout = time.Millisecond * 100
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		time.Sleep(time.Millisecond * 300)
+		return handler(srv, ss)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a server-streaming method that responds after the timeouts have passed
+	_, body := getEventStream(t, fmt.Sprintf("http://%v/v1/repeat?value=test&count=2", httpAddr), nil)
+
+	// assert
+	assert.Len(t, parseEvents(body), 2)
+}
+
+func Test_Hoster_Validate_SSE(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableSSE = true
+	hoster.SSEHeartbeat = -time.Second
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 1)
+}
+
+// withSSE is a helper function that configures a hoster with the HTTP gateway and Server-Sent Events enabled.
+func withSSE(hoster *gohost.Hoster) {
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+	hoster.EnableSSE = true
+}
+
+// getEventStream is a helper function that makes a GET request that accepts Server-Sent Events and returns the response and its body.
+func getEventStream(t *testing.T, url string, header http.Header) (*http.Response, string) {
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	for k, v := range header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	resp, err := httpClient.Do(httpReq)
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp, string(body)
+}
+
+// sseEvent is an event parsed from an event stream.
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// parseEvents is a helper function that parses the events in an event stream, skipping comments.
+func parseEvents(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		var event sseEvent
+		hasData := false
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data += strings.TrimPrefix(line, "data: ")
+				hasData = true
+			}
+		}
+		if hasData {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// failingServerStream is a server stream that fails with Aborted after sending a number of messages.
+type failingServerStream struct {
+	grpc.ServerStream
+	remaining int
+}
+
+// SendMsg sends the message, or fails if no messages remain.
+func (s *failingServerStream) SendMsg(m interface{}) error {
+	if s.remaining == 0 {
+		return status.Error(codes.Aborted, "stream stopped")
+	}
+	s.remaining--
+
+	return s.ServerStream.SendMsg(m)
+}
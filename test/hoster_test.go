@@ -1,12 +1,17 @@
 package test
 
 import (
+	"expvar"
 	"flag"
 	"net"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/eleniums/gohost"
+	"google.golang.org/grpc"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
 	assert "github.com/stretchr/testify/require"
 )
 
@@ -35,3 +40,26 @@ func getAddr(t *testing.T) string {
 
 	return lis.Addr().String()
 }
+
+// metricValue is a helper function that returns the current value of an integer metric published on the debug endpoint.
+func metricValue(name string) int64 {
+	v, ok := expvar.Get("gohost").(*expvar.Map).Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+
+	return v.Value()
+}
+
+// newTestHoster is a helper function that creates a hoster serving the test service on the gRPC address and, if it is not empty, the HTTP address. The hoster is passed to configure before it is returned.
+func newTestHoster(grpcAddr string, httpAddr string, service pb.TestServiceServer, configure func(hoster *gohost.Hoster)) *gohost.Hoster {
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.HTTPAddr = httpAddr
+	configure(hoster)
+
+	return hoster
+}
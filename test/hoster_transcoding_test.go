@@ -0,0 +1,281 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_DynamicGateway(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withDynamicGateway)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call unary and server-streaming methods through routes built from their annotations
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	echoResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+	assert.NoError(t, err)
+	echoBody, err := ioutil.ReadAll(echoResp.Body)
+	assert.NoError(t, err)
+
+	sendResp, err := httpClient.Post(fmt.Sprintf("http://%v/v1/send", httpAddr), "application/json", strings.NewReader(`{"value":"test"}`))
+	assert.NoError(t, err)
+	sendBody, err := ioutil.ReadAll(sendResp.Body)
+	assert.NoError(t, err)
+
+	repeatResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/repeat?value=test&count=2", httpAddr))
+	assert.NoError(t, err)
+	repeatBody, err := ioutil.ReadAll(repeatResp.Body)
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, echoResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"test"}`, string(echoBody))
+	assert.Equal(t, http.StatusOK, sendResp.StatusCode)
+	assert.JSONEq(t, `{"success":true}`, string(sendBody))
+	assert.Equal(t, http.StatusOK, repeatResp.StatusCode)
+	assert.Equal(t, 2, strings.Count(string(repeatBody), `{"result":{"echo":"test"}}`))
+}
+
+func Test_Hoster_ListenAndServe_DynamicGateway_Error(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withDynamicGateway)
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "not allowed")
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a method that fails, and send a query parameter of the wrong type
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	errorResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+	assert.NoError(t, err)
+	invalidResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/repeat?count=abc", httpAddr))
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusForbidden, errorResp.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, invalidResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_DynamicGateway_DescriptorSet(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	// write a descriptor set that binds Echo to a path parameter and Send to a body field
+	set := &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{loadTestDescriptor(t)},
+	}
+	for _, method := range set.File[0].Service[0].Method {
+		var rule *annotations.HttpRule
+		switch method.GetName() {
+		case "Echo":
+			rule = &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v2/echo/{value}"}}
+		case "Send":
+			rule = &annotations.HttpRule{Pattern: &annotations.HttpRule_Put{Put: "/v2/send/{value=items/*}:save"}}
+		default:
+			continue
+		}
+		method.Options = &descriptor.MethodOptions{}
+		err := proto.SetExtension(method.Options, annotations.E_Http, rule)
+		assert.NoError(t, err)
+	}
+	file := writeDescriptorSet(t, set)
+	defer os.Remove(file)
+
+	values := make(chan string, 1)
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withDynamicGateway)
+	hoster.DescriptorSetFile = file
+	hoster.UnaryInterceptors = append(hoster.UnaryInterceptors, func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if send, ok := req.(*pb.SendRequest); ok && info.FullMethod == "/test.TestService/Send" {
+			values <- send.Value
+		}
+		return handler(ctx, req)
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the routes from the descriptor set, and a route from the registered descriptor it replaced
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	echoResp, err := httpClient.Get(fmt.Sprintf("http://%v/v2/echo/hello", httpAddr))
+	assert.NoError(t, err)
+	echoBody, err := ioutil.ReadAll(echoResp.Body)
+	assert.NoError(t, err)
+
+	sendReq, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%v/v2/send/items/1:save", httpAddr), nil)
+	assert.NoError(t, err)
+	sendResp, err := httpClient.Do(sendReq)
+	assert.NoError(t, err)
+
+	oldResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/echo?value=test", httpAddr))
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, echoResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"hello"}`, string(echoBody))
+	assert.Equal(t, http.StatusOK, sendResp.StatusCode)
+	assert.Equal(t, "items/1", <-values)
+	assert.Equal(t, http.StatusNotFound, oldResp.StatusCode)
+}
+
+func Test_Hoster_ListenAndServe_DynamicGateway_OverlappingRoutes(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	// write a descriptor set that binds Echo to a path parameter and Send to a literal path that the parameter also matches
+	set := &descriptor.FileDescriptorSet{
+		File: []*descriptor.FileDescriptorProto{loadTestDescriptor(t)},
+	}
+	for _, method := range set.File[0].Service[0].Method {
+		var rule *annotations.HttpRule
+		switch method.GetName() {
+		case "Echo":
+			rule = &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{value}"}}
+		case "Send":
+			rule = &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/items"}}
+		default:
+			continue
+		}
+		method.Options = &descriptor.MethodOptions{}
+		err := proto.SetExtension(method.Options, annotations.E_Http, rule)
+		assert.NoError(t, err)
+	}
+	file := writeDescriptorSet(t, set)
+	defer os.Remove(file)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withDynamicGateway)
+	hoster.DescriptorSetFile = file
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call the literal route and the route with a path parameter
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	itemsResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/items", httpAddr))
+	assert.NoError(t, err)
+	itemsBody, err := ioutil.ReadAll(itemsResp.Body)
+	assert.NoError(t, err)
+
+	echoResp, err := httpClient.Get(fmt.Sprintf("http://%v/v1/hello", httpAddr))
+	assert.NoError(t, err)
+	echoBody, err := ioutil.ReadAll(echoResp.Body)
+	assert.NoError(t, err)
+
+	// assert
+	assert.Equal(t, http.StatusOK, itemsResp.StatusCode)
+	assert.JSONEq(t, `{"success":true}`, string(itemsBody))
+	assert.Equal(t, http.StatusOK, echoResp.StatusCode)
+	assert.JSONEq(t, `{"echo":"hello"}`, string(echoBody))
+}
+
+func Test_Hoster_Validate_DynamicGateway(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableDynamicGateway = true
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 1)
+}
+
+// withDynamicGateway is a helper function that configures a hoster with the dynamic HTTP gateway enabled.
+func withDynamicGateway(hoster *gohost.Hoster) {
+	hoster.EnableDynamicGateway = true
+}
+
+// loadTestDescriptor is a helper function that returns the descriptor registered by the generated code of the test service.
+func loadTestDescriptor(t *testing.T) *descriptor.FileDescriptorProto {
+	reader, err := gzip.NewReader(bytes.NewReader(proto.FileDescriptor("proto/test.proto")))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	fd := &descriptor.FileDescriptorProto{}
+	assert.NoError(t, proto.Unmarshal(b, fd))
+
+	return fd
+}
+
+// loadUnlinkedTestDescriptor is a helper function that returns the descriptor of the test service with its messages renamed (e.g. test.UnlinkedSendRequest), so their types are not linked into the program.
+func loadUnlinkedTestDescriptor(t *testing.T) *descriptor.FileDescriptorProto {
+	fd := loadTestDescriptor(t)
+	for _, md := range fd.MessageType {
+		md.Name = proto.String("Unlinked" + md.GetName())
+	}
+	for _, method := range fd.Service[0].Method {
+		method.InputType = proto.String(strings.Replace(method.GetInputType(), ".test.", ".test.Unlinked", 1))
+		method.OutputType = proto.String(strings.Replace(method.GetOutputType(), ".test.", ".test.Unlinked", 1))
+	}
+
+	return fd
+}
+
+// writeDescriptorSet is a helper function that writes a descriptor set to a temporary file and returns its path.
+func writeDescriptorSet(t *testing.T, set *descriptor.FileDescriptorSet) string {
+	b, err := proto.Marshal(set)
+	assert.NoError(t, err)
+	file, err := ioutil.TempFile("", "gohost-descriptor-set")
+	assert.NoError(t, err)
+	_, err = file.Write(b)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	return file.Name()
+}
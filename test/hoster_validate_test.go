@@ -0,0 +1,262 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"google.golang.org/grpc"
+
+	pb "github.com/eleniums/gohost/examples/test/proto"
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_Validate_Successful(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.CertFile = "../testdata/test.crt"
+	hoster.KeyFile = "../testdata/test.key"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_Hoster_Validate_AggregatesErrors(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.GRPCAddr = "badaddress"
+	hoster.HTTPAddr = ""
+	hoster.MaxSendMsgSize = 0
+	hoster.MaxRecvMsgSize = -1
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	validationErr, ok := err.(*gohost.ValidationError)
+	assert.True(t, ok)
+	assert.Len(t, validationErr.Errors, 4)
+}
+
+func Test_Hoster_Validate_InvalidPort(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.GRPCAddr = "127.0.0.1:70000"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_Validate_PortConflict(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.GRPCAddr = "127.0.0.1:8080"
+	hoster.HTTPAddr = "127.0.0.1:8080"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "port 8080")
+}
+
+func Test_Hoster_Validate_PortConflict_UnspecifiedHost(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.HTTPAddr = ":8080"
+	hoster.DebugAddr = "127.0.0.1:8080"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_Validate_PortConflict_DisabledEndpoint(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.EnableDebug = false
+	hoster.DebugAddr = hoster.HTTPAddr
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_Hoster_Validate_MissingKeyFile(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.CertFile = "../testdata/test.crt"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_Validate_MismatchedKeyPair(t *testing.T) {
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(dir, "other.key")
+	writePEM(t, keyFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	hoster := newValidateHoster()
+	hoster.CertFile = "../testdata/test.crt"
+	hoster.KeyFile = keyFile
+
+	// act
+	err = hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+}
+
+func Test_Hoster_Validate_ExpiredCert(t *testing.T) {
+	// arrange
+	dir, err := ioutil.TempDir("", "gohost")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "expired.crt")
+	keyFile := filepath.Join(dir, "expired.key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	hoster := newValidateHoster()
+	hoster.CertFile = certFile
+	hoster.KeyFile = keyFile
+
+	// act
+	err = hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expired")
+}
+
+func Test_Hoster_Validate_MaxMsgSize(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.MaxSendMsgSize = math.MaxInt32
+	hoster.MaxRecvMsgSize = 1
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func Test_Hoster_ListenAndServe_Validate_NothingStarted(t *testing.T) {
+	// arrange
+	grpcAddr := getAddr(t)
+
+	hoster := newValidateHoster()
+	hoster.GRPCAddr = grpcAddr
+	hoster.KeyFile = "../testdata/badkey.key"
+
+	// act
+	err := hoster.ListenAndServe()
+
+	// assert
+	assert.Error(t, err)
+	_, ok := err.(*gohost.ValidationError)
+	assert.True(t, ok)
+
+	// the gRPC address should still be free
+	lis, err := net.Listen("tcp", grpcAddr)
+	assert.NoError(t, err)
+	lis.Close()
+}
+
+// newValidateHoster is a helper function that creates a hoster with all endpoints enabled and distinct addresses.
+func newValidateHoster() *gohost.Hoster {
+	service := test.NewService()
+
+	hoster := gohost.NewHoster()
+	hoster.GRPCAddr = "127.0.0.1:50051"
+	hoster.HTTPAddr = "127.0.0.1:9090"
+	hoster.DebugAddr = "127.0.0.1:6060"
+	hoster.EnableDebug = true
+	hoster.RegisterGRPCServer(func(s *grpc.Server) {
+		pb.RegisterTestServiceServer(s, service)
+	})
+	hoster.RegisterHTTPGateway(pb.RegisterTestServiceHandlerFromEndpoint)
+
+	return hoster
+}
+
+// writePEM is a helper function that writes a PEM encoded block to a file.
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	err := ioutil.WriteFile(file, data, 0600)
+	assert.NoError(t, err)
+}
+
+func Test_Hoster_Validate_NegativeKeepalive(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.KeepaliveTime = -time.Second
+	hoster.MaxConnectionAge = -time.Second
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+func Test_Hoster_Validate_InitialWindowSize(t *testing.T) {
+	// arrange
+	hoster := newValidateHoster()
+	hoster.InitialWindowSize = 1024
+	hoster.InitialConnWindowSize = 65535
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 1)
+}
@@ -0,0 +1,301 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eleniums/gohost"
+	"github.com/eleniums/gohost/examples/test"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func Test_Hoster_ListenAndServe_WebSocket_ClientStream(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// stream messages to the service over a WebSocket connection, then end the stream with an empty message
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Stream", "", nil)
+	for _, value := range []string{"one", "two", "three", ""} {
+		err := websocket.Message.Send(ws, value2JSON(value))
+		assert.NoError(t, err)
+	}
+	var resp string
+	err := websocket.Message.Receive(ws, &resp)
+	assert.NoError(t, err)
+	code, reason := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.JSONEq(t, `{"success":true}`, resp)
+	assert.Equal(t, 1000, code)
+	assert.Empty(t, reason)
+}
+
+func Test_Hoster_ListenAndServe_WebSocket_Unary(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a unary method over a WebSocket connection
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Echo", "", nil)
+	err := websocket.Message.Send(ws, `{"value":"test"}`)
+	assert.NoError(t, err)
+	var resp string
+	err = websocket.Message.Receive(ws, &resp)
+	assert.NoError(t, err)
+	code, _ := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.JSONEq(t, `{"echo":"test"}`, resp)
+	assert.Equal(t, 1000, code)
+}
+
+func Test_Hoster_ListenAndServe_WebSocket_Timeouts(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+	hoster.HTTPReadTimeout = time.Millisecond * 100
+	hoster.HTTPWriteTimeout = time.Millisecond * 100
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// call a unary method over a WebSocket connection after the timeouts have passed
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Echo", "", nil)
+	time.Sleep(time.Millisecond * 300)
+	err := websocket.Message.Send(ws, `{"value":"test"}`)
+	assert.NoError(t, err)
+	var resp string
+	err = websocket.Message.Receive(ws, &resp)
+	assert.NoError(t, err)
+	code, _ := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.JSONEq(t, `{"echo":"test"}`, resp)
+	assert.Equal(t, 1000, code)
+}
+
+func Test_Hoster_ListenAndServe_WebSocket_StatusAndMetadata(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	requestIDs := make(chan string, 1)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+	hoster.StreamInterceptors = append(hoster.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		requestIDs <- md.Get(gohost.RequestIDHeader)[0]
+		return status.Error(codes.PermissionDenied, "not allowed")
+	})
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// open a WebSocket connection with a request ID header to a method that fails
+	header := http.Header{}
+	header.Set(gohost.RequestIDHeader, "abc123")
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Stream", "", header)
+	code, reason := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.Equal(t, "abc123", <-requestIDs)
+	assert.Equal(t, 4000+int(codes.PermissionDenied), code)
+	assert.Equal(t, "not allowed", reason)
+}
+
+func Test_Hoster_ListenAndServe_WebSocket_InvalidMessage(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// send a message that is not valid JSON
+	ws, frames := dialWebSocket(t, httpAddr, "/ws/test.TestService/Stream", "", nil)
+	err := websocket.Message.Send(ws, "not json")
+	assert.NoError(t, err)
+	code, _ := readCloseFrame(t, ws, frames)
+
+	// assert
+	assert.Equal(t, 4000+int(codes.InvalidArgument), code)
+}
+
+func Test_Hoster_ListenAndServe_WebSocket_Rejected(t *testing.T) {
+	// arrange
+	service := test.NewService()
+	httpAddr := getAddr(t)
+	grpcAddr := getAddr(t)
+
+	hoster := newTestHoster(grpcAddr, httpAddr, service, withWebSocket)
+	hoster.WebSocketOrigins = []string{"https://allowed.example.com"}
+
+	// act - start the service
+	go hoster.ListenAndServe()
+
+	// make sure service has time to start
+	time.Sleep(serviceStartDelay)
+
+	// connect to an unknown method and from origins that are and are not allowed
+	httpClient := http.Client{
+		Timeout: httpClientTimeout,
+	}
+	unknownResp, err := httpClient.Get(fmt.Sprintf("http://%v/ws/test.TestService/Missing", httpAddr))
+	assert.NoError(t, err)
+
+	config, err := websocket.NewConfig(fmt.Sprintf("ws://%v/ws/test.TestService/Echo", httpAddr), "https://evil.example.com")
+	assert.NoError(t, err)
+	_, errDenied := websocket.DialConfig(config)
+
+	config, err = websocket.NewConfig(fmt.Sprintf("ws://%v/ws/test.TestService/Echo", httpAddr), "https://allowed.example.com")
+	assert.NoError(t, err)
+	allowed, errAllowed := websocket.DialConfig(config)
+
+	// assert
+	assert.Equal(t, http.StatusNotFound, unknownResp.StatusCode)
+	assert.Error(t, errDenied)
+	assert.NoError(t, errAllowed)
+	allowed.Close()
+}
+
+func Test_Hoster_Validate_WebSocket(t *testing.T) {
+	// arrange
+	hoster := gohost.NewHoster()
+	hoster.EnableWebSocket = true
+	hoster.WebSocketPath = "ws"
+
+	// act
+	err := hoster.Validate()
+
+	// assert
+	assert.Error(t, err)
+	assert.Len(t, err.(*gohost.ValidationError).Errors, 2)
+}
+
+// withWebSocket is a helper function that configures a hoster with the WebSocket bridge enabled.
+func withWebSocket(hoster *gohost.Hoster) {
+	hoster.EnableWebSocket = true
+}
+
+// value2JSON is a helper function that returns a SendRequest as JSON, or an empty message for an empty value.
+func value2JSON(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(`{"value":%q}`, value)
+}
+
+// frameRecorder is a connection that records everything read from it, so the close frame can be inspected.
+type frameRecorder struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+// Read records the bytes read.
+func (r *frameRecorder) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+	r.buf.Write(b[:n])
+	return n, err
+}
+
+// dialWebSocket is a helper function that opens a WebSocket connection to the HTTP endpoint and records the frames received.
+func dialWebSocket(t *testing.T, httpAddr string, path string, origin string, header http.Header) (*websocket.Conn, *frameRecorder) {
+	if origin == "" {
+		origin = "http://" + httpAddr
+	}
+	config, err := websocket.NewConfig(fmt.Sprintf("ws://%v%v", httpAddr, path), origin)
+	assert.NoError(t, err)
+	if header != nil {
+		config.Header = header
+	}
+
+	conn, err := net.Dial("tcp", httpAddr)
+	assert.NoError(t, err)
+	frames := &frameRecorder{Conn: conn}
+	ws, err := websocket.NewClient(config, frames)
+	assert.NoError(t, err)
+
+	return ws, frames
+}
+
+// readCloseFrame is a helper function that waits for the connection to close and returns the code and reason of the close frame sent by the server.
+func readCloseFrame(t *testing.T, ws *websocket.Conn, frames *frameRecorder) (int, string) {
+	ws.SetReadDeadline(time.Now().Add(httpClientTimeout))
+	var msg []byte
+	err := websocket.Message.Receive(ws, &msg)
+	assert.Error(t, err)
+
+	data := frames.buf.Bytes()
+	i := bytes.Index(data, []byte("\r\n\r\n"))
+	assert.True(t, i >= 0)
+	data = data[i+4:]
+	for len(data) >= 2 {
+		opcode := data[0] & 0x0f
+		length := int(data[1] & 0x7f)
+		data = data[2:]
+		switch length {
+		case 126:
+			length = int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+		case 127:
+			length = int(binary.BigEndian.Uint64(data))
+			data = data[8:]
+		}
+		payload := data[:length]
+		data = data[length:]
+		if opcode == websocket.CloseFrame {
+			assert.True(t, len(payload) >= 2)
+			return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+		}
+	}
+
+	t.Fatal("no close frame received")
+	return 0, ""
+}